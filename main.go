@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"go4pack/pkg/adminapi"
 	"go4pack/pkg/common"
 	"go4pack/pkg/common/restful"
 	"go4pack/pkg/common/worker"
@@ -44,20 +45,50 @@ func main() {
 	if err := worker.Init(8); err != nil {
 		logger.Error().Err(err).Msg("Worker pool init failed")
 	}
+	worker.StartHistory(common.GetConfig().Pool.HistorySamples, time.Second)
+	defer worker.StopHistory()
 
 	// Start REST server
-	srv := restful.NewServer(restful.WithAddress(":8080"))
+	cfg := common.GetConfig()
+	srv := restful.NewServer(
+		restful.WithAddress(":8080"),
+		restful.WithMaxBodyBytes(cfg.Server.MaxBodyBytes),
+		restful.WithAuth(restful.AuthConfig{Keys: cfg.Auth.APIKeys, Header: cfg.Auth.Header, ExemptPaths: cfg.Auth.ExemptPaths}),
+		restful.WithRequestLogSampling(cfg.Log.RequestSampleRate),
+		restful.WithSlowRequestThreshold(time.Duration(cfg.Log.SlowRequestMs)*time.Millisecond),
+	)
+	srv.RegisterHealth()
+	srv.RegisterMetrics()
 
 	api := srv.Engine.Group("/api")
 	fileGroup := api.Group("/fileio")
 	fileio.RegisterRoutes(fileGroup)
 	poolGroup := api.Group("/pool")
 	poolapi.RegisterRoutes(poolGroup)
+	adminGroup := api.Group("/admin")
+	adminapi.RegisterRoutes(adminGroup)
+	fileio.RegisterAdminRoutes(adminGroup.Group("/fileio", adminapi.RequireAdminToken))
 
 	if err := srv.Start(); err != nil {
 		logger.Fatal().Err(err).Msg("Failed to start server")
 	}
 
+	// Periodic cleanup of abandoned temp files and stuck analyses
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	defer stopJanitor()
+	fileio.StartJanitor(janitorCtx)
+
+	// SIGHUP reloads the config file in place
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := common.Reload(); err != nil {
+				logger.Error().Err(err).Msg("Config reload failed")
+			}
+		}
+	}()
+
 	// Graceful shutdown handling
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -69,5 +100,9 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.Error().Err(err).Msg("Server shutdown error")
 	}
+	// let pending analyses write their results before the process exits
+	if err := worker.Shutdown(ctx); err != nil {
+		logger.Error().Err(err).Msg("Worker pool shutdown error")
+	}
 	logger.Info().Msg("Server exited cleanly")
 }
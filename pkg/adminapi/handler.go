@@ -0,0 +1,21 @@
+package adminapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes registers operator/diagnostic endpoints
+func RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/selftest", RequireAdminToken, func(c *gin.Context) {
+		report := RunSelfTest()
+		status := http.StatusOK
+		if !report.OK {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	})
+	rg.GET("/logs/tail", RequireAdminToken, logsTailHandler)
+	rg.GET("/db/schema", RequireAdminToken, dbSchemaHandler)
+}
@@ -0,0 +1,144 @@
+package adminapi
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/logger"
+)
+
+const (
+	defaultTailLines = 100
+	maxTailLines     = 10000
+	// maxTailBytes bounds how far back the initial tail reads
+	maxTailBytes = 1 << 20
+)
+
+// tailPollInterval is how often a followed log is checked for new data and rotation
+var tailPollInterval = 250 * time.Millisecond
+
+// RequireAdminToken rejects requests without "Authorization: Bearer <admin.token>".
+// Protected endpoints stay closed while no token is configured.
+func RequireAdminToken(c *gin.Context) {
+	token := config.Get().Admin.Token
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin token not configured"})
+		return
+	}
+	got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	c.Next()
+}
+
+// logsTailHandler streams the last ?lines= lines of the log file as chunked text and, unless
+// ?follow=false, keeps streaming appended lines until the client goes away. A rotated or
+// truncated file is reopened from the start.
+func logsTailHandler(c *gin.Context) {
+	if !config.Get().Debug {
+		c.JSON(http.StatusNotFound, gin.H{"error": "log tail is only available in debug mode"})
+		return
+	}
+	path := logger.OutputPath()
+	if path == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "logger is not writing to a file"})
+		return
+	}
+	lines := defaultTailLines
+	if v, err := strconv.Atoi(c.Query("lines")); err == nil && v >= 0 {
+		lines = min(v, maxTailLines)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "open log failed"})
+		return
+	}
+	defer func() { f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "stat log failed"})
+		return
+	}
+	offset := info.Size()
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+	_, _ = c.Writer.Write(lastLines(f, offset, lines))
+	c.Writer.Flush()
+	if c.Query("follow") == "false" {
+		return
+	}
+
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cur, err := os.Stat(path)
+		if err != nil {
+			continue // rotated away; wait for the new file
+		}
+		if !os.SameFile(cur, info) || cur.Size() < offset {
+			nf, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			f.Close()
+			f, offset = nf, 0
+			if info, err = f.Stat(); err != nil {
+				return
+			}
+		}
+		if cur.Size() > offset {
+			n, _ := io.Copy(c.Writer, io.NewSectionReader(f, offset, cur.Size()-offset))
+			offset += n
+			c.Writer.Flush()
+		}
+	}
+}
+
+// lastLines returns up to n trailing lines of the first size bytes of r
+func lastLines(r io.ReaderAt, size int64, n int) []byte {
+	if n == 0 || size == 0 {
+		return nil
+	}
+	start := max(size-maxTailBytes, 0)
+	buf := make([]byte, size-start)
+	k, _ := r.ReadAt(buf, start)
+	buf = buf[:k]
+	// ignore the final newline so it does not count as an empty last line
+	end := len(buf)
+	if end > 0 && buf[end-1] == '\n' {
+		end--
+	}
+	cut := 0
+	for seen := 0; ; {
+		i := bytes.LastIndexByte(buf[:end], '\n')
+		if i < 0 {
+			break
+		}
+		if seen++; seen == n {
+			cut = i + 1
+			break
+		}
+		end = i
+	}
+	return buf[cut:]
+}
@@ -0,0 +1,128 @@
+package adminapi
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/logger"
+)
+
+const testAdminToken = "s3cret"
+
+// setupLogTail points the logger at a temp file and enables the tail endpoint
+func setupLogTail(t *testing.T, debug bool) (*gin.Engine, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.log")
+	lc := logger.DefaultConfig()
+	lc.Format = "json"
+	lc.Output = path
+	if err := logger.Init(lc); err != nil {
+		t.Fatalf("logger init: %v", err)
+	}
+	cfg := config.Default()
+	cfg.Debug = debug
+	cfg.Admin.Token = testAdminToken
+	config.SetForTest(cfg)
+	prevInterval := tailPollInterval
+	tailPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() {
+		config.SetForTest(nil)
+		tailPollInterval = prevInterval
+		_ = logger.Init(logger.DefaultConfig())
+	})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutes(r.Group("/admin"))
+	return r, path
+}
+
+func tailRequest(ctx context.Context, url, token string) *http.Request {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestLogsTailAccess(t *testing.T) {
+	r, _ := setupLogTail(t, true)
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, testAdminToken: http.StatusOK} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, tailRequest(context.Background(), "/admin/logs/tail?follow=false", token))
+		if w.Code != want {
+			t.Errorf("token %q: code=%d want %d", token, w.Code, want)
+		}
+	}
+
+	r, _ = setupLogTail(t, false)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, tailRequest(context.Background(), "/admin/logs/tail?follow=false", testAdminToken))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("non-debug mode: code=%d want 404", w.Code)
+	}
+}
+
+func TestLogsTailLines(t *testing.T) {
+	r, _ := setupLogTail(t, true)
+	for _, msg := range []string{"first line", "second line", "third line"} {
+		logger.GetLogger().Info().Msg(msg)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, tailRequest(context.Background(), "/admin/logs/tail?follow=false&lines=2", testAdminToken))
+	body := w.Body.String()
+	if strings.Contains(body, "first line") || !strings.Contains(body, "second line") || !strings.Contains(body, "third line") {
+		t.Fatalf("unexpected tail:\n%s", body)
+	}
+}
+
+func TestLogsTailFollowAndRotate(t *testing.T) {
+	r, path := setupLogTail(t, true)
+	logger.GetLogger().Info().Msg("before follow")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(tailRequest(ctx, srv.URL+"/admin/logs/tail", testAdminToken))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewScanner(resp.Body)
+	waitFor := func(want string) {
+		t.Helper()
+		for lines.Scan() {
+			if strings.Contains(lines.Text(), want) {
+				return
+			}
+		}
+		t.Fatalf("stream ended before %q appeared: %v", want, lines.Err())
+	}
+	waitFor("before follow")
+
+	logger.GetLogger().Info().Msg("appended while following")
+	waitFor("appended while following")
+
+	// rotate: move the file away and start a fresh one at the same path
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	lc := logger.DefaultConfig()
+	lc.Format = "json"
+	lc.Output = path
+	if err := logger.Init(lc); err != nil {
+		t.Fatalf("logger reinit: %v", err)
+	}
+	logger.GetLogger().Info().Msg("after rotation")
+	waitFor("after rotation")
+}
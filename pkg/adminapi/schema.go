@@ -0,0 +1,40 @@
+package adminapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/database"
+)
+
+// dbSchemaHandler reports the on-disk schema of every registered model's table together with the
+// changes AutoMigrate would make, so operators see pending migrations before they run, along with
+// the steps already recorded in schema_migrations
+func dbSchemaHandler(c *gin.Context) {
+	db := database.Get()
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not initialized"})
+		return
+	}
+	tables, err := database.InspectSchema(db, database.Models()...)
+	if errors.Is(err, database.ErrSchemaUnsupported) {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error(), "driver": db.Dialector.Name()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "schema inspection failed", "detail": err.Error()})
+		return
+	}
+	applied, err := database.AppliedMigrations(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "schema inspection failed", "detail": err.Error()})
+		return
+	}
+	pending := false
+	for _, t := range tables {
+		pending = pending || len(t.Pending) > 0
+	}
+	c.JSON(http.StatusOK, gin.H{"tables": tables, "migration_pending": pending, "applied_migrations": applied})
+}
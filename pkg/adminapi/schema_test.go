@@ -0,0 +1,116 @@
+package adminapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/database"
+	_ "go4pack/pkg/fileio" // registers the file metadata models
+)
+
+func TestDBSchemaReport(t *testing.T) {
+	database.ResetForTest()
+	tempDir := t.TempDir()
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	db, err := database.Init("filemeta.db", database.Models()...)
+	if err != nil {
+		t.Fatalf("db init: %v", err)
+	}
+	// simulate a database written by an older version that lacked a column
+	if err := db.Exec("ALTER TABLE file_records DROP COLUMN charset").Error; err != nil {
+		t.Fatalf("drop column: %v", err)
+	}
+	cfg := config.Default()
+	cfg.Admin.Token = testAdminToken
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutes(r.Group("/admin"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, tailRequest(t.Context(), "/admin/db/schema", testAdminToken))
+	if w.Code != http.StatusOK {
+		t.Fatalf("schema report code=%d body=%s", w.Code, w.Body.String())
+	}
+	var report struct {
+		Tables           []database.TableSchema `json:"tables"`
+		MigrationPending bool                   `json:"migration_pending"`
+		Applied          []struct {
+			ID string `json:"id"`
+		} `json:"applied_migrations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if len(report.Applied) == 0 || report.Applied[0].ID != "0001_fileio_models" {
+		t.Errorf("expected the fileio migration recorded, got %+v", report.Applied)
+	}
+	i := slices.IndexFunc(report.Tables, func(ts database.TableSchema) bool { return ts.Model == "FileRecord" })
+	if i < 0 {
+		t.Fatalf("FileRecord missing from report: %s", w.Body.String())
+	}
+	files := report.Tables[i]
+	var cols []string
+	for _, c := range files.Columns {
+		cols = append(cols, c.Name)
+	}
+	for _, want := range []string{"id", "filename", "size", "compressed_size", "md5", "mime", "created_at"} {
+		if !slices.Contains(cols, want) {
+			t.Errorf("column %s missing from %v", want, cols)
+		}
+	}
+	if !slices.Contains(files.Indexes, "idx_file_records_filename") {
+		t.Errorf("expected filename index, got %v", files.Indexes)
+	}
+	if !report.MigrationPending || !slices.Equal(files.Pending, []string{"add column charset"}) {
+		t.Fatalf("expected the dropped column as the only pending change, got %v (pending=%v)", files.Pending, report.MigrationPending)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, tailRequest(t.Context(), "/admin/db/schema", ""))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", w.Code)
+	}
+}
+
+// otherDialector is sqlite under another name, standing in for a driver without pragmas
+type otherDialector struct{ gorm.Dialector }
+
+func (otherDialector) Name() string { return "othersql" }
+
+func TestDBSchemaUnsupportedDriver(t *testing.T) {
+	database.ResetForTest()
+	t.Cleanup(database.ResetForTest)
+	database.RegisterDriver("othersql", func(dsn string) gorm.Dialector { return otherDialector{sqlite.Open(dsn)} })
+	if _, err := database.InitWithConfig(database.Config{Driver: "othersql", DSN: filepath.Join(t.TempDir(), "other.db")}); err != nil {
+		t.Fatalf("db init: %v", err)
+	}
+	cfg := config.Default()
+	cfg.Admin.Token = testAdminToken
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutes(r.Group("/admin"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, tailRequest(t.Context(), "/admin/db/schema", testAdminToken))
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("schema on othersql: code=%d body=%s, want 501", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,150 @@
+package adminapi
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"go4pack/pkg/common/compress"
+	"go4pack/pkg/common/database"
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/worker"
+)
+
+// Check status values
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+// CheckResult is the outcome of a single self-test check
+type CheckResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// Report aggregates all checks; OK is false if any check failed (skips do not count)
+type Report struct {
+	OK     bool          `json:"ok"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// errSkip marks a check that could not run in the current state
+type errSkip string
+
+func (e errSkip) Error() string { return string(e) }
+
+// RunSelfTest exercises the storage layer with each codec, the database and the worker pool
+func RunSelfTest() Report {
+	report := Report{OK: true}
+	run := func(name string, fn func() error) {
+		start := time.Now()
+		err := fn()
+		res := CheckResult{Name: name, Status: StatusPass, DurationMs: time.Since(start).Milliseconds()}
+		if skip, ok := err.(errSkip); ok {
+			res.Status = StatusSkip
+			res.Detail = string(skip)
+		} else if err != nil {
+			res.Status = StatusFail
+			res.Detail = err.Error()
+			report.OK = false
+		}
+		report.Checks = append(report.Checks, res)
+	}
+	for _, codec := range compress.Codecs() {
+		codec := codec
+		run("codec_roundtrip_"+codec.Name, func() error { return checkCodecRoundTrip(codec) })
+	}
+	for _, ct := range []compress.CompressionType{compress.None, compress.Gzip, compress.Zstd} {
+		ct := ct
+		run("fs_roundtrip_"+ct.String(), func() error { return checkFsRoundTrip(ct) })
+	}
+	run("database_ping", checkDatabase)
+	run("worker_submit", checkWorker)
+	return report
+}
+
+// codecSamples are representative round-trip inputs: empty, incompressible and highly compressible
+func codecSamples() map[string][]byte {
+	random := make([]byte, 16*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+	return map[string][]byte{
+		"empty":        {},
+		"random":       random,
+		"compressible": bytes.Repeat([]byte("go4pack "), 8*1024),
+	}
+}
+
+// checkCodecRoundTrip verifies a registered codec against each sample input
+func checkCodecRoundTrip(codec compress.Codec) error {
+	if codec.New == nil {
+		return errSkip("codec has no constructor")
+	}
+	for name, data := range codecSamples() {
+		if err := compress.VerifyRoundTrip(codec.New(), data); err != nil {
+			return fmt.Errorf("%s input: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// checkFsRoundTrip writes, reads back and verifies a hashed object in a throwaway runtime dir
+func checkFsRoundTrip(ct compress.CompressionType) error {
+	dir, err := os.MkdirTemp("", "go4pack-selftest-*")
+	if err != nil {
+		return fmt.Errorf("temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	fsys, err := fs.NewWithBasePathAndCompression(dir, compress.NewCompressor(ct))
+	if err != nil {
+		return err
+	}
+	data := bytes.Repeat([]byte("go4pack selftest payload "), 64)
+	const hash = "5e1f7e575e1f7e575e1f7e575e1f7e57"
+	if err := fsys.WriteObjectHashed(hash, data); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	if err := fsys.VerifyHashedRegular(hash); err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	got, err := fsys.ReadObjectHashed(hash)
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	if !bytes.Equal(got, data) {
+		return fmt.Errorf("read back %d bytes, mismatch with %d written", len(got), len(data))
+	}
+	return nil
+}
+
+// checkDatabase pings the shared database connection (skipped until something initialized it)
+func checkDatabase() error {
+	db := database.Get()
+	if db == nil {
+		return errSkip("database not initialized yet")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Ping()
+}
+
+// checkWorker submits a no-op job and waits for the pool to run it
+func checkWorker() error {
+	done := make(chan struct{})
+	if err := worker.Submit(func() { close(done) }); err != nil {
+		return fmt.Errorf("submit: %w", err)
+	}
+	select {
+	case <-done:
+		return nil
+	case <-time.After(2 * time.Second):
+		return fmt.Errorf("job not executed within 2s")
+	}
+}
@@ -0,0 +1,58 @@
+package adminapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/database"
+)
+
+func TestSelfTestAllPass(t *testing.T) {
+	database.ResetForTest()
+	tempDir := t.TempDir()
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	if _, err := database.Init("selftest.db"); err != nil {
+		t.Fatalf("db init: %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.Admin.Token = testAdminToken
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutes(r.Group("/admin"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/selftest", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("selftest without token: code=%d, want 401", w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, tailRequest(t.Context(), "/admin/selftest", testAdminToken))
+	if w.Code != http.StatusOK {
+		t.Fatalf("selftest failed code=%d body=%s", w.Code, w.Body.String())
+	}
+	var report Report
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if !report.OK || len(report.Checks) == 0 {
+		t.Fatalf("expected ok report with checks, got %+v", report)
+	}
+	for _, c := range report.Checks {
+		if c.Status != StatusPass {
+			t.Errorf("check %s: status=%s detail=%s", c.Name, c.Status, c.Detail)
+		}
+	}
+}
@@ -1,9 +1,13 @@
 package common
 
 import (
+	"fmt"
+
+	"go4pack/pkg/common/compress"
 	"go4pack/pkg/common/config"
 	"go4pack/pkg/common/fs"
 	"go4pack/pkg/common/logger"
+	"go4pack/pkg/common/tracing"
 
 	"github.com/rs/zerolog"
 )
@@ -32,8 +36,30 @@ func InitWithConfig(configPath string) error {
 	if cfg.Debug {
 		loggerConfig.Level = "debug"
 	}
+	if cfg.Log.Output != "" {
+		loggerConfig.Output = cfg.Log.Output
+	}
+	loggerConfig.MaxSizeMB = cfg.Log.MaxSizeMB
+	loggerConfig.MaxBackups = cfg.Log.MaxBackups
+	loggerConfig.MaxAgeDays = cfg.Log.MaxAgeDays
+
+	if err := logger.Init(loggerConfig); err != nil {
+		return err
+	}
+
+	exporter, err := tracing.NewExporter(cfg.Tracing.Exporter)
+	if err != nil {
+		return err
+	}
+	tracing.SetExporter(exporter)
 
-	return logger.Init(loggerConfig)
+	compressor, err := compress.NewCompressorByName(cfg.Compression.Algorithm, cfg.Compression.Level)
+	if err != nil {
+		return fmt.Errorf("invalid compression config: %w", err)
+	}
+	fs.SetDefaultCompressor(compressor)
+	fs.SetIncompressibleMIMETypes(cfg.Compression.IncompressibleMIMETypes)
+	return nil
 }
 
 // Init initializes the application with default settings
@@ -41,6 +67,25 @@ func Init() error {
 	return InitWithConfig("")
 }
 
+// Reload re-reads the config file and applies the settings that can change without a restart:
+// currently the debug log level
+func Reload() error {
+	before := config.IsDebug()
+	if err := config.Reload(); err != nil {
+		return err
+	}
+	after := config.IsDebug()
+	level := "info"
+	if after {
+		level = "debug"
+	}
+	if err := logger.SetLevel(level); err != nil {
+		return err
+	}
+	logger.GetLogger().Info().Bool("debug_before", before).Bool("debug_after", after).Msg("configuration reloaded")
+	return nil
+}
+
 // GetLogger returns the global logger instance
 func GetLogger() *zerolog.Logger {
 	return logger.GetLogger()
@@ -56,7 +101,7 @@ func IsDebug() bool {
 	return config.IsDebug()
 }
 
-// GetFileSystem returns a new filesystem instance
+// GetFileSystem returns a new filesystem instance using the configured compressor
 func GetFileSystem() (*fs.FileSystem, error) {
 	return fs.New()
 }
@@ -0,0 +1,50 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+
+	"go4pack/pkg/common/config"
+)
+
+func TestReloadAppliesDebugLevel(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"debug": false, "log": {"output": "stderr"}}`), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	viper.Reset()
+	t.Cleanup(func() {
+		viper.Reset()
+		config.SetForTest(nil)
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	})
+	if err := InitWithConfig(dir); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if IsDebug() || zerolog.GlobalLevel() != zerolog.InfoLevel {
+		t.Fatalf("expected info level before reload, debug=%v level=%v", IsDebug(), zerolog.GlobalLevel())
+	}
+
+	if err := os.WriteFile(path, []byte(`{"debug": true, "log": {"output": "stderr"}}`), 0644); err != nil {
+		t.Fatalf("rewrite config: %v", err)
+	}
+	if err := Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !IsDebug() || zerolog.GlobalLevel() != zerolog.DebugLevel {
+		t.Fatalf("expected debug level after reload, debug=%v level=%v", IsDebug(), zerolog.GlobalLevel())
+	}
+
+	// an invalid file keeps the running configuration
+	if err := os.WriteFile(path, []byte(`{"debug": false, "list": {"default_page_size": 0}}`), 0644); err != nil {
+		t.Fatalf("rewrite config: %v", err)
+	}
+	if err := Reload(); err == nil || !IsDebug() {
+		t.Fatalf("expected rejected reload to keep debug on, err=%v debug=%v", err, IsDebug())
+	}
+}
@@ -23,16 +23,10 @@ const (
 
 // String returns the string representation of the compression type
 func (ct CompressionType) String() string {
-	switch ct {
-	case None:
-		return "none"
-	case Gzip:
-		return "gzip"
-	case Zstd:
-		return "zstd"
-	default:
-		return "unknown"
+	if c, ok := Lookup(ct); ok {
+		return c.Name
 	}
+	return "unknown"
 }
 
 // Compressor interface defines methods for data compression
@@ -92,6 +86,35 @@ func (gc *gzipCompressor) Decompress(data []byte) ([]byte, error) {
 	return result, nil
 }
 
+// CompressStream gzips src into dst without holding the input in memory
+func (gc *gzipCompressor) CompressStream(dst io.Writer, src io.Reader) error {
+	writer, err := gzip.NewWriterLevel(dst, gc.level)
+	if err != nil {
+		return fmt.Errorf("failed to create gzip writer: %w", err)
+	}
+	if _, err := io.Copy(writer, src); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to stream data to gzip writer: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to close gzip writer: %w", err)
+	}
+	return nil
+}
+
+// DecompressStream gunzips src into dst
+func (gc *gzipCompressor) DecompressStream(dst io.Writer, src io.Reader) error {
+	reader, err := gzip.NewReader(src)
+	if err != nil {
+		return fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer reader.Close()
+	if _, err := io.Copy(dst, reader); err != nil {
+		return fmt.Errorf("failed to stream from gzip reader: %w", err)
+	}
+	return nil
+}
+
 // Type returns the compression type
 func (gc *gzipCompressor) Type() CompressionType {
 	return Gzip
@@ -112,24 +135,16 @@ func NewZstdCompressor(level zstd.EncoderLevel) Compressor {
 	return &zstdCompressor{encoderLevel: level}
 }
 
-// Compress compresses data using zstandard
+// Compress compresses data using zstandard. The whole input is encoded as a single frame,
+// which records the content size in the frame header (see ContentSize).
 func (zc *zstdCompressor) Compress(data []byte) ([]byte, error) {
-	var buf bytes.Buffer
-	enc, err := zstd.NewWriter(&buf, zstd.WithEncoderLevel(zc.encoderLevel))
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zc.encoderLevel))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
 	}
+	defer enc.Close()
 
-	if _, err := enc.Write(data); err != nil {
-		enc.Close()
-		return nil, fmt.Errorf("failed to write data to zstd encoder: %w", err)
-	}
-
-	if err := enc.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close zstd encoder: %w", err)
-	}
-
-	return buf.Bytes(), nil
+	return enc.EncodeAll(data, nil), nil
 }
 
 // Decompress decompresses zstandard data
@@ -148,6 +163,42 @@ func (zc *zstdCompressor) Decompress(data []byte) ([]byte, error) {
 	return result, nil
 }
 
+// CompressStream zstd-encodes src into dst without holding the input in memory. When the
+// remaining size of src is known (see streamSize) it is recorded in the frame header, like
+// Compress does, so ContentSize keeps working for streamed objects.
+func (zc *zstdCompressor) CompressStream(dst io.Writer, src io.Reader) error {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zc.encoderLevel))
+	if err != nil {
+		return fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	if n, ok := streamSize(src); ok {
+		enc.ResetContentSize(dst, n)
+	} else {
+		enc.Reset(dst)
+	}
+	if _, err := io.Copy(enc, src); err != nil {
+		enc.Close()
+		return fmt.Errorf("failed to stream data to zstd encoder: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to close zstd encoder: %w", err)
+	}
+	return nil
+}
+
+// DecompressStream decodes zstandard src into dst
+func (zc *zstdCompressor) DecompressStream(dst io.Writer, src io.Reader) error {
+	dec, err := zstd.NewReader(src)
+	if err != nil {
+		return fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	defer dec.Close()
+	if _, err := io.Copy(dst, dec); err != nil {
+		return fmt.Errorf("failed to stream from zstd decoder: %w", err)
+	}
+	return nil
+}
+
 // Type returns the compression type
 func (zc *zstdCompressor) Type() CompressionType {
 	return Zstd
@@ -171,22 +222,59 @@ func (nc *noneCompressor) Decompress(data []byte) ([]byte, error) {
 	return data, nil
 }
 
+// CompressStream copies src to dst unchanged
+func (nc *noneCompressor) CompressStream(dst io.Writer, src io.Reader) error {
+	_, err := io.Copy(dst, src)
+	return err
+}
+
+// DecompressStream copies src to dst unchanged
+func (nc *noneCompressor) DecompressStream(dst io.Writer, src io.Reader) error {
+	_, err := io.Copy(dst, src)
+	return err
+}
+
 // Type returns the compression type
 func (nc *noneCompressor) Type() CompressionType {
 	return None
 }
 
-// NewCompressor creates a new compressor based on the specified type
+// NewCompressor creates a new compressor based on the specified type (none for unknown types)
 func NewCompressor(cType CompressionType) Compressor {
-	switch cType {
-	case Gzip:
-		return NewGzipCompressor(gzip.DefaultCompression)
-	case Zstd:
-		return NewZstdCompressorMax()
-	case None:
-		return NewNoneCompressor()
+	if c, ok := Lookup(cType); ok && c.New != nil {
+		return c.New()
+	}
+	return NewNoneCompressor()
+}
+
+// NewCompressorByName creates the compressor for a configured algorithm name and level.
+// level 0 selects gzip's default or zstd's best compression (the built-in default); other levels
+// must be 1-9 for gzip or 1-22 for zstd, and "none" takes no level.
+func NewCompressorByName(algorithm string, level int) (Compressor, error) {
+	switch algorithm {
+	case "none":
+		if level != 0 {
+			return nil, fmt.Errorf("compression level %d given for algorithm \"none\"", level)
+		}
+		return NewNoneCompressor(), nil
+	case "gzip":
+		if level == 0 {
+			return NewGzipCompressor(gzip.DefaultCompression), nil
+		}
+		if level < gzip.BestSpeed || level > gzip.BestCompression {
+			return nil, fmt.Errorf("gzip compression level %d out of range 1-9", level)
+		}
+		return NewGzipCompressor(level), nil
+	case "zstd":
+		if level == 0 {
+			return NewZstdCompressorMax(), nil
+		}
+		if level < 1 || level > 22 {
+			return nil, fmt.Errorf("zstd compression level %d out of range 1-22", level)
+		}
+		return NewZstdCompressor(zstd.EncoderLevelFromZstd(level)), nil
 	default:
-		return NewNoneCompressor()
+		return nil, fmt.Errorf("unknown compression algorithm %q (expected none, gzip or zstd)", algorithm)
 	}
 }
 
@@ -208,22 +296,9 @@ func DecompressWithType(data []byte, cType CompressionType) ([]byte, error) {
 }
 
 // IsCompressed checks if the data appears to be compressed by examining magic bytes
+// of the registered codecs
 func IsCompressed(data []byte) CompressionType {
-	if len(data) < 2 {
-		return None
-	}
-
-	// Check for gzip magic number (0x1f, 0x8b)
-	if data[0] == 0x1f && data[1] == 0x8b {
-		return Gzip
-	}
-
-	// Check for zstd frame magic (0x28, 0xB5, 0x2F, 0xFD)
-	if len(data) >= 4 && data[0] == 0x28 && data[1] == 0xB5 && data[2] == 0x2F && data[3] == 0xFD {
-		return Zstd
-	}
-
-	return None
+	return detect(data)
 }
 
 var mimeCompressionMap = map[string]CompressionType{
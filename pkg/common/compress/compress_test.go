@@ -212,3 +212,42 @@ func BenchmarkGzipDecompress(b *testing.B) {
 		}
 	}
 }
+
+func TestNewCompressorByName(t *testing.T) {
+	valid := []struct {
+		algorithm string
+		level     int
+		want      CompressionType
+	}{
+		{"none", 0, None},
+		{"gzip", 0, Gzip},
+		{"gzip", 9, Gzip},
+		{"zstd", 0, Zstd},
+		{"zstd", 3, Zstd},
+		{"zstd", 22, Zstd},
+	}
+	data := []byte(strings.Repeat("configured compressor ", 200))
+	for _, tt := range valid {
+		c, err := NewCompressorByName(tt.algorithm, tt.level)
+		if err != nil {
+			t.Fatalf("NewCompressorByName(%q, %d): %v", tt.algorithm, tt.level, err)
+		}
+		if c.Type() != tt.want {
+			t.Errorf("NewCompressorByName(%q, %d) => %v, want %v", tt.algorithm, tt.level, c.Type(), tt.want)
+		}
+		if err := VerifyRoundTrip(c, data); err != nil {
+			t.Errorf("%s level %d: %v", tt.algorithm, tt.level, err)
+		}
+	}
+	invalid := []struct {
+		algorithm string
+		level     int
+	}{
+		{"brotli", 0}, {"", 0}, {"none", 1}, {"gzip", 10}, {"gzip", -2}, {"zstd", 23}, {"zstd", -1},
+	}
+	for _, tt := range invalid {
+		if _, err := NewCompressorByName(tt.algorithm, tt.level); err == nil {
+			t.Errorf("NewCompressorByName(%q, %d): expected error", tt.algorithm, tt.level)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ratioCorpus is the standard "highly compressible text" input: ~256KiB of synthetic access-log
+// lines with a small vocabulary and pseudo-random (but seeded, hence stable) numeric fields.
+func ratioCorpus() []byte {
+	rng := rand.New(rand.NewSource(42))
+	methods := []string{"GET", "POST", "DELETE"}
+	paths := []string{"/api/fileio/upload", "/api/fileio/list", "/api/fileio/meta/", "/api/pool/stats"}
+	var sb strings.Builder
+	for sb.Len() < 256*1024 {
+		fmt.Fprintf(&sb, "2024-01-%02d 12:%02d:%02d %s %s%d status=%d bytes=%d\n",
+			rng.Intn(28)+1, rng.Intn(60), rng.Intn(60), methods[rng.Intn(len(methods))],
+			paths[rng.Intn(len(paths))], rng.Intn(1000), []int{200, 200, 200, 404, 500}[rng.Intn(5)], rng.Intn(1<<20))
+	}
+	return []byte(sb.String())
+}
+
+// TestCompressionRatioFloor guards against codec regressions such as a lowered default level.
+// Floors sit well below observed ratios and the time bound is generous, so only real
+// regressions (not machine noise) trip it.
+func TestCompressionRatioFloor(t *testing.T) {
+	corpus := ratioCorpus()
+	cases := []struct {
+		name  string
+		c     Compressor
+		floor float64 // minimum original/compressed ratio
+	}{
+		{"gzip_default", NewGzipCompressor(gzip.DefaultCompression), 3.0},
+		{"zstd_default", NewDefaultCompressor(), 4.0},
+		{"zstd_factory", NewCompressor(Zstd), 4.0},
+	}
+	ratios := map[string]float64{}
+	for _, tc := range cases {
+		start := time.Now()
+		out, err := tc.c.Compress(corpus)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if d := time.Since(start); d > 10*time.Second {
+			t.Errorf("%s: compressing %d bytes took %v", tc.name, len(corpus), d)
+		}
+		ratio := float64(len(corpus)) / float64(len(out))
+		ratios[tc.name] = ratio
+		t.Logf("%s ratio %.2f", tc.name, ratio)
+		if ratio < tc.floor {
+			t.Errorf("%s: ratio %.2f below floor %.2f", tc.name, ratio, tc.floor)
+		}
+	}
+	// the default must stay at a stronger level than the fastest zstd setting
+	fast, _ := NewZstdCompressor(zstd.SpeedFastest).Compress(corpus)
+	if fastRatio := float64(len(corpus)) / float64(len(fast)); ratios["zstd_default"] <= fastRatio {
+		t.Errorf("default zstd ratio %.2f not better than SpeedFastest %.2f; was the level lowered?", ratios["zstd_default"], fastRatio)
+	}
+}
+
+func BenchmarkCompressCorpus(b *testing.B) {
+	corpus := ratioCorpus()
+	for _, c := range Codecs() {
+		b.Run(c.Name, func(b *testing.B) {
+			comp := c.New()
+			b.SetBytes(int64(len(corpus)))
+			for i := 0; i < b.N; i++ {
+				if _, err := comp.Compress(corpus); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec describes a compression algorithm known to the registry
+type Codec struct {
+	// Type is the identifier persisted alongside objects
+	Type CompressionType
+	// Name is the human-readable name returned by CompressionType.String
+	Name string
+	// New returns a compressor for this codec
+	New func() Compressor
+	// Detect reports whether data starts with this codec's magic bytes (nil: never detected)
+	Detect func(data []byte) bool
+	// ContentSize reads the decompressed size declared by the stream itself (nil: not supported)
+	ContentSize func(r io.ReaderAt, size int64) (int64, bool)
+	// NewReader returns a streaming decompressor over r (nil: no streaming support)
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+	// NewWriter returns a streaming compressor writing to w; level 0 selects the codec default
+	// (nil: no streaming support)
+	NewWriter func(w io.Writer, level int) (io.WriteCloser, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	codecs     = make(map[CompressionType]Codec)
+	// detectOrder keeps magic detection deterministic (registration order)
+	detectOrder []CompressionType
+)
+
+// Register adds or replaces a codec. Codecs normally register themselves from init.
+func Register(c Codec) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := codecs[c.Type]; !exists {
+		detectOrder = append(detectOrder, c.Type)
+	}
+	codecs[c.Type] = c
+}
+
+// Lookup returns the registered codec for a compression type
+func Lookup(ct CompressionType) (Codec, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	c, ok := codecs[ct]
+	return c, ok
+}
+
+// LookupByName returns the registered codec with the given name
+func LookupByName(name string) (Codec, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for _, ct := range detectOrder {
+		if c := codecs[ct]; c.Name == name {
+			return c, true
+		}
+	}
+	return Codec{}, false
+}
+
+// Codecs returns all registered codecs in registration order
+func Codecs() []Codec {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make([]Codec, 0, len(detectOrder))
+	for _, ct := range detectOrder {
+		out = append(out, codecs[ct])
+	}
+	return out
+}
+
+// detect returns the first registered codec whose magic matches data
+func detect(data []byte) CompressionType {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for _, ct := range detectOrder {
+		if c := codecs[ct]; c.Detect != nil && c.Detect(data) {
+			return ct
+		}
+	}
+	return None
+}
+
+func init() {
+	Register(Codec{
+		Type:      None,
+		Name:      "none",
+		New:       NewNoneCompressor,
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil },
+		NewWriter: func(w io.Writer, _ int) (io.WriteCloser, error) { return nopWriteCloser{w}, nil },
+	})
+	Register(Codec{
+		Type: Gzip,
+		Name: "gzip",
+		New:  func() Compressor { return NewGzipCompressor(gzip.DefaultCompression) },
+		// gzip magic number (0x1f, 0x8b)
+		Detect:      func(data []byte) bool { return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b },
+		ContentSize: gzipContentSize,
+		NewReader:   func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == 0 {
+				level = gzip.DefaultCompression
+			}
+			return gzip.NewWriterLevel(w, level)
+		},
+	})
+	Register(Codec{
+		Type: Zstd,
+		Name: "zstd",
+		New:  NewZstdCompressorMax,
+		// zstd frame magic (0x28, 0xB5, 0x2F, 0xFD)
+		Detect: func(data []byte) bool {
+			return len(data) >= 4 && data[0] == 0x28 && data[1] == 0xB5 && data[2] == 0x2F && data[3] == 0xFD
+		},
+		ContentSize: zstdContentSize,
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			dec, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return dec.IOReadCloser(), nil
+		},
+		NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			opts := []zstd.EOption{}
+			if level != 0 {
+				opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+			}
+			return zstd.NewWriter(w, opts...)
+		},
+	})
+}
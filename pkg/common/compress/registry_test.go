@@ -0,0 +1,75 @@
+package compress
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// fakeCompressor reverses the payload behind a 3-byte magic header
+type fakeCompressor struct{}
+
+const fakeType CompressionType = 100
+
+var fakeMagic = []byte("FK1")
+
+func (fakeCompressor) Compress(data []byte) ([]byte, error) {
+	out := append([]byte{}, fakeMagic...)
+	for i := len(data) - 1; i >= 0; i-- {
+		out = append(out, data[i])
+	}
+	return out, nil
+}
+
+func (fakeCompressor) Decompress(data []byte) ([]byte, error) {
+	body := data[len(fakeMagic):]
+	out := make([]byte, 0, len(body))
+	for i := len(body) - 1; i >= 0; i-- {
+		out = append(out, body[i])
+	}
+	return out, nil
+}
+
+func (fakeCompressor) Type() CompressionType { return fakeType }
+
+func TestRegister_FakeCodec(t *testing.T) {
+	Register(Codec{
+		Type:   fakeType,
+		Name:   "fake",
+		New:    func() Compressor { return fakeCompressor{} },
+		Detect: func(data []byte) bool { return bytes.HasPrefix(data, fakeMagic) },
+	})
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(codecs, fakeType)
+		detectOrder = slices.DeleteFunc(detectOrder, func(ct CompressionType) bool { return ct == fakeType })
+		registryMu.Unlock()
+	})
+
+	if got := fakeType.String(); got != "fake" {
+		t.Errorf("String()=%q want fake", got)
+	}
+	c := NewCompressor(fakeType)
+	if c.Type() != fakeType {
+		t.Fatalf("NewCompressor returned %v, want fake", c.Type())
+	}
+	data := []byte("registry roundtrip")
+	compressed, err := c.Compress(data)
+	if err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	if IsCompressed(compressed) != fakeType {
+		t.Errorf("IsCompressed did not detect fake codec")
+	}
+	out, err := DecompressWithType(compressed, fakeType)
+	if err != nil || !bytes.Equal(out, data) {
+		t.Errorf("roundtrip mismatch: %q %v", out, err)
+	}
+	if cd, ok := LookupByName("fake"); !ok || cd.Type != fakeType {
+		t.Errorf("LookupByName(fake) = %v, %v", cd, ok)
+	}
+	// built-in detection is unaffected
+	if IsCompressed([]byte{0x1f, 0x8b, 0x08}) != Gzip {
+		t.Errorf("gzip detection broken after registering fake codec")
+	}
+}
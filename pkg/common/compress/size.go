@@ -0,0 +1,82 @@
+package compress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxDeflateRatio bounds how far deflate can expand (a compressed byte yields at most ~1032 bytes)
+const maxDeflateRatio = 1032
+
+// ContentSize returns the decompressed size a compressed stream declares about itself, without
+// decompressing it. ok is false when the codec is unknown or the size is not recorded reliably,
+// in which case callers must fall back to full decompression.
+func ContentSize(r io.ReaderAt, size int64) (n int64, ok bool) {
+	head := make([]byte, 4)
+	k, _ := r.ReadAt(head, 0)
+	c, found := Lookup(detect(head[:k]))
+	if !found || c.ContentSize == nil {
+		return 0, false
+	}
+	return c.ContentSize(r, size)
+}
+
+// zstdContentSize reads the Frame_Content_Size field of the first frame header. Only the first
+// frame is consulted, which matches what Compress produces (a single frame per object).
+func zstdContentSize(r io.ReaderAt, size int64) (int64, bool) {
+	buf := make([]byte, zstd.HeaderMaxSize)
+	k, _ := r.ReadAt(buf, 0)
+	var h zstd.Header
+	if err := h.Decode(buf[:k]); err != nil || !h.HasFCS {
+		return 0, false
+	}
+	return int64(h.FrameContentSize), true
+}
+
+// gzipContentSize reads the ISIZE trailer, which holds the input size modulo 2^32 of the last
+// member only. It is trusted only when the stream is too small to have wrapped past 4GiB and
+// holds a single member; a concatenated stream reports unknown, so callers decompress it.
+func gzipContentSize(r io.ReaderAt, size int64) (int64, bool) {
+	if size < 18 || size*maxDeflateRatio >= 1<<32 {
+		return 0, false
+	}
+	if gzipMayHaveMembers(r, size) {
+		return 0, false
+	}
+	trailer := make([]byte, 4)
+	if _, err := r.ReadAt(trailer, size-4); err != nil {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint32(trailer)), true
+}
+
+// gzipMemberMagic starts every gzip member (ID1, ID2 and CM=deflate)
+var gzipMemberMagic = []byte{0x1f, 0x8b, 0x08}
+
+// gzipMayHaveMembers scans the compressed bytes after the first header for the start of another
+// member. Any later member begins with the magic, so a miss proves the stream is a single member;
+// a hit may also be chance bytes inside deflate data, which merely costs a full decode.
+func gzipMayHaveMembers(r io.ReaderAt, size int64) bool {
+	buf := make([]byte, 32*1024)
+	// a later member starts after the 10-byte first header and leaves room for its own header
+	// and 8-byte trailer
+	off, limit := int64(10), size-18+int64(len(gzipMemberMagic))
+	for off < limit {
+		n := int(min(int64(len(buf)), limit-off))
+		if _, err := r.ReadAt(buf[:n], off); err != nil {
+			return true
+		}
+		if bytes.Contains(buf[:n], gzipMemberMagic) {
+			return true
+		}
+		if off+int64(n) >= limit {
+			break
+		}
+		// step back so a magic split across reads is still seen
+		off += int64(n - len(gzipMemberMagic) + 1)
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package compress
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// StreamCompressor is implemented by compressors that can encode and decode incrementally, so
+// callers can pipe large inputs through them without a full in-memory copy
+type StreamCompressor interface {
+	CompressStream(dst io.Writer, src io.Reader) error
+	DecompressStream(dst io.Writer, src io.Reader) error
+}
+
+// CompressStream compresses src into dst with c, streaming when c implements StreamCompressor
+// and otherwise falling back to buffering the input for Compress
+func CompressStream(c Compressor, dst io.Writer, src io.Reader) error {
+	if sc, ok := c.(StreamCompressor); ok {
+		return sc.CompressStream(dst, src)
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	out, err := c.Compress(data)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(out)
+	return err
+}
+
+// DecompressStream is the decoding counterpart of CompressStream
+func DecompressStream(c Compressor, dst io.Writer, src io.Reader) error {
+	if sc, ok := c.(StreamCompressor); ok {
+		return sc.DecompressStream(dst, src)
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	out, err := c.Decompress(data)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(out)
+	return err
+}
+
+// streamSize reports how many bytes are left in src when it is a file positioned somewhere in it
+func streamSize(src io.Reader) (int64, bool) {
+	f, ok := src.(*os.File)
+	if !ok {
+		return 0, false
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false
+	}
+	return info.Size() - pos, true
+}
+
+// NewReader wraps r with a streaming decompressor for ct; uncompressed data is passed through
+func NewReader(ct CompressionType, r io.Reader) (io.ReadCloser, error) {
+	if c, ok := Lookup(ct); ok && c.NewReader != nil {
+		return c.NewReader(r)
+	}
+	return io.NopCloser(r), nil
+}
+
+// NewWriter returns a streaming compressor for ct writing to w. level is codec specific
+// (gzip 1-9, zstd 1-22); 0 selects the codec default. Close must be called to flush the stream;
+// it does not close w. None passes data through unchanged.
+func NewWriter(ct CompressionType, w io.Writer, level int) (io.WriteCloser, error) {
+	c, ok := Lookup(ct)
+	if !ok || c.NewWriter == nil {
+		return nil, fmt.Errorf("no streaming writer for compression type %d", ct)
+	}
+	return c.NewWriter(w, level)
+}
+
+// nopWriteCloser adds a no-op Close to a writer
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,195 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestStreamRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat("streaming codec round trip payload\n", 2000))
+	for _, ct := range []CompressionType{None, Gzip, Zstd} {
+		for _, level := range []int{0, 1} {
+			var buf bytes.Buffer
+			w, err := NewWriter(ct, &buf, level)
+			if err != nil {
+				t.Fatalf("%s level %d: NewWriter: %v", ct, level, err)
+			}
+			// write in uneven chunks to exercise streaming rather than one-shot encoding
+			for rest := data; len(rest) > 0; {
+				n := min(777, len(rest))
+				if _, err := w.Write(rest[:n]); err != nil {
+					t.Fatalf("%s: write: %v", ct, err)
+				}
+				rest = rest[n:]
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("%s: close: %v", ct, err)
+			}
+			if ct == None && !bytes.Equal(buf.Bytes(), data) {
+				t.Fatalf("none writer altered data")
+			}
+			if ct != None {
+				if got := IsCompressed(buf.Bytes()); got != ct {
+					t.Errorf("%s: stream detected as %s", ct, got)
+				}
+				if buf.Len() >= len(data) {
+					t.Errorf("%s: expected compression, %d >= %d", ct, buf.Len(), len(data))
+				}
+			}
+
+			r, err := NewReader(ct, &buf)
+			if err != nil {
+				t.Fatalf("%s: NewReader: %v", ct, err)
+			}
+			got, err := io.ReadAll(r)
+			r.Close()
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("%s level %d: round trip mismatch (err=%v, %d bytes)", ct, level, err, len(got))
+			}
+		}
+	}
+}
+
+func TestStreamReaderMatchesCompressor(t *testing.T) {
+	data := []byte("one-shot compressed, stream decompressed")
+	for _, ct := range []CompressionType{Gzip, Zstd} {
+		packed, err := CompressWithType(data, ct)
+		if err != nil {
+			t.Fatalf("%s: compress: %v", ct, err)
+		}
+		r, err := NewReader(ct, bytes.NewReader(packed))
+		if err != nil {
+			t.Fatalf("%s: NewReader: %v", ct, err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: got %q err=%v", ct, got, err)
+		}
+	}
+}
+
+func TestStreamUnknownType(t *testing.T) {
+	r, err := NewReader(CompressionType(99), strings.NewReader("raw"))
+	if err != nil {
+		t.Fatalf("NewReader for unknown type: %v", err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "raw" {
+		t.Errorf("unknown type should pass data through, got %q", got)
+	}
+	if _, err := NewWriter(CompressionType(99), io.Discard, 0); err == nil {
+		t.Error("expected NewWriter error for unknown type")
+	}
+}
+
+// patternReader yields n bytes of mildly compressible data without materializing them
+type patternReader struct {
+	n, off int64
+}
+
+func (p *patternReader) Read(b []byte) (int, error) {
+	if p.off >= p.n {
+		return 0, io.EOF
+	}
+	b = b[:min(int64(len(b)), p.n-p.off)]
+	for i := range b {
+		x := p.off + int64(i)
+		b[i] = byte(x*x>>7) ^ byte(x>>12)
+	}
+	p.off += int64(len(b))
+	return len(b), nil
+}
+
+func TestCompressStreamRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat("piped through the stream compressor\n", 5000))
+	for _, c := range []Compressor{NewNoneCompressor(), NewGzipCompressor(6), NewDefaultCompressor()} {
+		var packed bytes.Buffer
+		if err := CompressStream(c, &packed, bytes.NewReader(data)); err != nil {
+			t.Fatalf("%s: CompressStream: %v", c.Type(), err)
+		}
+		// streamed output must be readable by the buffered decoder and vice versa
+		unpacked, err := c.Decompress(packed.Bytes())
+		if err != nil || !bytes.Equal(unpacked, data) {
+			t.Fatalf("%s: buffered decode of stream mismatch (err=%v)", c.Type(), err)
+		}
+		buffered, _ := c.Compress(data)
+		var out bytes.Buffer
+		if err := DecompressStream(c, &out, bytes.NewReader(buffered)); err != nil || !bytes.Equal(out.Bytes(), data) {
+			t.Fatalf("%s: DecompressStream mismatch (err=%v)", c.Type(), err)
+		}
+	}
+}
+
+func TestCompressStreamRecordsFileSize(t *testing.T) {
+	data := []byte(strings.Repeat("zstd frame header carries the size\n", 3000))
+	f, err := os.CreateTemp(t.TempDir(), "src-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, _ = f.Write(data)
+	_, _ = f.Seek(0, io.SeekStart)
+	var packed bytes.Buffer
+	if err := CompressStream(NewDefaultCompressor(), &packed, f); err != nil {
+		t.Fatalf("CompressStream: %v", err)
+	}
+	if n, ok := ContentSize(bytes.NewReader(packed.Bytes()), int64(packed.Len())); !ok || n != int64(len(data)) {
+		t.Fatalf("ContentSize=%d,%v want %d", n, ok, len(data))
+	}
+}
+
+type failingWriter struct{ after int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.after <= 0 {
+		return 0, errors.New("disk full")
+	}
+	n := min(w.after, len(p))
+	w.after -= n
+	return n, io.ErrShortWrite
+}
+
+func TestCompressStreamPropagatesErrors(t *testing.T) {
+	src := func() io.Reader { return &patternReader{n: 4 << 20} }
+	for _, c := range []Compressor{NewNoneCompressor(), NewGzipCompressor(1), NewZstdCompressor(1)} {
+		if err := CompressStream(c, &failingWriter{after: 1024}, src()); err == nil {
+			t.Errorf("%s: expected write error mid-stream", c.Type())
+		}
+		broken := io.MultiReader(io.LimitReader(src(), 1<<20), iotest.ErrReader(errors.New("connection reset")))
+		if err := CompressStream(c, io.Discard, broken); err == nil || !strings.Contains(err.Error(), "connection reset") {
+			t.Errorf("%s: expected read error to surface, got %v", c.Type(), err)
+		}
+	}
+	var packed bytes.Buffer
+	_ = CompressStream(NewDefaultCompressor(), &packed, src())
+	truncated := packed.Bytes()[:packed.Len()/2]
+	if err := DecompressStream(NewDefaultCompressor(), io.Discard, bytes.NewReader(truncated)); err == nil {
+		t.Error("expected error decoding a truncated stream")
+	}
+}
+
+func TestCompressStreamBoundedAllocations(t *testing.T) {
+	c := NewDefaultCompressor()
+	allocFor := func(size int64) uint64 {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		if err := CompressStream(c, io.Discard, &patternReader{n: size}); err != nil {
+			t.Fatalf("CompressStream: %v", err)
+		}
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+	// the encoder has a fixed setup cost; what must not happen is allocation growing with the input
+	small, large := allocFor(8<<20), allocFor(64<<20)
+	t.Logf("allocated %d MiB for 8 MiB, %d MiB for 64 MiB", small>>20, large>>20)
+	if large > small+(8<<20) {
+		t.Fatalf("allocations grow with input: %d MiB for 8 MiB vs %d MiB for 64 MiB", small>>20, large>>20)
+	}
+}
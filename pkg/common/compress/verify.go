@@ -0,0 +1,24 @@
+package compress
+
+import "fmt"
+
+// VerifyRoundTrip compresses then decompresses data with c and checks the result is identical
+func VerifyRoundTrip(c Compressor, data []byte) error {
+	compressed, err := c.Compress(data)
+	if err != nil {
+		return fmt.Errorf("%s: compress %d bytes: %w", c.Type(), len(data), err)
+	}
+	out, err := c.Decompress(compressed)
+	if err != nil {
+		return fmt.Errorf("%s: decompress %d bytes: %w", c.Type(), len(compressed), err)
+	}
+	if len(out) != len(data) {
+		return fmt.Errorf("%s: round trip returned %d bytes, want %d", c.Type(), len(out), len(data))
+	}
+	for i := range data {
+		if out[i] != data[i] {
+			return fmt.Errorf("%s: round trip differs at offset %d (got 0x%02x, want 0x%02x)", c.Type(), i, out[i], data[i])
+		}
+	}
+	return nil
+}
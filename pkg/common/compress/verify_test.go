@@ -0,0 +1,51 @@
+package compress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// truncatingCompressor drops the last byte on decompress, simulating a codec regression
+type truncatingCompressor struct{ noneCompressor }
+
+func (truncatingCompressor) Decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	return data[:len(data)-1], nil
+}
+
+// flippingCompressor corrupts one byte without changing the length
+type flippingCompressor struct{ noneCompressor }
+
+func (flippingCompressor) Decompress(data []byte) ([]byte, error) {
+	out := bytes.Clone(data)
+	if len(out) > 3 {
+		out[3] ^= 0xff
+	}
+	return out, nil
+}
+
+func TestVerifyRoundTrip_RegisteredCodecs(t *testing.T) {
+	inputs := [][]byte{nil, []byte("x"), bytes.Repeat([]byte("abc"), 1000)}
+	for _, c := range Codecs() {
+		for _, in := range inputs {
+			if err := VerifyRoundTrip(c.New(), in); err != nil {
+				t.Errorf("%s: %v", c.Name, err)
+			}
+		}
+	}
+}
+
+func TestVerifyRoundTrip_CatchesBrokenCodec(t *testing.T) {
+	data := []byte("payload that must survive the round trip")
+	err := VerifyRoundTrip(&truncatingCompressor{}, data)
+	if err == nil || !strings.Contains(err.Error(), "returned") {
+		t.Errorf("expected length mismatch error, got %v", err)
+	}
+	err = VerifyRoundTrip(&flippingCompressor{}, data)
+	if err == nil || !strings.Contains(err.Error(), "offset 3") {
+		t.Errorf("expected byte mismatch at offset 3, got %v", err)
+	}
+}
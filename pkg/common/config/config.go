@@ -3,20 +3,374 @@ package config
 import (
 	"fmt"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/spf13/viper"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Debug bool `json:"debug" mapstructure:"debug"`
+	Debug       bool              `json:"debug" mapstructure:"debug"`
+	Upload      UploadConfig      `json:"upload" mapstructure:"upload"`
+	Download    DownloadConfig    `json:"download" mapstructure:"download"`
+	Quota       QuotaConfig       `json:"quota" mapstructure:"quota"`
+	Retention   RetentionConfig   `json:"retention" mapstructure:"retention"`
+	Analysis    AnalysisConfig    `json:"analysis" mapstructure:"analysis"`
+	Janitor     JanitorConfig     `json:"janitor" mapstructure:"janitor"`
+	Log         LogConfig         `json:"log" mapstructure:"log"`
+	Admin       AdminConfig       `json:"admin" mapstructure:"admin"`
+	Tracing     TracingConfig     `json:"tracing" mapstructure:"tracing"`
+	List        ListConfig        `json:"list" mapstructure:"list"`
+	Eviction    EvictionConfig    `json:"eviction" mapstructure:"eviction"`
+	Compression CompressionConfig `json:"compression" mapstructure:"compression"`
+	Pool        PoolConfig        `json:"pool" mapstructure:"pool"`
+	Server      ServerConfig      `json:"server" mapstructure:"server"`
+	Auth        AuthConfig        `json:"auth" mapstructure:"auth"`
+	Database    DatabaseConfig    `json:"database" mapstructure:"database"`
 	// Add more configuration fields here as needed
 }
 
-var appConfig *Config
+// UploadConfig holds limits applied to incoming uploads
+type UploadConfig struct {
+	MaxBytes      int64    `json:"max_bytes" mapstructure:"max_bytes"`           // 0 = unlimited
+	FieldNames    []string `json:"field_names" mapstructure:"field_names"`       // accepted multipart file fields
+	FieldFallback bool     `json:"field_fallback" mapstructure:"field_fallback"` // accept any file field when none of FieldNames is present
+	// JSONSchemaPath, when set, points at a JSON Schema that application/json uploads must satisfy
+	JSONSchemaPath string `json:"json_schema_path" mapstructure:"json_schema_path"`
+	// NormalizeCompressed decompresses gzip/zstd uploads before hashing so content dedups regardless
+	// of wire encoding; NormalizeMaxBytes caps the decoded size (larger uploads are stored as sent).
+	NormalizeCompressed bool  `json:"normalize_compressed" mapstructure:"normalize_compressed"`
+	NormalizeMaxBytes   int64 `json:"normalize_max_bytes" mapstructure:"normalize_max_bytes"`
+	// CompressOffload hands compression of buffered uploads to the worker pool and responds before
+	// the object is written; the X-Compress-Offload request header overrides it per request.
+	CompressOffload bool `json:"compress_offload" mapstructure:"compress_offload"`
+	// Archive uploads (POST /upload/archive) are exploded into one object per member; these cap a
+	// single member, the sum of all members and the member count (0 = unlimited)
+	ArchiveMaxMemberBytes int64 `json:"archive_max_member_bytes" mapstructure:"archive_max_member_bytes"`
+	ArchiveMaxTotalBytes  int64 `json:"archive_max_total_bytes" mapstructure:"archive_max_total_bytes"`
+	ArchiveMaxMembers     int   `json:"archive_max_members" mapstructure:"archive_max_members"`
+	// ChunkSessionTTLSeconds expires resumable uploads (POST /upload/chunked) that received no
+	// chunk for this long, removing their spooled data
+	ChunkSessionTTLSeconds int `json:"chunk_session_ttl_seconds" mapstructure:"chunk_session_ttl_seconds"`
+}
+
+// DownloadConfig controls download delivery
+type DownloadConfig struct {
+	RateLimitBytes int64  `json:"rate_limit_bytes" mapstructure:"rate_limit_bytes"` // bytes/sec per download, 0 = unlimited
+	SigningKey     string `json:"signing_key" mapstructure:"signing_key"`           // HMAC key for signed per-URL overrides
+	// InlineTypes are MIME types served inline; entries ending in "/" match a whole family.
+	// HTML and SVG are always served as attachments regardless of this list.
+	InlineTypes []string `json:"inline_types" mapstructure:"inline_types"`
+	// GzipMemberMaxBytes caps a single tar member extracted from a stored .tar.gz, 0 = unlimited
+	GzipMemberMaxBytes int64 `json:"gzip_member_max_bytes" mapstructure:"gzip_member_max_bytes"`
+	// ServeAssets enables GET /assets, which serves uploads as web assets from the API origin; off
+	// by default since anyone able to upload could then publish pages there
+	ServeAssets bool `json:"serve_assets" mapstructure:"serve_assets"`
+}
+
+// QuotaConfig limits the bytes a single client (IP or API key) may upload within a rolling window
+type QuotaConfig struct {
+	Enabled       bool  `json:"enabled" mapstructure:"enabled"`
+	MaxBytes      int64 `json:"max_bytes" mapstructure:"max_bytes"`
+	WindowSeconds int   `json:"window_seconds" mapstructure:"window_seconds"`
+}
+
+// RetentionConfig enables WORM-style retention: records cannot be deleted until the period elapses
+type RetentionConfig struct {
+	Enabled       bool  `json:"enabled" mapstructure:"enabled"`
+	PeriodSeconds int64 `json:"period_seconds" mapstructure:"period_seconds"`
+}
+
+// AnalysisConfig toggles content analysis; Enabled is the master switch, the rest are per kind
+type AnalysisConfig struct {
+	Enabled  bool  `json:"enabled" mapstructure:"enabled"`
+	ELF      bool  `json:"elf" mapstructure:"elf"`
+	Gzip     bool  `json:"gzip" mapstructure:"gzip"`
+	SQLite   bool  `json:"sqlite" mapstructure:"sqlite"`
+	RPM      bool  `json:"rpm" mapstructure:"rpm"`
+	Tar      bool  `json:"tar" mapstructure:"tar"`
+	MaxBytes int64 `json:"max_bytes" mapstructure:"max_bytes"` // larger inputs are not analyzed, 0 = unlimited
+	// TimeoutSeconds bounds a single ELF/gzip/tar analysis job so a malformed input can't hold a
+	// pool worker forever; 0 disables the limit
+	TimeoutSeconds int `json:"timeout_seconds" mapstructure:"timeout_seconds"`
+	// MIMETypes restricts analysis to uploads of these types (entries ending in "/" match a
+	// family); empty allows every type an enabled analyzer recognizes
+	MIMETypes []string `json:"mime_types" mapstructure:"mime_types"`
+	// CompressBenchMaxBytes caps the prefix of an object GET /analysis/compress-bench compresses;
+	// 0 = whole object
+	CompressBenchMaxBytes int64 `json:"compress_bench_max_bytes" mapstructure:"compress_bench_max_bytes"`
+	// Thumbnails generates a JPEG preview for PNG, JPEG and GIF uploads; images whose header
+	// declares more than ThumbnailMaxPixels pixels are never decoded (0 = unlimited)
+	Thumbnails         bool  `json:"thumbnails" mapstructure:"thumbnails"`
+	ThumbnailMaxPixels int64 `json:"thumbnail_max_pixels" mapstructure:"thumbnail_max_pixels"`
+}
+
+// JanitorConfig controls the periodic cleanup of stale temp files and stuck analyses
+type JanitorConfig struct {
+	Enabled               bool `json:"enabled" mapstructure:"enabled"`
+	IntervalSeconds       int  `json:"interval_seconds" mapstructure:"interval_seconds"`
+	TempMaxAgeSeconds     int  `json:"temp_max_age_seconds" mapstructure:"temp_max_age_seconds"`       // temp files older than this are removed
+	PendingTimeoutSeconds int  `json:"pending_timeout_seconds" mapstructure:"pending_timeout_seconds"` // pending analyses older than this are reset
+}
+
+// LogConfig selects where application logs go
+type LogConfig struct {
+	Output string `json:"output" mapstructure:"output"` // "stdout", "stderr", or file path
+	// Size-based rotation of a file Output, off while MaxSizeMB is 0; MaxBackups and MaxAgeDays
+	// (0 = no limit) bound the rotated files kept
+	MaxSizeMB  int `json:"max_size_mb" mapstructure:"max_size_mb"`
+	MaxBackups int `json:"max_backups" mapstructure:"max_backups"`
+	MaxAgeDays int `json:"max_age_days" mapstructure:"max_age_days"`
+	// RequestSampleRate logs one in N successful requests (0 or 1 logs all); errors and requests
+	// slower than SlowRequestMs (0 = no threshold) are always logged
+	RequestSampleRate int `json:"request_sample_rate" mapstructure:"request_sample_rate"`
+	SlowRequestMs     int `json:"slow_request_ms" mapstructure:"slow_request_ms"`
+}
+
+// AdminConfig protects sensitive admin endpoints
+type AdminConfig struct {
+	Token string `json:"token" mapstructure:"token"` // bearer token; empty disables protected endpoints
+}
+
+// TracingConfig selects the span exporter; tracing is a no-op when Exporter is empty
+type TracingConfig struct {
+	Exporter string `json:"exporter" mapstructure:"exporter"` // "", "none" or "log"
+}
+
+// ListConfig bounds pagination of file listings
+type ListConfig struct {
+	DefaultPageSize int `json:"default_page_size" mapstructure:"default_page_size"` // used when page_size is absent or invalid
+	MaxPageSize     int `json:"max_page_size" mapstructure:"max_page_size"`         // larger page_size requests are clamped
+}
+
+// EvictionConfig caps the objects directory for cache-style deployments. When Enabled and a write
+// pushes the stored objects past MaxBytes, least-recently-accessed objects and their records are
+// removed until the total fits again.
+type EvictionConfig struct {
+	Enabled  bool  `json:"enabled" mapstructure:"enabled"`
+	MaxBytes int64 `json:"max_bytes" mapstructure:"max_bytes"` // on-disk bytes, 0 = unlimited
+}
+
+// CompressionConfig selects the compressor applied to stored objects
+type CompressionConfig struct {
+	Algorithm string `json:"algorithm" mapstructure:"algorithm"` // "none", "gzip" or "zstd"
+	Level     int    `json:"level" mapstructure:"level"`         // gzip 1-9, zstd 1-22; 0 = gzip default / zstd best
+	// IncompressibleMIMETypes are stored uncompressed since compressing them wastes CPU for no
+	// gain; entries ending in "/" match a whole family
+	IncompressibleMIMETypes []string `json:"incompressible_mime_types" mapstructure:"incompressible_mime_types"`
+}
+
+// PoolConfig tunes the worker pool
+type PoolConfig struct {
+	HistorySamples int `json:"history_samples" mapstructure:"history_samples"` // per-second samples kept for GET /pool/history
+}
+
+// ServerConfig tunes the HTTP server
+type ServerConfig struct {
+	// MaxBodyBytes caps every request body, including chunked ones without a Content-Length;
+	// 0 = unlimited
+	MaxBodyBytes int64 `json:"max_body_bytes" mapstructure:"max_body_bytes"`
+}
+
+// AuthConfig requires an API key on every endpoint except ExemptPaths; disabled while APIKeys is empty
+type AuthConfig struct {
+	APIKeys     []string `json:"api_keys" mapstructure:"api_keys"`
+	Header      string   `json:"header" mapstructure:"header"`             // request header carrying the key
+	ExemptPaths []string `json:"exempt_paths" mapstructure:"exempt_paths"` // exact paths served without a key
+}
+
+// DatabaseConfig selects the metadata database. The sqlite file is Name inside .runtime unless DSN
+// gives a path; other drivers connect with DSN.
+type DatabaseConfig struct {
+	Driver string `json:"driver" mapstructure:"driver"` // "sqlite" or "postgres"
+	DSN    string `json:"dsn" mapstructure:"dsn"`
+	Name   string `json:"name" mapstructure:"name"`
+}
+
+// Default returns the configuration used when no config file values override it
+func Default() *Config {
+	return &Config{
+		Debug: false,
+		Upload: UploadConfig{
+			MaxBytes:               0,
+			FieldNames:             []string{"file", "files"},
+			NormalizeMaxBytes:      256 << 20, // 256MiB
+			ArchiveMaxMemberBytes:  256 << 20, // 256MiB
+			ArchiveMaxTotalBytes:   1 << 30,   // 1GiB
+			ArchiveMaxMembers:      1000,
+			ChunkSessionTTLSeconds: 24 * 60 * 60,
+		},
+		Download: DownloadConfig{
+			RateLimitBytes:     0,
+			InlineTypes:        []string{"image/", "video/", "audio/", "application/pdf"},
+			GzipMemberMaxBytes: 256 << 20, // 256MiB
+		},
+		Quota: QuotaConfig{
+			Enabled:       false,
+			MaxBytes:      1 << 30, // 1GiB
+			WindowSeconds: 24 * 60 * 60,
+		},
+		Retention: RetentionConfig{
+			Enabled:       false,
+			PeriodSeconds: 30 * 24 * 60 * 60,
+		},
+		Analysis: AnalysisConfig{
+			Enabled:               true,
+			ELF:                   true,
+			Gzip:                  true,
+			SQLite:                true,
+			RPM:                   true,
+			Tar:                   true,
+			MaxBytes:              0,
+			TimeoutSeconds:        30,
+			CompressBenchMaxBytes: 16 << 20, // 16MiB
+			Thumbnails:            true,
+			ThumbnailMaxPixels:    50_000_000,
+		},
+		Janitor: JanitorConfig{
+			Enabled:               true,
+			IntervalSeconds:       10 * 60,
+			TempMaxAgeSeconds:     60 * 60,
+			PendingTimeoutSeconds: 60 * 60,
+		},
+		Log: LogConfig{
+			Output:            "stdout",
+			RequestSampleRate: 1,
+			SlowRequestMs:     1000,
+		},
+		List: ListConfig{
+			DefaultPageSize: 50,
+			MaxPageSize:     500,
+		},
+		Compression: CompressionConfig{
+			Algorithm: "zstd",
+			IncompressibleMIMETypes: []string{
+				"image/jpeg", "image/png", "image/gif", "image/webp", "image/avif", "image/heic",
+				"video/",
+				"audio/mpeg", "audio/aac", "audio/ogg", "audio/opus", "audio/flac", "audio/mp4",
+				"application/zip", "application/x-7z-compressed", "application/x-rar-compressed",
+				"application/x-xz", "application/x-bzip2",
+			},
+		},
+		Pool: PoolConfig{
+			HistorySamples: 300,
+		},
+		Auth: AuthConfig{
+			Header:      "X-API-Key",
+			ExemptPaths: []string{"/healthz", "/readyz", "/metrics"},
+		},
+		Database: DatabaseConfig{
+			Driver: "sqlite",
+			Name:   "filemeta.db",
+		},
+	}
+}
+
+// setDefaults registers default values with viper so partial config files are completed
+func setDefaults() {
+	def := Default()
+	viper.SetDefault("debug", def.Debug)
+	viper.SetDefault("upload.max_bytes", def.Upload.MaxBytes)
+	viper.SetDefault("upload.field_names", def.Upload.FieldNames)
+	viper.SetDefault("upload.field_fallback", def.Upload.FieldFallback)
+	viper.SetDefault("upload.json_schema_path", def.Upload.JSONSchemaPath)
+	viper.SetDefault("upload.normalize_compressed", def.Upload.NormalizeCompressed)
+	viper.SetDefault("upload.normalize_max_bytes", def.Upload.NormalizeMaxBytes)
+	viper.SetDefault("upload.compress_offload", def.Upload.CompressOffload)
+	viper.SetDefault("upload.archive_max_member_bytes", def.Upload.ArchiveMaxMemberBytes)
+	viper.SetDefault("upload.archive_max_total_bytes", def.Upload.ArchiveMaxTotalBytes)
+	viper.SetDefault("upload.archive_max_members", def.Upload.ArchiveMaxMembers)
+	viper.SetDefault("upload.chunk_session_ttl_seconds", def.Upload.ChunkSessionTTLSeconds)
+	viper.SetDefault("download.rate_limit_bytes", def.Download.RateLimitBytes)
+	viper.SetDefault("download.signing_key", def.Download.SigningKey)
+	viper.SetDefault("download.inline_types", def.Download.InlineTypes)
+	viper.SetDefault("download.gzip_member_max_bytes", def.Download.GzipMemberMaxBytes)
+	viper.SetDefault("download.serve_assets", def.Download.ServeAssets)
+	viper.SetDefault("quota.enabled", def.Quota.Enabled)
+	viper.SetDefault("quota.max_bytes", def.Quota.MaxBytes)
+	viper.SetDefault("quota.window_seconds", def.Quota.WindowSeconds)
+	viper.SetDefault("retention.enabled", def.Retention.Enabled)
+	viper.SetDefault("retention.period_seconds", def.Retention.PeriodSeconds)
+	viper.SetDefault("analysis.enabled", def.Analysis.Enabled)
+	viper.SetDefault("analysis.elf", def.Analysis.ELF)
+	viper.SetDefault("analysis.gzip", def.Analysis.Gzip)
+	viper.SetDefault("analysis.sqlite", def.Analysis.SQLite)
+	viper.SetDefault("analysis.rpm", def.Analysis.RPM)
+	viper.SetDefault("analysis.tar", def.Analysis.Tar)
+	viper.SetDefault("analysis.max_bytes", def.Analysis.MaxBytes)
+	viper.SetDefault("analysis.timeout_seconds", def.Analysis.TimeoutSeconds)
+	viper.SetDefault("analysis.mime_types", def.Analysis.MIMETypes)
+	viper.SetDefault("analysis.compress_bench_max_bytes", def.Analysis.CompressBenchMaxBytes)
+	viper.SetDefault("analysis.thumbnails", def.Analysis.Thumbnails)
+	viper.SetDefault("analysis.thumbnail_max_pixels", def.Analysis.ThumbnailMaxPixels)
+	viper.SetDefault("janitor.enabled", def.Janitor.Enabled)
+	viper.SetDefault("janitor.interval_seconds", def.Janitor.IntervalSeconds)
+	viper.SetDefault("janitor.temp_max_age_seconds", def.Janitor.TempMaxAgeSeconds)
+	viper.SetDefault("janitor.pending_timeout_seconds", def.Janitor.PendingTimeoutSeconds)
+	viper.SetDefault("log.output", def.Log.Output)
+	viper.SetDefault("log.max_size_mb", def.Log.MaxSizeMB)
+	viper.SetDefault("log.max_backups", def.Log.MaxBackups)
+	viper.SetDefault("log.max_age_days", def.Log.MaxAgeDays)
+	viper.SetDefault("log.request_sample_rate", def.Log.RequestSampleRate)
+	viper.SetDefault("log.slow_request_ms", def.Log.SlowRequestMs)
+	viper.SetDefault("admin.token", def.Admin.Token)
+	viper.SetDefault("tracing.exporter", def.Tracing.Exporter)
+	viper.SetDefault("list.default_page_size", def.List.DefaultPageSize)
+	viper.SetDefault("list.max_page_size", def.List.MaxPageSize)
+	viper.SetDefault("eviction.enabled", def.Eviction.Enabled)
+	viper.SetDefault("eviction.max_bytes", def.Eviction.MaxBytes)
+	viper.SetDefault("compression.algorithm", def.Compression.Algorithm)
+	viper.SetDefault("compression.level", def.Compression.Level)
+	viper.SetDefault("compression.incompressible_mime_types", def.Compression.IncompressibleMIMETypes)
+	viper.SetDefault("pool.history_samples", def.Pool.HistorySamples)
+	viper.SetDefault("server.max_body_bytes", def.Server.MaxBodyBytes)
+	viper.SetDefault("auth.api_keys", def.Auth.APIKeys)
+	viper.SetDefault("auth.header", def.Auth.Header)
+	viper.SetDefault("auth.exempt_paths", def.Auth.ExemptPaths)
+	viper.SetDefault("database.driver", def.Database.Driver)
+	viper.SetDefault("database.dsn", def.Database.DSN)
+	viper.SetDefault("database.name", def.Database.Name)
+}
+
+// Validate rejects settings that would leave the application in an unusable state
+func (c *Config) Validate() error {
+	if c.List.DefaultPageSize <= 0 || c.List.MaxPageSize <= 0 {
+		return fmt.Errorf("list page sizes must be positive (default_page_size=%d, max_page_size=%d)", c.List.DefaultPageSize, c.List.MaxPageSize)
+	}
+	if c.List.DefaultPageSize > c.List.MaxPageSize {
+		return fmt.Errorf("list.default_page_size (%d) exceeds list.max_page_size (%d)", c.List.DefaultPageSize, c.List.MaxPageSize)
+	}
+	return nil
+}
 
-// Load loads the configuration from config.json file
+var (
+	// appConfig is swapped as a whole by Load/Reload, never mutated in place; mu guards the pointer
+	// so a SIGHUP reload can race with request handlers reading it
+	appConfig *Config
+	mu        sync.RWMutex
+	// viperMu serializes Load and Reload, since viper's own state is not safe for concurrent use
+	viperMu sync.Mutex
+)
+
+// set publishes c as the current configuration
+func set(c *Config) {
+	mu.Lock()
+	appConfig = c
+	mu.Unlock()
+}
+
+// EnvPrefix prefixes environment overrides: GO4PACK_DEBUG, GO4PACK_UPLOAD_MAX_BYTES, ...
+const EnvPrefix = "GO4PACK"
+
+// Load loads the configuration from config.json file. Precedence is environment (EnvPrefix plus
+// the key with "." as "_") over the file over the defaults. A missing file is created from the
+// defaults alone, so environment values never end up in it.
 func Load(configPath string) (*Config, error) {
+	viperMu.Lock()
+	defer viperMu.Unlock()
 	viper.SetConfigName("config")
 	viper.SetConfigType("json")
 
@@ -29,34 +383,89 @@ func Load(configPath string) (*Config, error) {
 	}
 
 	// Set defaults
-	viper.SetDefault("debug", false)
+	setDefaults()
 
 	// Read the config file
 	if err := viper.ReadInConfig(); err != nil {
 		// If config file doesn't exist, create a default one
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			return createDefaultConfig()
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return nil, fmt.Errorf("error reading config file: %w", err)
+		}
+		if _, err := createDefaultConfig(); err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	bindEnv()
+	if err := checkUnknownKeys(); err != nil {
+		return nil, err
 	}
 
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
 
-	appConfig = &config
+	set(&config)
 	return &config, nil
 }
 
+// knownKeys holds every dotted key Config declares, sections included
+var knownKeys = func() map[string]bool {
+	keys := map[string]bool{}
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := f.Tag.Get("mapstructure")
+			if name == "" || name == "-" {
+				continue
+			}
+			key := prefix + strings.ToLower(name)
+			keys[key] = true
+			if f.Type.Kind() == reflect.Struct {
+				walk(f.Type, key+".")
+			}
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "")
+	return keys
+}()
+
+// checkUnknownKeys fails on settings Config does not declare, so a misspelt key in config.json is
+// reported instead of silently falling back to its default
+func checkUnknownKeys() error {
+	var unknown []string
+	for _, key := range viper.AllKeys() {
+		if !knownKeys[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown config keys in %s: %s", viper.ConfigFileUsed(), strings.Join(unknown, ", "))
+}
+
+// bindEnv lets EnvPrefix environment variables override every known key; Reload keeps honoring them
+func bindEnv() {
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+	for _, key := range viper.AllKeys() {
+		_ = viper.BindEnv(key)
+	}
+}
+
 // createDefaultConfig creates a default config.json file if it doesn't exist
 func createDefaultConfig() (*Config, error) {
-	defaultConfig := &Config{
-		Debug: false,
-	}
+	defaultConfig := Default()
 
-	// Set the default values in viper
-	viper.Set("debug", defaultConfig.Debug)
+	// Set the default values in viper (as defaults, so environment overrides still win)
+	viper.SetDefault("debug", defaultConfig.Debug)
 
 	// Write the default config file
 	configFile := filepath.Join(".", "config.json")
@@ -64,19 +473,21 @@ func createDefaultConfig() (*Config, error) {
 		return nil, fmt.Errorf("error creating default config file: %w", err)
 	}
 
-	appConfig = defaultConfig
+	set(defaultConfig)
 	return defaultConfig, nil
 }
 
-// Get returns the current configuration
+// Get returns the current configuration. It is safe to call while Reload runs; the returned value
+// is a snapshot and must not be modified.
 func Get() *Config {
-	if appConfig == nil {
+	mu.RLock()
+	c := appConfig
+	mu.RUnlock()
+	if c == nil {
 		// Return default config if not loaded
-		return &Config{
-			Debug: false,
-		}
+		return Default()
 	}
-	return appConfig
+	return c
 }
 
 // IsDebug returns whether debug mode is enabled
@@ -86,15 +497,23 @@ func IsDebug() bool {
 
 // Reload reloads the configuration from file
 func Reload() error {
+	viperMu.Lock()
+	defer viperMu.Unlock()
 	if err := viper.ReadInConfig(); err != nil {
 		return fmt.Errorf("error reloading config: %w", err)
 	}
+	if err := checkUnknownKeys(); err != nil {
+		return err
+	}
 
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		return fmt.Errorf("error unmarshaling reloaded config: %w", err)
 	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
 
-	appConfig = &config
+	set(&config)
 	return nil
 }
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/spf13/viper"
@@ -269,3 +273,200 @@ func BenchmarkIsDebug(b *testing.B) {
 		IsDebug()
 	}
 }
+
+func TestLoadRejectsInvalidListLimits(t *testing.T) {
+	tempDir := t.TempDir()
+	content := `{"list": {"default_page_size": 100, "max_page_size": 10}}`
+	if err := os.WriteFile(filepath.Join(tempDir, "config.json"), []byte(content), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	viper.Reset()
+	appConfig = nil
+	t.Cleanup(func() { viper.Reset(); appConfig = nil })
+
+	if _, err := Load(tempDir); err == nil {
+		t.Fatal("expected default_page_size above max_page_size to be rejected")
+	}
+	if err := Default().Validate(); err != nil {
+		t.Errorf("default config should validate: %v", err)
+	}
+}
+
+func TestLoadCompressionConfig(t *testing.T) {
+	t.Cleanup(func() { viper.Reset(); appConfig = nil })
+	for _, tc := range []struct {
+		name, content string
+		want          CompressionConfig
+	}{
+		{"Default", `{"debug": false}`, CompressionConfig{Algorithm: "zstd", Level: 0, IncompressibleMIMETypes: Default().Compression.IncompressibleMIMETypes}},
+		{"Gzip", `{"compression": {"algorithm": "gzip", "level": 6}}`, CompressionConfig{Algorithm: "gzip", Level: 6, IncompressibleMIMETypes: Default().Compression.IncompressibleMIMETypes}},
+		{"ZstdLevelOnly", `{"compression": {"level": 3}}`, CompressionConfig{Algorithm: "zstd", Level: 3, IncompressibleMIMETypes: Default().Compression.IncompressibleMIMETypes}},
+		{"IncompressibleOverride", `{"compression": {"incompressible_mime_types": ["image/"]}}`, CompressionConfig{Algorithm: "zstd", IncompressibleMIMETypes: []string{"image/"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(tempDir, "config.json"), []byte(tc.content), 0644); err != nil {
+				t.Fatalf("write config: %v", err)
+			}
+			viper.Reset()
+			appConfig = nil
+			cfg, err := Load(tempDir)
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if !reflect.DeepEqual(cfg.Compression, tc.want) {
+				t.Errorf("compression = %+v, want %+v", cfg.Compression, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	t.Cleanup(func() { viper.Reset(); appConfig = nil })
+	for _, tc := range []struct {
+		name, content string
+		unknown       string // "" = must load
+	}{
+		{"Valid", `{"debug": true, "analysis": {"gzip": false, "thumbnail_max_pixels": 10}, "log": {"output": "stderr"}}`, ""},
+		{"TopLevel", `{"debgu": true}`, "debgu"},
+		{"Nested", `{"upload": {"max_bytes": 10, "max_byte": 5}, "analysis": {"elff": true}}`, "analysis.elff, upload.max_byte"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(tempDir, "config.json"), []byte(tc.content), 0644); err != nil {
+				t.Fatalf("write config: %v", err)
+			}
+			viper.Reset()
+			appConfig = nil
+			cfg, err := Load(tempDir)
+			if tc.unknown == "" {
+				if err != nil {
+					t.Fatalf("load: %v", err)
+				}
+				if !cfg.Debug || cfg.Analysis.Gzip || cfg.Analysis.ThumbnailMaxPixels != 10 {
+					t.Errorf("values not applied: %+v", cfg.Analysis)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "unknown config keys") || !strings.HasSuffix(err.Error(), ": "+tc.unknown) {
+				t.Fatalf("expected unknown keys %q to be reported, got %v", tc.unknown, err)
+			}
+			if appConfig != nil {
+				t.Error("rejected config must not be installed")
+			}
+		})
+	}
+}
+
+// TestGetDuringReload is meant for -race: readers must never observe a torn update
+func TestGetDuringReload(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"debug": false}`), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	viper.Reset()
+	appConfig = nil
+	t.Cleanup(func() { SetForTest(nil) })
+	if _, err := Load(tempDir); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if c := Get(); c.List.MaxPageSize <= 0 {
+					t.Errorf("incomplete config observed: %+v", c.List)
+					return
+				}
+				_ = IsDebug()
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		content := `{"debug": false}`
+		if i%2 == 0 {
+			content = `{"debug": true}`
+		}
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("rewrite config: %v", err)
+		}
+		if err := Reload(); err != nil {
+			t.Fatalf("reload %d: %v", i, err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	if IsDebug() {
+		t.Fatalf("expected the last reload (debug=false) to win")
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	t.Cleanup(func() {
+		viper.Reset()
+		SetForTest(nil)
+	})
+
+	t.Run("OverridesFile", func(t *testing.T) {
+		tempDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(tempDir, "config.json"), []byte(`{"debug": false, "list": {"max_page_size": 100}}`), 0644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		t.Setenv("GO4PACK_DEBUG", "true")
+		t.Setenv("GO4PACK_LIST_MAX_PAGE_SIZE", "80")
+		t.Setenv("GO4PACK_DOWNLOAD_INLINE_TYPES", "image/,text/plain")
+		viper.Reset()
+		appConfig = nil
+		if _, err := Load(tempDir); err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		c := Get()
+		if !c.Debug || c.List.MaxPageSize != 80 || len(c.Download.InlineTypes) != 2 || c.Download.InlineTypes[1] != "text/plain" {
+			t.Fatalf("env not applied: debug=%v max_page_size=%d inline=%v", c.Debug, c.List.MaxPageSize, c.Download.InlineTypes)
+		}
+		// the file is still read for keys without an override
+		if c.List.DefaultPageSize != 50 {
+			t.Fatalf("default_page_size = %d", c.List.DefaultPageSize)
+		}
+		if err := Reload(); err != nil || !IsDebug() {
+			t.Fatalf("reload dropped env override: err=%v debug=%v", err, IsDebug())
+		}
+	})
+
+	t.Run("NotWrittenToDefaultFile", func(t *testing.T) {
+		tempDir := t.TempDir()
+		oldWd, _ := os.Getwd()
+		defer os.Chdir(oldWd)
+		os.Chdir(tempDir)
+		t.Setenv("GO4PACK_DEBUG", "true")
+		viper.Reset()
+		appConfig = nil
+		if _, err := Load("."); err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		if !IsDebug() {
+			t.Fatal("expected env debug override without a config file")
+		}
+		data, err := os.ReadFile("config.json")
+		if err != nil {
+			t.Fatalf("read created config: %v", err)
+		}
+		var written map[string]any
+		if err := json.Unmarshal(data, &written); err != nil {
+			t.Fatalf("decode created config: %v", err)
+		}
+		if written["debug"] != false {
+			t.Fatalf("env value leaked into the created config: %s", data)
+		}
+	})
+}
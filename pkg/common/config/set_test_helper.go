@@ -0,0 +1,9 @@
+package config
+
+// NOTE: This helper is intended ONLY for test code to inject a configuration
+// without touching config files. It should not be used in production code.
+
+// SetForTest replaces the current configuration (nil restores defaults).
+func SetForTest(c *Config) {
+	set(c)
+}
@@ -3,7 +3,9 @@ package database
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"go4pack/pkg/common/fs"
 	"go4pack/pkg/common/logger"
@@ -13,21 +15,56 @@ import (
 )
 
 var (
-	instance *gorm.DB
+	// instance is read without holding once, so handlers can take the fast path of Get while
+	// another goroutine is still initializing
+	instance atomic.Pointer[gorm.DB]
 	once     sync.Once
 )
 
+// Config selects the database backend. Driver defaults to sqlite, whose file is Name inside the
+// .runtime directory unless DSN gives another path; other drivers connect with DSN.
+type Config struct {
+	Driver string
+	DSN    string
+	Name   string
+}
+
+// DriverSQLite and DriverPostgres are the recognised Config.Driver values
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+var (
+	driversMu sync.Mutex
+	drivers   = map[string]func(dsn string) gorm.Dialector{DriverSQLite: sqlite.Open}
+)
+
+// RegisterDriver makes a gorm dialector available under name. Only sqlite is linked in by default
+// so the binary does not carry every client library; a build that needs postgres registers
+// gorm.io/driver/postgres's Open here before Init.
+func RegisterDriver(name string, open func(dsn string) gorm.Dialector) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	drivers[name] = open
+}
+
 // Init initializes the sqlite database inside .runtime directory
 func Init(dbName string, models ...interface{}) (*gorm.DB, error) {
+	return InitWithConfig(Config{Name: dbName}, models...)
+}
+
+// InitWithConfig opens the database described by cfg once and applies the registered migrations;
+// later calls return the first instance
+func InitWithConfig(cfg Config, models ...interface{}) (*gorm.DB, error) {
 	var initErr error
 	once.Do(func() {
-		fsys, err := fs.New()
+		dialector, target, err := dialectorFor(cfg)
 		if err != nil {
-			initErr = fmt.Errorf("filesystem init failed: %w", err)
+			initErr = err
 			return
 		}
-		dbPath := filepath.Join(fsys.GetRuntimePath(), dbName)
-		db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+		db, err := gorm.Open(dialector, &gorm.Config{})
 		if err != nil {
 			initErr = fmt.Errorf("open db failed: %w", err)
 			return
@@ -39,11 +76,55 @@ func Init(dbName string, models ...interface{}) (*gorm.DB, error) {
 				return
 			}
 		}
-		instance = db
-		logger.GetLogger().Info().Str("db", dbPath).Msg("database initialized")
+		if err := Migrate(db, Migrations()...); err != nil {
+			initErr = err
+			return
+		}
+		instance.Store(db)
+		logger.GetLogger().Info().Str("driver", cfg.driver()).Str("db", target).Msg("database initialized")
 	})
-	return instance, initErr
+	return instance.Load(), initErr
+}
+
+func (c Config) driver() string {
+	if c.Driver == "" {
+		return DriverSQLite
+	}
+	return strings.ToLower(c.Driver)
+}
+
+// dialectorFor resolves cfg to a dialector and a loggable description of what it connects to;
+// DSNs of network drivers may carry credentials so only the driver is reported for them
+func dialectorFor(cfg Config) (gorm.Dialector, string, error) {
+	name := cfg.driver()
+	driversMu.Lock()
+	open, ok := drivers[name]
+	driversMu.Unlock()
+	if !ok {
+		if name == DriverPostgres {
+			return nil, "", fmt.Errorf("database driver %q is not built in; register gorm.io/driver/postgres with database.RegisterDriver", name)
+		}
+		return nil, "", fmt.Errorf("unsupported database driver %q (supported: %s, %s)", cfg.Driver, DriverSQLite, DriverPostgres)
+	}
+	if name != DriverSQLite {
+		if cfg.DSN == "" {
+			return nil, "", fmt.Errorf("database driver %q requires a dsn", name)
+		}
+		return open(cfg.DSN), name, nil
+	}
+	dbPath := cfg.DSN
+	if dbPath == "" {
+		if cfg.Name == "" {
+			return nil, "", fmt.Errorf("sqlite database requires a name or dsn")
+		}
+		fsys, err := fs.New()
+		if err != nil {
+			return nil, "", fmt.Errorf("filesystem init failed: %w", err)
+		}
+		dbPath = filepath.Join(fsys.GetRuntimePath(), cfg.Name)
+	}
+	return open(dbPath), dbPath, nil
 }
 
 // Get returns the gorm DB instance
-func Get() *gorm.DB { return instance }
+func Get() *gorm.DB { return instance.Load() }
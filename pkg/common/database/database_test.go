@@ -3,6 +3,7 @@ package database
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -60,3 +61,47 @@ func TestGetBeforeInitReturnsNil(t *testing.T) {
 		t.Error("expected nil before Init")
 	}
 }
+
+// Test that the explicit sqlite config initializes, including a dsn outside .runtime
+func TestInitWithConfigSQLite(t *testing.T) {
+	ResetForTest()
+	tempDir := t.TempDir()
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("chdir failed: %v", err)
+	}
+
+	if _, err := InitWithConfig(Config{Driver: "SQLite", Name: "cfg.db"}); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(".runtime", "cfg.db")); err != nil {
+		t.Fatalf("expected db under .runtime: %v", err)
+	}
+
+	ResetForTest()
+	dsn := filepath.Join(tempDir, "elsewhere.db")
+	if _, err := InitWithConfig(Config{Driver: DriverSQLite, DSN: dsn}); err != nil {
+		t.Fatalf("init with dsn failed: %v", err)
+	}
+	if _, err := os.Stat(dsn); err != nil {
+		t.Fatalf("expected db at dsn: %v", err)
+	}
+}
+
+// Test that unknown or unavailable drivers fail with a clear error and leave Get nil
+func TestInitWithConfigInvalidDriver(t *testing.T) {
+	for driver, want := range map[string]string{
+		"mysql":        `unsupported database driver "mysql"`,
+		DriverPostgres: "register gorm.io/driver/postgres",
+	} {
+		ResetForTest()
+		_, err := InitWithConfig(Config{Driver: driver, DSN: "host=localhost"})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("driver %s: expected error containing %q, got %v", driver, want, err)
+		}
+		if Get() != nil {
+			t.Errorf("driver %s: expected nil instance after failed init", driver)
+		}
+	}
+}
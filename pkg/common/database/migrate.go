@@ -0,0 +1,106 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go4pack/pkg/common/logger"
+)
+
+// Migration is one named, ordered step. Models are AutoMigrated first, then Run (if set) applies
+// any data change; both happen in one transaction recorded in schema_migrations, so a step runs
+// at most once per database. Never edit a released step: append a new one for later changes,
+// including new columns on models an earlier step already migrated.
+type Migration struct {
+	ID     string
+	Models []any
+	Run    func(tx *gorm.DB) error
+}
+
+// AppliedMigration is a row of schema_migrations
+type AppliedMigration struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// TableName pins the version table name
+func (AppliedMigration) TableName() string { return "schema_migrations" }
+
+var (
+	migrationsMu sync.Mutex
+	migrations   []Migration
+)
+
+// RegisterMigrations appends steps to the list Init runs, panicking on a duplicate ID since that
+// can only come from a programming error at init time
+func RegisterMigrations(ms ...Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	for _, m := range ms {
+		for _, have := range migrations {
+			if have.ID == m.ID {
+				panic("database: duplicate migration " + m.ID)
+			}
+		}
+		migrations = append(migrations, m)
+	}
+}
+
+// Migrations returns the registered steps in registration order
+func Migrations() []Migration {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	return append([]Migration(nil), migrations...)
+}
+
+// Migrate applies the steps of ms not yet recorded in schema_migrations, in order, stopping at
+// the first failure
+func Migrate(db *gorm.DB, ms ...Migration) error {
+	if err := db.AutoMigrate(&AppliedMigration{}); err != nil {
+		return fmt.Errorf("create schema_migrations failed: %w", err)
+	}
+	applied, err := AppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	done := make(map[string]bool, len(applied))
+	for _, a := range applied {
+		done[a.ID] = true
+	}
+	for _, m := range ms {
+		if done[m.ID] {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if len(m.Models) > 0 {
+				if err := tx.AutoMigrate(m.Models...); err != nil {
+					return err
+				}
+			}
+			if m.Run != nil {
+				if err := m.Run(tx); err != nil {
+					return err
+				}
+			}
+			return tx.Create(&AppliedMigration{ID: m.ID, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.ID, err)
+		}
+		done[m.ID] = true
+		logger.GetLogger().Info().Str("migration", m.ID).Msg("database migration applied")
+	}
+	return nil
+}
+
+// AppliedMigrations lists the recorded steps, oldest first
+func AppliedMigrations(db *gorm.DB) ([]AppliedMigration, error) {
+	var applied []AppliedMigration
+	if err := db.Order("applied_at, id").Find(&applied).Error; err != nil {
+		return nil, fmt.Errorf("read schema_migrations failed: %w", err)
+	}
+	return applied, nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Test that Migrate applies each step once, in order, and records it in schema_migrations
+func TestMigrateRunsOnceAndRecords(t *testing.T) {
+	ResetForTest()
+	tempDir := t.TempDir()
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("chdir failed: %v", err)
+	}
+
+	type Widget struct {
+		ID   int
+		Name string
+	}
+	var ran []string
+	steps := []Migration{
+		{ID: "0001_widgets", Models: []any{&Widget{}}},
+		{ID: "0002_seed", Run: func(tx *gorm.DB) error {
+			ran = append(ran, "0002_seed")
+			return tx.Create(&Widget{Name: "first"}).Error
+		}},
+	}
+	saved := Migrations()
+	migrations = nil
+	t.Cleanup(func() { migrations = saved })
+	RegisterMigrations(steps...)
+
+	db, err := Init("migrate.db")
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if err := Migrate(db, Migrations()...); err != nil {
+		t.Fatalf("second migrate failed: %v", err)
+	}
+	if len(ran) != 1 {
+		t.Fatalf("expected custom step to run once, ran %d times", len(ran))
+	}
+	var n int64
+	db.Model(&Widget{}).Count(&n)
+	if n != 1 {
+		t.Fatalf("expected 1 seeded widget, got %d", n)
+	}
+	applied, err := AppliedMigrations(db)
+	if err != nil {
+		t.Fatalf("applied: %v", err)
+	}
+	if len(applied) != 2 || applied[0].ID != "0001_widgets" || applied[1].ID != "0002_seed" {
+		t.Fatalf("unexpected applied migrations %+v", applied)
+	}
+
+	// a failing step is rolled back and not recorded, and later steps do not run
+	boom := errors.New("boom")
+	err = Migrate(db, Migration{ID: "0003_fail", Run: func(tx *gorm.DB) error {
+		if err := tx.Create(&Widget{Name: "partial"}).Error; err != nil {
+			return err
+		}
+		return boom
+	}}, Migration{ID: "0004_after", Run: func(*gorm.DB) error { t.Error("step after a failure ran"); return nil }})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected step error, got %v", err)
+	}
+	db.Model(&Widget{}).Count(&n)
+	if applied, _ := AppliedMigrations(db); n != 1 || len(applied) != 2 {
+		t.Fatalf("expected failed step rolled back, widgets=%d applied=%+v", n, applied)
+	}
+}
@@ -6,6 +6,6 @@ import "sync"
 
 // ResetForTest resets the internal singleton so tests can start with a clean state.
 func ResetForTest() {
-	instance = nil
+	instance.Store(nil)
 	once = sync.Once{}
 }
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+var (
+	modelsMu sync.Mutex
+	models   []any
+)
+
+// RegisterModels records models owned by a package so operator tooling can inspect their tables
+// without importing that package. Registering does not migrate anything.
+func RegisterModels(ms ...any) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	models = append(models, ms...)
+}
+
+// Models returns the registered models in registration order
+func Models() []any {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	return append([]any(nil), models...)
+}
+
+// Column is one row of PRAGMA table_info
+type Column struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	NotNull    bool   `json:"not_null"`
+	PrimaryKey bool   `json:"primary_key"`
+}
+
+// TableSchema describes a model's table as it exists on disk and what AutoMigrate would change.
+// Pending lists the changes in plain words; it is empty when the table is up to date.
+type TableSchema struct {
+	Model   string   `json:"model"`
+	Table   string   `json:"table"`
+	Exists  bool     `json:"exists"`
+	Columns []Column `json:"columns"`
+	Indexes []string `json:"indexes"`
+	Pending []string `json:"pending"`
+}
+
+// ErrSchemaUnsupported is returned by InspectSchema for databases other than sqlite
+var ErrSchemaUnsupported = errors.New("schema inspection is only supported on sqlite")
+
+// InspectSchema reads the sqlite schema of every model's table and diffs it against the model
+// definition. It is read-only: missing tables, columns and indexes are reported, not created.
+// Column type changes are not compared since sqlite's type affinity makes them mostly cosmetic.
+// Other drivers get ErrSchemaUnsupported, as the schema is read through sqlite pragmas.
+func InspectSchema(db *gorm.DB, ms ...any) ([]TableSchema, error) {
+	if db.Dialector.Name() != DriverSQLite {
+		return nil, ErrSchemaUnsupported
+	}
+	tables := make([]TableSchema, 0, len(ms))
+	for _, m := range ms {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return nil, fmt.Errorf("parse model %T: %w", m, err)
+		}
+		ts := TableSchema{
+			Model:   reflect.Indirect(reflect.ValueOf(m)).Type().Name(),
+			Table:   stmt.Schema.Table,
+			Columns: []Column{},
+			Indexes: []string{},
+			Pending: []string{},
+		}
+		if err := readTableInfo(db, &ts); err != nil {
+			return nil, err
+		}
+		if !ts.Exists {
+			ts.Pending = append(ts.Pending, "create table "+ts.Table)
+			tables = append(tables, ts)
+			continue
+		}
+		have := make(map[string]bool, len(ts.Columns))
+		for _, col := range ts.Columns {
+			have[col.Name] = true
+		}
+		for _, f := range stmt.Schema.Fields {
+			if f.DBName != "" && !have[f.DBName] {
+				ts.Pending = append(ts.Pending, "add column "+f.DBName)
+			}
+		}
+		haveIdx := make(map[string]bool, len(ts.Indexes))
+		for _, name := range ts.Indexes {
+			haveIdx[name] = true
+		}
+		for _, idx := range stmt.Schema.ParseIndexes() {
+			if !haveIdx[idx.Name] {
+				ts.Pending = append(ts.Pending, "create index "+idx.Name)
+			}
+		}
+		tables = append(tables, ts)
+	}
+	return tables, nil
+}
+
+// readTableInfo fills in the columns and index names of ts.Table via PRAGMA table_info/index_list
+func readTableInfo(db *gorm.DB, ts *TableSchema) error {
+	rows, err := db.Raw("SELECT name, type, \"notnull\", pk FROM pragma_table_info(?)", ts.Table).Rows()
+	if err != nil {
+		return fmt.Errorf("table_info %s: %w", ts.Table, err)
+	}
+	for rows.Next() {
+		var col Column
+		var notNull, pk int
+		if err := rows.Scan(&col.Name, &col.Type, &notNull, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		col.NotNull, col.PrimaryKey = notNull != 0, pk != 0
+		ts.Columns = append(ts.Columns, col)
+	}
+	rows.Close()
+	// pragma_table_info yields no rows for a missing table
+	ts.Exists = len(ts.Columns) > 0
+	if !ts.Exists {
+		return nil
+	}
+	// automatic indexes (sqlite_autoindex_*) back PRIMARY KEY/UNIQUE constraints, not model tags
+	return db.Raw("SELECT name FROM pragma_index_list(?) WHERE origin = 'c' ORDER BY name", ts.Table).Scan(&ts.Indexes).Error
+}
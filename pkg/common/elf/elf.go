@@ -1,6 +1,7 @@
 package elfutil
 
 import (
+	"bytes"
 	"debug/elf"
 	"encoding/json"
 	"fmt"
@@ -8,34 +9,48 @@ import (
 	"math"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 )
 
 // AnalyzeBytes analyzes ELF file metadata from raw bytes (if ELF magic present)
 func AnalyzeBytes(b []byte) (map[string]any, error) {
-	if len(b) < 4 || b[0] != 0x7f || b[1] != 'E' || b[2] != 'L' || b[3] != 'F' {
+	return AnalyzeReaderAt(bytes.NewReader(b), int64(len(b)))
+}
+
+// AnalyzeReaderAt analyzes an ELF image read through r, so large or stored objects need not be
+// copied into memory. Only the first size bytes of r are consulted.
+func AnalyzeReaderAt(r io.ReaderAt, size int64) (map[string]any, error) {
+	sr := io.NewSectionReader(r, 0, size)
+	magic := make([]byte, 4)
+	if n, _ := sr.ReadAt(magic, 0); n < 4 || magic[0] != 0x7f || magic[1] != 'E' || magic[2] != 'L' || magic[3] != 'F' {
 		return nil, fmt.Errorf("not elf")
 	}
-	tmp, err := os.CreateTemp("", "elf-*\n")
+	f, err := elf.NewFile(sr)
 	if err != nil {
 		return nil, err
 	}
-	defer os.Remove(tmp.Name())
-	if _, err := tmp.Write(b); err != nil {
-		tmp.Close()
-		return nil, err
-	}
-	tmp.Close()
-	return AnalyzeFile(tmp.Name())
+	defer f.Close()
+	return analyze(f, sr), nil
 }
 
 // AnalyzeFile opens an ELF file and extracts structured metadata.
 func AnalyzeFile(path string) (map[string]any, error) {
-	f, err := elf.Open(path)
+	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzeReaderAt(f, info.Size())
+}
+
+// analyze extracts structured metadata from an opened ELF file; src holds the raw image f was
+// parsed from, for figures computed over the whole file
+func analyze(f *elf.File, src *io.SectionReader) map[string]any {
 	m := map[string]any{}
 	m["class"] = f.Class.String()
 	m["endianness"] = f.ByteOrder.String()
@@ -66,13 +81,16 @@ func AnalyzeFile(path string) (map[string]any, error) {
 		phs = append(phs, map[string]any{
 			"type":   p.Type.String(),
 			"vaddr":  fmt.Sprintf("0x%x", p.Vaddr),
-			"memsz":  p.Memsz,
-			"filesz": p.Filesz,
+			"memsz":  u64(p.Memsz),
+			"filesz": u64(p.Filesz),
 			"flags":  flags,
-			"align":  p.Align,
+			"align":  u64(p.Align),
 		})
 	}
 	m["program_headers_detail"] = phs
+	if eb := entryBytes(f, entryBytesLen); len(eb) > 0 {
+		m["entry_bytes"] = fmt.Sprintf("%x", eb)
+	}
 	var interp string
 	var needed []string
 	var rpath, runpath, buildID string
@@ -84,20 +102,27 @@ func AnalyzeFile(path string) (map[string]any, error) {
 	}
 	// sections detail w/ flags & entropy (limited)
 	sections := make([]map[string]any, 0, len(f.Sections))
+	sectionSizes := make([]uint64, 0, len(f.Sections))
 	var textSize, rodataSize, dataSize, bssSize uint64
 	var debugSections []string
 	var hasSymtab bool
 	var hasTLSSection bool
 	var commentContent string
+	textEntropy := -1.0 // unknown: no .text, or too large to measure
 	for _, s := range f.Sections {
 		ent := interface{}(nil)
 		if (s.Name == ".text" || s.Name == ".rodata") && s.Size > 0 && s.Size < 4*1024*1024 { // cap for performance
 			if b, e := s.Data(); e == nil {
-				ent = fmt.Sprintf("%.4f", entropy(b))
+				e := entropy(b)
+				ent = fmt.Sprintf("%.4f", e)
+				if s.Name == ".text" {
+					textEntropy = e
+				}
 			}
 		}
 		flags := sectionFlags(s.Flags)
-		sections = append(sections, map[string]any{"name": s.Name, "size": s.Size, "type": s.Type.String(), "flags": flags, "entropy": ent})
+		sections = append(sections, map[string]any{"name": s.Name, "size": u64(s.Size), "type": s.Type.String(), "flags": flags, "entropy": ent})
+		sectionSizes = append(sectionSizes, s.Size)
 		if s.Name == ".text" {
 			textSize = s.Size
 		}
@@ -126,13 +151,19 @@ func AnalyzeFile(path string) (map[string]any, error) {
 		}
 	}
 	m["sections_detail"] = sections
-	m["section_sizes"] = map[string]any{"text": textSize, "rodata": rodataSize, "data": dataSize, "bss": bssSize}
+	m["section_sizes"] = map[string]any{"text": u64(textSize), "rodata": u64(rodataSize), "data": u64(dataSize), "bss": u64(bssSize)}
 	// top sections by size (descending)
-	top := make([]map[string]any, len(sections))
-	copy(top, sections)
-	sort.Slice(top, func(i, j int) bool { return top[i]["size"].(uint64) > top[j]["size"].(uint64) })
-	if len(top) > 10 {
-		top = top[:10]
+	order := make([]int, len(sections))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return sectionSizes[order[i]] > sectionSizes[order[j]] })
+	if len(order) > 10 {
+		order = order[:10]
+	}
+	top := make([]map[string]any, 0, len(order))
+	for _, i := range order {
+		top = append(top, sections[i])
 	}
 	m["top_sections"] = top
 	for _, sec := range f.Sections {
@@ -173,9 +204,12 @@ func AnalyzeFile(path string) (map[string]any, error) {
 	// symbol tables
 	var symCount, symExport, dynSymCount, dynSymExport int
 	var exportedFuncs []string
+	var canary bool
+	var imports int
 	if syms, err := f.Symbols(); err == nil {
 		symCount = len(syms)
 		for _, s := range syms {
+			canary = canary || s.Name == stackChkFail
 			if elf.ST_BIND(s.Info) == elf.STB_GLOBAL {
 				symExport++
 				if elf.ST_TYPE(s.Info) == elf.STT_FUNC {
@@ -189,6 +223,10 @@ func AnalyzeFile(path string) (map[string]any, error) {
 	if dsyms, err := f.DynamicSymbols(); err == nil {
 		dynSymCount = len(dsyms)
 		for _, s := range dsyms {
+			canary = canary || s.Name == stackChkFail
+			if s.Section == elf.SHN_UNDEF && s.Name != "" {
+				imports++
+			}
 			if elf.ST_BIND(s.Info) == elf.STB_GLOBAL {
 				dynSymExport++
 				if elf.ST_TYPE(s.Info) == elf.STT_FUNC {
@@ -200,24 +238,10 @@ func AnalyzeFile(path string) (map[string]any, error) {
 		}
 	}
 	m["symbols"] = map[string]any{"sym_total": symCount, "sym_exported": symExport, "dyn_total": dynSymCount, "dyn_exported": dynSymExport, "exported_funcs_sample": exportedFuncs}
-	// relocations count
-	var relCount int
-	for _, s := range f.Sections {
-		if s.Type == elf.SHT_RELA || s.Type == elf.SHT_REL {
-			if rels, e := s.Data(); e == nil { // rough count length/ entry guess
-				if s.Type == elf.SHT_RELA && f.Class == elf.ELFCLASS64 {
-					relCount += len(rels) / 24
-				} else if s.Type == elf.SHT_REL && f.Class == elf.ELFCLASS64 {
-					relCount += len(rels) / 16
-				} else if s.Type == elf.SHT_RELA && f.Class == elf.ELFCLASS32 {
-					relCount += len(rels) / 12
-				} else if s.Type == elf.SHT_REL && f.Class == elf.ELFCLASS32 {
-					relCount += len(rels) / 8
-				}
-			}
-		}
+	m["relocations"] = relocations(f)
+	if sv := symbolVersions(f); sv != nil {
+		m["symbol_versions"] = sv
 	}
-	m["relocations"] = map[string]any{"approx_total": relCount}
 	// derive compiler from comment
 	compiler := ""
 	if commentContent != "" {
@@ -269,9 +293,264 @@ func AnalyzeFile(path string) (map[string]any, error) {
 		"tls":         hasTLS,
 		"compiler":    compiler,
 		"libc":        libc,
+		"relro":       relroLevel(f),
+		"nx":          nxStack(f),
+		"canary":      canary,
+		"packed":      textEntropy > packedTextEntropy && interp != "" && imports <= packedMaxImports,
 	}
 	m["debug_info"] = map[string]any{"has": len(debugSections) > 0, "sections": debugSections}
-	return m, nil
+	m["entropy_overall"] = fmt.Sprintf("%.4f", readerEntropy(src))
+	return m
+}
+
+// Packer heuristic: compressed or encrypted code has near-random .text, and a packed dynamic
+// binary imports little beyond what its unpacking stub needs (typically dlopen/mmap-style calls).
+const (
+	packedTextEntropy = 7.2
+	packedMaxImports  = 8
+)
+
+// Wide values policy: JSON consumers decoding numbers as float64 (JavaScript in particular) lose
+// precision above 2^53, so 64-bit values never go out as JSON numbers. Addresses (entry, vaddr) are
+// "0x"-prefixed hex strings and sizes are decimal strings. NumericSizes restores numbers for
+// consumers that relied on the old shape; StringSizes upgrades analyses stored in that shape.
+
+// u64 formats a 64-bit size as a decimal string
+func u64(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
+
+// wideSizeKeys are the analysis keys holding 64-bit sizes formatted with u64
+var wideSizeKeys = map[string]bool{
+	"memsz": true, "filesz": true, "align": true, "size": true,
+	"text": true, "rodata": true, "data": true, "bss": true,
+}
+
+// NumericSizes rewrites analysis JSON so that size fields are JSON numbers again. Values are kept
+// as exact decimal literals; it is up to the consumer to decode them without precision loss.
+func NumericSizes(data []byte) ([]byte, error) {
+	return rewriteSizes(data, true)
+}
+
+// StringSizes rewrites analysis JSON so that size fields are decimal strings, bringing analyses
+// cached before this policy in line with fresh ones
+func StringSizes(data []byte) ([]byte, error) {
+	return rewriteSizes(data, false)
+}
+
+func rewriteSizes(data []byte, numeric bool) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(convertSizes(v, numeric))
+}
+
+func convertSizes(v any, numeric bool) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if wideSizeKeys[k] {
+				switch sv := val.(type) {
+				case string:
+					if _, err := strconv.ParseUint(sv, 10, 64); err == nil && numeric {
+						t[k] = json.Number(sv)
+						continue
+					}
+				case json.Number:
+					if _, err := strconv.ParseUint(sv.String(), 10, 64); err == nil && !numeric {
+						t[k] = sv.String()
+						continue
+					}
+				}
+			}
+			t[k] = convertSizes(val, numeric)
+		}
+	case []any:
+		for i := range t {
+			t[i] = convertSizes(t[i], numeric)
+		}
+	}
+	return v
+}
+
+// maxRelocTypes caps the distinct relocation types reported in relocations.by_type
+const maxRelocTypes = 32
+
+// relocations decodes every SHT_REL/SHT_RELA entry and tallies them by relocation type name.
+// Types beyond maxRelocTypes distinct names are counted under "other".
+func relocations(f *elf.File) map[string]any {
+	var total int
+	byType := map[string]int{}
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_RELA && s.Type != elf.SHT_REL {
+			continue
+		}
+		entsize := relocEntrySize(f.Class, s.Type)
+		if s.Entsize >= uint64(entsize) {
+			entsize = int(s.Entsize)
+		}
+		data, err := s.Data()
+		if err != nil || entsize == 0 {
+			continue
+		}
+		for off := 0; off+entsize <= len(data); off += entsize {
+			var typ uint32
+			// r_info follows r_offset in both Rel and Rela layouts
+			if f.Class == elf.ELFCLASS64 {
+				typ = elf.R_TYPE64(f.ByteOrder.Uint64(data[off+8:]))
+			} else {
+				typ = elf.R_TYPE32(f.ByteOrder.Uint32(data[off+4:]))
+			}
+			name := relocTypeName(f.Machine, typ)
+			if _, seen := byType[name]; !seen && len(byType) >= maxRelocTypes {
+				name = "other"
+			}
+			byType[name]++
+			total++
+		}
+	}
+	return map[string]any{"total": total, "by_type": byType}
+}
+
+// stackChkFail is the handler called on a smashed stack canary; linking it means some function
+// was compiled with -fstack-protector
+const stackChkFail = "__stack_chk_fail"
+
+// relroLevel reports "full" when a PT_GNU_RELRO segment is combined with eager binding
+// (DF_BIND_NOW, DF_1_NOW or DT_BIND_NOW), "partial" with the segment alone and "none" otherwise.
+// Unreadable dynamic entries count as lazy binding.
+func relroLevel(f *elf.File) string {
+	relro := false
+	for _, p := range f.Progs {
+		relro = relro || p.Type == elf.PT_GNU_RELRO
+	}
+	if !relro {
+		return "none"
+	}
+	if v, _ := f.DynValue(elf.DT_FLAGS); len(v) > 0 && v[0]&uint64(elf.DF_BIND_NOW) != 0 {
+		return "full"
+	}
+	if v, _ := f.DynValue(elf.DT_FLAGS_1); len(v) > 0 && v[0]&uint64(elf.DF_1_NOW) != 0 {
+		return "full"
+	}
+	if v, _ := f.DynValue(elf.DT_BIND_NOW); len(v) > 0 {
+		return "full"
+	}
+	return "partial"
+}
+
+// nxStack reports whether the stack is non-executable: a PT_GNU_STACK segment without PF_X.
+// Without that segment loaders traditionally fall back to an executable stack, so it is false.
+func nxStack(f *elf.File) bool {
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_GNU_STACK {
+			return p.Flags&elf.PF_X == 0
+		}
+	}
+	return false
+}
+
+// symbolVersions reports the GNU symbol versioning of a dynamic object: version_needs maps each
+// library to the versions required from it (.gnu.version_r) and version_defs lists the versions
+// the object defines (.gnu.version_d), without the base entry naming the object itself.
+// Returns nil when the object carries no version sections.
+func symbolVersions(f *elf.File) map[string]any {
+	needs, nerr := f.DynamicVersionNeeds()
+	defs, derr := f.DynamicVersions()
+	if nerr != nil && derr != nil {
+		return nil
+	}
+	versionNeeds := map[string][]string{}
+	for _, n := range needs {
+		for _, d := range n.Needs {
+			versionNeeds[n.Name] = append(versionNeeds[n.Name], d.Dep)
+		}
+	}
+	versionDefs := []string{}
+	for _, d := range defs {
+		if d.Flags&elf.VER_FLG_BASE == 0 {
+			versionDefs = append(versionDefs, d.Name)
+		}
+	}
+	if len(versionNeeds) == 0 && len(versionDefs) == 0 {
+		return nil
+	}
+	return map[string]any{"version_needs": versionNeeds, "version_defs": versionDefs}
+}
+
+// relocEntrySize returns the standard entry size for a relocation section of the given class
+func relocEntrySize(class elf.Class, typ elf.SectionType) int {
+	switch {
+	case class == elf.ELFCLASS64 && typ == elf.SHT_RELA:
+		return 24
+	case class == elf.ELFCLASS64 && typ == elf.SHT_REL:
+		return 16
+	case class == elf.ELFCLASS32 && typ == elf.SHT_RELA:
+		return 12
+	case class == elf.ELFCLASS32 && typ == elf.SHT_REL:
+		return 8
+	}
+	return 0
+}
+
+// relocTypeName names a relocation type for the common machines, "type_N" otherwise
+func relocTypeName(machine elf.Machine, typ uint32) string {
+	switch machine {
+	case elf.EM_X86_64:
+		return elf.R_X86_64(typ).String()
+	case elf.EM_386:
+		return elf.R_386(typ).String()
+	case elf.EM_AARCH64:
+		return elf.R_AARCH64(typ).String()
+	case elf.EM_ARM:
+		return elf.R_ARM(typ).String()
+	case elf.EM_PPC64:
+		return elf.R_PPC64(typ).String()
+	case elf.EM_PPC:
+		return elf.R_PPC(typ).String()
+	case elf.EM_RISCV:
+		return elf.R_RISCV(typ).String()
+	case elf.EM_S390:
+		return elf.R_390(typ).String()
+	case elf.EM_MIPS:
+		return elf.R_MIPS(typ).String()
+	case elf.EM_LOONGARCH:
+		return elf.R_LARCH(typ).String()
+	}
+	return "type_" + strconv.FormatUint(uint64(typ), 10)
+}
+
+// entryBytesLen is how many bytes at the entry point are reported (enough for a typical prologue)
+const entryBytesLen = 16
+
+// entryBytes returns up to n bytes at the entry virtual address, mapped through the loadable
+// segment (or executable section) containing it. Returns nil when the entry cannot be resolved.
+func entryBytes(f *elf.File, n int) []byte {
+	if f.Entry == 0 {
+		return nil
+	}
+	read := func(r io.ReaderAt, off, avail uint64) []byte {
+		if avail > uint64(n) {
+			avail = uint64(n)
+		}
+		buf := make([]byte, avail)
+		k, _ := r.ReadAt(buf, int64(off))
+		return buf[:k]
+	}
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD && f.Entry >= p.Vaddr && f.Entry < p.Vaddr+p.Filesz {
+			return read(p, f.Entry-p.Vaddr, p.Vaddr+p.Filesz-f.Entry)
+		}
+	}
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_EXECINSTR != 0 && s.Type != elf.SHT_NOBITS && f.Entry >= s.Addr && f.Entry < s.Addr+s.Size {
+			return read(s, f.Entry-s.Addr, s.Addr+s.Size-f.Entry)
+		}
+	}
+	return nil
 }
 
 // TryAnalyzeBytes returns JSON string if ELF else nil.
@@ -320,15 +599,39 @@ func align4(v int) int {
 	return v + (4 - v%4)
 }
 func entropy(b []byte) float64 {
-	if len(b) == 0 {
-		return 0
-	}
 	var freq [256]int
 	for _, by := range b {
 		freq[by]++
 	}
+	return shannon(&freq, len(b))
+}
+
+// readerEntropy is entropy over all of r, read in chunks so whole files need not be in memory
+func readerEntropy(r *io.SectionReader) float64 {
+	var freq [256]int
+	buf := make([]byte, 64*1024)
+	n := 0
+	for off := int64(0); ; {
+		k, err := r.ReadAt(buf, off)
+		for _, by := range buf[:k] {
+			freq[by]++
+		}
+		n += k
+		off += int64(k)
+		if err != nil || k == 0 {
+			break
+		}
+	}
+	return shannon(&freq, n)
+}
+
+// shannon returns the entropy in bits per byte of a byte histogram covering n bytes
+func shannon(freq *[256]int, n int) float64 {
+	if n == 0 {
+		return 0
+	}
 	var e float64
-	ln := float64(len(b))
+	ln := float64(n)
 	for _, c := range freq {
 		if c == 0 {
 			continue
@@ -1,9 +1,16 @@
 package elfutil
 
 import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"math/rand"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -118,3 +125,339 @@ func TestAnalyzeFile_PlatformStability(t *testing.T) {
 		t.Errorf("sections key missing in self analysis")
 	}
 }
+
+func TestAnalyzeFile_EntryBytes(t *testing.T) {
+	bin := elfSamplePath(t)
+	info, err := AnalyzeFile(bin)
+	if err != nil {
+		t.Fatalf("AnalyzeFile: %v", err)
+	}
+	eb, ok := info["entry_bytes"].(string)
+	if !ok || eb == "" {
+		t.Fatalf("entry_bytes missing or empty: %v", info["entry_bytes"])
+	}
+	if len(eb) != 2*entryBytesLen {
+		t.Errorf("expected %d hex chars, got %d (%s)", 2*entryBytesLen, len(eb), eb)
+	}
+	if _, err := hex.DecodeString(eb); err != nil {
+		t.Errorf("entry_bytes not valid hex: %v", err)
+	}
+}
+
+// buildWideELF returns a minimal ELF64 whose .bss section declares a size above 2^53
+func buildWideELF(t *testing.T, bssSize uint64) []byte {
+	t.Helper()
+	shstrtab := []byte("\x00.shstrtab\x00.bss\x00")
+	const ehsize, shentsize = 64, 64
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     uint64(ehsize + len(shstrtab)),
+		Ehsize:    ehsize,
+		Phentsize: 56,
+		Shentsize: shentsize,
+		Shnum:     3,
+		Shstrndx:  1,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	sections := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_STRTAB), Off: ehsize, Size: uint64(len(shstrtab)), Addralign: 1},
+		{Name: 11, Type: uint32(elf.SHT_NOBITS), Flags: uint64(elf.SHF_ALLOC | elf.SHF_WRITE), Addr: 0x400000, Size: bssSize, Addralign: 8},
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, hdr); err != nil {
+		t.Fatalf("write header: %v", err)
+	}
+	buf.Write(shstrtab)
+	if err := binary.Write(&buf, binary.LittleEndian, sections); err != nil {
+		t.Fatalf("write sections: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestAnalyzeBytes_WideSizesKeepPrecision(t *testing.T) {
+	const bss uint64 = 1<<60 + 1 // not representable as float64
+	info, err := AnalyzeBytes(buildWideELF(t, bss))
+	if err != nil {
+		t.Fatalf("AnalyzeBytes: %v", err)
+	}
+	b, _ := json.Marshal(info)
+
+	// a float64-based consumer (e.g. JavaScript) sees the exact value as a string
+	var generic map[string]any
+	if err := json.Unmarshal(b, &generic); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := strconv.FormatUint(bss, 10)
+	if got := generic["section_sizes"].(map[string]any)["bss"]; got != want {
+		t.Fatalf("section_sizes.bss=%v want %s", got, want)
+	}
+
+	// the numeric variant carries the exact literal as a JSON number
+	nb, err := NumericSizes(b)
+	if err != nil {
+		t.Fatalf("NumericSizes: %v", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(nb))
+	dec.UseNumber()
+	var numeric map[string]any
+	if err := dec.Decode(&numeric); err != nil {
+		t.Fatalf("decode numeric: %v", err)
+	}
+	got, ok := numeric["section_sizes"].(map[string]any)["bss"].(json.Number)
+	if !ok || got.String() != want {
+		t.Fatalf("numeric bss=%v want %s", numeric["section_sizes"], want)
+	}
+	if entry, _ := numeric["entry"].(string); !strings.HasPrefix(entry, "0x") {
+		t.Errorf("addresses should stay hex strings, got %v", numeric["entry"])
+	}
+
+	// and the numeric shape converts back to strings without losing digits
+	sb, err := StringSizes(nb)
+	if err != nil {
+		t.Fatalf("StringSizes: %v", err)
+	}
+	var restored map[string]any
+	if err := json.Unmarshal(sb, &restored); err != nil {
+		t.Fatalf("decode strings: %v", err)
+	}
+	if got := restored["section_sizes"].(map[string]any)["bss"]; got != want {
+		t.Fatalf("restored bss=%v want %s", got, want)
+	}
+}
+
+func TestAnalyzeReaderAt_MatchesBytes(t *testing.T) {
+	bin := elfSamplePath(t)
+	data, err := os.ReadFile(bin)
+	if err != nil {
+		t.Fatalf("read sample: %v", err)
+	}
+	fromBytes, err := AnalyzeBytes(data)
+	if err != nil {
+		t.Fatalf("AnalyzeBytes: %v", err)
+	}
+	f, err := os.Open(bin)
+	if err != nil {
+		t.Fatalf("open sample: %v", err)
+	}
+	defer f.Close()
+	fromReader, err := AnalyzeReaderAt(f, int64(len(data)))
+	if err != nil {
+		t.Fatalf("AnalyzeReaderAt: %v", err)
+	}
+	a, _ := json.Marshal(fromBytes)
+	b, _ := json.Marshal(fromReader)
+	if !bytes.Equal(a, b) {
+		t.Fatalf("reader-based analysis differs from bytes-based analysis")
+	}
+	if _, err := AnalyzeReaderAt(bytes.NewReader([]byte("not an elf")), 10); err == nil {
+		t.Errorf("expected error for non-ELF input")
+	}
+}
+
+// buildRelocELF returns a minimal ELF64 relocatable object with one .rela.text section
+func buildRelocELF(t *testing.T, relas []elf.Rela64) []byte {
+	t.Helper()
+	shstrtab := []byte("\x00.shstrtab\x00.rela.text\x00")
+	const ehsize, shentsize, relaSize = 64, 64, 24
+	relaOff := uint64(ehsize + len(shstrtab))
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_REL),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     relaOff + uint64(len(relas)*relaSize),
+		Ehsize:    ehsize,
+		Shentsize: shentsize,
+		Shnum:     3,
+		Shstrndx:  1,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	sections := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_STRTAB), Off: ehsize, Size: uint64(len(shstrtab)), Addralign: 1},
+		{Name: 11, Type: uint32(elf.SHT_RELA), Off: relaOff, Size: uint64(len(relas) * relaSize), Addralign: 8, Entsize: relaSize},
+	}
+	var buf bytes.Buffer
+	for _, v := range []any{hdr, shstrtab, relas, sections} {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestAnalyzeBytes_RelocationsExact(t *testing.T) {
+	relas := []elf.Rela64{
+		{Off: 0x10, Info: elf.R_INFO(1, uint32(elf.R_X86_64_PC32)), Addend: -4},
+		{Off: 0x20, Info: elf.R_INFO(2, uint32(elf.R_X86_64_PLT32)), Addend: -4},
+		{Off: 0x30, Info: elf.R_INFO(1, uint32(elf.R_X86_64_PC32)), Addend: -4},
+		{Off: 0x40, Info: elf.R_INFO(3, uint32(elf.R_X86_64_64))},
+	}
+	info, err := AnalyzeBytes(buildRelocELF(t, relas))
+	if err != nil {
+		t.Fatalf("AnalyzeBytes: %v", err)
+	}
+	rel := info["relocations"].(map[string]any)
+	if rel["total"] != 4 {
+		t.Fatalf("total=%v want 4", rel["total"])
+	}
+	want := map[string]int{"R_X86_64_PC32": 2, "R_X86_64_PLT32": 1, "R_X86_64_64": 1}
+	got := rel["by_type"].(map[string]int)
+	if len(got) != len(want) {
+		t.Fatalf("by_type=%v want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("by_type[%s]=%d want %d", k, got[k], v)
+		}
+	}
+}
+
+func TestAnalyzeFile_SymbolVersions(t *testing.T) {
+	bin := elfSamplePath(t)
+	info, err := AnalyzeFile(bin)
+	if err != nil {
+		t.Fatalf("AnalyzeFile: %v", err)
+	}
+	sv, ok := info["symbol_versions"].(map[string]any)
+	if !ok {
+		t.Fatalf("symbol_versions missing for %s", bin)
+	}
+	needs := sv["version_needs"].(map[string][]string)
+	if len(needs) == 0 {
+		t.Fatalf("version_needs empty: %v", sv)
+	}
+	if glibc, ok := needs["libc.so.6"]; ok {
+		found := false
+		for _, v := range glibc {
+			found = found || strings.HasPrefix(v, "GLIBC_")
+		}
+		if !found {
+			t.Errorf("libc.so.6 needs %v, want GLIBC_ entries", glibc)
+		}
+	}
+
+	// an object without version sections omits the key
+	info, err = AnalyzeBytes(buildRelocELF(t, nil))
+	if err != nil {
+		t.Fatalf("AnalyzeBytes: %v", err)
+	}
+	if _, ok := info["symbol_versions"]; ok {
+		t.Errorf("symbol_versions present without version sections: %v", info["symbol_versions"])
+	}
+}
+
+func TestAnalyzeFile_Hardening(t *testing.T) {
+	bin := elfSamplePath(t)
+	info, err := AnalyzeFile(bin)
+	if err != nil {
+		t.Fatalf("AnalyzeFile: %v", err)
+	}
+	chars := info["characteristics"].(map[string]any)
+	switch chars["relro"] {
+	case "none", "partial", "full":
+	default:
+		t.Errorf("relro=%v, want none/partial/full", chars["relro"])
+	}
+	for _, k := range []string{"nx", "canary"} {
+		if _, ok := chars[k].(bool); !ok {
+			t.Errorf("%s=%v, want a bool", k, chars[k])
+		}
+	}
+
+	// a bare object without program headers or symbols gets the conservative defaults
+	info, err = AnalyzeBytes(buildRelocELF(t, nil))
+	if err != nil {
+		t.Fatalf("AnalyzeBytes: %v", err)
+	}
+	chars = info["characteristics"].(map[string]any)
+	if chars["relro"] != "none" || chars["nx"] != false || chars["canary"] != false {
+		t.Errorf("bare object hardening relro=%v nx=%v canary=%v", chars["relro"], chars["nx"], chars["canary"])
+	}
+}
+
+// buildPackedELF returns a dynamically linked ELF64 executable (PT_INTERP, no imports) whose
+// .text holds text
+func buildPackedELF(t *testing.T, text []byte) []byte {
+	t.Helper()
+	const ehsize, phentsize, shentsize = 64, 56, 64
+	interp := []byte("/lib64/ld-linux-x86-64.so.2\x00")
+	shstrtab := []byte("\x00.shstrtab\x00.text\x00")
+	interpOff := uint64(ehsize + phentsize)
+	textOff := interpOff + uint64(len(interp))
+	strOff := textOff + uint64(len(text))
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     ehsize,
+		Shoff:     strOff + uint64(len(shstrtab)),
+		Ehsize:    ehsize,
+		Phentsize: phentsize,
+		Phnum:     1,
+		Shentsize: shentsize,
+		Shnum:     3,
+		Shstrndx:  1,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	progs := []elf.Prog64{{Type: uint32(elf.PT_INTERP), Flags: uint32(elf.PF_R), Off: interpOff, Filesz: uint64(len(interp)), Memsz: uint64(len(interp)), Align: 1}}
+	sections := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_STRTAB), Off: strOff, Size: uint64(len(shstrtab)), Addralign: 1},
+		{Name: 11, Type: uint32(elf.SHT_PROGBITS), Flags: uint64(elf.SHF_ALLOC | elf.SHF_EXECINSTR), Off: textOff, Size: uint64(len(text)), Addralign: 16},
+	}
+	var buf bytes.Buffer
+	for _, v := range []any{hdr, progs, interp, text, shstrtab, sections} {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestAnalyzeBytes_PackedHeuristic(t *testing.T) {
+	random := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+	info, err := AnalyzeBytes(buildPackedELF(t, random))
+	if err != nil {
+		t.Fatalf("AnalyzeBytes: %v", err)
+	}
+	if packed := info["characteristics"].(map[string]any)["packed"]; packed != true {
+		t.Errorf("random .text in a dynamic binary without imports should look packed, got %v", packed)
+	}
+	if overall, _ := strconv.ParseFloat(info["entropy_overall"].(string), 64); overall < 7.9 {
+		t.Errorf("entropy_overall=%v, want near 8 for random content", info["entropy_overall"])
+	}
+
+	// low-entropy code with the same layout is not flagged
+	info, err = AnalyzeBytes(buildPackedELF(t, bytes.Repeat([]byte{0x90, 0xc3}, 4096)))
+	if err != nil {
+		t.Fatalf("AnalyzeBytes: %v", err)
+	}
+	if packed := info["characteristics"].(map[string]any)["packed"]; packed != false {
+		t.Errorf("repetitive .text flagged as packed")
+	}
+
+	bin := elfSamplePath(t)
+	info, err = AnalyzeFile(bin)
+	if err != nil {
+		t.Fatalf("AnalyzeFile: %v", err)
+	}
+	if packed := info["characteristics"].(map[string]any)["packed"]; packed != false {
+		t.Errorf("%s flagged as packed", bin)
+	}
+	if overall, err := strconv.ParseFloat(info["entropy_overall"].(string), 64); err != nil || overall <= 0 || overall > 8 {
+		t.Errorf("entropy_overall=%v out of range", info["entropy_overall"])
+	}
+}
@@ -1,9 +1,11 @@
 package file
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/hex"
 	"net/http"
+	"unicode/utf8"
 
 	"github.com/gabriel-vasile/mimetype"
 )
@@ -28,3 +30,63 @@ func DetectMIME(data []byte, filename string) string {
 	}
 	return "application/octet-stream"
 }
+
+// DetectEncoding guesses the character encoding of text content.
+// A byte order mark wins outright; otherwise valid UTF-8 is reported as "utf-8", a high share of
+// NUL bytes in alternating positions as UTF-16, and anything else falls back to "iso-8859-1".
+// The returned confidence is in the range [0,1].
+func DetectEncoding(data []byte) (charset string, confidence float64) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8", 1
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return "utf-16be", 1
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return "utf-16le", 1
+	}
+	if len(data) == 0 {
+		return "utf-8", 0
+	}
+	// UTF-16 without BOM: ASCII-range text leaves every other byte zero
+	var evenZero, oddZero int
+	for i, b := range data {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenZero++
+		} else {
+			oddZero++
+		}
+	}
+	half := float64(len(data)) / 2
+	if r := float64(oddZero) / half; r > 0.4 && evenZero == 0 {
+		return "utf-16le", min(r, 0.9)
+	}
+	if r := float64(evenZero) / half; r > 0.4 && oddZero == 0 {
+		return "utf-16be", min(r, 0.9)
+	}
+	if utf8.Valid(trimPartialRune(data)) {
+		for _, b := range data {
+			if b >= utf8.RuneSelf {
+				return "utf-8", 1
+			}
+		}
+		// pure ASCII is also valid UTF-8, but carries no distinguishing evidence
+		return "utf-8", 0.9
+	}
+	return "iso-8859-1", 0.5
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence at the end of a (possibly truncated) sample.
+func trimPartialRune(data []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return data
+}
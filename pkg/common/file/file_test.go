@@ -37,3 +37,32 @@ func TestDetectMIME(t *testing.T) {
 		}
 	}
 }
+
+func TestDetectEncoding(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   []byte
+		expect string
+	}{
+		{"utf8", []byte("héllo wörld — ünïcode"), "utf-8"},
+		{"ascii", []byte("plain ascii text"), "utf-8"},
+		{"utf16le-bom", []byte{0xFF, 0xFE, 'h', 0, 'i', 0}, "utf-16le"},
+		{"utf16be-bom", []byte{0xFE, 0xFF, 0, 'h', 0, 'i'}, "utf-16be"},
+		{"utf16le-nobom", []byte{'h', 0, 'e', 0, 'l', 0, 'l', 0, 'o', 0}, "utf-16le"},
+		{"latin1", []byte{'c', 'a', 'f', 0xE9, ' ', 0xE0, ' ', 'l', 'a'}, "iso-8859-1"},
+	}
+	for _, c := range cases {
+		charset, conf := DetectEncoding(c.data)
+		if charset != c.expect {
+			t.Fatalf("%s: charset got=%s expected=%s", c.name, charset, c.expect)
+		}
+		if conf <= 0 || conf > 1 {
+			t.Fatalf("%s: confidence out of range: %f", c.name, conf)
+		}
+	}
+	// truncated multi-byte rune at the end of a sample must not flip detection
+	sample := []byte("naïve")
+	if charset, _ := DetectEncoding(sample[:3]); charset != "utf-8" {
+		t.Fatalf("truncated sample detected as %s", charset)
+	}
+}
@@ -1,9 +1,16 @@
 package fs
 
 import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
 	"go4pack/pkg/common/compress"
 
@@ -18,6 +25,58 @@ type FileSystem struct {
 	compressor  compress.Compressor
 }
 
+var (
+	defaultMu         sync.RWMutex
+	defaultCompressor compress.Compressor
+)
+
+// SetDefaultCompressor sets the compressor used by filesystems created without an explicit one
+// (nil restores compress.NewDefaultCompressor)
+func SetDefaultCompressor(c compress.Compressor) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultCompressor = c
+}
+
+// DefaultCompressor returns the compressor used by New and NewWithBasePath
+func DefaultCompressor() compress.Compressor {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	if defaultCompressor != nil {
+		return defaultCompressor
+	}
+	return compress.NewDefaultCompressor()
+}
+
+var incompressible []string
+
+// SetIncompressibleMIMETypes sets the MIME types (entries ending in "/" match a whole family)
+// whose content is stored as-is because compressing it gains next to nothing, e.g. JPEG or MP4.
+// nil disables the check, leaving only already gzip/zstd-compressed data uncompressed.
+func SetIncompressibleMIMETypes(types []string) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	incompressible = append([]string(nil), types...)
+}
+
+// IsIncompressibleMIME reports whether mime (parameters such as charset are ignored) is in the
+// incompressible set
+func IsIncompressibleMIME(mime string) bool {
+	mime, _, _ = strings.Cut(mime, ";")
+	mime = strings.ToLower(strings.TrimSpace(mime))
+	if mime == "" {
+		return false
+	}
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	for _, t := range incompressible {
+		if t == mime || strings.HasSuffix(t, "/") && strings.HasPrefix(mime, t) {
+			return true
+		}
+	}
+	return false
+}
+
 // New creates a new filesystem instance with runtime directory management
 func New() (*FileSystem, error) {
 	return NewWithBasePath(".")
@@ -25,7 +84,7 @@ func New() (*FileSystem, error) {
 
 // NewWithBasePath creates a new filesystem instance with custom base path
 func NewWithBasePath(basePath string) (*FileSystem, error) {
-	return NewWithBasePathAndCompression(basePath, compress.NewDefaultCompressor())
+	return NewWithBasePathAndCompression(basePath, DefaultCompressor())
 }
 
 // NewWithCompression creates a new filesystem instance with custom compression
@@ -92,9 +151,10 @@ func (fsys *FileSystem) WriteObject(filename string, data []byte) error {
 	return afero.WriteFile(fsys.fs, objectPath, compressedData, 0644)
 }
 
-// WriteObjectWithMIME writes data, skipping compression if already compressed per magic or MIME.
+// WriteObjectWithMIME writes data, skipping compression if already compressed per magic or MIME,
+// or if the MIME type is incompressible (see SetIncompressibleMIMETypes).
 func (fsys *FileSystem) WriteObjectWithMIME(filename string, data []byte, mime string) error {
-	if ct := compress.IsCompressedOrMIME(data, mime); ct != compress.None {
+	if ct := compress.IsCompressedOrMIME(data, mime); ct != compress.None || IsIncompressibleMIME(mime) {
 		objectPath := filepath.Join(fsys.objectsPath, filename)
 		return afero.WriteFile(fsys.fs, objectPath, data, 0644)
 	}
@@ -123,7 +183,8 @@ func (fsys *FileSystem) DeleteObject(filename string) error {
 	return fsys.fs.Remove(objectPath)
 }
 
-// ListObjects lists all files in the objects directory
+// ListObjects lists the files directly inside the objects directory. Content-addressed objects
+// live in two-level shards below it; use WalkObjects or ListHashedObjects for those.
 func (fsys *FileSystem) ListObjects() ([]string, error) {
 	entries, err := afero.ReadDir(fsys.fs, fsys.objectsPath)
 	if err != nil {
@@ -276,9 +337,10 @@ func (fsys *FileSystem) WriteObjectHashed(hash string, data []byte) error {
 	return afero.WriteFile(fsys.fs, p, compressedData, 0644)
 }
 
-// WriteObjectHashedWithMIME hashed write with MIME-aware double compression avoidance.
+// WriteObjectHashedWithMIME hashed write with MIME-aware double compression avoidance; data of an
+// incompressible MIME type is stored raw as well.
 func (fsys *FileSystem) WriteObjectHashedWithMIME(hash string, data []byte, mime string) error {
-	if ct := compress.IsCompressedOrMIME(data, mime); ct != compress.None {
+	if ct := compress.IsCompressedOrMIME(data, mime); ct != compress.None || IsIncompressibleMIME(mime) {
 		return fsys.WriteObjectHashedRaw(hash, data)
 	}
 	return fsys.WriteObjectHashed(hash, data)
@@ -321,6 +383,145 @@ func (fsys *FileSystem) ReadObjectHashed(hash string) ([]byte, error) {
 	return fsys.safeDecompress(compressedData)
 }
 
+// ReadObjectHashedRaw returns the stored bytes of a hashed object as they are on disk, without
+// decompressing them.
+func (fsys *FileSystem) ReadObjectHashedRaw(hash string) ([]byte, error) {
+	return afero.ReadFile(fsys.fs, fsys.hashedPath(hash))
+}
+
+// OpenObjectHashedRaw opens a hashed object for streaming its on-disk bytes, without decompressing
+func (fsys *FileSystem) OpenObjectHashedRaw(hash string) (io.ReadSeekCloser, error) {
+	return fsys.fs.Open(fsys.hashedPath(hash))
+}
+
+// WalkObjects calls fn for every stored hashed object (objects/<hash[:2]>/<hash>), skipping
+// upload temp files and any other entries that are not content-addressed objects. Walking
+// stops at the first error returned by fn, which is passed back to the caller; returning
+// filepath.SkipAll stops early without an error.
+func (fsys *FileSystem) WalkObjects(fn func(hash string, info os.FileInfo) error) error {
+	shards, err := afero.ReadDir(fsys.fs, fsys.objectsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, shard := range shards {
+		if !shard.IsDir() || len(shard.Name()) != 2 || !isHex(shard.Name()) {
+			continue
+		}
+		entries, err := afero.ReadDir(fsys.fs, filepath.Join(fsys.objectsPath, shard.Name()))
+		if err != nil {
+			return err
+		}
+		for _, info := range entries {
+			name := info.Name()
+			if !info.Mode().IsRegular() || !strings.HasPrefix(name, shard.Name()) || !isHex(name) {
+				continue
+			}
+			if err := fn(name, info); err != nil {
+				if err == filepath.SkipAll {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListHashedObjects returns the keys of every stored hashed object (see WalkObjects), sorted
+func (fsys *FileSystem) ListHashedObjects() ([]string, error) {
+	keys := []string{}
+	err := fsys.WalkObjects(func(key string, _ os.FileInfo) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hashed objects: %w", err)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// ObjectReader gives random access to the original (decompressed) bytes of a stored object
+type ObjectReader interface {
+	io.ReaderAt
+	io.Closer
+	// Size returns the original object size
+	Size() int64
+}
+
+type objectReader struct {
+	afero.File
+	size    int64
+	cleanup func()
+}
+
+func (o *objectReader) Size() int64 { return o.size }
+
+func (o *objectReader) Close() error {
+	err := o.File.Close()
+	if o.cleanup != nil {
+		o.cleanup()
+	}
+	return err
+}
+
+// OpenObjectHashed opens a hashed object for random access without loading it into memory.
+// Objects stored as-is are read directly; compressed ones are stream-decompressed into a temp
+// file under the runtime temp dir, which is removed on Close.
+func (fsys *FileSystem) OpenObjectHashed(hash string) (ObjectReader, error) {
+	f, err := fsys.fs.Open(fsys.hashedPath(hash))
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, 4)
+	n, _ := f.ReadAt(head, 0)
+	ct := compress.IsCompressed(head[:n])
+	if ct == compress.None {
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &objectReader{File: f, size: info.Size()}, nil
+	}
+	defer f.Close()
+	dir := filepath.Join(fsys.runtimePath, "temp")
+	if err := fsys.fs.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	tmp, err := afero.TempFile(fsys.fs, dir, "obj-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp: %w", err)
+	}
+	remove := func() { _ = fsys.fs.Remove(tmp.Name()) }
+	rc, err := compress.NewReader(ct, f)
+	if err != nil {
+		tmp.Close()
+		remove()
+		return nil, fmt.Errorf("open %s stream: %w", ct, err)
+	}
+	size, err := io.Copy(tmp, rc)
+	rc.Close()
+	if err != nil {
+		tmp.Close()
+		remove()
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+	return &objectReader{File: tmp, size: size, cleanup: remove}, nil
+}
+
 // GetHashedObjectSize returns compressed size of hashed object.
 func (fsys *FileSystem) GetHashedObjectSize(hash string) (int64, error) {
 	p := fsys.hashedPath(hash)
@@ -331,6 +532,149 @@ func (fsys *FileSystem) GetHashedObjectSize(hash string) (int64, error) {
 	return info.Size(), nil
 }
 
+// GetOriginalObjectSizeFast returns the uncompressed size of a hashed object from the size its
+// compressed stream declares, falling back to full decompression when none is recorded.
+func (fsys *FileSystem) GetOriginalObjectSizeFast(hash string) (int64, error) {
+	f, err := fsys.fs.Open(fsys.hashedPath(hash))
+	if err != nil {
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		if n, ok := compress.ContentSize(f, info.Size()); ok {
+			f.Close()
+			return n, nil
+		}
+	}
+	f.Close()
+	data, err := fsys.ReadObjectHashed(hash)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+// ReadHashedObjectHead returns up to n leading bytes of a hashed object as stored on disk
+func (fsys *FileSystem) ReadHashedObjectHead(hash string, n int) ([]byte, error) {
+	f, err := fsys.fs.Open(fsys.hashedPath(hash))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, n)
+	read, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+// DeleteObjectHashed removes a content-addressed object.
+func (fsys *FileSystem) DeleteObjectHashed(hash string) error {
+	return fsys.fs.Remove(fsys.hashedPath(hash))
+}
+
+// GCOrphans deletes every hashed object (objects/<hash[:2]>/<hash>) whose name is not in
+// referenced and reports how many were removed and the bytes reclaimed. Temp files and other
+// entries outside the two-level layout are never touched (see WalkObjects).
+func (fsys *FileSystem) GCOrphans(referenced map[string]struct{}) (removed int, freed int64, err error) {
+	var orphans []string
+	sizes := make(map[string]int64)
+	if err := fsys.WalkObjects(func(hash string, info os.FileInfo) error {
+		if _, ok := referenced[hash]; !ok {
+			orphans = append(orphans, hash)
+			sizes[hash] = info.Size()
+		}
+		return nil
+	}); err != nil {
+		return 0, 0, err
+	}
+	for _, hash := range orphans {
+		if err := fsys.DeleteObjectHashed(hash); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return removed, freed, fmt.Errorf("delete orphan %s: %w", hash, err)
+		}
+		removed++
+		freed += sizes[hash]
+	}
+	return removed, freed, nil
+}
+
+// VerifyAllHashed re-hashes every stored object and returns the keys whose content no longer
+// matches the MD5 their name carries (the first 32 hex digits; salted keys append random hex).
+// Uploads key objects by the MD5 of the bytes they were given: objects this package compressed
+// therefore match once decompressed, while already-compressed uploads stored as-is match their
+// on-disk bytes, so either digest is accepted. An object that fails to decompress or cannot be
+// read counts as corrupt, and the walk goes on; keys too short to carry an MD5 are not checked.
+// Only a failure listing the store returns an error.
+func (fsys *FileSystem) VerifyAllHashed() ([]string, error) {
+	corrupt := []string{}
+	err := fsys.WalkObjects(func(key string, _ os.FileInfo) error {
+		if len(key) < md5.Size*2 {
+			return nil
+		}
+		if ok, err := fsys.verifyHashed(key); err != nil || !ok {
+			corrupt = append(corrupt, key)
+		}
+		return nil
+	})
+	return corrupt, err
+}
+
+// verifyHashed streams one object, comparing its stored and (when compressed) decompressed MD5
+// against the key
+func (fsys *FileSystem) verifyHashed(key string) (bool, error) {
+	want := strings.ToLower(key[:md5.Size*2])
+	f, err := fsys.fs.Open(fsys.hashedPath(key))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, 4)
+	n, _ := f.ReadAt(head, 0)
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, err
+	}
+	if hex.EncodeToString(h.Sum(nil)) == want {
+		return true, nil
+	}
+	ct := compress.IsCompressed(head[:n])
+	if ct == compress.None {
+		return false, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	rc, err := compress.NewReader(ct, f)
+	if err != nil {
+		return false, nil
+	}
+	defer rc.Close()
+	h.Reset()
+	if _, err := io.Copy(h, rc); err != nil {
+		return false, nil
+	}
+	return hex.EncodeToString(h.Sum(nil)) == want, nil
+}
+
+// HashedObjectExists checks whether a content-addressed object is already stored.
+func (fsys *FileSystem) HashedObjectExists(hash string) (bool, error) {
+	return afero.Exists(fsys.fs, fsys.hashedPath(hash))
+}
+
+// SaltedKey returns a storage key for hash that no other object shares: the hash followed by
+// random hex. It lives in the same shard as hash, so the hashed helpers accept it unchanged.
+func SaltedKey(hash string) (string, error) {
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate salt: %w", err)
+	}
+	return hash + hex.EncodeToString(salt), nil
+}
+
 // HashedObjectPath returns the filesystem path where a given hash would be stored.
 func (fsys *FileSystem) HashedObjectPath(hash string) string { return fsys.hashedPath(hash) }
 
@@ -1,10 +1,18 @@
 package fs
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
+	"github.com/spf13/afero"
+
 	"go4pack/pkg/common/compress"
 )
 
@@ -623,6 +631,22 @@ func TestNewWithCompression(t *testing.T) {
 	}
 }
 
+func TestSetDefaultCompressor(t *testing.T) {
+	SetDefaultCompressor(compress.NewGzipCompressor(5))
+	t.Cleanup(func() { SetDefaultCompressor(nil) })
+	fsys, err := NewWithBasePath(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create filesystem: %v", err)
+	}
+	if fsys.GetCompressor().Type() != compress.Gzip {
+		t.Errorf("Expected configured gzip compressor, got %v", fsys.GetCompressor().Type())
+	}
+	SetDefaultCompressor(nil)
+	if DefaultCompressor().Type() != compress.Zstd {
+		t.Errorf("Expected zstd after reset, got %v", DefaultCompressor().Type())
+	}
+}
+
 func TestCompressionInWriteAndRead(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -694,3 +718,345 @@ func TestCompressionWithDirectories(t *testing.T) {
 		t.Errorf("Expected %s, got %s", string(testData), string(readData))
 	}
 }
+
+func TestHashedObjectExists(t *testing.T) {
+	tempDir := t.TempDir()
+	fsys, err := NewWithBasePath(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create filesystem: %v", err)
+	}
+	hash := "0123456789abcdef0123456789abcdef"
+	if exists, err := fsys.HashedObjectExists(hash); err != nil || exists {
+		t.Fatalf("Expected hashed object to not exist (exists=%v err=%v)", exists, err)
+	}
+	if err := fsys.WriteObjectHashed(hash, []byte("hashed data")); err != nil {
+		t.Fatalf("Failed to write hashed object: %v", err)
+	}
+	if exists, err := fsys.HashedObjectExists(hash); err != nil || !exists {
+		t.Fatalf("Expected hashed object to exist (exists=%v err=%v)", exists, err)
+	}
+}
+
+func TestGetOriginalObjectSizeFast(t *testing.T) {
+	tempDir := t.TempDir()
+	fsys, err := NewWithBasePath(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create filesystem: %v", err)
+	}
+	data := bytes.Repeat([]byte("fast size from the zstd frame header "), 4096)
+	hash := "aa23456789abcdef0123456789abcdef"
+	if err := fsys.WriteObjectHashed(hash, data); err != nil {
+		t.Fatalf("Failed to write hashed object: %v", err)
+	}
+	f, err := os.Open(fsys.HashedObjectPath(hash))
+	if err != nil {
+		t.Fatalf("open object: %v", err)
+	}
+	info, _ := f.Stat()
+	declared, ok := compress.ContentSize(f, info.Size())
+	f.Close()
+	if !ok || declared != int64(len(data)) {
+		t.Fatalf("zstd frame declared %d (ok=%v), want %d", declared, ok, len(data))
+	}
+	if n, err := fsys.GetOriginalObjectSizeFast(hash); err != nil || n != int64(len(data)) {
+		t.Fatalf("fast size %d err=%v, want %d", n, err, len(data))
+	}
+
+	// gzip objects are stored as-is; ISIZE is used because the stream is far below 4GiB/1032,
+	// larger streams (whose ISIZE may have wrapped modulo 2^32) fall back to decompression
+	gz, err := compress.CompressWithType(data, compress.Gzip)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	gzHash := "bb23456789abcdef0123456789abcdef"
+	if err := fsys.WriteObjectHashed(gzHash, gz); err != nil {
+		t.Fatalf("Failed to write gzip object: %v", err)
+	}
+	if n, err := fsys.GetOriginalObjectSizeFast(gzHash); err != nil || n != int64(len(data)) {
+		t.Fatalf("gzip fast size %d err=%v, want %d", n, err, len(data))
+	}
+	if n, ok := compress.ContentSize(bytes.NewReader(gz), int64(len(gz))); !ok || n != int64(len(data)) {
+		t.Errorf("single-member gzip: ISIZE %d (ok=%v), want %d", n, ok, len(data))
+	}
+	if _, ok := compress.ContentSize(bytes.NewReader(gz), 5<<20); ok {
+		t.Errorf("gzip ISIZE should not be trusted for streams that may exceed 4GiB")
+	}
+
+	// concatenated members: ISIZE covers only the last one, so the size is decoded instead
+	tail, _ := compress.CompressWithType([]byte("second member"), compress.Gzip)
+	multi := append(append([]byte{}, gz...), tail...)
+	if _, ok := compress.ContentSize(bytes.NewReader(multi), int64(len(multi))); ok {
+		t.Errorf("gzip ISIZE should not be trusted for multi-member streams")
+	}
+	multiHash := "dd23456789abcdef0123456789abcdef"
+	if err := fsys.WriteObjectHashed(multiHash, multi); err != nil {
+		t.Fatalf("Failed to write multi-member object: %v", err)
+	}
+	if n, err := fsys.GetOriginalObjectSizeFast(multiHash); err != nil || n != int64(len(data))+13 {
+		t.Fatalf("multi-member size %d err=%v, want %d", n, err, len(data)+13)
+	}
+}
+
+func TestOpenObjectHashed(t *testing.T) {
+	tempDir := t.TempDir()
+	fsys, err := NewWithBasePath(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create filesystem: %v", err)
+	}
+	data := bytes.Repeat([]byte("random access into a compressed object "), 2048)
+	hash := "cc23456789abcdef0123456789abcdef"
+	if err := fsys.WriteObjectHashed(hash, data); err != nil {
+		t.Fatalf("Failed to write hashed object: %v", err)
+	}
+	obj, err := fsys.OpenObjectHashed(hash)
+	if err != nil {
+		t.Fatalf("OpenObjectHashed: %v", err)
+	}
+	if obj.Size() != int64(len(data)) {
+		t.Errorf("size %d want %d", obj.Size(), len(data))
+	}
+	buf := make([]byte, 64)
+	if _, err := obj.ReadAt(buf, 1000); err != nil || !bytes.Equal(buf, data[1000:1064]) {
+		t.Errorf("ReadAt mismatch (err=%v)", err)
+	}
+	if err := obj.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(fsys.GetRuntimePath(), "temp"))
+	if len(entries) != 0 {
+		t.Errorf("expected decompressed temp file to be removed, found %d entries", len(entries))
+	}
+}
+
+func TestWalkObjects(t *testing.T) {
+	tempDir := t.TempDir()
+	fsys, err := NewWithBasePath(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create filesystem: %v", err)
+	}
+	want := map[string]bool{
+		"0a23456789abcdef0123456789abcdef": true,
+		"0a99999999abcdef0123456789abcdef": true,
+		"ff23456789abcdef0123456789abcdef": true,
+	}
+	for hash := range want {
+		if err := fsys.WriteObjectHashed(hash, []byte("object "+hash)); err != nil {
+			t.Fatalf("write %s: %v", hash, err)
+		}
+	}
+	// temps and sidecars that must be ignored
+	objects := fsys.GetObjectsPath()
+	_ = os.WriteFile(filepath.Join(objects, "up-12345"), []byte("temp"), 0644)
+	_ = os.WriteFile(filepath.Join(objects, "0a", "0a23456789abcdef0123456789abcdef.json"), []byte("{}"), 0644)
+	_ = os.MkdirAll(filepath.Join(objects, "tmp"), 0755)
+
+	seen := map[string]bool{}
+	if err := fsys.WalkObjects(func(hash string, info os.FileInfo) error {
+		seen[hash] = true
+		if info.Size() == 0 {
+			t.Errorf("%s: empty info", hash)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("WalkObjects: %v", err)
+	}
+	if len(seen) != len(want) {
+		t.Fatalf("saw %v, want %v", seen, want)
+	}
+	for hash := range want {
+		if !seen[hash] {
+			t.Errorf("missing %s", hash)
+		}
+	}
+
+	keys, err := fsys.ListHashedObjects()
+	if err != nil {
+		t.Fatalf("ListHashedObjects: %v", err)
+	}
+	if !slices.Equal(keys, []string{"0a23456789abcdef0123456789abcdef", "0a99999999abcdef0123456789abcdef", "ff23456789abcdef0123456789abcdef"}) {
+		t.Errorf("ListHashedObjects = %v", keys)
+	}
+	if top, _ := fsys.ListObjects(); !slices.Equal(top, []string{"up-12345"}) {
+		t.Errorf("ListObjects should only see top-level files, got %v", top)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	if err := fsys.WalkObjects(func(string, os.FileInfo) error { calls++; return stop }); err != stop || calls != 1 {
+		t.Errorf("early termination: err=%v calls=%d", err, calls)
+	}
+	calls = 0
+	if err := fsys.WalkObjects(func(string, os.FileInfo) error { calls++; return filepath.SkipAll }); err != nil || calls != 1 {
+		t.Errorf("SkipAll: err=%v calls=%d", err, calls)
+	}
+}
+
+func TestIncompressibleMIMEStoredRaw(t *testing.T) {
+	fsys, err := NewWithBasePath(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create filesystem: %v", err)
+	}
+	SetIncompressibleMIMETypes([]string{"image/jpeg", "video/"})
+	t.Cleanup(func() { SetIncompressibleMIMETypes(nil) })
+
+	for mime, want := range map[string]bool{"image/jpeg": true, "IMAGE/JPEG; q=1": true, "video/mp4": true, "image/png": false, "text/plain": false, "": false} {
+		if got := IsIncompressibleMIME(mime); got != want {
+			t.Errorf("IsIncompressibleMIME(%q)=%v, want %v", mime, got, want)
+		}
+	}
+	content := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte("jpeg"), 256)...)
+	if err := fsys.WriteObjectHashedWithMIME("aa11", content, "image/jpeg"); err != nil {
+		t.Fatalf("write jpeg: %v", err)
+	}
+	if raw, _ := fsys.ReadObjectHashedRaw("aa11"); !bytes.Equal(raw, content) {
+		t.Fatalf("expected incompressible object stored as-is (%d bytes on disk, %d original)", len(raw), len(content))
+	}
+	if err := fsys.WriteObjectHashedWithMIME("bb22", content, "text/plain"); err != nil {
+		t.Fatalf("write text: %v", err)
+	}
+	if raw, _ := fsys.ReadObjectHashedRaw("bb22"); bytes.Equal(raw, content) {
+		t.Fatal("expected compressible object to be compressed")
+	}
+}
+
+func TestGCOrphans(t *testing.T) {
+	tempDir := t.TempDir()
+	fsys, err := NewWithBasePath(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create filesystem: %v", err)
+	}
+	kept := "0a23456789abcdef0123456789abcdef"
+	orphans := []string{"0a99999999abcdef0123456789abcdef", "ff23456789abcdef0123456789abcdef"}
+	for _, hash := range append([]string{kept}, orphans...) {
+		if err := fsys.WriteObjectHashed(hash, []byte("object "+hash)); err != nil {
+			t.Fatalf("write %s: %v", hash, err)
+		}
+	}
+	var wantFreed int64
+	for _, hash := range orphans {
+		size, _ := fsys.GetHashedObjectSize(hash)
+		wantFreed += size
+	}
+	// temp files are never garbage, wherever they sit
+	objects := fsys.GetObjectsPath()
+	temps := []string{
+		filepath.Join(objects, "up-12345"),
+		filepath.Join(objects, "upc-67890"),
+		filepath.Join(objects, "ff", "up-abc"),
+	}
+	for _, p := range temps {
+		if err := os.WriteFile(p, []byte("temp"), 0644); err != nil {
+			t.Fatalf("write temp: %v", err)
+		}
+	}
+
+	removed, freed, err := fsys.GCOrphans(map[string]struct{}{kept: {}})
+	if err != nil {
+		t.Fatalf("GCOrphans: %v", err)
+	}
+	if removed != len(orphans) || freed != wantFreed {
+		t.Fatalf("removed=%d freed=%d, want %d and %d", removed, freed, len(orphans), wantFreed)
+	}
+	for _, hash := range orphans {
+		if exists, _ := fsys.HashedObjectExists(hash); exists {
+			t.Errorf("orphan %s survived", hash)
+		}
+	}
+	if exists, _ := fsys.HashedObjectExists(kept); !exists {
+		t.Errorf("referenced object %s was removed", kept)
+	}
+	for _, p := range temps {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("temp file %s touched: %v", p, err)
+		}
+	}
+
+	if removed, freed, err := fsys.GCOrphans(map[string]struct{}{kept: {}}); err != nil || removed != 0 || freed != 0 {
+		t.Errorf("second sweep should be a no-op: removed=%d freed=%d err=%v", removed, freed, err)
+	}
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestVerifyAllHashed(t *testing.T) {
+	tempDir := t.TempDir()
+	fsys, err := NewWithBasePath(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create filesystem: %v", err)
+	}
+	plain := []byte(strings.Repeat("compressible object content ", 64))
+	good := md5Hex(plain)
+	bad := md5Hex([]byte("about to be corrupted"))
+	salted, _ := SaltedKey(good)
+	// already-compressed uploads are stored as sent and keyed by those bytes
+	gz, _ := compress.CompressWithType([]byte("gzip upload"), compress.Gzip)
+	raw := md5Hex(gz)
+	for key, data := range map[string][]byte{good: plain, salted: plain, bad: []byte("about to be corrupted")} {
+		if err := fsys.WriteObjectHashed(key, data); err != nil {
+			t.Fatalf("write %s: %v", key, err)
+		}
+	}
+	if err := fsys.WriteObjectHashedRaw(raw, gz); err != nil {
+		t.Fatalf("write raw: %v", err)
+	}
+	if corrupt, err := fsys.VerifyAllHashed(); err != nil || len(corrupt) != 0 {
+		t.Fatalf("expected clean store, got %v (err=%v)", corrupt, err)
+	}
+
+	if err := os.WriteFile(fsys.HashedObjectPath(bad), []byte("bit rot"), 0644); err != nil {
+		t.Fatalf("corrupt object: %v", err)
+	}
+	corrupt, err := fsys.VerifyAllHashed()
+	if err != nil {
+		t.Fatalf("VerifyAllHashed: %v", err)
+	}
+	if len(corrupt) != 1 || corrupt[0] != bad {
+		t.Fatalf("expected only %s reported, got %v", bad, corrupt)
+	}
+}
+
+// failOpenFs fails to open one path, standing in for an object the process cannot read
+type failOpenFs struct {
+	afero.Fs
+	path string
+}
+
+func (f failOpenFs) Open(name string) (afero.File, error) {
+	if name == f.path {
+		return nil, os.ErrPermission
+	}
+	return f.Fs.Open(name)
+}
+
+func TestVerifyAllHashedReportsUnreadable(t *testing.T) {
+	fsys, err := NewWithBasePath(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create filesystem: %v", err)
+	}
+	var keys []string
+	for _, s := range []string{"first object", "second object", "third object"} {
+		key := md5Hex([]byte(s))
+		if err := fsys.WriteObjectHashed(key, []byte(s)); err != nil {
+			t.Fatalf("write %s: %v", key, err)
+		}
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	// the first object walked is unreadable; the rest must still be checked
+	unreadable := keys[0]
+	fsys.fs = failOpenFs{Fs: fsys.fs, path: fsys.hashedPath(unreadable)}
+	if err := os.WriteFile(fsys.HashedObjectPath(keys[2]), []byte("bit rot"), 0644); err != nil {
+		t.Fatalf("corrupt object: %v", err)
+	}
+	corrupt, err := fsys.VerifyAllHashed()
+	if err != nil {
+		t.Fatalf("VerifyAllHashed: %v", err)
+	}
+	slices.Sort(corrupt)
+	if want := []string{unreadable, keys[2]}; !slices.Equal(corrupt, want) {
+		t.Fatalf("expected %v reported, got %v", want, corrupt)
+	}
+}
@@ -0,0 +1,324 @@
+// Package jsonschema implements a small subset of JSON Schema (draft 2020-12 keywords) sufficient
+// for validating uploaded documents: type, enum, const, properties, required,
+// additionalProperties, items, min/max constraints for numbers, strings and arrays, and pattern.
+// Unknown keywords are ignored.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// Schema is a compiled schema node
+type Schema struct {
+	types         []string
+	enum          []any
+	constVal      any
+	hasConst      bool
+	properties    map[string]*Schema
+	required      []string
+	additional    *Schema // nil: anything allowed
+	noAdditional  bool
+	items         *Schema
+	minimum       *float64
+	maximum       *float64
+	exclusiveMin  *float64
+	exclusiveMax  *float64
+	minLength     *int
+	maxLength     *int
+	minItems      *int
+	maxItems      *int
+	pattern       *regexp.Regexp
+	alwaysInvalid bool // the boolean schema false
+}
+
+// Compile parses a JSON Schema document
+func Compile(data []byte) (*Schema, error) {
+	v, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	return compile(v, "#")
+}
+
+func compile(v any, path string) (*Schema, error) {
+	switch t := v.(type) {
+	case bool:
+		return &Schema{alwaysInvalid: !t}, nil
+	case map[string]any:
+		s := &Schema{}
+		var err error
+		if tv, ok := t["type"]; ok {
+			switch tt := tv.(type) {
+			case string:
+				s.types = []string{tt}
+			case []any:
+				for _, x := range tt {
+					str, ok := x.(string)
+					if !ok {
+						return nil, fmt.Errorf("%s/type: expected string", path)
+					}
+					s.types = append(s.types, str)
+				}
+			default:
+				return nil, fmt.Errorf("%s/type: expected string or array", path)
+			}
+		}
+		if ev, ok := t["enum"].([]any); ok {
+			s.enum = ev
+		}
+		if cv, ok := t["const"]; ok {
+			s.constVal, s.hasConst = cv, true
+		}
+		if pv, ok := t["properties"].(map[string]any); ok {
+			s.properties = make(map[string]*Schema, len(pv))
+			for name, sub := range pv {
+				if s.properties[name], err = compile(sub, path+"/properties/"+name); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if rv, ok := t["required"].([]any); ok {
+			for _, x := range rv {
+				if str, ok := x.(string); ok {
+					s.required = append(s.required, str)
+				}
+			}
+		}
+		switch av := t["additionalProperties"].(type) {
+		case bool:
+			s.noAdditional = !av
+		case map[string]any:
+			if s.additional, err = compile(av, path+"/additionalProperties"); err != nil {
+				return nil, err
+			}
+		}
+		if iv, ok := t["items"]; ok {
+			if s.items, err = compile(iv, path+"/items"); err != nil {
+				return nil, err
+			}
+		}
+		s.minimum = number(t["minimum"])
+		s.maximum = number(t["maximum"])
+		s.exclusiveMin = number(t["exclusiveMinimum"])
+		s.exclusiveMax = number(t["exclusiveMaximum"])
+		s.minLength = integer(t["minLength"])
+		s.maxLength = integer(t["maxLength"])
+		s.minItems = integer(t["minItems"])
+		s.maxItems = integer(t["maxItems"])
+		if pv, ok := t["pattern"].(string); ok {
+			if s.pattern, err = regexp.Compile(pv); err != nil {
+				return nil, fmt.Errorf("%s/pattern: %w", path, err)
+			}
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("%s: schema must be an object or boolean", path)
+	}
+}
+
+// ValidateReader decodes a JSON document from r and validates it. A malformed document is
+// reported as a single validation error.
+func (s *Schema) ValidateReader(r io.Reader) []string {
+	v, err := decode(r)
+	if err != nil {
+		return []string{"invalid JSON: " + err.Error()}
+	}
+	return s.Validate(v)
+}
+
+// Validate checks a decoded JSON value (numbers as json.Number or float64) and returns
+// human-readable errors prefixed with the instance location; nil means valid.
+func (s *Schema) Validate(v any) []string {
+	var errs []string
+	s.validate(v, "$", &errs)
+	return errs
+}
+
+func (s *Schema) validate(v any, at string, errs *[]string) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, at+": "+fmt.Sprintf(format, args...))
+	}
+	if s.alwaysInvalid {
+		fail("not allowed")
+		return
+	}
+	if len(s.types) > 0 && !matchesType(v, s.types) {
+		fail("expected %v, got %s", typeList(s.types), typeOf(v))
+		return
+	}
+	if s.hasConst && !equal(v, s.constVal) {
+		fail("must equal %v", s.constVal)
+	}
+	if s.enum != nil {
+		found := false
+		for _, e := range s.enum {
+			if equal(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %v", s.enum)
+		}
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		for _, name := range s.required {
+			if _, ok := t[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(t))
+		for name := range t {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if sub, ok := s.properties[name]; ok {
+				sub.validate(t[name], at+"."+name, errs)
+			} else if s.noAdditional {
+				fail("unexpected property %q", name)
+			} else if s.additional != nil {
+				s.additional.validate(t[name], at+"."+name, errs)
+			}
+		}
+	case []any:
+		if s.minItems != nil && len(t) < *s.minItems {
+			fail("expected at least %d items, got %d", *s.minItems, len(t))
+		}
+		if s.maxItems != nil && len(t) > *s.maxItems {
+			fail("expected at most %d items, got %d", *s.maxItems, len(t))
+		}
+		if s.items != nil {
+			for i, item := range t {
+				s.items.validate(item, fmt.Sprintf("%s[%d]", at, i), errs)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(t)
+		if s.minLength != nil && n < *s.minLength {
+			fail("expected at least %d characters, got %d", *s.minLength, n)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			fail("expected at most %d characters, got %d", *s.maxLength, n)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(t) {
+			fail("does not match pattern %q", s.pattern.String())
+		}
+	case json.Number, float64:
+		f := toFloat(t)
+		if s.minimum != nil && f < *s.minimum {
+			fail("must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && f > *s.maximum {
+			fail("must be <= %v", *s.maximum)
+		}
+		if s.exclusiveMin != nil && f <= *s.exclusiveMin {
+			fail("must be > %v", *s.exclusiveMin)
+		}
+		if s.exclusiveMax != nil && f >= *s.exclusiveMax {
+			fail("must be < %v", *s.exclusiveMax)
+		}
+	}
+}
+
+func decode(r io.Reader) (any, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+	return v, nil
+}
+
+func typeOf(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case json.Number, float64:
+		if f := toFloat(t); f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
+
+func matchesType(v any, types []string) bool {
+	actual := typeOf(v)
+	for _, want := range types {
+		if want == actual || (want == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeList(types []string) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return fmt.Sprint(types)
+}
+
+func equal(a, b any) bool {
+	if isNumber(a) && isNumber(b) {
+		return toFloat(a) == toFloat(b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func isNumber(v any) bool {
+	switch v.(type) {
+	case json.Number, float64:
+		return true
+	}
+	return false
+}
+
+func toFloat(v any) float64 {
+	switch t := v.(type) {
+	case json.Number:
+		f, _ := t.Float64()
+		return f
+	case float64:
+		return t
+	}
+	return math.NaN()
+}
+
+func number(v any) *float64 {
+	if !isNumber(v) {
+		return nil
+	}
+	f := toFloat(v)
+	return &f
+}
+
+func integer(v any) *int {
+	if !isNumber(v) {
+		return nil
+	}
+	n := int(toFloat(v))
+	return &n
+}
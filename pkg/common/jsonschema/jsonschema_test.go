@@ -0,0 +1,58 @@
+package jsonschema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	s, err := Compile([]byte(`{
+		"type": "object",
+		"required": ["name", "tags"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 2, "pattern": "^[a-z]+$"},
+			"version": {"type": "integer", "minimum": 1},
+			"kind": {"enum": ["lib", "bin"]},
+			"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	cases := []struct {
+		doc  string
+		want []string // substrings expected in the errors, nil for a valid document
+	}{
+		{`{"name":"pkg","version":2,"kind":"lib","tags":["a"]}`, nil},
+		{`{"tags":[]}`, []string{`missing required property "name"`}},
+		{`{"name":"Pkg","tags":[]}`, []string{"$.name: does not match pattern"}},
+		{`{"name":"pkg","version":1.5,"tags":[]}`, []string{"$.version: expected integer, got number"}},
+		{`{"name":"pkg","version":0,"tags":[]}`, []string{"$.version: must be >= 1"}},
+		{`{"name":"pkg","kind":"doc","tags":[]}`, []string{"$.kind: must be one of"}},
+		{`{"name":"pkg","tags":["a",1,"c"]}`, []string{"$.tags: expected at most 2 items", "$.tags[1]: expected string"}},
+		{`{"name":"pkg","tags":[],"extra":true}`, []string{`unexpected property "extra"`}},
+		{`["not","an","object"]`, []string{"$: expected object, got array"}},
+		{`{"name":`, []string{"invalid JSON"}},
+	}
+	for _, tc := range cases {
+		errs := s.ValidateReader(strings.NewReader(tc.doc))
+		if len(errs) != len(tc.want) {
+			t.Errorf("%s: got errors %q, want %d", tc.doc, errs, len(tc.want))
+			continue
+		}
+		for i, w := range tc.want {
+			if !strings.Contains(errs[i], w) {
+				t.Errorf("%s: error %q does not contain %q", tc.doc, errs[i], w)
+			}
+		}
+	}
+}
+
+func TestCompileRejectsBadSchema(t *testing.T) {
+	for _, doc := range []string{`"string"`, `{"pattern":"("}`, `{"type":5}`, `{`} {
+		if _, err := Compile([]byte(doc)); err == nil {
+			t.Errorf("expected compile error for %s", doc)
+		}
+	}
+}
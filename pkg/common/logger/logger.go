@@ -15,6 +15,10 @@ type Config struct {
 	Format     string `json:"format" yaml:"format"` // "json" or "console"
 	TimeFormat string `json:"time_format" yaml:"time_format"`
 	Output     string `json:"output" yaml:"output"` // "stdout", "stderr", or file path
+	// Rotation of a file Output: MaxSizeMB > 0 enables it; the other two limit the kept backups
+	MaxSizeMB  int `json:"max_size_mb" yaml:"max_size_mb"`
+	MaxBackups int `json:"max_backups" yaml:"max_backups"`
+	MaxAgeDays int `json:"max_age_days" yaml:"max_age_days"`
 }
 
 // DefaultConfig returns the default logger configuration
@@ -27,6 +31,9 @@ func DefaultConfig() *Config {
 	}
 }
 
+// outputPath is the log file in use, empty when logging to stdout/stderr
+var outputPath string
+
 // Init initializes the global logger with the provided configuration
 func Init(config *Config) error {
 	// Set log level
@@ -41,6 +48,7 @@ func Init(config *Config) error {
 
 	// Configure output
 	var output io.Writer
+	path := ""
 	switch config.Output {
 	case "stdout":
 		output = os.Stdout
@@ -48,12 +56,22 @@ func Init(config *Config) error {
 		output = os.Stderr
 	default:
 		// Assume it's a file path
-		file, err := os.OpenFile(config.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-		if err != nil {
-			return err
+		if config.MaxSizeMB > 0 {
+			rf, err := newRotatingFile(config.Output, int64(config.MaxSizeMB)<<20, config.MaxBackups, time.Duration(config.MaxAgeDays)*24*time.Hour)
+			if err != nil {
+				return err
+			}
+			output = rf
+		} else {
+			file, err := os.OpenFile(config.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+			if err != nil {
+				return err
+			}
+			output = file
 		}
-		output = file
+		path = config.Output
 	}
+	outputPath = path
 
 	// Configure format
 	if config.Format == "console" {
@@ -69,6 +87,21 @@ func Init(config *Config) error {
 	return nil
 }
 
+// SetLevel changes the global log level without touching the output, e.g. after a config reload
+func SetLevel(name string) error {
+	level, err := zerolog.ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	zerolog.SetGlobalLevel(level)
+	return nil
+}
+
+// OutputPath returns the file the logger writes to, or "" when it logs to stdout/stderr
+func OutputPath() string {
+	return outputPath
+}
+
 // GetLogger returns a new logger instance
 func GetLogger() *zerolog.Logger {
 	return &log.Logger
@@ -441,3 +441,64 @@ func BenchmarkLogMessage(b *testing.B) {
 		buf.Reset()
 	}
 }
+
+func TestRotation(t *testing.T) {
+	for _, format := range []string{"json", "console"} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.log")
+			cfg := DefaultConfig()
+			cfg.Format = format
+			cfg.Output = path
+			cfg.MaxSizeMB = 1
+			cfg.MaxBackups = 2
+			if err := Init(cfg); err != nil {
+				t.Fatalf("init: %v", err)
+			}
+			t.Cleanup(func() { _ = Init(DefaultConfig()) })
+
+			// ~3.5MiB of log lines forces at least three rotations
+			line := strings.Repeat("x", 1024)
+			for i := 0; i < 3500; i++ {
+				GetLogger().Info().Int("i", i).Msg(line)
+			}
+			backups, _ := filepath.Glob(filepath.Join(dir, "app-*.log"))
+			if len(backups) != 2 {
+				t.Fatalf("expected 2 kept backups, got %v", backups)
+			}
+			for _, p := range append(backups, path) {
+				st, err := os.Stat(p)
+				if err != nil {
+					t.Fatalf("stat %s: %v", p, err)
+				}
+				if st.Size() > 1<<20 {
+					t.Fatalf("%s grew past the limit: %d bytes", p, st.Size())
+				}
+			}
+			// the newest entries are in the live file
+			data, _ := os.ReadFile(path)
+			if !strings.Contains(string(data), "3499") {
+				t.Fatalf("last entry missing from the live log")
+			}
+		})
+	}
+}
+
+func TestNoRotationByDefault(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	cfg := DefaultConfig()
+	cfg.Format = "json"
+	cfg.Output = path
+	if err := Init(cfg); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	t.Cleanup(func() { _ = Init(DefaultConfig()) })
+	line := strings.Repeat("y", 1024)
+	for i := 0; i < 1500; i++ {
+		GetLogger().Info().Msg(line)
+	}
+	if backups, _ := filepath.Glob(filepath.Join(dir, "app-*.log")); len(backups) != 0 {
+		t.Fatalf("unexpected backups without rotation configured: %v", backups)
+	}
+}
@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat stamps rotated files; it sorts lexically in time order
+const backupTimeFormat = "20060102T150405.000"
+
+// rotatingFile is an append-only log file that is renamed to a timestamped backup
+// ("app-20240102T150405.000.log") once a write would take it past maxBytes. Backups beyond
+// maxBackups or older than maxAge are removed after each rotation; zero disables either limit.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	maxBackups int
+	maxAge     time.Duration
+	f          *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxBytes int64, maxBackups int, maxAge time.Duration) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups, maxAge: maxAge}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, st.Size()
+	return nil
+}
+
+// Write appends p, rotating first when p would not fit. A single write larger than maxBytes still
+// goes to a fresh file whole rather than being split.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && r.size+int64(len(p)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(r.path)
+	base := strings.TrimSuffix(r.path, ext)
+	backup := base + "-" + time.Now().Format(backupTimeFormat) + ext
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			break
+		}
+		backup = fmt.Sprintf("%s-%s.%d%s", base, time.Now().Format(backupTimeFormat), i, ext)
+	}
+	if err := os.Rename(r.path, backup); err != nil {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.prune(base, ext)
+	return nil
+}
+
+// prune removes backups past the count and age limits, newest kept first
+func (r *rotatingFile) prune(base, ext string) {
+	if r.maxBackups <= 0 && r.maxAge <= 0 {
+		return
+	}
+	backups, _ := filepath.Glob(base + "-*" + ext)
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i, b := range backups {
+		expired := false
+		if r.maxAge > 0 {
+			if st, err := os.Stat(b); err == nil && time.Since(st.ModTime()) > r.maxAge {
+				expired = true
+			}
+		}
+		if expired || (r.maxBackups > 0 && i >= r.maxBackups) {
+			_ = os.Remove(b)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Package metrics is a minimal registry of counters, histograms and gauges rendered in the
+// Prometheus text exposition format, enough for /metrics without the full client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency histogram bounds in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// collector is one registered metric family
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	mu       sync.Mutex
+	registry = map[string]collector{}
+)
+
+// register adds c under name, panicking on duplicates like the Prometheus client does, since a
+// duplicate can only come from a programming error at init time
+func register(name string, c collector) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic("metrics: duplicate metric " + name)
+	}
+	registry[name] = c
+}
+
+// WriteText renders every registered metric, sorted by name
+func WriteText(w io.Writer) {
+	mu.Lock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	cs := make([]collector, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		cs[i] = registry[name]
+	}
+	mu.Unlock()
+	for _, c := range cs {
+		c.write(w)
+	}
+}
+
+// series holds the per-label-set values of a vector, keyed by the joined label values
+type series[T any] struct {
+	name, help, typ string
+	labels          []string
+	mu              sync.Mutex
+	values          map[string]*T
+}
+
+func (s *series[T]) get(values []string) *T {
+	if len(values) != len(s.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", s.name, len(s.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v, ok := s.values[key]
+	if !ok {
+		v = new(T)
+		s.values[key] = v
+	}
+	return v
+}
+
+// sorted returns the label keys in a stable order for rendering
+func (s *series[T]) sorted() []string {
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *series[T]) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.name, s.help, s.name, s.typ)
+}
+
+// labelText renders {a="x",b="y"} for the label key plus any extra pair (e.g. le)
+func (s *series[T]) labelText(key string, extra ...string) string {
+	var parts []string
+	if len(s.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			parts = append(parts, s.labels[i]+"="+strconv.Quote(v))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, extra[i]+"="+strconv.Quote(extra[i+1]))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// CounterVec is a monotonically increasing value per label set
+type CounterVec struct{ s *series[float64] }
+
+// NewCounterVec registers a counter family
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{s: &series[float64]{name: name, help: help, typ: "counter", labels: labels, values: map[string]*float64{}}}
+	register(name, c)
+	return c
+}
+
+// Inc adds one to the series for the given label values
+func (c *CounterVec) Inc(values ...string) { c.Add(1, values...) }
+
+// Add adds v (which must not be negative) to the series for the given label values
+func (c *CounterVec) Add(v float64, values ...string) {
+	if v < 0 {
+		return
+	}
+	c.s.mu.Lock()
+	*c.s.get(values) += v
+	c.s.mu.Unlock()
+}
+
+// Value returns the current value of a series, mainly for tests
+func (c *CounterVec) Value(values ...string) float64 {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	if v, ok := c.s.values[strings.Join(values, "\xff")]; ok {
+		return *v
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	c.s.header(w)
+	for _, k := range c.s.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", c.s.name, c.s.labelText(k), formatFloat(*c.s.values[k]))
+	}
+}
+
+// histogram is the state of one histogram series; counts are per bucket, not cumulative
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec tracks the distribution of observations per label set
+type HistogramVec struct {
+	s       *series[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec registers a histogram family with the given upper bounds (nil for DefaultBuckets)
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &HistogramVec{s: &series[histogram]{name: name, help: help, typ: "histogram", labels: labels, values: map[string]*histogram{}}, buckets: buckets}
+	register(name, h)
+	return h
+}
+
+// Observe records v in the series for the given label values
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	st := h.s.get(values)
+	if st.counts == nil {
+		st.counts = make([]uint64, len(h.buckets))
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		st.counts[i]++
+	}
+	st.sum += v
+	st.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	h.s.header(w)
+	for _, k := range h.s.sorted() {
+		st := h.s.values[k]
+		var cum uint64
+		for i, le := range h.buckets {
+			cum += st.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.s.name, h.s.labelText(k, "le", formatFloat(le)), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.s.name, h.s.labelText(k, "le", "+Inf"), st.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.s.name, h.s.labelText(k), formatFloat(st.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.s.name, h.s.labelText(k), st.count)
+	}
+}
+
+// valueFunc is an unlabelled metric read when scraped, for values another package already tracks
+type valueFunc struct {
+	name, help, typ string
+	fn              func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn at scrape time
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(name, &valueFunc{name: name, help: help, typ: "gauge", fn: fn})
+}
+
+// NewCounterFunc registers a counter whose value is read from fn at scrape time; fn must never
+// decrease
+func NewCounterFunc(name, help string, fn func() float64) {
+	register(name, &valueFunc{name: name, help: help, typ: "counter", fn: fn})
+}
+
+func (g *valueFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", g.name, g.help, g.name, g.typ, g.name, formatFloat(g.fn()))
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
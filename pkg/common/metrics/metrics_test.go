@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	c := NewCounterVec("test_events_total", "Events.", "kind")
+	c.Inc("a")
+	c.Add(2, "b")
+	c.Add(-1, "b") // ignored, counters never decrease
+	h := NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/x")
+	h.Observe(0.5, "/x")
+	h.Observe(3, "/x")
+	NewGaugeFunc("test_depth", "Depth.", func() float64 { return 7 })
+
+	var buf bytes.Buffer
+	WriteText(&buf)
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE test_events_total counter\n",
+		`test_events_total{kind="a"} 1` + "\n",
+		`test_events_total{kind="b"} 2` + "\n",
+		"# TYPE test_latency_seconds histogram\n",
+		`test_latency_seconds_bucket{route="/x",le="0.1"} 1` + "\n",
+		`test_latency_seconds_bucket{route="/x",le="1"} 2` + "\n",
+		`test_latency_seconds_bucket{route="/x",le="+Inf"} 3` + "\n",
+		`test_latency_seconds_sum{route="/x"} 3.55` + "\n",
+		`test_latency_seconds_count{route="/x"} 3` + "\n",
+		"# TYPE test_depth gauge\ntest_depth 7\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	if c.Value("b") != 2 || c.Value("never") != 0 {
+		t.Fatalf("unexpected values %v %v", c.Value("b"), c.Value("never"))
+	}
+	if strings.Contains(out, "never") {
+		t.Fatalf("reading a value should not create a series:\n%s", out)
+	}
+}
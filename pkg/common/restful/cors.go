@@ -0,0 +1,74 @@
+package restful
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSConfig controls the Cross-Origin Resource Sharing headers. An AllowedOrigins entry of "*"
+// admits any origin; credentials are never allowed together with it, as browsers reject that.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int // preflight cache lifetime in seconds, 0 to omit
+}
+
+// DefaultCORSConfig is the permissive configuration servers start with unless WithCORS is given
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"POST", "OPTIONS", "GET", "PUT", "DELETE"},
+		AllowedHeaders: []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "accept", "origin", "Cache-Control", "X-Requested-With"},
+	}
+}
+
+func (cfg CORSConfig) wildcard() bool { return slices.Contains(cfg.AllowedOrigins, "*") }
+
+// CORSMiddleware handles Cross-Origin Resource Sharing. A request Origin on the allowlist is echoed
+// back (with Vary: Origin); other origins get no CORS headers, and their preflights a 403.
+func CORSMiddleware(cfg CORSConfig) gin.HandlerFunc {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		allowed := ""
+		switch {
+		case origin != "" && slices.Contains(cfg.AllowedOrigins, origin):
+			allowed = origin
+		case cfg.wildcard():
+			allowed = "*"
+		}
+		if allowed != "" {
+			h := c.Writer.Header()
+			h.Set("Access-Control-Allow-Origin", allowed)
+			if allowed != "*" {
+				h.Add("Vary", "Origin")
+				if cfg.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+			h.Set("Access-Control-Allow-Headers", headers)
+			h.Set("Access-Control-Allow-Methods", methods)
+			if cfg.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+			}
+		}
+
+		if c.Request.Method == http.MethodOptions {
+			if allowed == "" && origin != "" {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
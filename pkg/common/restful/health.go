@@ -0,0 +1,61 @@
+package restful
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/database"
+	"go4pack/pkg/common/fs"
+)
+
+// Probe paths; RequestLogger logs them (and MetricsPath) at debug level so frequent polling does
+// not flood the log
+const (
+	HealthPath = "/healthz"
+	ReadyPath  = "/readyz"
+)
+
+// RegisterHealth registers the liveness (/healthz) and readiness (/readyz) probes on the engine root
+func (s *Server) RegisterHealth() {
+	s.Engine.GET(HealthPath, func(c *gin.Context) {
+		uptime := time.Since(s.started)
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "uptime": uptime.Round(time.Second).String(), "uptime_seconds": int64(uptime.Seconds())})
+	})
+	s.Engine.GET(ReadyPath, readyHandler)
+}
+
+// readyHandler reports 200 when the database answers a query and the runtime filesystem is usable,
+// otherwise 503; either way the body carries the status of each check
+func readyHandler(c *gin.Context) {
+	checks := gin.H{"database": checkDatabase(), "filesystem": checkFilesystem()}
+	ready := true
+	for _, v := range checks {
+		ready = ready && v == "ok"
+	}
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{"ready": ready, "checks": checks})
+}
+
+func checkDatabase() string {
+	db := database.Get()
+	if db == nil {
+		return "not initialized"
+	}
+	var one int
+	if err := db.Raw("SELECT 1").Scan(&one).Error; err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
+
+func checkFilesystem() string {
+	if _, err := fs.New(); err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
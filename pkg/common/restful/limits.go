@@ -0,0 +1,33 @@
+package restful
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxBodyBytes caps request bodies at limit bytes (0 disables the cap). A declared Content-Length
+// over the limit is rejected with 413 before the body is read; otherwise the body is wrapped with
+// http.MaxBytesReader so chunked bodies fail once they pass it, which handlers can detect with
+// IsBodyTooLarge.
+func MaxBodyBytes(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large", "max_bytes": limit})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// IsBodyTooLarge reports whether err comes from reading past the MaxBodyBytes limit
+func IsBodyTooLarge(err error) bool {
+	var mbe *http.MaxBytesError
+	return errors.As(err, &mbe)
+}
@@ -0,0 +1,40 @@
+package restful
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/metrics"
+)
+
+// MetricsPath serves the Prometheus scrape endpoint
+const MetricsPath = "/metrics"
+
+var (
+	httpRequests = metrics.NewCounterVec("go4pack_http_requests_total", "HTTP requests by method, route and status.", "method", "route", "status")
+	httpDuration = metrics.NewHistogramVec("go4pack_http_request_duration_seconds", "HTTP request latency by method and route.", nil, "method", "route")
+)
+
+// observeRequest records a finished request. The label is the matched route pattern (or
+// "unmatched") rather than the raw path, so ids in URLs cannot blow up the series count.
+func observeRequest(c *gin.Context, latency time.Duration) {
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	method := c.Request.Method
+	httpRequests.Inc(method, route, strconv.Itoa(c.Writer.Status()))
+	httpDuration.Observe(latency.Seconds(), method, route)
+}
+
+// RegisterMetrics registers GET /metrics in the Prometheus text format on the engine root
+func (s *Server) RegisterMetrics() {
+	s.Engine.GET(MetricsPath, func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		metrics.WriteText(c.Writer)
+	})
+}
@@ -0,0 +1,62 @@
+package restful
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/logger"
+)
+
+// RequestIDHeader carries the request correlation id in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the gin context key holding the id
+const requestIDKey = "request_id"
+
+// maxRequestIDLen bounds client-supplied ids so they cannot bloat every log line
+const maxRequestIDLen = 128
+
+// RequestID assigns every request a correlation id: the client's X-Request-ID when it is usable,
+// otherwise a random UUID. The id is echoed in the response header, stored in the gin context
+// and in the request context (see logger.RequestID) for handlers and the jobs they schedule.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newUUID()
+		}
+		c.Set(requestIDKey, id)
+		c.Request = c.Request.WithContext(logger.ContextWithRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// GetRequestID returns the id assigned by RequestID, or "" when the middleware is not installed
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// validRequestID accepts non-empty, bounded ids of printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"go4pack/pkg/common/logger"
+	"go4pack/pkg/common/tracing"
 )
 
 // Server wraps gin.Engine with graceful shutdown support
@@ -17,6 +19,12 @@ type Server struct {
 	httpServer  *http.Server
 	addr        string
 	shutdownDur time.Duration
+	started     time.Time
+	cors        CORSConfig
+	maxBody     int64
+	auth        AuthConfig
+	logSampleN  int
+	slowRequest time.Duration
 }
 
 // Option pattern for server configuration
@@ -24,26 +32,48 @@ type Option func(*Server)
 
 func WithAddress(addr string) Option             { return func(s *Server) { s.addr = addr } }
 func WithShutdownTimeout(d time.Duration) Option { return func(s *Server) { s.shutdownDur = d } }
+func WithCORS(cfg CORSConfig) Option             { return func(s *Server) { s.cors = cfg } }
+func WithMaxBodyBytes(n int64) Option            { return func(s *Server) { s.maxBody = n } }
+func WithAuth(cfg AuthConfig) Option             { return func(s *Server) { s.auth = cfg } }
+
+// WithRequestLogSampling logs one in n successful requests (see SampledRequestLogger)
+func WithRequestLogSampling(n int) Option { return func(s *Server) { s.logSampleN = n } }
+
+// WithSlowRequestThreshold always logs, at warn level, requests taking at least d (0 disables)
+func WithSlowRequestThreshold(d time.Duration) Option { return func(s *Server) { s.slowRequest = d } }
 
 // NewServer creates a new RESTful server instance
 func NewServer(opts ...Option) *Server {
 	g := gin.New()
-	// route panics to zerolog
-	g.Use(RecoveryWithLogger())
-	g.Use(CORSMiddleware())
-	g.Use(RequestLogger())
-	// direct gin internal output to zerolog (avoid duplicate default logger middleware)
-	gin.DefaultWriter = zerologWriter{}
-	gin.DefaultErrorWriter = zerologWriter{}
-
 	s := &Server{
 		Engine:      g,
 		addr:        ":8080",
 		shutdownDur: 5 * time.Second,
+		started:     time.Now(),
+		cors:        DefaultCORSConfig(),
 	}
 	for _, opt := range opts {
 		opt(s)
 	}
+	if s.cors.wildcard() {
+		logger.GetLogger().Warn().Msg("CORS allows any origin; configure WithCORS with an origin allowlist")
+	}
+
+	// route panics to zerolog
+	g.Use(RecoveryWithLogger())
+	g.Use(CORSMiddleware(s.cors))
+	g.Use(RequestID())
+	g.Use(SampledRequestLogger(s.logSampleN, s.slowRequest))
+	g.Use(TracingMiddleware())
+	if len(s.auth.Keys) > 0 {
+		g.Use(authMiddleware(s.auth))
+	}
+	if s.maxBody > 0 {
+		g.Use(MaxBodyBytes(s.maxBody))
+	}
+	// direct gin internal output to zerolog (avoid duplicate default logger middleware)
+	gin.DefaultWriter = zerologWriter{}
+	gin.DefaultErrorWriter = zerologWriter{}
 
 	s.httpServer = &http.Server{Addr: s.addr, Handler: s.Engine}
 	return s
@@ -83,30 +113,63 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return s.httpServer.Shutdown(ctxTimeout)
 }
 
-// RequestLogger logs basic request info
+// RequestLogger logs every request and feeds the request metrics
 func RequestLogger() gin.HandlerFunc {
+	return SampledRequestLogger(1, 0)
+}
+
+// SampledRequestLogger logs one in n successful (< 400) requests; client and server errors, and
+// requests slower than slow (when > 0), are always logged. n <= 1 logs everything. The request
+// metrics still observe every request.
+func SampledRequestLogger(n int, slow time.Duration) gin.HandlerFunc {
+	var seq atomic.Uint64
 	return func(c *gin.Context) {
 		start := time.Now()
 		c.Next()
 		latency := time.Since(start)
 		status := c.Writer.Status()
-		logger.GetLogger().Info().Int("status", status).Str("method", c.Request.Method).Str("path", c.Request.URL.Path).Dur("latency", latency).Msg("request")
+		observeRequest(c, latency)
+		if n > 1 && status < 400 && (slow <= 0 || latency < slow) && seq.Add(1)%uint64(n) != 1 {
+			return
+		}
+		log := logger.GetLogger()
+		if id := GetRequestID(c); id != "" {
+			log = logger.WithFields(map[string]interface{}{"request_id": id})
+		}
+		ev := log.Info()
+		if p := c.Request.URL.Path; p == HealthPath || p == ReadyPath || p == MetricsPath {
+			ev = log.Debug()
+		}
+		if slow > 0 && latency >= slow {
+			ev = log.Warn().Bool("slow", true)
+		}
+		ev.Int("status", status).Str("method", c.Request.Method).Str("path", c.Request.URL.Path).Dur("latency", latency).Msg("request")
 	}
 }
 
-// CORSMiddleware handles Cross-Origin Resource Sharing
-func CORSMiddleware() gin.HandlerFunc {
+// TracingMiddleware starts a span per request, continuing an incoming W3C traceparent when present.
+// The span is stored in the request context so handlers and the jobs they schedule can link to it.
+func TracingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		if !tracing.Enabled() {
+			c.Next()
 			return
 		}
-
+		var opts []tracing.StartOption
+		if parent, ok := tracing.ParseTraceparent(c.GetHeader("traceparent")); ok {
+			opts = append(opts, tracing.WithRemoteParent(parent))
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx, span := tracing.Start(c.Request.Context(), c.Request.Method+" "+route, opts...)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		c.Header("traceparent", tracing.Traceparent(span.SpanContext()))
 		c.Next()
+		span.SetAttribute("http.method", c.Request.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.status_code", c.Writer.Status())
 	}
 }
@@ -3,8 +3,11 @@ package restful
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -13,6 +16,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"go4pack/pkg/common/database"
 	"go4pack/pkg/common/logger"
 )
 
@@ -103,6 +107,41 @@ func TestRequestLoggerMiddleware(t *testing.T) {
 	}
 }
 
+func TestSampledRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	initTestLogger(&buf)
+	gin.SetMode(gin.ReleaseMode)
+
+	r := gin.New()
+	r.Use(SampledRequestLogger(4, 20*time.Millisecond))
+	r.GET("/ok", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	r.GET("/fail", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+	r.GET("/slow", func(c *gin.Context) {
+		time.Sleep(25 * time.Millisecond)
+		c.Status(http.StatusNoContent)
+	})
+
+	serve := func(path string, times int) {
+		for i := 0; i < times; i++ {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+	}
+	serve("/ok", 8)
+	serve("/fail", 3)
+	serve("/slow", 1)
+
+	out := buf.String()
+	if n := strings.Count(out, `"path":"/ok"`); n != 2 {
+		t.Fatalf("expected 2 of 8 successful requests logged, got %d: %s", n, out)
+	}
+	if n := strings.Count(out, `"path":"/fail"`); n != 3 {
+		t.Fatalf("expected every 5xx logged, got %d: %s", n, out)
+	}
+	if !strings.Contains(out, `"slow":true`) || !strings.Contains(out, `"path":"/slow"`) {
+		t.Fatalf("expected slow request logged, got %s", out)
+	}
+}
+
 func TestServerStartAndShutdown(t *testing.T) {
 	var buf bytes.Buffer
 	initTestLogger(&buf)
@@ -150,3 +189,287 @@ func BenchmarkRequestLogger(b *testing.B) {
 		r.ServeHTTP(w, req)
 	}
 }
+
+func BenchmarkSampledRequestLogger(b *testing.B) {
+	var buf bytes.Buffer
+	initTestLogger(&buf)
+	gin.SetMode(gin.ReleaseMode)
+
+	r := gin.New()
+	r.Use(SampledRequestLogger(100, time.Second))
+	r.GET("/x", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	req := httptest.NewRequest(http.MethodGet, "/x", nil)
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+	}
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	var buf bytes.Buffer
+	initTestLogger(&buf)
+	gin.SetMode(gin.ReleaseMode)
+	database.ResetForTest()
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir failed: %v", err)
+	}
+
+	s := NewServer()
+	s.RegisterHealth()
+	get := func(path string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		s.Engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	if code, body := get("/healthz"); code != http.StatusOK || body["status"] != "ok" || body["uptime_seconds"] == nil {
+		t.Fatalf("healthz: code=%d body=%v", code, body)
+	}
+	// database not initialized yet
+	code, body := get("/readyz")
+	checks, _ := body["checks"].(map[string]any)
+	if code != http.StatusServiceUnavailable || body["ready"] != false || checks["database"] == "ok" || checks["filesystem"] != "ok" {
+		t.Fatalf("readyz before db init: code=%d body=%v", code, body)
+	}
+
+	if _, err := database.Init("ready.db"); err != nil {
+		t.Fatalf("db init failed: %v", err)
+	}
+	t.Cleanup(database.ResetForTest)
+	if code, body := get("/readyz"); code != http.StatusOK || body["ready"] != true {
+		t.Fatalf("readyz after db init: code=%d body=%v", code, body)
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, `"path":"/readyz"`) && !strings.Contains(line, `"level":"debug"`) {
+			t.Fatalf("probe requests should be logged at debug level: %s", line)
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	var buf bytes.Buffer
+	initTestLogger(&buf)
+	gin.SetMode(gin.ReleaseMode)
+
+	s := NewServer()
+	s.RegisterMetrics()
+	s.Engine.GET("/items/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	before := httpRequests.Value(http.MethodGet, "/items/:id", "204")
+	for _, id := range []string{"1", "2"} {
+		s.Engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/"+id, nil))
+	}
+	s.Engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+	w := httptest.NewRecorder()
+	s.Engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("metrics: code=%d content-type=%q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if got := httpRequests.Value(http.MethodGet, "/items/:id", "204"); got != before+2 {
+		t.Fatalf("expected request counter to grow by 2, got %v -> %v", before, got)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`go4pack_http_requests_total{method="GET",route="/items/:id",status="204"}`,
+		`go4pack_http_requests_total{method="GET",route="unmatched",status="404"}`,
+		`go4pack_http_request_duration_seconds_count{method="GET",route="/items/:id"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %s in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "/items/1") {
+		t.Fatalf("raw paths must not be used as labels:\n%s", body)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	var buf bytes.Buffer
+	initTestLogger(&buf)
+	gin.SetMode(gin.ReleaseMode)
+
+	cfg := DefaultCORSConfig()
+	cfg.AllowedOrigins = []string{"https://app.example.com"}
+	cfg.AllowCredentials = true
+	cfg.MaxAge = 600
+	s := NewServer(WithCORS(cfg))
+	s.Engine.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	do := func(method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/ping", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		s.Engine.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "https://app.example.com")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "true" || w.Header().Get("Vary") != "Origin" {
+		t.Fatalf("allowed origin: code=%d headers=%v", w.Code, w.Header())
+	}
+	w = do(http.MethodGet, "https://evil.example.com")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("disallowed origin: code=%d headers=%v", w.Code, w.Header())
+	}
+
+	w = do(http.MethodOptions, "https://app.example.com")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") == "" || w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Fatalf("allowed preflight: code=%d headers=%v", w.Code, w.Header())
+	}
+	if w = do(http.MethodOptions, "https://evil.example.com"); w.Code != http.StatusForbidden {
+		t.Fatalf("disallowed preflight: code=%d", w.Code)
+	}
+
+	// the permissive default answers any origin with "*" but never allows credentials alongside it
+	buf.Reset()
+	s = NewServer()
+	s.Engine.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	w = do(http.MethodGet, "https://anywhere.example.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("default cors headers: %v", w.Header())
+	}
+	if !strings.Contains(buf.String(), "CORS allows any origin") {
+		t.Fatalf("expected wildcard warning, got %s", buf.String())
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	var buf bytes.Buffer
+	initTestLogger(&buf)
+	gin.SetMode(gin.ReleaseMode)
+
+	const limit = 64
+	s := NewServer(WithMaxBodyBytes(limit))
+	s.Engine.POST("/echo", func(c *gin.Context) {
+		data, err := io.ReadAll(c.Request.Body)
+		if IsBodyTooLarge(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "too large"})
+			return
+		}
+		c.String(http.StatusOK, "%d", len(data))
+	})
+	post := func(n int, chunked bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(strings.Repeat("a", n)))
+		if chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		s.Engine.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, chunked := range []bool{false, true} {
+		if w := post(limit, chunked); w.Code != http.StatusOK || w.Body.String() != "64" {
+			t.Fatalf("at limit (chunked=%v): code=%d body=%s", chunked, w.Code, w.Body.String())
+		}
+		if w := post(limit+1, chunked); w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("over limit (chunked=%v): code=%d body=%s", chunked, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	var buf bytes.Buffer
+	initTestLogger(&buf)
+	gin.SetMode(gin.ReleaseMode)
+
+	s := NewServer(WithAuth(AuthConfig{Keys: []string{"key-one", "key-two"}, ExemptPaths: []string{HealthPath}}))
+	s.RegisterHealth()
+	s.Engine.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	s.Engine.GET("/whoami", func(c *gin.Context) { c.String(http.StatusOK, AuthIdentity(c)) })
+	get := func(path, key string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set(DefaultAPIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		s.Engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	cases := []struct {
+		name, path, key string
+		want            int
+	}{
+		{"valid key", "/ping", "key-two", http.StatusOK},
+		{"invalid key", "/ping", "key-three", http.StatusUnauthorized},
+		{"key prefix", "/ping", "key-on", http.StatusUnauthorized},
+		{"missing key", "/ping", "", http.StatusUnauthorized},
+		{"exempt path", HealthPath, "", http.StatusOK},
+	}
+	for _, tc := range cases {
+		if got := get(tc.path, tc.key); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	// the identity names the key without revealing it, and differs per key
+	whoami := func(key string) string {
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		req.Header.Set(DefaultAPIKeyHeader, key)
+		w := httptest.NewRecorder()
+		s.Engine.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	one, two := whoami("key-one"), whoami("key-two")
+	if !strings.HasPrefix(one, "key:") || strings.Contains(one, "key-one") || one == two {
+		t.Errorf("identities: %q, %q", one, two)
+	}
+
+	// a custom header replaces X-API-Key
+	s = NewServer(WithAuth(AuthConfig{Keys: []string{"k"}, Header: "Authorization-Key"}))
+	s.Engine.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set("Authorization-Key", "k")
+	w := httptest.NewRecorder()
+	s.Engine.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("custom header: got %d", w.Code)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	initTestLogger(&buf)
+	gin.SetMode(gin.ReleaseMode)
+
+	s := NewServer()
+	var seen string
+	s.Engine.GET("/ping", func(c *gin.Context) {
+		seen = logger.RequestID(c.Request.Context())
+		c.String(http.StatusOK, "pong")
+	})
+	get := func(id string) string {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		s.Engine.ServeHTTP(w, req)
+		return w.Header().Get(RequestIDHeader)
+	}
+
+	generated := get("")
+	if len(generated) != 36 || generated[14] != '4' || seen != generated {
+		t.Fatalf("expected a generated UUID in header and context, got header=%q context=%q", generated, seen)
+	}
+	if other := get(""); other == generated {
+		t.Fatalf("generated ids should differ, got %q twice", other)
+	}
+	if got := get("client-abc-123"); got != "client-abc-123" || seen != got {
+		t.Fatalf("provided id not echoed: header=%q context=%q", got, seen)
+	}
+	if got := get("bad id with spaces"); got == "bad id with spaces" || len(got) != 36 {
+		t.Fatalf("unusable id should be replaced, got %q", got)
+	}
+	if !strings.Contains(buf.String(), `"request_id":"client-abc-123"`) {
+		t.Fatalf("request log line lacks the request id: %s", buf.String())
+	}
+}
@@ -0,0 +1,186 @@
+package rpmutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// LeadMagic starts the 96-byte lead every RPM package begins with
+var LeadMagic = []byte{0xed, 0xab, 0xee, 0xdb}
+
+// headerMagic starts the signature and main header structures (magic plus version 1)
+var headerMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+
+const (
+	leadSize       = 96
+	headerPrefix   = 16 // magic, 4 reserved bytes, index count, store size
+	indexEntrySize = 16
+	// limits on untrusted headers; real packages stay far below them
+	maxIndexEntries = 1 << 16
+	maxStoreSize    = 64 << 20
+)
+
+// Header data types
+const (
+	typeString      = 6
+	typeStringArray = 8
+	typeI18NString  = 9
+)
+
+// stringTags maps the scalar string tags of the main header to their metadata keys
+var stringTags = map[uint32]string{
+	1000: "name",
+	1001: "version",
+	1002: "release",
+	1004: "summary",
+	1005: "description",
+	1007: "build_host",
+	1011: "vendor",
+	1014: "license",
+	1015: "packager",
+	1016: "group",
+	1020: "url",
+	1021: "os",
+	1022: "arch",
+	1044: "source_rpm",
+	1124: "payload_format",
+	1125: "payload_compressor",
+}
+
+// arrayTags maps the dependency string array tags of the main header to their metadata keys
+var arrayTags = map[uint32]string{
+	1047: "provides",
+	1049: "requires",
+	1054: "conflicts",
+	1090: "obsoletes",
+}
+
+// IsRPM reports whether data starts with the RPM lead magic
+func IsRPM(data []byte) bool {
+	return bytes.HasPrefix(data, LeadMagic)
+}
+
+// indexEntry is one tag of a header index
+type indexEntry struct {
+	tag, typ, offset, count uint32
+}
+
+// header is a parsed header structure: its index and the data store the entries point into
+type header struct {
+	entries []indexEntry
+	store   []byte
+}
+
+// Analyze parses the lead, skips the signature header and reports the package metadata found in
+// the main header. The payload is not read.
+func Analyze(data []byte) (map[string]any, error) {
+	if len(data) < leadSize || !IsRPM(data) {
+		return nil, fmt.Errorf("not rpm")
+	}
+	m := map[string]any{
+		"lead_version": fmt.Sprintf("%d.%d", data[4], data[5]),
+		"source":       binary.BigEndian.Uint16(data[6:8]) == 1,
+	}
+	sig, next, err := readHeader(data, leadSize)
+	if err != nil {
+		return nil, fmt.Errorf("signature header: %w", err)
+	}
+	// the signature store is padded so the main header starts 8-byte aligned
+	next += (8 - len(sig.store)%8) % 8
+	hdr, _, err := readHeader(data, next)
+	if err != nil {
+		return nil, fmt.Errorf("main header: %w", err)
+	}
+	for k, v := range parseRPMHeaders(hdr) {
+		m[k] = v
+	}
+	m["header_entries"] = len(hdr.entries)
+	return m, nil
+}
+
+// readHeader parses the header structure at off and returns it with the offset just past it
+func readHeader(data []byte, off int) (*header, int, error) {
+	if off < 0 || len(data)-off < headerPrefix {
+		return nil, 0, fmt.Errorf("truncated at %d", off)
+	}
+	if !bytes.Equal(data[off:off+4], headerMagic) {
+		return nil, 0, fmt.Errorf("bad magic at %d", off)
+	}
+	nindex := binary.BigEndian.Uint32(data[off+8:])
+	hsize := binary.BigEndian.Uint32(data[off+12:])
+	if nindex > maxIndexEntries || hsize > maxStoreSize {
+		return nil, 0, fmt.Errorf("header too large (%d entries, %d bytes)", nindex, hsize)
+	}
+	start := off + headerPrefix
+	storeStart := start + int(nindex)*indexEntrySize
+	end := storeStart + int(hsize)
+	if end > len(data) {
+		return nil, 0, fmt.Errorf("truncated header (%d bytes needed, %d available)", end-off, len(data)-off)
+	}
+	h := &header{entries: make([]indexEntry, nindex), store: data[storeStart:end]}
+	for i := range h.entries {
+		e := data[start+i*indexEntrySize:]
+		h.entries[i] = indexEntry{
+			tag:    binary.BigEndian.Uint32(e[0:]),
+			typ:    binary.BigEndian.Uint32(e[4:]),
+			offset: binary.BigEndian.Uint32(e[8:]),
+			count:  binary.BigEndian.Uint32(e[12:]),
+		}
+	}
+	return h, end, nil
+}
+
+// parseRPMHeaders extracts the known string and dependency array tags of a main header. For I18N
+// strings only the first (default locale) translation is kept. Entries pointing outside the
+// store are skipped.
+func parseRPMHeaders(h *header) map[string]any {
+	m := map[string]any{}
+	for _, e := range h.entries {
+		if key, ok := arrayTags[e.tag]; ok && e.typ == typeStringArray {
+			if vals, ok := stringArray(h.store, e.offset, e.count); ok {
+				m[key] = vals
+			}
+			continue
+		}
+		key, ok := stringTags[e.tag]
+		if !ok || (e.typ != typeString && e.typ != typeI18NString) {
+			continue
+		}
+		if s, ok := cString(h.store, e.offset); ok {
+			m[key] = s
+		}
+	}
+	return m
+}
+
+// stringArray reads count consecutive NUL-terminated strings starting at off in store. It fails
+// when the strings would run past the end of the store.
+func stringArray(store []byte, off, count uint32) ([]string, bool) {
+	// every string takes at least its terminator, so a larger count cannot fit
+	if uint64(count) > uint64(len(store)) {
+		return nil, false
+	}
+	vals := make([]string, 0, count)
+	for i := uint32(0); i < count; i++ {
+		s, ok := cString(store, off)
+		if !ok {
+			return nil, false
+		}
+		vals = append(vals, s)
+		off += uint32(len(s)) + 1
+	}
+	return vals, true
+}
+
+// cString reads the NUL-terminated string at off in store
+func cString(store []byte, off uint32) (string, bool) {
+	if uint64(off) >= uint64(len(store)) {
+		return "", false
+	}
+	n := bytes.IndexByte(store[off:], 0)
+	if n < 0 {
+		return "", false
+	}
+	return string(store[off : int(off)+n]), true
+}
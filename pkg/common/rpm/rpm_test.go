@@ -0,0 +1,158 @@
+package rpmutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// rpmTag is one main header entry of a test package; values holds count strings
+type rpmTag struct {
+	tag    uint32
+	typ    uint32
+	values []string
+}
+
+// buildRPM assembles a package with a lead, an empty signature header and a main header holding
+// tags. The payload is omitted since the analyzer never reads it.
+func buildRPM(t *testing.T, tags ...rpmTag) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	lead := make([]byte, leadSize)
+	copy(lead, LeadMagic)
+	lead[4], lead[5] = 3, 0
+	copy(lead[10:], "hello-1.0-1")
+	buf.Write(lead)
+	writeHeader(&buf, nil, nil)
+	var store bytes.Buffer
+	entries := make([]indexEntry, 0, len(tags))
+	for _, tg := range tags {
+		entries = append(entries, indexEntry{tag: tg.tag, typ: tg.typ, offset: uint32(store.Len()), count: uint32(len(tg.values))})
+		for _, v := range tg.values {
+			store.WriteString(v)
+			store.WriteByte(0)
+		}
+	}
+	writeHeader(&buf, entries, store.Bytes())
+	return buf.Bytes()
+}
+
+// writeHeader appends a header structure, padding the store to 8 bytes like rpm does for the
+// signature header
+func writeHeader(buf *bytes.Buffer, entries []indexEntry, store []byte) {
+	buf.Write(headerMagic)
+	buf.Write(make([]byte, 4))
+	_ = binary.Write(buf, binary.BigEndian, []uint32{uint32(len(entries)), uint32(len(store))})
+	for _, e := range entries {
+		_ = binary.Write(buf, binary.BigEndian, []uint32{e.tag, e.typ, e.offset, e.count})
+	}
+	buf.Write(store)
+	buf.Write(make([]byte, (8-len(store)%8)%8))
+}
+
+func TestAnalyze(t *testing.T) {
+	data := buildRPM(t,
+		rpmTag{1000, typeString, []string{"hello"}},
+		rpmTag{1001, typeString, []string{"1.0"}},
+		rpmTag{1002, typeString, []string{"1.el9"}},
+		rpmTag{1004, typeI18NString, []string{"Greets the world", "Grüßt die Welt"}},
+		rpmTag{1022, typeString, []string{"x86_64"}},
+		rpmTag{9999, typeString, []string{"unknown tag"}},
+	)
+	if !IsRPM(data) {
+		t.Fatal("IsRPM false for a package")
+	}
+	m, err := Analyze(data)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	want := map[string]any{"name": "hello", "version": "1.0", "release": "1.el9", "summary": "Greets the world", "arch": "x86_64", "lead_version": "3.0", "source": false, "header_entries": 6}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("%s=%v want %v", k, m[k], v)
+		}
+	}
+	if len(m) != len(want) {
+		t.Errorf("unexpected keys in %v", m)
+	}
+}
+
+func TestAnalyzeDependencyArrays(t *testing.T) {
+	requires := []string{"libc.so.6()(64bit)", "rtld(GNU_HASH)", "bash"}
+	data := buildRPM(t,
+		rpmTag{1000, typeString, []string{"hello"}},
+		rpmTag{1049, typeStringArray, requires},
+		rpmTag{1047, typeStringArray, []string{"hello", "hello(x86-64)"}},
+		rpmTag{1054, typeStringArray, []string{"hello-legacy"}},
+		rpmTag{1090, typeStringArray, []string{"hello-old", "greeter"}},
+		rpmTag{1001, typeString, []string{"1.0"}},
+	)
+	m, err := Analyze(data)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	want := map[string][]string{
+		"requires":  requires,
+		"provides":  {"hello", "hello(x86-64)"},
+		"conflicts": {"hello-legacy"},
+		"obsoletes": {"hello-old", "greeter"},
+	}
+	for k, v := range want {
+		got, _ := m[k].([]string)
+		if len(got) != len(v) {
+			t.Fatalf("%s has %d entries, want count %d: %v", k, len(got), len(v), got)
+		}
+		for i := range v {
+			if got[i] != v[i] {
+				t.Errorf("%s[%d]=%q want %q", k, i, got[i], v[i])
+			}
+		}
+	}
+	// the array must not disturb the scalar after it
+	if m["name"] != "hello" || m["version"] != "1.0" {
+		t.Errorf("name=%v version=%v", m["name"], m["version"])
+	}
+
+	// a count running past the store drops the tag instead of reading beyond it
+	for _, count := range []uint32{4, 1 << 30} {
+		bad := buildRPM(t, rpmTag{1049, typeStringArray, requires})
+		off := len(bad) - 40 - indexEntrySize + 12 // count field of the only main header entry
+		binary.BigEndian.PutUint32(bad[off:], count)
+		m, err = Analyze(bad)
+		if err != nil {
+			t.Fatalf("Analyze: %v", err)
+		}
+		if _, ok := m["requires"]; ok {
+			t.Errorf("count %d past the store was read: %v", count, m["requires"])
+		}
+	}
+}
+
+func TestAnalyzeRejectsMalformed(t *testing.T) {
+	good := buildRPM(t, rpmTag{1000, typeString, []string{"hello"}})
+	cases := map[string][]byte{
+		"not rpm":   []byte("definitely not an rpm package"),
+		"lead only": good[:leadSize],
+		"truncated": good[:len(good)-4],
+	}
+	huge := append([]byte{}, good...)
+	binary.BigEndian.PutUint32(huge[leadSize+8:], maxIndexEntries+1)
+	cases["huge index"] = huge
+	for name, data := range cases {
+		if _, err := Analyze(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// an entry pointing past the store is skipped rather than read out of bounds
+	bad := buildRPM(t, rpmTag{1000, typeString, []string{"hello"}})
+	off := len(bad) - 8 - indexEntrySize + 8 // offset field of the only main header entry
+	binary.BigEndian.PutUint32(bad[off:], 1<<20)
+	m, err := Analyze(bad)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if _, ok := m["name"]; ok {
+		t.Errorf("out of range entry was read: %v", m["name"])
+	}
+}
@@ -0,0 +1,130 @@
+package sqliteutil
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/driver/sqlite" // registers the sqlite3 database/sql driver
+)
+
+// Magic is the 16-byte header every SQLite 3 database file starts with
+var Magic = []byte("SQLite format 3\x00")
+
+// DefaultTimeout bounds a whole analysis; queries are interrupted when it expires
+const DefaultTimeout = 5 * time.Second
+
+// maxTables caps how many tables are listed and counted
+const maxTables = 256
+
+// IsSQLite reports whether data starts with the SQLite 3 header
+func IsSQLite(data []byte) bool {
+	return bytes.HasPrefix(data, Magic)
+}
+
+// AnalyzeFile inspects the SQLite database at path and reports its page size, schema and user
+// versions, and the tables with their row counts. Untrusted files are opened read-only and
+// immutable (no journal or WAL is touched), views, triggers and virtual tables are never
+// evaluated, and all queries stop once ctx is done.
+func AnalyzeFile(ctx context.Context, path string) (map[string]any, error) {
+	q := url.Values{}
+	q.Set("mode", "ro")
+	q.Set("immutable", "1")
+	q.Set("_query_only", "1")
+	db, err := sql.Open(sqlite.DriverName, "file:"+path+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// keep functions declared in the file's schema from running
+	if _, err := conn.ExecContext(ctx, "PRAGMA trusted_schema = OFF"); err != nil {
+		return nil, err
+	}
+
+	pragma := func(name string) (int64, error) {
+		var v int64
+		err := conn.QueryRowContext(ctx, "PRAGMA "+name).Scan(&v)
+		return v, err
+	}
+	pageSize, err := pragma("page_size")
+	if err != nil {
+		return nil, fmt.Errorf("not a readable sqlite database: %w", err)
+	}
+	pageCount, _ := pragma("page_count")
+	schemaVersion, err := pragma("schema_version")
+	if err != nil {
+		return nil, err
+	}
+	userVersion, _ := pragma("user_version")
+	var encoding string
+	_ = conn.QueryRowContext(ctx, "PRAGMA encoding").Scan(&encoding)
+
+	rows, err := conn.QueryContext(ctx,
+		"SELECT name, COALESCE(sql, '') FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	type table struct{ name, ddl string }
+	var tables []table
+	total := 0
+	for rows.Next() {
+		var t table
+		if err := rows.Scan(&t.name, &t.ddl); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		total++
+		if len(tables) < maxTables {
+			tables = append(tables, t)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	list := make([]map[string]any, 0, len(tables))
+	for _, t := range tables {
+		entry := map[string]any{"name": t.name}
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(t.ddl)), "CREATE VIRTUAL") {
+			// counting would run the module's code
+			entry["virtual"] = true
+		} else {
+			var n int64
+			if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+quoteIdent(t.name)).Scan(&n); err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				entry["error"] = err.Error()
+			} else {
+				entry["rows"] = n
+			}
+		}
+		list = append(list, entry)
+	}
+	return map[string]any{
+		"page_size":      pageSize,
+		"page_count":     pageCount,
+		"schema_version": schemaVersion,
+		"user_version":   userVersion,
+		"encoding":       encoding,
+		"table_count":    total,
+		"tables":         list,
+		"truncated":      total > len(tables),
+	}, nil
+}
+
+// quoteIdent quotes an SQL identifier, doubling embedded quotes
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
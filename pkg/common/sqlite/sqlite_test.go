@@ -0,0 +1,77 @@
+package sqliteutil
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+)
+
+// buildDB creates a small database with two tables and a view
+func buildDB(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sample.db")
+	db, err := sql.Open(sqlite.DriverName, path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`PRAGMA user_version = 7`,
+		`CREATE TABLE packages (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE "odd ""name""" (v TEXT)`,
+		`CREATE VIEW package_names AS SELECT name FROM packages`,
+		`INSERT INTO packages (name) VALUES ('a'), ('b'), ('c')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return path
+}
+
+func TestAnalyzeFile(t *testing.T) {
+	path := buildDB(t)
+	head := make([]byte, 16)
+	f, _ := os.Open(path)
+	f.Read(head)
+	f.Close()
+	if !IsSQLite(head) {
+		t.Fatalf("expected sqlite magic, got %q", head)
+	}
+	before, _ := os.ReadFile(path)
+
+	m, err := AnalyzeFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+	if m["page_size"].(int64) <= 0 || m["user_version"] != int64(7) || m["table_count"] != 2 {
+		t.Errorf("unexpected header fields: %v", m)
+	}
+	tables := m["tables"].([]map[string]any)
+	if len(tables) != 2 || tables[0]["name"] != `odd "name"` || tables[1]["name"] != "packages" || tables[1]["rows"] != int64(3) {
+		t.Errorf("unexpected tables: %v", tables)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Error("analysis modified the database file")
+	}
+}
+
+func TestAnalyzeFileRejectsGarbage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "junk.db")
+	os.WriteFile(path, append(append([]byte{}, Magic...), make([]byte, 64)...), 0644)
+	if _, err := AnalyzeFile(context.Background(), path); err == nil {
+		t.Error("expected error for a truncated database")
+	}
+}
+
+func TestAnalyzeFileHonoursContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := AnalyzeFile(ctx, buildDB(t)); err == nil {
+		t.Error("expected error for a cancelled context")
+	}
+}
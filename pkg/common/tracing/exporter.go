@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"go4pack/pkg/common/logger"
+)
+
+// InMemoryExporter keeps finished spans in memory (tests and debugging)
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// ExportSpan implements Exporter
+func (e *InMemoryExporter) ExportSpan(d SpanData) {
+	e.mu.Lock()
+	e.spans = append(e.spans, d)
+	e.mu.Unlock()
+}
+
+// Spans returns a copy of the recorded spans in the order they ended
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// LogExporter writes each finished span as a structured "span" log event
+type LogExporter struct{}
+
+// ExportSpan implements Exporter
+func (LogExporter) ExportSpan(d SpanData) {
+	ev := logger.GetLogger().Info().
+		Str("name", d.Name).
+		Str("trace_id", d.SpanContext.TraceID).
+		Str("span_id", d.SpanContext.SpanID).
+		Str("parent_span_id", d.ParentSpanID).
+		Dur("duration", d.End.Sub(d.Start))
+	if len(d.Links) > 0 {
+		ev = ev.Interface("links", d.Links)
+	}
+	if len(d.Attributes) > 0 {
+		ev = ev.Interface("attributes", d.Attributes)
+	}
+	if d.Error != "" {
+		ev = ev.Str("error", d.Error)
+	}
+	ev.Msg("span")
+}
+
+// NewExporter returns the exporter for a configured name: "" or "none" disables tracing, "log"
+// writes spans to the application log.
+func NewExporter(name string) (Exporter, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return nil, nil
+	case "log":
+		return LogExporter{}, nil
+	}
+	return nil, fmt.Errorf("unknown tracing exporter %q", name)
+}
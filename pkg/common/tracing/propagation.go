@@ -0,0 +1,30 @@
+package tracing
+
+import "strings"
+
+// ParseTraceparent decodes a W3C traceparent header ("00-<trace-id>-<parent-id>-<flags>")
+func ParseTraceparent(h string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	if !isLowerHex(parts[1]) || !isLowerHex(parts[2]) ||
+		parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return SpanContext{}, false
+	}
+	return SpanContext{TraceID: parts[1], SpanID: parts[2]}, true
+}
+
+// Traceparent encodes sc as a W3C traceparent header value (sampled)
+func Traceparent(sc SpanContext) string {
+	return "00-" + sc.TraceID + "-" + sc.SpanID + "-01"
+}
+
+func isLowerHex(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
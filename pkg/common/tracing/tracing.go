@@ -0,0 +1,183 @@
+// Package tracing provides lightweight request tracing modelled on OpenTelemetry: spans carry W3C
+// trace/span IDs, parent relationships and links, and finished spans are handed to an Exporter.
+// Without an exporter every operation is a no-op and Start returns a nil *Span, whose methods are
+// safe to call.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// SpanContext identifies a span within a trace (hex encoded W3C IDs)
+type SpanContext struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool { return sc.TraceID != "" && sc.SpanID != "" }
+
+// SpanData is the immutable record of a finished span passed to exporters
+type SpanData struct {
+	Name         string         `json:"name"`
+	SpanContext  SpanContext    `json:"span_context"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Links        []SpanContext  `json:"links,omitempty"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// Exporter receives finished spans
+type Exporter interface {
+	ExportSpan(SpanData)
+}
+
+var (
+	mu       sync.RWMutex
+	exporter Exporter
+)
+
+// SetExporter installs the span exporter; nil disables tracing
+func SetExporter(e Exporter) {
+	mu.Lock()
+	exporter = e
+	mu.Unlock()
+}
+
+func currentExporter() Exporter {
+	mu.RLock()
+	defer mu.RUnlock()
+	return exporter
+}
+
+// Enabled reports whether spans are being recorded
+func Enabled() bool { return currentExporter() != nil }
+
+// Span is an in-progress operation; a nil *Span records nothing
+type Span struct {
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+	exp   Exporter
+}
+
+// StartOption customizes a new span
+type StartOption func(*SpanData)
+
+// WithLinks relates the span to spans in other traces or to causally earlier work, e.g. the
+// request that scheduled an asynchronous job. Invalid contexts are ignored.
+func WithLinks(links ...SpanContext) StartOption {
+	return func(d *SpanData) {
+		for _, l := range links {
+			if l.IsValid() {
+				d.Links = append(d.Links, l)
+			}
+		}
+	}
+}
+
+// WithRemoteParent makes the span a child of a span from another process (see ParseTraceparent)
+func WithRemoteParent(parent SpanContext) StartOption {
+	return func(d *SpanData) {
+		if parent.IsValid() {
+			d.SpanContext.TraceID = parent.TraceID
+			d.ParentSpanID = parent.SpanID
+		}
+	}
+}
+
+type spanKey struct{}
+
+// Start begins a span that is a child of the span in ctx, if any. It returns ctx unchanged and a
+// nil span when tracing is disabled.
+func Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	exp := currentExporter()
+	if exp == nil {
+		return ctx, nil
+	}
+	d := SpanData{Name: name, Start: time.Now()}
+	if parent := SpanContextFromContext(ctx); parent.IsValid() {
+		d.SpanContext.TraceID = parent.TraceID
+		d.ParentSpanID = parent.SpanID
+	}
+	for _, opt := range opts {
+		opt(&d)
+	}
+	if d.SpanContext.TraceID == "" {
+		d.SpanContext.TraceID = randomID(16)
+	}
+	d.SpanContext.SpanID = randomID(8)
+	s := &Span{data: d, exp: exp}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SpanFromContext returns the active span, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SpanContextFromContext returns the active span's context (zero when there is none)
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	return SpanFromContext(ctx).SpanContext()
+}
+
+// SpanContext returns the span's identifiers
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetAttribute records a key/value on the span
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]any)
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetError marks the span as failed; nil is ignored
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Error = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and exports it; later calls are ignored
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	d := s.data
+	s.mu.Unlock()
+	s.exp.ExportSpan(d)
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
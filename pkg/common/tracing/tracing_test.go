@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStartDisabledIsNoop(t *testing.T) {
+	SetExporter(nil)
+	ctx := context.Background()
+	got, span := Start(ctx, "noop")
+	if span != nil || got != ctx {
+		t.Fatalf("expected nil span and unchanged context when disabled")
+	}
+	// nil spans must be safe to use
+	span.SetAttribute("k", "v")
+	span.SetError(errors.New("boom"))
+	span.End()
+	if SpanContextFromContext(got).IsValid() {
+		t.Errorf("unexpected span context")
+	}
+}
+
+func TestStartParentAndLinks(t *testing.T) {
+	exp := &InMemoryExporter{}
+	SetExporter(exp)
+	t.Cleanup(func() { SetExporter(nil) })
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	child.End()
+	_, linked := Start(context.Background(), "linked", WithLinks(parent.SpanContext(), SpanContext{}))
+	linked.SetError(errors.New("failed"))
+	linked.End()
+	parent.End()
+	parent.End()
+
+	spans := exp.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 exported spans, got %d", len(spans))
+	}
+	c, l, p := spans[0], spans[1], spans[2]
+	if c.SpanContext.TraceID != p.SpanContext.TraceID || c.ParentSpanID != p.SpanContext.SpanID {
+		t.Errorf("child not parented: %+v / %+v", c, p)
+	}
+	if l.SpanContext.TraceID == p.SpanContext.TraceID || l.ParentSpanID != "" {
+		t.Errorf("linked span should start a new trace: %+v", l)
+	}
+	if len(l.Links) != 1 || l.Links[0] != p.SpanContext || l.Error != "failed" {
+		t.Errorf("unexpected linked span %+v", l)
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	sc := SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	got, ok := ParseTraceparent(Traceparent(sc))
+	if !ok || got != sc {
+		t.Fatalf("round trip: got %+v ok=%v", got, ok)
+	}
+	for _, bad := range []string{"", "00-xyz-00f067aa0ba902b7-01", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultHistorySize is the number of samples kept when StartHistory is given a non-positive size
+const DefaultHistorySize = 300
+
+// Sample is one tick of pool activity; the counters are deltas since the previous sample
+type Sample struct {
+	At        time.Time `json:"at"`
+	Running   int       `json:"running"`
+	Free      int       `json:"free"`
+	Submitted uint64    `json:"submitted"`
+	Completed uint64    `json:"completed"`
+}
+
+var (
+	histMu   sync.Mutex
+	samples  []Sample // ring buffer, histNext is the slot written next
+	histNext int
+	histFull bool
+	histStop chan struct{}
+	histDone chan struct{}
+	// counters at the previous sample, for the deltas
+	lastSubmitted, lastCompleted uint64
+)
+
+// StartHistory begins sampling the pool every interval into a ring of size samples, replacing
+// any history already collected. Calling it while sampling restarts the ticker.
+func StartHistory(size int, interval time.Duration) {
+	StopHistory()
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	mu.RLock()
+	sub, comp := stats.Submitted, stats.Completed
+	mu.RUnlock()
+
+	histMu.Lock()
+	samples, histNext, histFull = make([]Sample, size), 0, false
+	lastSubmitted, lastCompleted = sub, comp
+	stop, done := make(chan struct{}), make(chan struct{})
+	histStop, histDone = stop, done
+	histMu.Unlock()
+
+	go func() {
+		defer close(done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				recordSample()
+			}
+		}
+	}()
+}
+
+// StopHistory stops the sampler and waits for it to exit. The collected samples are kept.
+func StopHistory() {
+	histMu.Lock()
+	stop, done := histStop, histDone
+	histStop, histDone = nil, nil
+	histMu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// recordSample appends the current pool state to the ring, overwriting the oldest when full
+func recordSample() {
+	mu.RLock()
+	sub, comp := stats.Submitted, stats.Completed
+	mu.RUnlock()
+	s := Sample{At: time.Now().UTC(), Running: Running(), Free: Free()}
+
+	histMu.Lock()
+	defer histMu.Unlock()
+	if len(samples) == 0 {
+		return
+	}
+	s.Submitted, s.Completed = sub-lastSubmitted, comp-lastCompleted
+	lastSubmitted, lastCompleted = sub, comp
+	samples[histNext] = s
+	histNext = (histNext + 1) % len(samples)
+	if histNext == 0 {
+		histFull = true
+	}
+}
+
+// History returns the collected samples, oldest first
+func History() []Sample {
+	histMu.Lock()
+	defer histMu.Unlock()
+	if !histFull {
+		return append([]Sample{}, samples[:histNext]...)
+	}
+	return append(append([]Sample{}, samples[histNext:]...), samples[:histNext]...)
+}
@@ -0,0 +1,21 @@
+package worker
+
+import "go4pack/pkg/common/metrics"
+
+// statValue reads one pool counter under the stats lock
+func statValue(get func() uint64) func() float64 {
+	return func() float64 {
+		mu.RLock()
+		defer mu.RUnlock()
+		return float64(get())
+	}
+}
+
+func init() {
+	metrics.NewGaugeFunc("go4pack_pool_capacity", "Worker pool capacity.", func() float64 { return float64(Cap()) })
+	metrics.NewGaugeFunc("go4pack_pool_running", "Worker pool jobs currently running.", func() float64 { return float64(Running()) })
+	metrics.NewGaugeFunc("go4pack_pool_free", "Worker pool idle slots.", func() float64 { return float64(Free()) })
+	metrics.NewCounterFunc("go4pack_pool_jobs_submitted_total", "Jobs submitted to the worker pool.", statValue(func() uint64 { return stats.Submitted }))
+	metrics.NewCounterFunc("go4pack_pool_jobs_completed_total", "Jobs finished by the worker pool.", statValue(func() uint64 { return stats.Completed }))
+	metrics.NewCounterFunc("go4pack_pool_jobs_timeouts_total", "Jobs cancelled by their deadline.", statValue(func() uint64 { return stats.Timeouts }))
+}
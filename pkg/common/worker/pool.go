@@ -1,6 +1,9 @@
 package worker
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -10,13 +13,20 @@ import (
 
 type Job func()
 
+// ErrShutdown is returned for jobs submitted after Shutdown began
+var ErrShutdown = errors.New("worker pool is shutting down")
+
 var (
-	pool     *ants.Pool
-	initOnce sync.Once
-	mu       sync.RWMutex
-	stats    = struct {
+	pool       *ants.Pool
+	initOnce   sync.Once
+	mu         sync.RWMutex
+	configured int  // capacity last requested via Init or Resize
+	closing    bool // set by Shutdown; no further jobs are accepted
+	pending    int  // submitted jobs that have not finished yet
+	stats      = struct {
 		Submitted uint64
 		Completed uint64
+		Timeouts  uint64
 		LastErr   string
 		LastDur   time.Duration
 		LastAt    time.Time
@@ -28,10 +38,33 @@ func Init(size int) error {
 	var err error
 	initOnce.Do(func() {
 		pool, err = ants.NewPool(size, ants.WithNonblocking(true))
+		if err == nil {
+			mu.Lock()
+			configured = size
+			mu.Unlock()
+		}
 	})
 	return err
 }
 
+// Resize changes the pool capacity at runtime. Shrinking does not interrupt running jobs; the
+// extra workers exit as they finish. The pool is initialized with n workers if it isn't yet.
+func Resize(n int) error {
+	if n <= 0 {
+		return errors.New("pool size must be positive")
+	}
+	if pool == nil {
+		if err := Init(n); err != nil {
+			return err
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	pool.Tune(n)
+	configured = n
+	return nil
+}
+
 // Submit enqueues a job for asynchronous execution.
 func Submit(j Job) error {
 	if pool == nil {
@@ -39,30 +72,124 @@ func Submit(j Job) error {
 			return err
 		}
 	}
-	mu.Lock()
-	stats.Submitted++
-	mu.Unlock()
-	return pool.Submit(func() {
+	if err := admit(); err != nil {
+		return err
+	}
+	return released(pool.Submit(func() {
 		start := time.Now()
 		defer func() {
 			if r := recover(); r != nil {
 				log.Error().Interface("panic", r).Msg("worker panic recovered")
-				mu.Lock()
-				stats.LastErr = "panic"
-				stats.Completed++
-				stats.LastDur = time.Since(start)
-				stats.LastAt = time.Now()
-				mu.Unlock()
+				finish(start, "panic")
 				return
 			}
-			mu.Lock()
-			stats.Completed++
-			stats.LastDur = time.Since(start)
-			stats.LastAt = time.Now()
-			mu.Unlock()
+			finish(start, "")
 		}()
 		j()
-	})
+	}))
+}
+
+// SubmitWithContext enqueues a job bounded by ctx. The job keeps its worker until it returns, so
+// the pool size stays a real bound on concurrency; it must watch ctx to stop early once it ends.
+// A job returning after its deadline counts as a timeout, one returning after cancellation as
+// canceled.
+func SubmitWithContext(ctx context.Context, j func(context.Context)) error {
+	if pool == nil {
+		if err := Init(4); err != nil { // default size
+			return err
+		}
+	}
+	if err := admit(); err != nil {
+		return err
+	}
+	return released(pool.Submit(func() {
+		start := time.Now()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error().Interface("panic", r).Msg("worker panic recovered")
+				finish(start, "panic")
+				return
+			}
+			switch err := ctx.Err(); {
+			case errors.Is(err, context.DeadlineExceeded):
+				log.Warn().Dur("after", time.Since(start)).Msg("worker job timed out")
+				mu.Lock()
+				stats.Timeouts++
+				mu.Unlock()
+				finish(start, "timeout")
+			case err != nil:
+				finish(start, "canceled")
+			default:
+				finish(start, "")
+			}
+		}()
+		j(ctx)
+	}))
+}
+
+// admit counts a job about to be handed to the pool, or refuses it once Shutdown has begun
+func admit() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if closing {
+		return ErrShutdown
+	}
+	stats.Submitted++
+	pending++
+	return nil
+}
+
+// released stops tracking a job the pool rejected, which will never reach finish
+func released(err error) error {
+	if err != nil {
+		mu.Lock()
+		pending--
+		mu.Unlock()
+	}
+	return err
+}
+
+// Shutdown stops accepting jobs and waits for the submitted ones to finish, then releases the
+// pool. If ctx ends first the pool is released anyway and an error reports how many jobs were
+// still running; those jobs are not interrupted.
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	closing = true
+	p := pool
+	mu.Unlock()
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	var err error
+	for err == nil {
+		mu.RLock()
+		n := pending
+		mu.RUnlock()
+		if n == 0 {
+			break
+		}
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			err = fmt.Errorf("worker shutdown: %d jobs still running: %w", n, ctx.Err())
+		}
+	}
+	if p != nil {
+		p.Release()
+	}
+	return err
+}
+
+// finish records a job leaving the pool; errStr is empty on success
+func finish(start time.Time, errStr string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if errStr != "" {
+		stats.LastErr = errStr
+	}
+	stats.Completed++
+	stats.LastDur = time.Since(start)
+	stats.LastAt = time.Now()
+	pending--
 }
 
 // Cap returns pool capacity.
@@ -94,14 +221,16 @@ func StatsSnapshot() map[string]any {
 	mu.RLock()
 	defer mu.RUnlock()
 	return map[string]any{
-		"capacity":         Cap(),
-		"running":          Running(),
-		"free":             Free(),
-		"submitted":        stats.Submitted,
-		"completed":        stats.Completed,
-		"queued_est":       int(stats.Submitted - stats.Completed - uint64(Running())),
-		"last_error":       stats.LastErr,
-		"last_duration_ms": stats.LastDur.Milliseconds(),
-		"last_finished_at": stats.LastAt,
+		"capacity":            Cap(),
+		"configured_capacity": configured,
+		"running":             Running(),
+		"free":                Free(),
+		"submitted":           stats.Submitted,
+		"completed":           stats.Completed,
+		"timeouts":            stats.Timeouts,
+		"queued_est":          int(stats.Submitted - stats.Completed - uint64(Running())),
+		"last_error":          stats.LastErr,
+		"last_duration_ms":    stats.LastDur.Milliseconds(),
+		"last_finished_at":    stats.LastAt,
 	}
 }
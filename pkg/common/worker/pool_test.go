@@ -0,0 +1,247 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResize(t *testing.T) {
+	if err := Init(2); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	t.Cleanup(func() { _ = Resize(2) })
+	completed := StatsSnapshot()["completed"].(uint64)
+
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		if err := Submit(func() { defer wg.Done(); <-release }); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	// the pool is nonblocking, so a saturated pool refuses further jobs until it grows
+	if err := Submit(func() {}); err == nil {
+		t.Fatalf("submit to a saturated pool should fail")
+	}
+
+	if err := Resize(4); err != nil {
+		t.Fatalf("resize up: %v", err)
+	}
+	if Cap() != 4 {
+		t.Fatalf("Cap() = %d after resize up, want 4", Cap())
+	}
+	wg.Add(1)
+	if err := Submit(func() { defer wg.Done(); <-release }); err != nil {
+		t.Fatalf("submit after resize up: %v", err)
+	}
+
+	if err := Resize(1); err != nil {
+		t.Fatalf("resize down: %v", err)
+	}
+	if Cap() != 1 {
+		t.Fatalf("Cap() = %d after resize down, want 1", Cap())
+	}
+	if got := StatsSnapshot()["configured_capacity"]; got != 1 {
+		t.Fatalf("configured_capacity = %v, want 1", got)
+	}
+	close(release)
+	wg.Wait()
+	// running jobs finish after a shrink; the pool then accepts work within its new capacity
+	deadline := time.Now().Add(2 * time.Second)
+	for Running() > 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := Submit(func() {}); err != nil {
+		t.Fatalf("submit after shrink: %v", err)
+	}
+	// the rejected submit is never run, so four jobs complete
+	waitCompleted(t, completed+4)
+
+	for _, n := range []int{0, -3} {
+		if err := Resize(n); err == nil {
+			t.Fatalf("Resize(%d) should fail", n)
+		}
+	}
+	if Cap() != 1 {
+		t.Fatalf("invalid resize changed capacity to %d", Cap())
+	}
+}
+
+func TestSubmitWithContextTimeout(t *testing.T) {
+	if err := Init(2); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	before := StatsSnapshot()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	release := make(chan struct{})
+	if err := SubmitWithContext(ctx, func(ctx context.Context) {
+		<-ctx.Done()
+		<-release // slow to notice, like an analysis between two context checks
+	}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+
+	// the job holds its worker past the deadline instead of leaking a goroutine
+	time.Sleep(50 * time.Millisecond)
+	if got := Running(); got != 1 {
+		t.Fatalf("running = %d after the deadline, want the job to keep its worker", got)
+	}
+	if got := StatsSnapshot()["completed"].(uint64); got != before["completed"].(uint64) {
+		t.Fatalf("job counted as finished while still running, completed = %d", got)
+	}
+	close(release)
+	waitCompleted(t, before["completed"].(uint64)+1)
+	snap := StatsSnapshot()
+	if snap["timeouts"].(uint64) != before["timeouts"].(uint64)+1 {
+		t.Fatalf("timeouts = %v, want %v", snap["timeouts"], before["timeouts"].(uint64)+1)
+	}
+	if snap["last_error"] != "timeout" {
+		t.Fatalf("last_error = %q, want timeout", snap["last_error"])
+	}
+
+	// a job finishing in time is tracked normally and is not a timeout
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second)
+	defer cancel2()
+	ran := make(chan struct{})
+	if err := SubmitWithContext(ctx2, func(context.Context) { close(ran) }); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	<-ran
+	waitCompleted(t, snap["completed"].(uint64)+1)
+	if got := StatsSnapshot()["timeouts"].(uint64); got != snap["timeouts"].(uint64) {
+		t.Fatalf("fast job counted as timeout: %d", got)
+	}
+}
+
+// waitCompleted blocks until at least n jobs have been recorded as completed
+func waitCompleted(t *testing.T, n uint64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for StatsSnapshot()["completed"].(uint64) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("completed = %v, want at least %d", StatsSnapshot()["completed"], n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	if err := Init(2); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	StartHistory(0, 5*time.Millisecond)
+	t.Cleanup(StopHistory)
+
+	completed := StatsSnapshot()["completed"].(uint64)
+	const jobs = 6
+	for i := 0; i < jobs; i++ {
+		if err := Submit(func() { time.Sleep(time.Millisecond) }); err != nil {
+			// nonblocking pool: retry once the workers drain
+			time.Sleep(5 * time.Millisecond)
+			i--
+		}
+	}
+	waitCompleted(t, completed+jobs)
+	// let a tick pick up the last completion before stopping
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var sub, comp uint64
+		for _, s := range History() {
+			sub += s.Submitted
+			comp += s.Completed
+		}
+		if comp >= jobs {
+			// a rejected Submit still counts as submitted, so only a lower bound holds there
+			if comp != jobs || sub < jobs {
+				t.Fatalf("history sums submitted=%d completed=%d, want >=%d and %d", sub, comp, jobs, jobs)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("history completed sum %d, want %d", comp, jobs)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	StopHistory()
+	n := len(History())
+	if n < 2 {
+		t.Fatalf("history has %d samples, want it to grow", n)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if len(History()) != n {
+		t.Fatalf("history kept growing after StopHistory")
+	}
+
+	// the ring keeps only the newest size samples, oldest first
+	StartHistory(3, time.Hour)
+	for i := 0; i < 5; i++ {
+		recordSample()
+	}
+	h := History()
+	if len(h) != 3 {
+		t.Fatalf("ring of 3 holds %d samples", len(h))
+	}
+	for i := 1; i < len(h); i++ {
+		if h[i].At.Before(h[i-1].At) {
+			t.Fatalf("history not ordered oldest first: %v", h)
+		}
+	}
+}
+
+// reopen undoes Shutdown so later tests get a fresh pool
+func reopen(t *testing.T) {
+	t.Cleanup(func() {
+		mu.Lock()
+		closing = false
+		pool = nil
+		initOnce = sync.Once{}
+		mu.Unlock()
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	reopen(t)
+	if err := Init(2); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	var finished sync.WaitGroup
+	finished.Add(2)
+	release := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		if err := Submit(func() { <-release; finished.Done() }); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+
+	// times out while both jobs are blocked
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- Shutdown(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	if err := Submit(func() {}); err != ErrShutdown {
+		t.Fatalf("submit during shutdown: %v", err)
+	}
+	if err := <-errc; err == nil || !strings.Contains(err.Error(), "2 jobs still running") {
+		t.Fatalf("expected timeout error with 2 running jobs, got %v", err)
+	}
+
+	// blocks until the jobs finish
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		close(release)
+	}()
+	start := time.Now()
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("shutdown returned before the jobs finished")
+	}
+	finished.Wait()
+}
@@ -0,0 +1,219 @@
+package fileio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/logger"
+	rpmutil "go4pack/pkg/common/rpm"
+	sqliteutil "go4pack/pkg/common/sqlite"
+	"go4pack/pkg/common/tracing"
+)
+
+// analysisEnabled reports whether analyzers of the given kind ("elf", "gzip", "sqlite", "rpm", "tar") may run
+func analysisEnabled(kind string) bool {
+	ac := config.Get().Analysis
+	if !ac.Enabled {
+		return false
+	}
+	switch kind {
+	case "elf":
+		return ac.ELF
+	case "gzip":
+		return ac.Gzip
+	case "sqlite":
+		return ac.SQLite
+	case "rpm":
+		return ac.RPM
+	case "tar":
+		return ac.Tar
+	default:
+		return true
+	}
+}
+
+// analyzer pairs an upload detector with the job scheduling its analysis. hash is the stored
+// object key the job reads the upload back from.
+type analyzer struct {
+	kind     string
+	match    func(head []byte, mime string) bool
+	schedule func(ctx context.Context, recID uint, hash string)
+}
+
+// analyzers lists the upload analyzers in match order; analysisKind is the single dispatcher
+// consulting it, so every upload path schedules the same analyses. Supporting a new format is
+// one entry here. The formats are mutually exclusive, so the first match is the only one.
+var analyzers = []analyzer{
+	{"elf", func(head []byte, _ string) bool { return hasELFMagic(head) }, func(ctx context.Context, recID uint, hash string) {
+		scheduleELFAnalysis(ctx, recID, hash)
+	}},
+	{"sqlite", func(head []byte, _ string) bool { return sqliteutil.IsSQLite(head) }, func(ctx context.Context, recID uint, hash string) {
+		scheduleSQLiteAnalysis(ctx, recID, hash)
+	}},
+	{"rpm", func(head []byte, mime string) bool { return rpmutil.IsRPM(head) || mime == rpmMIME }, func(ctx context.Context, recID uint, hash string) {
+		scheduleRpmAnalysis(ctx, recID, hash)
+	}},
+	{"gzip", func(_ []byte, mime string) bool { return isGzipMIME(mime) }, func(ctx context.Context, recID uint, hash string) {
+		scheduleGzipAnalysis(ctx, recID, hash)
+	}},
+	{"tar", isTar, func(ctx context.Context, recID uint, hash string) {
+		scheduleTarAnalysis(ctx, recID, hash)
+	}},
+}
+
+// analysisKind returns the analyzer for an upload given its leading bytes and MIME type, or ""
+// when none matches, the kind is disabled, or the MIME type is outside Analysis.MIMETypes
+func analysisKind(head []byte, mime string) string {
+	if !analysisMIMEAllowed(mime) {
+		return ""
+	}
+	for _, a := range analyzers {
+		if a.match(head, mime) {
+			if analysisEnabled(a.kind) {
+				return a.kind
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// analysisMIMEAllowed applies the Analysis.MIMETypes allowlist (empty allows everything);
+// entries ending in "/" match a whole family
+func analysisMIMEAllowed(mime string) bool {
+	allowed := config.Get().Analysis.MIMETypes
+	if len(allowed) == 0 {
+		return true
+	}
+	base := strings.ToLower(strings.TrimSpace(strings.SplitN(mime, ";", 2)[0]))
+	for _, t := range allowed {
+		t = strings.ToLower(t)
+		if base == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(base, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleAnalysis submits the job of the analyzer registered for kind
+func scheduleAnalysis(ctx context.Context, kind string, recID uint, hash string) {
+	for _, a := range analyzers {
+		if a.kind == kind {
+			a.schedule(ctx, recID, hash)
+			return
+		}
+	}
+}
+
+// analysisJobContext bounds an async analysis by Analysis.TimeoutSeconds. The returned cancel
+// must be called when the job ends, or right away if it was never submitted.
+func analysisJobContext() (context.Context, context.CancelFunc) {
+	if secs := config.Get().Analysis.TimeoutSeconds; secs > 0 {
+		return context.WithTimeout(context.Background(), time.Duration(secs)*time.Second)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// errAnalysisTimeout is recorded for an analysis that outlived its job context; whatever it
+// produced is discarded
+var errAnalysisTimeout = errors.New("analysis timed out")
+
+// ctxReaderAt fails reads once ctx ends, so an analyzer reading the object through it stops at
+// its next read after a timeout rather than holding its worker until it completes
+type ctxReaderAt struct {
+	ctx context.Context
+	r   io.ReaderAt
+}
+
+func (c ctxReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.ReadAt(p, off)
+}
+
+// ctxReadSeeker is ctxReaderAt for analyzers streaming the object
+type ctxReadSeeker struct {
+	ctx context.Context
+	io.ReadSeeker
+}
+
+func (c ctxReadSeeker) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.ReadSeeker.Read(p)
+}
+
+// analysisSkippedTooLarge is the analysis status of records whose input exceeds Analysis.MaxBytes
+const analysisSkippedTooLarge = "skipped_too_large"
+
+// analysisTooLarge reports whether an input of size bytes exceeds the configured analysis limit
+func analysisTooLarge(size int64) bool {
+	max := config.Get().Analysis.MaxBytes
+	return max > 0 && size > max
+}
+
+// analysisTooLargeReason explains why an input of size bytes was not analyzed
+func analysisTooLargeReason(size int64) string {
+	return fmt.Sprintf("input of %d bytes exceeds analysis limit of %d bytes", size, config.Get().Analysis.MaxBytes)
+}
+
+// markAnalysisTooLarge flags rec as skipped, keeping the reason in AnalysisError for meta
+func markAnalysisTooLarge(rec *FileRecord) {
+	msg := analysisTooLargeReason(rec.Size)
+	rec.AnalysisStatus = analysisSkippedTooLarge
+	rec.AnalysisError = &msg
+}
+
+// logAnalysisCompleted emits the "analysis_completed" event shared by every analyzer, so outcomes
+// can be aggregated by kind and status, and feeds the analysis metrics. reqID is the id of the
+// request that scheduled the analysis ("" if unknown). resultSize is the length of the cached JSON (0 when nothing was cached).
+func logAnalysisCompleted(kind string, recID uint, reqID string, start time.Time, inputSize, resultSize int, status string, err error) {
+	analysesTotal.Inc(kind, status)
+	analysisDurations.Observe(time.Since(start).Seconds(), kind)
+	var ev *zerolog.Event
+	if status == "error" {
+		ev = logger.GetLogger().Error().Err(err)
+	} else {
+		ev = logger.GetLogger().Info()
+	}
+	if reqID != "" {
+		ev = ev.Str("request_id", reqID)
+	}
+	ev.Str("kind", kind).
+		Uint("record_id", recID).
+		Int64("duration_ms", time.Since(start).Milliseconds()).
+		Int("input_size", inputSize).
+		Int("result_size", resultSize).
+		Str("status", status).
+		Msg("analysis_completed")
+}
+
+// analysisLink captures the span of the request scheduling an analysis, for linking from the job
+func analysisLink(ctx context.Context) tracing.SpanContext {
+	return tracing.SpanContextFromContext(ctx)
+}
+
+// startAnalysisSpan opens the root span of an async analysis job. Jobs outlive their request, so
+// the originating request span is attached as a link rather than as the parent.
+func startAnalysisSpan(link tracing.SpanContext, kind string, recID uint) *tracing.Span {
+	_, span := tracing.Start(context.Background(), "analysis."+kind, tracing.WithLinks(link))
+	span.SetAttribute("analysis.kind", kind)
+	span.SetAttribute("record_id", recID)
+	return span
+}
+
+// endAnalysisSpan records the job outcome and finishes the span
+func endAnalysisSpan(span *tracing.Span, status string, err error) {
+	span.SetAttribute("analysis.status", status)
+	span.SetError(err)
+	span.End()
+}
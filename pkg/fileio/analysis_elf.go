@@ -1,28 +1,59 @@
 package fileio
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
 	elfutil "go4pack/pkg/common/elf"
+	"go4pack/pkg/common/fs"
 	"go4pack/pkg/common/logger"
 	"go4pack/pkg/common/worker"
 )
 
-// scheduleELFAnalysis submits an async job to analyze ELF and update DB record.
-func scheduleELFAnalysis(recID uint, data []byte) {
-	_ = worker.Submit(func() {
-		logger.GetLogger().Debug().Uint("record_id", recID).Msg("starting async ELF analysis")
+// scheduleELFAnalysis submits an async job to analyze the stored ELF object and update DB record.
+// The object is read through a seekable reader so the job does not pin the upload in memory.
+// Reads fail once Analysis.TimeoutSeconds has passed, so an overlong job gives its worker back
+// at its next read and records a timeout error.
+func scheduleELFAnalysis(ctx context.Context, recID uint, hash string) {
+	link := analysisLink(ctx)
+	reqID := logger.RequestID(ctx)
+	jobCtx, cancel := analysisJobContext()
+	err := worker.SubmitWithContext(jobCtx, func(jobCtx context.Context) {
+		defer cancel()
+		start := time.Now()
+		span := startAnalysisSpan(link, "elf", recID)
+		logger.GetLogger().Debug().Uint("record_id", recID).Str("request_id", reqID).Msg("starting async ELF analysis")
 		db, err := ensureDB()
 		if err != nil {
+			endAnalysisSpan(span, "error", err)
 			return
 		}
-		analysis, aerr := elfutil.AnalyzeBytes(data)
+		var analysis map[string]any
+		var size int64
+		fsys, aerr := fs.New()
+		if aerr == nil {
+			var obj fs.ObjectReader
+			if obj, aerr = fsys.OpenObjectHashed(hash); aerr == nil {
+				size = obj.Size()
+				analysis, aerr = elfutil.AnalyzeReaderAt(ctxReaderAt{jobCtx, obj}, size)
+				obj.Close()
+			}
+		}
+		if jobCtx.Err() != nil {
+			aerr = errAnalysisTimeout
+		}
 		if aerr != nil {
 			msg := aerr.Error()
 			db.Model(&FileRecord{}).
 				Where("id = ?", recID).
 				Updates(map[string]any{"analysis_status": "error", "analysis_error": msg})
-			logger.GetLogger().Error().Uint("record_id", recID).Err(aerr).Msg("elf analysis failed")
+			logAnalysisCompleted("elf", recID, reqID, start, int(size), 0, "error", aerr)
+			endAnalysisSpan(span, "error", aerr)
 			return
 		}
 		b, _ := json.Marshal(analysis)
@@ -32,6 +63,111 @@ func scheduleELFAnalysis(recID uint, data []byte) {
 			Assign(map[string]any{"data": js}).
 			FirstOrCreate(cache).Error
 		db.Model(&FileRecord{}).Where("id = ?", recID).Update("analysis_status", "done")
-		logger.GetLogger().Info().Uint("record_id", recID).Int("size", len(data)).Msg("elf analysis completed")
+		recordELFTraits(db, recID, analysis)
+		logAnalysisCompleted("elf", recID, reqID, start, int(size), len(js), "done", nil)
+		endAnalysisSpan(span, "done", nil)
 	})
+	if err != nil {
+		cancel()
+	}
+}
+
+// elfTraitColumns maps list filter names (and analysis characteristics keys) to record columns
+var elfTraitColumns = map[string]string{
+	"go_binary": "elf_go_binary",
+	"static":    "elf_static",
+	"pie":       "elf_pie",
+	"stripped":  "elf_stripped",
+}
+
+// recordELFTraits copies the filterable characteristics of a finished analysis onto the record
+func recordELFTraits(db *gorm.DB, recID uint, analysis map[string]any) {
+	chars, _ := analysis["characteristics"].(map[string]any)
+	updates := map[string]any{}
+	for key, col := range elfTraitColumns {
+		if v, ok := chars[key].(bool); ok {
+			updates[col] = v
+		}
+	}
+	if len(updates) > 0 {
+		db.Model(&FileRecord{}).Where("id = ?", recID).UpdateColumns(updates)
+	}
+}
+
+// hasELFMagic reports whether b starts with the ELF magic number
+func hasELFMagic(b []byte) bool {
+	return len(b) >= 4 && b[0] == 0x7f && b[1] == 'E' && b[2] == 'L' && b[3] == 'F'
+}
+
+// elfRefreshHandler drops the cached ELF analysis of a record and recomputes it synchronously, so
+// analyzer improvements reach files uploaded before them. It runs regardless of the analysis
+// config since it is an explicit request.
+func elfRefreshHandler(c *gin.Context) {
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
+		return
+	}
+	var fr FileRecord
+	if err := db.First(&fr, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, codeFileNotFound, "file not found")
+		return
+	}
+	fsys, err := fs.New()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
+		return
+	}
+	// the object is read through a seekable reader, as the upload-time analysis does, so large
+	// binaries are not loaded whole
+	obj, err := fsys.OpenObjectHashed(fr.objectKey())
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "read failed")
+		return
+	}
+	defer obj.Close()
+	// the head comes through the reader: the object on disk is usually compressed
+	head := make([]byte, 4)
+	n, _ := obj.ReadAt(head, 0)
+	if !hasELFMagic(head[:n]) {
+		apiError(c, http.StatusBadRequest, codeTypeMismatch, "file is not ELF")
+		return
+	}
+	db.Where("file_id = ?", fr.ID).Delete(&ElfAnalyzeCached{})
+
+	reqID := logger.RequestID(c.Request.Context())
+	start := time.Now()
+	size := int(obj.Size())
+	analysis, aerr := elfutil.AnalyzeReaderAt(obj, obj.Size())
+	if aerr != nil {
+		msg := aerr.Error()
+		db.Model(&FileRecord{}).Where("id = ?", fr.ID).
+			Updates(map[string]any{"analysis_status": "error", "analysis_error": msg})
+		logAnalysisCompleted("elf", fr.ID, reqID, start, size, 0, "error", aerr)
+		apiErrorWith(c, http.StatusUnprocessableEntity, codeAnalysisFailed, msg, gin.H{"analysis_status": "error"})
+		return
+	}
+	b, _ := json.Marshal(analysis)
+	if err := db.Create(&ElfAnalyzeCached{FileID: fr.ID, Data: string(b)}).Error; err != nil {
+		apiError(c, http.StatusInternalServerError, codeStoreFailed, "cache write failed")
+		return
+	}
+	db.Model(&FileRecord{}).Where("id = ?", fr.ID).
+		Updates(map[string]any{"analysis_status": "done", "analysis_error": nil})
+	recordELFTraits(db, fr.ID, analysis)
+	logAnalysisCompleted("elf", fr.ID, reqID, start, size, len(b), "done", nil)
+	c.JSON(http.StatusOK, gin.H{"file_id": fr.ID, "analysis_type": "elf", "analysis_status": "done", "analysis": elfAnalysisJSON(c, string(b))})
+}
+
+// elfAnalysisJSON renders cached ELF analysis with sizes as decimal strings, whichever shape the
+// row was stored in; ?numeric=true gives JSON numbers instead for older consumers
+func elfAnalysisJSON(c *gin.Context, data string) json.RawMessage {
+	rewrite := elfutil.StringSizes
+	if c.Query("numeric") == "true" {
+		rewrite = elfutil.NumericSizes
+	}
+	if b, err := rewrite([]byte(data)); err == nil {
+		return b
+	}
+	return json.RawMessage(data)
 }
@@ -3,129 +3,206 @@ package fileio
 import (
 	"archive/tar"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
-	"os"
-	"strconv"
 	"time"
 
+	"go4pack/pkg/common/compress"
+	"go4pack/pkg/common/file"
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/logger"
 	"go4pack/pkg/common/worker"
 )
 
-// scheduleGzipAnalysis submits async job to analyze gzip (streaming to temp to avoid OOM)
-func scheduleGzipAnalysis(recID uint, raw []byte) {
-	_ = worker.Submit(func() {
+// scheduleGzipAnalysis submits an async job analyzing a stored gzip upload, streamed from the
+// object as it was received (gzip uploads are stored without recompression), bounded by
+// Analysis.TimeoutSeconds like the ELF job
+func scheduleGzipAnalysis(ctx context.Context, recID uint, hash string) {
+	link := analysisLink(ctx)
+	reqID := logger.RequestID(ctx)
+	jobCtx, cancel := analysisJobContext()
+	err := worker.SubmitWithContext(jobCtx, func(jobCtx context.Context) {
+		defer cancel()
+		span := startAnalysisSpan(link, "gzip", recID)
 		db, err := ensureDB()
 		if err != nil {
+			endAnalysisSpan(span, "error", err)
 			return
 		}
-		meta := map[string]any{
-			"analyzed_at": time.Now().UTC().Format(time.RFC3339),
+		start := time.Now()
+		var meta map[string]any
+		var size int64
+		fsys, aerr := fs.New()
+		if aerr == nil {
+			var obj io.ReadSeekCloser
+			if obj, aerr = fsys.OpenObjectHashedRaw(hash); aerr == nil {
+				size, _ = fsys.GetHashedObjectSize(hash)
+				meta = analyzeGzip(ctxReadSeeker{jobCtx, obj})
+				obj.Close()
+			}
 		}
-
-		tempDir := ".runtime/temp"
-		_ = os.MkdirAll(tempDir, 0o755)
-		tmpPath := tempDir + "/gzip-" + strconv.FormatUint(uint64(recID), 10) + ".gz"
-		if err := os.WriteFile(tmpPath, raw, 0o644); err != nil {
-			meta["error"] = "write temp failed: " + err.Error()
-			b, _ := json.Marshal(meta)
-			cache := &GzipAnalyzeCached{FileID: recID, Data: string(b)}
-			_ = db.Where("file_id = ?", recID).
-				Assign(map[string]any{"data": cache.Data}).FirstOrCreate(cache)
-			return
+		if jobCtx.Err() != nil {
+			aerr = errAnalysisTimeout
 		}
-		defer os.Remove(tmpPath)
-
-		f, err := os.Open(tmpPath)
-		if err != nil {
-			meta["error"] = err.Error()
-			b, _ := json.Marshal(meta)
-			cache := &GzipAnalyzeCached{FileID: recID, Data: string(b)}
-			_ = db.Where("file_id = ?", recID).
-				Assign(map[string]any{"data": cache.Data}).FirstOrCreate(cache)
+		if aerr != nil {
+			db.Model(&FileRecord{}).Where("id = ?", recID).
+				Updates(map[string]any{"analysis_status": "error", "analysis_error": aerr.Error()})
+			logAnalysisCompleted("gzip", recID, reqID, start, int(size), 0, "error", aerr)
+			endAnalysisSpan(span, "error", aerr)
 			return
 		}
-		defer f.Close()
 
-		gr, err := gzip.NewReader(f)
-		if err != nil {
-			meta["error"] = err.Error()
-			b, _ := json.Marshal(meta)
-			cache := &GzipAnalyzeCached{FileID: recID, Data: string(b)}
-			_ = db.Where("file_id = ?", recID).
-				Assign(map[string]any{"data": cache.Data}).FirstOrCreate(cache)
-			return
-		}
+		b, _ := json.Marshal(meta)
+		cache := &GzipAnalyzeCached{FileID: recID, Data: string(b)}
+		_ = db.Where("file_id = ?", recID).
+			Assign(map[string]any{"data": cache.Data}).FirstOrCreate(cache)
 
-		tr := tar.NewReader(gr)
-		const maxEntries = 200
-		var (
-			entries          []map[string]any
-			uncompressedSize int64
-			isTar            = true
-		)
-
-		for isTar {
-			h, e := tr.Next()
-			if e == io.EOF {
-				break
-			}
-			if e != nil {
-				isTar = false
-				break
-			}
-			entries = append(entries, map[string]any{
-				"name": h.Name,
-				"size": h.Size,
-				"mode": h.Mode,
-				"type": h.Typeflag,
-			})
-			if h.Size > 0 {
-				n, _ := io.CopyN(io.Discard, tr, h.Size)
-				uncompressedSize += n
-			}
-			if len(entries) >= maxEntries {
-				meta["truncated"] = true
-				break
-			}
+		status := "done"
+		if msg, hasErr := meta["error"]; hasErr {
+			status = "error"
+			aerr = fmt.Errorf("%v", msg)
 		}
+		db.Model(&FileRecord{}).Where("id = ?", recID).Update("analysis_status", status)
+		logAnalysisCompleted("gzip", recID, reqID, start, int(size), len(b), status, aerr)
+		endAnalysisSpan(span, status, aerr)
+	})
+	if err != nil {
+		cancel()
+	}
+}
 
-		if !isTar && len(entries) == 0 {
-			gr.Close()
-			_, _ = f.Seek(0, 0)
-			gr2, g2 := gzip.NewReader(f)
-			if g2 != nil {
-				meta["error"] = g2.Error()
-			} else {
-				n, _ := io.Copy(io.Discard, gr2)
-				uncompressedSize = n
-				gr2.Close()
-			}
+// analyzeGzip inspects a gzip stream (and an embedded tar, if any) and returns the analysis map.
+// f is rewound for a second pass when the content is not a tar. Failures are reported through
+// the "error" key rather than a Go error so they can be cached.
+func analyzeGzip(f io.ReadSeeker) map[string]any {
+	meta := map[string]any{
+		"analyzed_at": time.Now().UTC().Format(time.RFC3339),
+	}
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		meta["error"] = err.Error()
+		return meta
+	}
+
+	tr := tar.NewReader(gr)
+	entries, uncompressedSize, truncated, terr := scanTar(tr)
+	isTar := terr == nil
+	if truncated {
+		meta["truncated"] = true
+	}
+
+	if !isTar && len(entries) == 0 {
+		gr.Close()
+		_, _ = f.Seek(0, io.SeekStart)
+		gr2, g2 := gzip.NewReader(f)
+		if g2 != nil {
+			meta["error"] = g2.Error()
 		} else {
-			if isTar {
-				nTail, _ := io.Copy(io.Discard, tr)
-				uncompressedSize += nTail
-			}
-			gr.Close()
+			n, _ := io.Copy(io.Discard, gr2)
+			uncompressedSize = n
+			gr2.Close()
+		}
+	} else {
+		if isTar {
+			nTail, _ := io.Copy(io.Discard, tr)
+			uncompressedSize += nTail
 		}
+		gr.Close()
+	}
+
+	if uncompressedSize > 0 {
+		meta["uncompressed_size"] = uncompressedSize
+	}
+	if len(entries) > 0 {
+		meta["tar_entries"] = entries
+		meta["tar_count"] = len(entries)
+		meta["inner_compression"] = innerCompression(entries)
+	}
+	return meta
+}
+
+// maxTarEntries caps how many tar members an analysis lists
+const maxTarEntries = 200
 
-		if uncompressedSize > 0 {
-			meta["uncompressed_size"] = uncompressedSize
+// scanTar lists the members of tr up to maxTarEntries (truncated reports hitting the cap) and
+// returns the member bytes read. Regular members are tagged with the MIME type sniffed from their
+// first 512 bytes and, when that is itself a compressed format, its name under "compression".
+// err is set when a header could not be parsed, e.g. because the stream is not a tar at all; the
+// members listed before it are still returned.
+func scanTar(tr *tar.Reader) (entries []map[string]any, size int64, truncated bool, err error) {
+	head := make([]byte, 512)
+	for {
+		h, e := tr.Next()
+		if e == io.EOF {
+			return entries, size, false, nil
+		}
+		if e != nil {
+			return entries, size, false, e
 		}
-		if len(entries) > 0 {
-			meta["tar_entries"] = entries
-			meta["tar_count"] = len(entries)
+		entry := tarEntryMeta(h)
+		entries = append(entries, entry)
+		if h.Size > 0 {
+			n, _ := io.ReadFull(tr, head[:min(h.Size, int64(len(head)))])
+			if h.Typeflag == tar.TypeReg && n > 0 {
+				mime := file.DetectMIME(head[:n], h.Name)
+				entry["mime"] = mime
+				if c := innerCompressionOf(head[:n], mime); c != "" {
+					entry["compression"] = c
+				}
+			}
+			rest, _ := io.CopyN(io.Discard, tr, h.Size-int64(n))
+			size += int64(n) + rest
+		}
+		if len(entries) >= maxTarEntries {
+			return entries, size, true, nil
 		}
+	}
+}
 
-		b, _ := json.Marshal(meta)
-		cache := &GzipAnalyzeCached{FileID: recID, Data: string(b)}
-		_ = db.Where("file_id = ?", recID).
-			Assign(map[string]any{"data": cache.Data}).FirstOrCreate(cache)
+// archiveMIMECompression names compressed and archive formats the compress package has no codec for
+var archiveMIMECompression = map[string]string{
+	"application/x-xz":             "xz",
+	"application/x-bzip2":          "bzip2",
+	"application/zip":              "zip",
+	"application/x-7z-compressed":  "7z",
+	"application/x-rar-compressed": "rar",
+}
 
-		status := "done"
-		if _, hasErr := meta["error"]; hasErr {
-			status = "error"
+// innerCompressionOf names the compression of a tar member from its leading bytes and sniffed
+// MIME type, or "" when it is not compressed
+func innerCompressionOf(head []byte, mime string) string {
+	if ct := compress.IsCompressedOrMIME(head, mime); ct != compress.None {
+		return ct.String()
+	}
+	return archiveMIMECompression[mime]
+}
+
+// innerCompression counts the listed members per compression format, so layered archives such as
+// a .tar.gz of .gz files stand out without reading every entry
+func innerCompression(entries []map[string]any) map[string]int {
+	counts := map[string]int{}
+	for _, e := range entries {
+		if c, ok := e["compression"].(string); ok {
+			counts[c]++
 		}
-		db.Model(&FileRecord{}).Where("id = ?", recID).Update("analysis_status", status)
-	})
+	}
+	return counts
+}
+
+// tarEntryMeta is the description of a tar member shared by the analysis and member listing
+func tarEntryMeta(h *tar.Header) map[string]any {
+	return map[string]any{
+		"name": h.Name,
+		"size": h.Size,
+		"mode": h.Mode,
+		"type": h.Typeflag,
+	}
+}
+
+// isGzipMIME reports whether mime is one of the types the gzip analyzer handles
+func isGzipMIME(mime string) bool {
+	return mime == "application/gzip" || mime == "application/x-gzip"
 }
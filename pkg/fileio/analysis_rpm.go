@@ -0,0 +1,57 @@
+package fileio
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/logger"
+	rpmutil "go4pack/pkg/common/rpm"
+	"go4pack/pkg/common/worker"
+)
+
+// rpmMIME is the type mimetype reports for RPM packages
+const rpmMIME = "application/x-rpm"
+
+// scheduleRpmAnalysis submits an async job parsing the headers of the stored package. Only the
+// lead and headers are inspected; the payload archive is never unpacked.
+func scheduleRpmAnalysis(ctx context.Context, recID uint, hash string) {
+	link := analysisLink(ctx)
+	reqID := logger.RequestID(ctx)
+	_ = worker.Submit(func() {
+		start := time.Now()
+		span := startAnalysisSpan(link, "rpm", recID)
+		db, err := ensureDB()
+		if err != nil {
+			endAnalysisSpan(span, "error", err)
+			return
+		}
+		var analysis map[string]any
+		var data []byte
+		fsys, aerr := fs.New()
+		if aerr == nil {
+			if data, aerr = fsys.ReadObjectHashed(hash); aerr == nil {
+				analysis, aerr = rpmutil.Analyze(data)
+			}
+		}
+		if aerr != nil {
+			msg := aerr.Error()
+			db.Model(&FileRecord{}).
+				Where("id = ?", recID).
+				Updates(map[string]any{"analysis_status": "error", "analysis_error": msg})
+			logAnalysisCompleted("rpm", recID, reqID, start, len(data), 0, "error", aerr)
+			endAnalysisSpan(span, "error", aerr)
+			return
+		}
+		b, _ := json.Marshal(analysis)
+		js := string(b)
+		cache := &RpmAnalyzeCached{FileID: recID, Data: js}
+		_ = db.Where("file_id = ?", recID).
+			Assign(map[string]any{"data": js}).
+			FirstOrCreate(cache).Error
+		db.Model(&FileRecord{}).Where("id = ?", recID).Update("analysis_status", "done")
+		logAnalysisCompleted("rpm", recID, reqID, start, len(data), len(js), "done", nil)
+		endAnalysisSpan(span, "done", nil)
+	})
+}
@@ -0,0 +1,103 @@
+package fileio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/logger"
+	sqliteutil "go4pack/pkg/common/sqlite"
+	"go4pack/pkg/common/worker"
+)
+
+// sqliteMIME is the type mimetype reports for SQLite 3 databases
+const sqliteMIME = "application/vnd.sqlite3"
+
+// scheduleSQLiteAnalysis submits an async job that copies the stored database to a private temp
+// file and inspects it read-only, so the stored object is never opened by SQLite itself.
+func scheduleSQLiteAnalysis(ctx context.Context, recID uint, hash string) {
+	link := analysisLink(ctx)
+	reqID := logger.RequestID(ctx)
+	_ = worker.Submit(func() {
+		start := time.Now()
+		span := startAnalysisSpan(link, "sqlite", recID)
+		db, err := ensureDB()
+		if err != nil {
+			endAnalysisSpan(span, "error", err)
+			return
+		}
+		analysis, size, aerr := analyzeStoredSQLite(hash)
+		if aerr != nil {
+			msg := aerr.Error()
+			db.Model(&FileRecord{}).
+				Where("id = ?", recID).
+				Updates(map[string]any{"analysis_status": "error", "analysis_error": msg})
+			logAnalysisCompleted("sqlite", recID, reqID, start, size, 0, "error", aerr)
+			endAnalysisSpan(span, "error", aerr)
+			return
+		}
+		b, _ := json.Marshal(analysis)
+		js := string(b)
+		cache := &SqliteAnalyzeCached{FileID: recID, Data: js}
+		_ = db.Where("file_id = ?", recID).
+			Assign(map[string]any{"data": js}).
+			FirstOrCreate(cache).Error
+		db.Model(&FileRecord{}).Where("id = ?", recID).Update("analysis_status", "done")
+		logAnalysisCompleted("sqlite", recID, reqID, start, size, len(js), "done", nil)
+		endAnalysisSpan(span, "done", nil)
+	})
+}
+
+// analyzeStoredSQLite analyzes a stored database object, streaming its decompressed bytes into
+// the private copy instead of loading them into memory
+func analyzeStoredSQLite(hash string) (map[string]any, int, error) {
+	fsys, err := fs.New()
+	if err != nil {
+		return nil, 0, err
+	}
+	obj, err := fsys.OpenObjectHashed(hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer obj.Close()
+	analysis, err := analyzeSQLiteReader(io.NewSectionReader(obj, 0, obj.Size()))
+	return analysis, int(obj.Size()), err
+}
+
+// analyzeSQLiteBytes is analyzeSQLiteReader over an in-memory database
+func analyzeSQLiteBytes(data []byte) (map[string]any, error) {
+	return analyzeSQLiteReader(bytes.NewReader(data))
+}
+
+// analyzeSQLiteReader copies r to a private file under .runtime/temp, as the driver needs a path,
+// and analyzes it within sqliteutil.DefaultTimeout
+func analyzeSQLiteReader(r io.Reader) (map[string]any, error) {
+	fsys, err := fs.New()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(fsys.GetRuntimePath(), "temp")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(dir, "sqlite-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sqliteutil.DefaultTimeout)
+	defer cancel()
+	return sqliteutil.AnalyzeFile(ctx, tmp.Name())
+}
@@ -0,0 +1,121 @@
+package fileio
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/logger"
+	"go4pack/pkg/common/worker"
+)
+
+// tarMIME is the type mimetype reports for tar archives
+const tarMIME = "application/x-tar"
+
+// ustarMagic sits at offset 257 of the first header block of POSIX and GNU tar archives
+var ustarMagic = []byte("ustar")
+
+// isTar reports whether head starts a tar archive; it needs the first 262 bytes
+func isTar(head []byte, mime string) bool {
+	return mime == tarMIME || (len(head) >= 262 && bytes.Equal(head[257:262], ustarMagic))
+}
+
+// scheduleTarAnalysis submits an async job listing the members of a stored uncompressed tar.
+// The object is streamed from storage, bounded by Analysis.TimeoutSeconds like the ELF job.
+func scheduleTarAnalysis(ctx context.Context, recID uint, hash string) {
+	link := analysisLink(ctx)
+	reqID := logger.RequestID(ctx)
+	jobCtx, cancel := analysisJobContext()
+	err := worker.SubmitWithContext(jobCtx, func(jobCtx context.Context) {
+		defer cancel()
+		start := time.Now()
+		span := startAnalysisSpan(link, "tar", recID)
+		db, err := ensureDB()
+		if err != nil {
+			endAnalysisSpan(span, "error", err)
+			return
+		}
+		var meta map[string]any
+		var size int64
+		fsys, aerr := fs.New()
+		if aerr == nil {
+			var obj fs.ObjectReader
+			if obj, aerr = fsys.OpenObjectHashed(hash); aerr == nil {
+				size = obj.Size()
+				meta = analyzeTar(io.NewSectionReader(ctxReaderAt{jobCtx, obj}, 0, size))
+				obj.Close()
+			}
+		}
+		if jobCtx.Err() != nil {
+			aerr = errAnalysisTimeout
+		}
+		if aerr != nil {
+			msg := aerr.Error()
+			db.Model(&FileRecord{}).
+				Where("id = ?", recID).
+				Updates(map[string]any{"analysis_status": "error", "analysis_error": msg})
+			logAnalysisCompleted("tar", recID, reqID, start, int(size), 0, "error", aerr)
+			endAnalysisSpan(span, "error", aerr)
+			return
+		}
+		b, _ := json.Marshal(meta)
+		js := string(b)
+		cache := &TarAnalyzeCached{FileID: recID, Data: js}
+		_ = db.Where("file_id = ?", recID).
+			Assign(map[string]any{"data": js}).
+			FirstOrCreate(cache).Error
+		status := "done"
+		var serr error
+		if msg, hasErr := meta["error"]; hasErr {
+			status = "error"
+			serr = fmt.Errorf("%v", msg)
+		}
+		db.Model(&FileRecord{}).Where("id = ?", recID).Update("analysis_status", status)
+		logAnalysisCompleted("tar", recID, reqID, start, int(size), len(js), status, serr)
+		endAnalysisSpan(span, status, serr)
+	})
+	if err != nil {
+		cancel()
+	}
+}
+
+// analyzeTar lists the members of a tar stream like the gzip analysis does for .tar.gz, with a
+// per-extension count of the listed regular files. A stream that is not a tar is reported through
+// the "error" key so the result can still be cached.
+func analyzeTar(r io.Reader) map[string]any {
+	meta := map[string]any{
+		"analyzed_at": time.Now().UTC().Format(time.RFC3339),
+	}
+	entries, size, truncated, err := scanTar(tar.NewReader(r))
+	if err != nil && len(entries) == 0 {
+		meta["error"] = "not a tar archive: " + err.Error()
+		return meta
+	}
+	extensions := map[string]int{}
+	for _, e := range entries {
+		if e["type"] != byte(tar.TypeReg) {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(e["name"].(string)))
+		if ext == "" {
+			ext = "(none)"
+		}
+		extensions[ext]++
+	}
+	if truncated {
+		meta["truncated"] = true
+	}
+	meta["tar_entries"] = entries
+	meta["tar_count"] = len(entries)
+	meta["uncompressed_size"] = size
+	meta["extensions"] = extensions
+	meta["inner_compression"] = innerCompression(entries)
+	return meta
+}
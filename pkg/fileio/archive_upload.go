@@ -0,0 +1,230 @@
+package fileio
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/file"
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/worker"
+)
+
+var (
+	// errArchiveLimit stops the member walk once the total size or member count cap is reached
+	errArchiveLimit   = errors.New("archive limit reached")
+	errMemberTooLarge = errors.New("member too large")
+)
+
+// archiveWalk calls fn with the name and content of every regular file in an archive, in order.
+// Directories, links and other special entries are skipped; an error from fn stops the walk.
+type archiveWalk func(fn func(name string, r io.Reader) error) error
+
+// openArchive sniffs a .tar, .tar.gz or .zip upload. zip needs random access, which the spooled
+// multipart file provides.
+func openArchive(f io.ReaderAt, size int64) (archiveWalk, error) {
+	head := make([]byte, 512)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(io.NewSectionReader(f, 0, size))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip stream: %w", err)
+		}
+		return tarWalk(tar.NewReader(zr)), nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		zr, err := zip.NewReader(f, size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zip archive: %w", err)
+		}
+		return zipWalk(zr), nil
+	case len(head) > 262 && string(head[257:262]) == "ustar":
+		return tarWalk(tar.NewReader(io.NewSectionReader(f, 0, size))), nil
+	}
+	return nil, errors.New("unsupported archive format (expected tar, tar.gz or zip)")
+}
+
+func tarWalk(tr *tar.Reader) archiveWalk {
+	return func(fn func(string, io.Reader) error) error {
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := fn(hdr.Name, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func zipWalk(zr *zip.Reader) archiveWalk {
+	return func(fn func(string, io.Reader) error) error {
+		for _, zf := range zr.File {
+			if !zf.Mode().IsRegular() {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			err = fn(zf.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// safeMemberPath rejects absolute paths, parent traversal and backslash separators, returning the
+// cleaned relative path used as the record's filename
+func safeMemberPath(name string) (string, bool) {
+	if name == "" || strings.ContainsAny(name, "\\\x00") || path.IsAbs(name) {
+		return "", false
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if seg == ".." {
+			return "", false
+		}
+	}
+	clean := path.Clean(name)
+	return clean, clean != "."
+}
+
+// readMember reads a whole member, failing with errMemberTooLarge past max bytes (0 = unlimited)
+func readMember(r io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err == nil && int64(len(data)) > max {
+		return nil, errMemberTooLarge
+	}
+	return data, err
+}
+
+// uploadArchiveHandler explodes an uploaded .tar, .tar.gz or .zip into one object and record per
+// member, named after the member path. Members are read in archive order and stored on the worker
+// pool (inline when it is saturated); the response mirrors uploadMultiHandler. Reaching the total
+// size or member count cap stops the walk and marks the response truncated; members already
+// stored are kept.
+func uploadArchiveHandler(c *gin.Context) {
+	f, header, ok := uploadFormFile(c)
+	if !ok {
+		return
+	}
+	defer f.Close()
+	walk, err := openArchive(f, header.Size)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, codeInvalidArchive, err.Error())
+		return
+	}
+	fsys, err := fs.New()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
+		return
+	}
+	db, _ := ensureDB()
+	uc := config.Get().Upload
+	opts := newStoreOptions(c, "archive")
+
+	var (
+		results   []*uploadResult
+		total     int64
+		truncated string
+		wg        sync.WaitGroup
+	)
+	werr := walk(func(name string, r io.Reader) error {
+		if uc.ArchiveMaxMembers > 0 && len(results) >= uc.ArchiveMaxMembers {
+			truncated = "member count limit reached"
+			return errArchiveLimit
+		}
+		res := &uploadResult{Filename: name}
+		results = append(results, res)
+		clean, ok := safeMemberPath(name)
+		if !ok {
+			res.Error = "invalid member path"
+			return nil
+		}
+		data, err := readMember(r, uc.ArchiveMaxMemberBytes)
+		if errors.Is(err, errMemberTooLarge) {
+			res.Error = "member too large"
+			return nil
+		}
+		if err != nil {
+			res.Error = "read failed"
+			return err
+		}
+		if max := uc.ArchiveMaxTotalBytes; max > 0 && total+int64(len(data)) > max {
+			res.Error = "archive total size limit exceeded"
+			truncated = "total size limit reached"
+			return errArchiveLimit
+		}
+		hold, _, ok := reserveQuota(c, int64(len(data)))
+		if !ok {
+			res.Error = "upload quota exceeded"
+			truncated = "upload quota reached"
+			return errArchiveLimit
+		}
+		total += int64(len(data))
+		res.Filename = clean
+		res.MD5 = file.MD5Sum(data)
+		res.OriginalSize = int64(len(data))
+
+		wg.Add(1)
+		store := func() {
+			defer wg.Done()
+			storeUploadResult(opts, fsys, db, res, data)
+			if res.Error != "" {
+				hold.release()
+			}
+		}
+		if worker.Submit(store) != nil {
+			store()
+		}
+		return nil
+	})
+	wg.Wait()
+	if werr != nil && !errors.Is(werr, errArchiveLimit) {
+		if len(results) == 0 {
+			apiError(c, http.StatusBadRequest, codeInvalidArchive, "invalid archive: "+werr.Error())
+			return
+		}
+		truncated = "archive read failed: " + werr.Error()
+	}
+	if len(results) == 0 {
+		apiError(c, http.StatusBadRequest, codeInvalidArchive, "archive contains no files")
+		return
+	}
+	resp := gin.H{"results": results, "count": len(results)}
+	if truncated != "" {
+		resp["truncated"] = truncated
+	}
+	if remaining, enabled := quotaRemaining(c); enabled {
+		resp["quota_remaining"] = remaining
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,118 @@
+package fileio
+
+import (
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/afero"
+
+	"go4pack/pkg/common/compress"
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/fs"
+)
+
+// webAssetTypes lists the extensions served by /assets and their Content-Type
+var webAssetTypes = map[string]string{
+	".html": "text/html; charset=utf-8",
+	".htm":  "text/html; charset=utf-8",
+	".css":  "text/css; charset=utf-8",
+	".js":   "text/javascript; charset=utf-8",
+	".mjs":  "text/javascript; charset=utf-8",
+	".json": "application/json",
+	".svg":  "image/svg+xml",
+}
+
+// webAssetType returns the Content-Type for a web-servable asset path ("" if not servable)
+func webAssetType(name string) string {
+	if ct, ok := webAssetTypes[strings.ToLower(path.Ext(name))]; ok {
+		return ct
+	}
+	return ""
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header allows a response in enc
+func acceptsEncoding(header, enc string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.TrimSpace(coding)
+		if !strings.EqualFold(coding, enc) && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// assetHandler serves a stored object as a static web asset when Download.ServeAssets is on. The
+// path maps to a record filename; a pre-gzipped upload named "<path>.gz" is used when no exact name
+// exists. Objects stored as gzip go out untouched with Content-Encoding: gzip when the client
+// accepts it. Types that can run script (see neverInline) are sandboxed by CSP, so an uploaded page
+// renders in an opaque origin instead of the API's.
+func assetHandler(c *gin.Context) {
+	if !config.Get().Download.ServeAssets {
+		apiError(c, http.StatusNotFound, codeAssetsDisabled, "asset serving disabled")
+		return
+	}
+	name := strings.TrimPrefix(c.Param("path"), "/")
+	ctype := webAssetType(name)
+	if name == "" || ctype == "" {
+		apiError(c, http.StatusNotFound, codeTypeMismatch, "not a web asset")
+		return
+	}
+	fsys, err := fs.New()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
+		return
+	}
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
+		return
+	}
+	var fr FileRecord
+	found := false
+	for _, candidate := range []string{name, name + ".gz"} {
+		// Find rather than First: a miss on the exact name is expected for pre-gzipped uploads
+		if res := db.Where("filename = ?", candidate).Limit(1).Find(&fr); res.Error == nil && res.RowsAffected > 0 {
+			found = true
+			break
+		}
+	}
+	if !found {
+		apiError(c, http.StatusNotFound, codeFileNotFound, "file not found")
+		return
+	}
+	raw, err := afero.ReadFile(fsys.GetFs(), fsys.HashedObjectPath(fr.objectKey()))
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "read failed")
+		return
+	}
+	c.Header("Vary", "Accept-Encoding")
+	c.Header("Content-Type", ctype)
+	c.Header("X-Content-Type-Options", "nosniff")
+	if slices.Contains(neverInline, strings.SplitN(ctype, ";", 2)[0]) {
+		c.Header("Content-Security-Policy", "sandbox")
+	}
+	if compress.IsCompressed(raw) == compress.Gzip && acceptsEncoding(c.GetHeader("Accept-Encoding"), "gzip") {
+		c.Header("Content-Encoding", "gzip")
+		c.Header("Content-Length", strconv.Itoa(len(raw)))
+		writeBody(c, fr.objectKey(), raw)
+		return
+	}
+	data, err := fsys.ReadObjectHashed(fr.objectKey())
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "read failed")
+		return
+	}
+	c.Header("Content-Length", strconv.Itoa(len(data)))
+	writeBody(c, fr.objectKey(), data)
+}
@@ -0,0 +1,298 @@
+package fileio
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding"
+	"encoding/hex"
+	"hash"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/logger"
+)
+
+// chunkTempPrefix names the spool files of resumable uploads in the objects directory
+const chunkTempPrefix = "upk-"
+
+// chunkSession is a resumable upload in progress. Its bytes are appended to a spool file and
+// hashed as they arrive, so committing never rereads the data to compute the md5.
+type chunkSession struct {
+	mu        sync.Mutex
+	id        string
+	filename  string
+	path      string
+	length    int64 // declared total size, -1 when the client did not send Upload-Length
+	offset    int64
+	md5       hash.Hash
+	updatedAt time.Time
+	closed    bool // committed or expired; set under mu so a racing request sees it gone
+}
+
+var (
+	chunkMu       sync.Mutex
+	chunkSessions = map[string]*chunkSession{}
+)
+
+// chunkSessionTTL is how long a session may go without receiving a chunk
+func chunkSessionTTL() time.Duration {
+	return time.Duration(config.Get().Upload.ChunkSessionTTLSeconds) * time.Second
+}
+
+// pruneChunkSessions drops sessions idle for longer than the TTL, removing their spool files, and
+// returns how many it dropped. Sessions busy with a request are left for the next pass.
+func pruneChunkSessions(now time.Time) int {
+	ttl := chunkSessionTTL()
+	if ttl <= 0 {
+		return 0
+	}
+	chunkMu.Lock()
+	defer chunkMu.Unlock()
+	removed := 0
+	for id, s := range chunkSessions {
+		if !s.mu.TryLock() {
+			continue
+		}
+		if now.Sub(s.updatedAt) > ttl {
+			s.closed = true
+			_ = os.Remove(s.path)
+			delete(chunkSessions, id)
+			removed++
+		}
+		s.mu.Unlock()
+	}
+	return removed
+}
+
+// chunkTempLive reports whether name is the spool file of a live session, which the janitor must
+// keep however long the client pauses between chunks
+func chunkTempLive(name string) bool {
+	chunkMu.Lock()
+	defer chunkMu.Unlock()
+	for _, s := range chunkSessions {
+		if filepath.Base(s.path) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lockChunkSession returns the session named by :id locked, or writes a 404 and returns nil
+func lockChunkSession(c *gin.Context) *chunkSession {
+	chunkMu.Lock()
+	s := chunkSessions[c.Param("id")]
+	chunkMu.Unlock()
+	if s != nil {
+		s.mu.Lock()
+		if !s.closed {
+			if ttl := chunkSessionTTL(); ttl <= 0 || time.Since(s.updatedAt) <= ttl {
+				return s
+			}
+		}
+		s.mu.Unlock()
+	}
+	apiError(c, http.StatusNotFound, codeUploadNotFound, "unknown or expired upload")
+	return nil
+}
+
+// chunkState writes the session's progress as Upload-Offset/Upload-Length headers and JSON
+func chunkState(c *gin.Context, status int, s *chunkSession) {
+	c.Header("Upload-Offset", strconv.FormatInt(s.offset, 10))
+	resp := gin.H{"id": s.id, "filename": s.filename, "offset": s.offset, "expires_at": s.updatedAt.Add(chunkSessionTTL()).UTC()}
+	if s.length >= 0 {
+		c.Header("Upload-Length", strconv.FormatInt(s.length, 10))
+		resp["length"] = s.length
+	}
+	c.JSON(status, resp)
+}
+
+// chunkCreateHandler opens a resumable upload of ?filename=. The optional Upload-Length header
+// declares the total size, which is then checked against the size limit and quota up front and
+// required before commit. The response carries the session id and its URL in Location.
+func chunkCreateHandler(c *gin.Context) {
+	filename := c.Query("filename")
+	if filename == "" {
+		apiError(c, http.StatusBadRequest, codeInvalidParam, "filename required")
+		return
+	}
+	length := int64(-1)
+	if v := c.GetHeader("Upload-Length"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			apiError(c, http.StatusBadRequest, codeInvalidParam, "invalid Upload-Length (expected a non-negative integer)")
+			return
+		}
+		if max := config.Get().Upload.MaxBytes; max > 0 && n > max {
+			apiError(c, http.StatusRequestEntityTooLarge, codeUploadTooLarge, "upload too large")
+			return
+		}
+		if remaining, ok := checkQuota(c, n); !ok {
+			rejectQuota(c, remaining)
+			return
+		}
+		length = n
+	}
+	pruneChunkSessions(time.Now())
+
+	fsys, err := fs.New()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
+		return
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		apiError(c, http.StatusInternalServerError, codeStoreFailed, "session id generation failed")
+		return
+	}
+	temp, err := os.CreateTemp(fsys.GetObjectsPath(), chunkTempPrefix+"*")
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeStoreFailed, "temp create failed")
+		return
+	}
+	temp.Close()
+	s := &chunkSession{id: hex.EncodeToString(b), filename: filename, path: temp.Name(), length: length, md5: md5.New(), updatedAt: time.Now()}
+	chunkMu.Lock()
+	chunkSessions[s.id] = s
+	chunkMu.Unlock()
+
+	logger.GetLogger().Info().Str("upload_id", s.id).Str("filename", filename).Int64("length", length).Msg("chunked upload created")
+	c.Header("Location", c.Request.URL.Path+"/"+s.id)
+	chunkState(c, http.StatusCreated, s)
+}
+
+// chunkStatusHandler reports the offset to resume from
+func chunkStatusHandler(c *gin.Context) {
+	s := lockChunkSession(c)
+	if s == nil {
+		return
+	}
+	defer s.mu.Unlock()
+	chunkState(c, http.StatusOK, s)
+}
+
+// chunkAppendHandler appends the request body at the Upload-Offset header, which must equal the
+// bytes received so far (409 otherwise, with the current offset in Upload-Offset). A body cut off
+// mid-way keeps what arrived, so the client resumes from the new offset; a body overrunning the
+// declared length or the size limit is rolled back whole.
+func chunkAppendHandler(c *gin.Context) {
+	s := lockChunkSession(c)
+	if s == nil {
+		return
+	}
+	defer s.mu.Unlock()
+	off, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || off < 0 {
+		apiError(c, http.StatusBadRequest, codeInvalidParam, "invalid Upload-Offset (expected a non-negative integer)")
+		return
+	}
+	if off != s.offset {
+		c.Header("Upload-Offset", strconv.FormatInt(s.offset, 10))
+		apiError(c, http.StatusConflict, codeOffsetMismatch, "Upload-Offset "+strconv.FormatInt(off, 10)+" does not match the "+strconv.FormatInt(s.offset, 10)+" bytes received")
+		return
+	}
+	limit := int64(math.MaxInt64)
+	if s.length >= 0 {
+		limit = s.length - s.offset
+	}
+	if max := config.Get().Upload.MaxBytes; max > 0 {
+		limit = min(limit, max-s.offset)
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeStoreFailed, "open spool failed")
+		return
+	}
+	defer f.Close()
+	// md5 state is restored along with the file size when the chunk has to be undone
+	state, _ := s.md5.(encoding.BinaryMarshaler).MarshalBinary()
+	rollback := func() {
+		_ = f.Truncate(s.offset)
+		_ = s.md5.(encoding.BinaryUnmarshaler).UnmarshalBinary(state)
+	}
+
+	body := io.LimitReader(c.Request.Body, limit)
+	var n int64
+	var rerr error
+	buf := make([]byte, 32*1024)
+	for {
+		k, err := body.Read(buf)
+		if k > 0 {
+			if _, werr := f.Write(buf[:k]); werr != nil {
+				rollback()
+				apiError(c, http.StatusInternalServerError, codeStoreFailed, "write failed")
+				return
+			}
+			s.md5.Write(buf[:k])
+			n += int64(k)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rerr = err
+			break
+		}
+	}
+	if rerr == nil && n == limit {
+		if k, _ := c.Request.Body.Read(buf[:1]); k > 0 {
+			rollback()
+			apiError(c, http.StatusRequestEntityTooLarge, codeUploadTooLarge, "chunk exceeds the declared upload length or size limit")
+			return
+		}
+	}
+	s.offset += n
+	s.updatedAt = time.Now()
+	if rerr != nil {
+		c.Header("Upload-Offset", strconv.FormatInt(s.offset, 10))
+		if !rejectBodyTooLarge(c, rerr) {
+			apiError(c, http.StatusBadRequest, codeReadFailed, "read failed; resume from Upload-Offset")
+		}
+		return
+	}
+	chunkState(c, http.StatusOK, s)
+}
+
+// chunkCommitHandler stores a finished upload like POST /upload/stream would, moving the spool
+// file into the hashed store with CommitTempAsHashed. An upload with a declared length must have
+// received all of it. The session ends here whatever the outcome.
+func chunkCommitHandler(c *gin.Context) {
+	s := lockChunkSession(c)
+	if s == nil {
+		return
+	}
+	defer s.mu.Unlock()
+	if s.length >= 0 && s.offset != s.length {
+		c.Header("Upload-Offset", strconv.FormatInt(s.offset, 10))
+		apiError(c, http.StatusConflict, codeUploadIncomplete, "upload incomplete: "+strconv.FormatInt(s.offset, 10)+" of "+strconv.FormatInt(s.length, 10)+" bytes received")
+		return
+	}
+	s.closed = true
+	chunkMu.Lock()
+	delete(chunkSessions, s.id)
+	chunkMu.Unlock()
+
+	fsys, err := fs.New()
+	if err != nil {
+		_ = os.Remove(s.path)
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
+		return
+	}
+	temp, err := os.OpenFile(s.path, os.O_RDWR, 0)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "open spool failed")
+		return
+	}
+	defer temp.Close()
+	finishSpooledUpload(c, fsys, temp, s.filename, hex.EncodeToString(s.md5.Sum(nil)), s.offset, "chunked")
+}
@@ -0,0 +1,110 @@
+package fileio
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/compress"
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/worker"
+)
+
+// compressBenchResult is one codec's outcome on an object; Ratio is compressed/original, so lower
+// is better
+type compressBenchResult struct {
+	Algorithm      string  `json:"algorithm"`
+	CompressedSize int64   `json:"compressed_size"`
+	Ratio          float64 `json:"ratio"`
+	CompressMs     float64 `json:"compress_ms"`
+	DecompressMs   float64 `json:"decompress_ms"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// compressBenchHandler compresses a stored object's original bytes with every registered codec
+// (at their default levels) and reports size, ratio and timings, best ratio first, to help pick
+// compression.algorithm. Objects larger than Analysis.CompressBenchMaxBytes are benchmarked on
+// that prefix only. Codecs run concurrently on the worker pool, inline when it is saturated.
+func compressBenchHandler(c *gin.Context) {
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
+		return
+	}
+	var fr FileRecord
+	if err := db.First(&fr, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, codeFileNotFound, "file not found")
+		return
+	}
+	fsys, err := fs.New()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
+		return
+	}
+	obj, err := fsys.OpenObjectHashed(fr.objectKey())
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "read failed")
+		return
+	}
+	defer obj.Close()
+	// only the benchmarked prefix is read, so a large object is never loaded whole
+	var src io.Reader = io.NewSectionReader(obj, 0, obj.Size())
+	sampled := false
+	if max := config.Get().Analysis.CompressBenchMaxBytes; max > 0 && obj.Size() > max {
+		src, sampled = io.LimitReader(src, max), true
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "read failed")
+		return
+	}
+
+	codecs := compress.Codecs()
+	results := make([]compressBenchResult, len(codecs))
+	var wg sync.WaitGroup
+	for i, codec := range codecs {
+		wg.Add(1)
+		job := func() {
+			defer wg.Done()
+			results[i] = benchCodec(codec, data)
+		}
+		if worker.Submit(job) != nil {
+			job()
+		}
+	}
+	wg.Wait()
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].Error == "") != (results[j].Error == "") {
+			return results[i].Error == ""
+		}
+		return results[i].Ratio < results[j].Ratio
+	})
+	c.JSON(http.StatusOK, gin.H{"id": fr.ID, "original_size": len(data), "sampled": sampled, "results": results})
+}
+
+// benchCodec times one compress/decompress round trip of data
+func benchCodec(codec compress.Codec, data []byte) compressBenchResult {
+	res := compressBenchResult{Algorithm: codec.Name}
+	start := time.Now()
+	out, err := compress.CompressWithType(data, codec.Type)
+	res.CompressMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.CompressedSize = int64(len(out))
+	if len(data) > 0 {
+		res.Ratio = float64(len(out)) / float64(len(data))
+	}
+	start = time.Now()
+	if _, err := compress.DecompressWithType(out, codec.Type); err != nil {
+		res.Error = err.Error()
+	}
+	res.DecompressMs = float64(time.Since(start).Microseconds()) / 1000
+	return res
+}
@@ -0,0 +1,131 @@
+package fileio
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/fs"
+)
+
+// noDedup reports whether the upload asked for its own physical copy even when identical content
+// is already stored, via the X-No-Dedup header or ?no_dedup=
+func noDedup(c *gin.Context) bool {
+	if v, err := strconv.ParseBool(c.GetHeader("X-No-Dedup")); err == nil {
+		return v
+	}
+	v, _ := strconv.ParseBool(c.Query("no_dedup"))
+	return v
+}
+
+// uploadObjectKey returns the key to store content hashed md5sum under: the hash itself, or a
+// salted key when dedup is skipped
+func uploadObjectKey(c *gin.Context, md5sum string) (string, error) {
+	return objectKeyFor(md5sum, noDedup(c))
+}
+
+// objectKeyFor is uploadObjectKey with the dedup decision already taken from the request
+func objectKeyFor(md5sum string, skipDedup bool) (string, error) {
+	if !skipDedup {
+		return md5sum, nil
+	}
+	return fs.SaltedKey(md5sum)
+}
+
+// recordObjectKey is the FileRecord.ObjectKey for an object stored under key
+func recordObjectKey(key, md5sum string) string {
+	if key == md5sum {
+		return ""
+	}
+	return key
+}
+
+// duplicateGroup is one content hash referenced by more than one upload
+type duplicateGroup struct {
+	MD5   string `json:"md5"`
+	Count int64  `json:"count"`
+}
+
+// duplicatesHandler reports content hashes shared by several uploads, largest groups first, with
+// the files in each and an estimate of the bytes reclaimable by keeping a single copy. Uploads
+// deduplicated onto one object share its bytes, so only the extra physical copies stored with
+// X-No-Dedup count as reclaimable. Paginated like listHandler.
+func duplicatesHandler(c *gin.Context) {
+	lc := config.Get().List
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = lc.DefaultPageSize
+	}
+	if pageSize > lc.MaxPageSize {
+		pageSize = lc.MaxPageSize
+	}
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "database init failed")
+		return
+	}
+	grouped := db.Model(&FileRecord{}).Select("md5, COUNT(*) AS count").
+		Group("md5").Having("COUNT(*) > 1")
+	var total int64
+	if err := db.Table("(?) AS dup", grouped).Count(&total).Error; err != nil {
+		apiError(c, http.StatusInternalServerError, codeQueryFailed, "count failed")
+		return
+	}
+	var groups []duplicateGroup
+	if err := grouped.Order("count DESC, md5").Limit(pageSize).Offset((page - 1) * pageSize).Scan(&groups).Error; err != nil {
+		apiError(c, http.StatusInternalServerError, codeQueryFailed, "query duplicates failed")
+		return
+	}
+	hashes := make([]string, len(groups))
+	for i, g := range groups {
+		hashes[i] = g.MD5
+	}
+	var files []FileRecord
+	if len(hashes) > 0 {
+		if err := db.Where("md5 IN ?", hashes).Order("created_at, id").Find(&files).Error; err != nil {
+			apiError(c, http.StatusInternalServerError, codeQueryFailed, "query files failed")
+			return
+		}
+	}
+	byHash := map[string][]gin.H{}
+	objects := map[string]map[string]int64{} // md5 -> object key -> stored size
+	for _, f := range files {
+		if objects[f.MD5] == nil {
+			objects[f.MD5] = map[string]int64{}
+		}
+		objects[f.MD5][f.objectKey()] = max(objects[f.MD5][f.objectKey()], f.CompressedSize)
+		byHash[f.MD5] = append(byHash[f.MD5], gin.H{
+			"id":              f.ID,
+			"filename":        f.Filename,
+			"size":            f.Size,
+			"compressed_size": f.CompressedSize,
+			"created_at":      f.CreatedAt,
+		})
+	}
+	resp := make([]gin.H, 0, len(groups))
+	for _, g := range groups {
+		// every physical copy but one (the smallest) could go
+		var sum, smallest int64
+		for _, size := range objects[g.MD5] {
+			sum += size
+			if smallest == 0 || size < smallest {
+				smallest = size
+			}
+		}
+		resp = append(resp, gin.H{
+			"md5":               g.MD5,
+			"count":             g.Count,
+			"objects":           len(objects[g.MD5]),
+			"files":             byHash[g.MD5],
+			"reclaimable_bytes": sum - smallest,
+		})
+	}
+	pages := (total + int64(pageSize) - 1) / int64(pageSize)
+	c.JSON(http.StatusOK, gin.H{"duplicates": resp, "count": len(resp), "total": total, "page": page, "page_size": pageSize, "pages": pages})
+}
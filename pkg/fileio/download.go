@@ -1,77 +1,142 @@
 package fileio
 
 import (
+	"encoding/hex"
 	"net/http"
-	"strconv"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 
+	"go4pack/pkg/common/config"
 	"go4pack/pkg/common/fs"
 )
 
 // Handlers focused on downloading and metadata listing.
 
+// neverInline lists types that can run script in the browser's origin and so are always attachments
+var neverInline = []string{"text/html", "application/xhtml+xml", "image/svg+xml", "text/xml", "application/xml"}
+
+// dispositionFor returns "inline" when the MIME type matches the configured inline list and is not
+// an active-content type, "attachment" otherwise
+func dispositionFor(mime string) string {
+	base := strings.ToLower(strings.TrimSpace(strings.SplitN(mime, ";", 2)[0]))
+	if slices.Contains(neverInline, base) {
+		return "attachment"
+	}
+	for _, t := range config.Get().Download.InlineTypes {
+		t = strings.ToLower(t)
+		if base == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(base, t)) {
+			return "inline"
+		}
+	}
+	return "attachment"
+}
+
 func downloadHandler(c *gin.Context) {
 	filename := c.Param("filename")
 	fsys, err := fs.New()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "filesystem init failed"})
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
 		return
 	}
 	db, err := ensureDB()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db init failed"})
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
 		return
 	}
 	var fr FileRecord
 	if err := db.Where("filename = ?", filename).First(&fr).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		apiError(c, http.StatusNotFound, codeFileNotFound, "file not found")
 		return
 	}
-	data, rErr := fsys.ReadObjectHashed(fr.MD5)
+	data, rErr := fsys.ReadObjectHashed(fr.objectKey())
 	if rErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "read failed"})
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "read failed")
 		return
 	}
-	dispType := "attachment"
-	if strings.HasPrefix(fr.MIME, "video/") || fr.MIME == "application/pdf" {
-		dispType = "inline"
-	}
-	c.Header("Content-Disposition", dispType+"; filename="+filename)
-	c.Header("Content-Length", strconv.FormatInt(fr.Size, 10))
-	c.Header("Content-Type", fr.MIME)
-	c.Writer.Write(data)
+	touchAccess(db, &fr)
+	c.Header("Content-Disposition", dispositionFor(fr.MIME)+"; filename="+filename)
+	serveObject(c, &fr, data)
 }
 
 func downloadByMD5Handler(c *gin.Context) {
 	md5v := c.Param("md5")
 	fsys, err := fs.New()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "filesystem init failed"})
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
 		return
 	}
 	db, err := ensureDB()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db init failed"})
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
 		return
 	}
 	var fr FileRecord
 	if err := db.Where("md5 = ?", md5v).First(&fr).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		apiError(c, http.StatusNotFound, codeFileNotFound, "file not found")
 		return
 	}
-	data, rErr := fsys.ReadObjectHashed(fr.MD5)
+	// with dedup several names share one hash; ?as= picks one, but only a name that references it
+	if as := c.Query("as"); as != "" && as != fr.Filename {
+		var named FileRecord
+		if res := db.Where("md5 = ? AND filename = ?", md5v, as).Limit(1).Find(&named); res.Error != nil || res.RowsAffected == 0 {
+			apiError(c, http.StatusBadRequest, codeHashMismatch, "filename does not reference this hash")
+			return
+		}
+		fr = named
+	}
+	data, rErr := fsys.ReadObjectHashed(fr.objectKey())
 	if rErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "read failed"})
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "read failed")
 		return
 	}
-	dispType := "attachment"
-	if strings.HasPrefix(fr.MIME, "video/") || fr.MIME == "application/pdf" {
-		dispType = "inline"
+	touchAccess(db, &fr)
+	c.Header("Content-Disposition", dispositionFor(fr.MIME)+"; filename="+fr.Filename)
+	serveObject(c, &fr, data)
+}
+
+// md5Param returns the lower-cased :md5 path parameter, answering 400 when it is not a hex MD5
+func md5Param(c *gin.Context) (string, bool) {
+	md5v := strings.ToLower(c.Param("md5"))
+	if _, err := hex.DecodeString(md5v); err != nil || len(md5v) != 32 {
+		apiError(c, http.StatusBadRequest, codeInvalidMD5, "invalid md5")
+		return "", false
+	}
+	return md5v, true
+}
+
+// objectExistsHandler lets a client holding a content hash skip uploading data already stored
+func objectExistsHandler(c *gin.Context) {
+	md5v, ok := md5Param(c)
+	if !ok {
+		return
+	}
+	fsys, err := fs.New()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
+		return
+	}
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
+		return
+	}
+	onDisk, err := fsys.HashedObjectExists(md5v)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeLookupFailed, "stat failed")
+		return
+	}
+	var fr FileRecord
+	res := db.Where("md5 = ?", md5v).Limit(1).Find(&fr)
+	if res.Error != nil {
+		apiError(c, http.StatusInternalServerError, codeLookupFailed, "lookup failed")
+		return
+	}
+	// an object only counts when it is both stored and referenced by a live record
+	if !onDisk || res.RowsAffected == 0 {
+		c.JSON(http.StatusOK, gin.H{"exists": false, "md5": md5v})
+		return
 	}
-	c.Header("Content-Disposition", dispType+"; filename="+fr.Filename)
-	c.Header("Content-Length", strconv.FormatInt(fr.Size, 10))
-	c.Header("Content-Type", fr.MIME)
-	c.Writer.Write(data)
+	c.JSON(http.StatusOK, gin.H{"exists": true, "md5": md5v, "size": fr.Size, "compressed_size": fr.CompressedSize})
 }
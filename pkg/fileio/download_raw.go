@@ -0,0 +1,62 @@
+package fileio
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/compress"
+	"go4pack/pkg/common/fs"
+)
+
+// downloadRawHandler serves the stored object as is, leaving decompression to the client:
+// gzip objects are sent with Content-Encoding: gzip, zstd ones only to clients accepting zstd.
+func downloadRawHandler(c *gin.Context) {
+	fsys, err := fs.New()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
+		return
+	}
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
+		return
+	}
+	var fr FileRecord
+	if err := db.First(&fr, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, codeFileNotFound, "file not found")
+		return
+	}
+	c.Header("Vary", "Accept-Encoding")
+	encoding := ""
+	switch fr.CompressionType {
+	case compress.Gzip.String():
+		encoding = "gzip"
+	case compress.Zstd.String():
+		// browsers do not decode zstd; only send it to clients that asked for it
+		if !acceptsEncoding(c.GetHeader("Accept-Encoding"), "zstd") {
+			apiError(c, http.StatusNotAcceptable, codeNotAcceptable, "object is zstd compressed; send Accept-Encoding: zstd or use /download")
+			return
+		}
+		encoding = "zstd"
+	}
+	data, err := fsys.ReadObjectHashedRaw(fr.objectKey())
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "read failed")
+		return
+	}
+	size, err := fsys.GetHashedObjectSize(fr.objectKey())
+	if err != nil {
+		size = int64(len(data))
+	}
+	touchAccess(db, &fr)
+	if encoding != "" {
+		c.Header("Content-Encoding", encoding)
+	}
+	c.Header("Content-Disposition", dispositionFor(fr.MIME)+"; filename="+fr.Filename)
+	c.Header("Content-Type", fr.MIME)
+	c.Header("Content-Length", strconv.FormatInt(size, 10))
+	c.Status(http.StatusOK)
+	writeBody(c, fr.objectKey(), data)
+}
@@ -0,0 +1,67 @@
+package fileio
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/logger"
+)
+
+// Stable machine-readable error codes carried in error responses
+const (
+	codeFSInitFailed      = "FS_INIT_FAILED"
+	codeDBInitFailed      = "DB_INIT_FAILED"
+	codeReadFailed        = "READ_FAILED"
+	codeStoreFailed       = "STORE_FAILED"
+	codeCompressFailed    = "COMPRESS_FAILED"
+	codeInvalidObject     = "INVALID_OBJECT"
+	codeInvalidMultipart  = "INVALID_MULTIPART"
+	codeFileNotFound      = "FILE_NOT_FOUND"
+	codeHashMismatch      = "HASH_MISMATCH"
+	codeInvalidMD5        = "INVALID_MD5"
+	codeLookupFailed      = "LOOKUP_FAILED"
+	codeQueryFailed       = "QUERY_FAILED"
+	codeInvalidParam      = "INVALID_PARAM"
+	codeTypeMismatch      = "TYPE_MISMATCH"
+	codeInvalidArchive    = "INVALID_ARCHIVE"
+	codeThumbnailNotFound = "THUMBNAIL_NOT_FOUND"
+	codeThumbnailFailed   = "THUMBNAIL_FAILED"
+	codeUploadNotFound    = "UPLOAD_NOT_FOUND"
+	codeUploadTooLarge    = "UPLOAD_TOO_LARGE"
+	codeUploadIncomplete  = "UPLOAD_INCOMPLETE"
+	codeOffsetMismatch    = "OFFSET_MISMATCH"
+	codeFileRequired      = "FILE_REQUIRED"
+	codeQuotaExceeded     = "QUOTA_EXCEEDED"
+	codeUploadRejected    = "UPLOAD_REJECTED"
+	codeSchemaUnavailable = "SCHEMA_UNAVAILABLE"
+	codeSchemaInvalid     = "SCHEMA_INVALID"
+	codeUpdateFailed      = "UPDATE_FAILED"
+	codeDeleteFailed      = "DELETE_FAILED"
+	codePinned            = "PINNED"
+	codeRetentionLocked   = "RETENTION_LOCKED"
+	codeGCFailed          = "GC_FAILED"
+	codeNotAcceptable     = "NOT_ACCEPTABLE"
+	codeMemberNotFound    = "MEMBER_NOT_FOUND"
+	codeMemberTooLarge    = "MEMBER_TOO_LARGE"
+	codeObjectNotFound    = "OBJECT_NOT_FOUND"
+	codeAssetsDisabled    = "ASSETS_DISABLED"
+	codeAnalysisFailed    = "ANALYSIS_FAILED"
+)
+
+// apiError writes the structured error body {"error":{"code":...,"message":...}}. Server-side (5xx)
+// failures are logged here, so handlers need not log them separately.
+func apiError(c *gin.Context, status int, code, msg string) {
+	apiErrorWith(c, status, code, msg, nil)
+}
+
+// apiErrorWith is apiError with extra top-level fields next to the error object, for responses
+// telling the client how to recover (a size limit, the remaining quota, ...)
+func apiErrorWith(c *gin.Context, status int, code, msg string, extra gin.H) {
+	if status >= 500 {
+		logger.GetLogger().Error().Int("status", status).Str("code", code).Str("method", c.Request.Method).Str("path", c.Request.URL.Path).Msg(msg)
+	}
+	resp := gin.H{"error": gin.H{"code": code, "message": msg}}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	c.JSON(status, resp)
+}
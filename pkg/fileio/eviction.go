@@ -0,0 +1,178 @@
+package fileio
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/logger"
+	"go4pack/pkg/common/worker"
+)
+
+// evictMu keeps concurrent writes from evicting the same objects twice
+var evictMu sync.Mutex
+
+// touchAccess stamps a record as just read, feeding LRU eviction
+func touchAccess(db *gorm.DB, fr *FileRecord) {
+	now := time.Now().UTC()
+	// UpdateColumn leaves updated_at alone: a read is not a modification
+	db.Model(&FileRecord{}).Where("id = ?", fr.ID).UpdateColumn("last_accessed_at", now)
+}
+
+// lastUse is when a record was last read, or created if it never was
+func lastUse(fr *FileRecord) time.Time {
+	if fr.LastAccessedAt != nil {
+		return *fr.LastAccessedAt
+	}
+	return fr.CreatedAt
+}
+
+// objectKeyExpr is FileRecord.objectKey in SQL
+const objectKeyExpr = "CASE WHEN object_key <> '' THEN object_key ELSE md5 END"
+
+// evictBatch is how many candidate objects an eviction pass loads at a time
+const evictBatch = 64
+
+// evictPending is set while a pass is queued, so a burst of uploads schedules only one
+var evictPending atomic.Bool
+
+// enforceObjectsCap schedules a pass evicting least-recently-accessed objects until the objects
+// directory fits Eviction.MaxBytes. Requests arriving while a pass is queued fold into it; the
+// pass runs on the worker pool (inline when it is saturated), so uploads do not wait for it.
+func enforceObjectsCap() {
+	ec := config.Get().Eviction
+	if !ec.Enabled || ec.MaxBytes <= 0 {
+		return
+	}
+	if !evictPending.CompareAndSwap(false, true) {
+		return
+	}
+	run := func() {
+		evictPending.Store(false)
+		evictObjects()
+	}
+	if worker.Submit(run) != nil {
+		run()
+	}
+}
+
+// storedObjectsSize is the size on disk of the objects referenced by live records, from the
+// recorded compressed sizes rather than a walk of the objects directory
+func storedObjectsSize(db *gorm.DB) (int64, error) {
+	perObject := db.Model(&FileRecord{}).Select("MAX(compressed_size) AS size").Group(objectKeyExpr)
+	var total int64
+	err := db.Table("(?) AS objs", perObject).Select("COALESCE(SUM(size), 0)").Scan(&total).Error
+	return total, err
+}
+
+// evictObjects evicts least-recently-accessed objects, and the records referencing them, until
+// the stored objects fit Eviction.MaxBytes. The most recently used object (normally the upload
+// that triggered the pass) and objects referenced by a pinned or retention-locked record are
+// never evicted. Candidates are read from the database oldest first, a batch at a time. It
+// returns the number of objects evicted.
+func evictObjects() int {
+	ec := config.Get().Eviction
+	evictMu.Lock()
+	defer evictMu.Unlock()
+
+	db, err := ensureDB()
+	if err != nil {
+		return 0
+	}
+	fsys, err := fs.New()
+	if err != nil {
+		return 0
+	}
+	total, err := storedObjectsSize(db)
+	if err != nil {
+		logger.GetLogger().Warn().Err(err).Msg("objects size lookup failed")
+		return 0
+	}
+	if total <= ec.MaxBytes {
+		return 0
+	}
+	type candidate struct {
+		Okey string
+		Size int64
+	}
+	var newest candidate
+	if err := objectsByLastUse(db).Order("MAX(COALESCE(last_accessed_at, created_at)) DESC").Limit(1).Scan(&newest).Error; err != nil {
+		return 0
+	}
+	evicted := 0
+	skipped := []string{newest.Okey}
+	for total > ec.MaxBytes {
+		var batch []candidate
+		q := objectsByLastUse(db).
+			Having("MAX(CASE WHEN pinned THEN 1 ELSE 0 END) = 0").
+			Order("MAX(COALESCE(last_accessed_at, created_at))").
+			Limit(evictBatch)
+		if len(skipped) > 0 {
+			q = q.Where(objectKeyExpr+" NOT IN ?", skipped)
+		}
+		if err := q.Scan(&batch).Error; err != nil || len(batch) == 0 {
+			break
+		}
+		for _, cand := range batch {
+			if total <= ec.MaxBytes {
+				break
+			}
+			if !evictObject(db, fsys, cand.Okey, cand.Size) {
+				skipped = append(skipped, cand.Okey)
+				continue
+			}
+			total -= cand.Size
+			evicted++
+		}
+	}
+	if total > ec.MaxBytes {
+		logger.GetLogger().Warn().Int64("total", total).Int64("max_bytes", ec.MaxBytes).Msg("objects directory still above cap after eviction")
+	}
+	return evicted
+}
+
+// objectsByLastUse groups live records by stored object, selecting each object's key and size
+func objectsByLastUse(db *gorm.DB) *gorm.DB {
+	return db.Model(&FileRecord{}).
+		Select(objectKeyExpr + " AS okey, MAX(compressed_size) AS size").
+		Group(objectKeyExpr)
+}
+
+// evictObject deletes the object key and every record referencing it, reporting false when it is
+// protected (pinned or retention-locked) or could not be deleted
+func evictObject(db *gorm.DB, fsys *fs.FileSystem, key string, size int64) bool {
+	var records []FileRecord
+	if err := db.Where(objectKeyExpr+" = ?", key).Find(&records).Error; err != nil || len(records) == 0 {
+		return false
+	}
+	var last time.Time
+	for i := range records {
+		if records[i].Pinned || retentionLocked(&records[i]) {
+			return false
+		}
+		if t := lastUse(&records[i]); t.After(last) {
+			last = t
+		}
+	}
+	if err := fsys.DeleteObjectHashed(key); err != nil {
+		logger.GetLogger().Warn().Err(err).Str("hash", key).Msg("evict object failed")
+		return false
+	}
+	for i := range records {
+		rec := &records[i]
+		if deleteRecord(db, rec) == nil {
+			statsOnDelete(db, rec, i == len(records)-1)
+		}
+	}
+	logger.GetLogger().Info().
+		Str("hash", key).
+		Int64("size", size).
+		Int("records", len(records)).
+		Time("last_accessed_at", last).
+		Msg("object evicted")
+	return true
+}
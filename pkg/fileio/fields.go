@@ -0,0 +1,94 @@
+package fileio
+
+import (
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/config"
+)
+
+// acceptsUploadField reports whether a multipart field named name may carry an upload
+func acceptsUploadField(name string) bool {
+	uc := config.Get().Upload
+	return slices.Contains(uc.FieldNames, name) || uc.FieldFallback
+}
+
+// uploadFormFile returns the uploaded file from the first configured field present, or, with
+// field fallback enabled, from the first file field in name order. When nothing matches it writes
+// a 400 listing the accepted and the available field names and returns ok=false.
+func uploadFormFile(c *gin.Context) (f multipart.File, header *multipart.FileHeader, ok bool) {
+	uc := config.Get().Upload
+	var available []string
+	err := c.Request.ParseMultipartForm(32 << 20)
+	if rejectBodyTooLarge(c, err) {
+		return nil, nil, false
+	}
+	if err == nil && c.Request.MultipartForm != nil {
+		files := c.Request.MultipartForm.File
+		for name := range files {
+			available = append(available, name)
+		}
+		sort.Strings(available)
+		candidates := slices.Clone(uc.FieldNames)
+		if uc.FieldFallback {
+			candidates = append(candidates, available...)
+		}
+		for _, name := range candidates {
+			if hs := files[name]; len(hs) > 0 {
+				if f, err := hs[0].Open(); err == nil {
+					return f, hs[0], true
+				}
+			}
+		}
+	}
+	rejectUploadFields(c, "file is required", available)
+	return nil, nil, false
+}
+
+// rejectUploadFields writes the 400 for a request without any accepted file field
+func rejectUploadFields(c *gin.Context, msg string, available []string) {
+	extra := gin.H{"expected_fields": config.Get().Upload.FieldNames}
+	if len(available) > 0 {
+		extra["available_fields"] = available
+	}
+	apiErrorWith(c, http.StatusBadRequest, codeFileRequired, msg, extra)
+}
+
+// partHasFilename reports whether a part's Content-Disposition carries a filename parameter at
+// all; multipart.Part.FileName cannot tell an empty filename="" apart from a plain form field.
+func partHasFilename(part *multipart.Part) bool {
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil {
+		return false
+	}
+	_, ok := params["filename"]
+	return ok
+}
+
+// storedFilename returns the client supplied name, or "<md5>.bin" when it is empty or blank.
+// Generated names get a numeric suffix while taken, since filename is unique across all records.
+func storedFilename(name, md5sum string) string {
+	if n := strings.TrimSpace(name); n != "" && n != "." && n != "/" {
+		return name
+	}
+	candidate := md5sum + ".bin"
+	db, err := ensureDB()
+	if err != nil {
+		return candidate
+	}
+	for i := 1; ; i++ {
+		var taken int64
+		// soft-deleted rows still hold the unique index
+		if err := db.Unscoped().Model(&FileRecord{}).Where("filename = ?", candidate).Count(&taken).Error; err != nil || taken == 0 {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d.bin", md5sum, i)
+	}
+}
@@ -0,0 +1,63 @@
+package fileio
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/logger"
+)
+
+// gcGracePeriod protects recently written objects from the sweep: uploads store the object
+// before creating its record, so a young unreferenced object may simply be in flight
+var gcGracePeriod = 5 * time.Minute
+
+// gcHandler deletes stored objects no live record references and reports what was reclaimed
+func gcHandler(c *gin.Context) {
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "database init failed")
+		return
+	}
+	fsys, err := fs.New()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
+		return
+	}
+	var keys []string
+	if err := db.Model(&FileRecord{}).Distinct("md5").Pluck("md5", &keys).Error; err != nil {
+		apiError(c, http.StatusInternalServerError, codeQueryFailed, "query files failed")
+		return
+	}
+	var salted []string
+	if err := db.Model(&FileRecord{}).Where("object_key <> ''").Pluck("object_key", &salted).Error; err != nil {
+		apiError(c, http.StatusInternalServerError, codeQueryFailed, "query files failed")
+		return
+	}
+	referenced := make(map[string]struct{}, len(keys)+len(salted))
+	for _, k := range append(keys, salted...) {
+		referenced[k] = struct{}{}
+	}
+	cutoff := time.Now().Add(-gcGracePeriod)
+	_ = fsys.WalkObjects(func(hash string, info os.FileInfo) error {
+		if info.ModTime().After(cutoff) {
+			referenced[hash] = struct{}{}
+		}
+		return nil
+	})
+	removed, freed, err := fsys.GCOrphans(referenced)
+	if err != nil {
+		logger.GetLogger().Error().Err(err).Int("removed", removed).Msg("object gc failed")
+		apiErrorWith(c, http.StatusInternalServerError, codeGCFailed, "gc failed", gin.H{"removed": removed, "freed_bytes": freed})
+		return
+	}
+	if removed > 0 {
+		// orphans were never in the stats' record-driven counters; rebuild the physical totals
+		_, _ = recomputeStats(db)
+	}
+	logger.GetLogger().Info().Int("removed", removed).Int64("freed_bytes", freed).Msg("object gc completed")
+	c.JSON(http.StatusOK, gin.H{"removed": removed, "freed_bytes": freed})
+}
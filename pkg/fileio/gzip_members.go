@@ -0,0 +1,143 @@
+package fileio
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/fs"
+)
+
+// safeMemberName returns the cleaned, relative form of a tar member name, or false when the
+// name is absolute or climbs out of the archive root ("../x", "a/../../x")
+func safeMemberName(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasPrefix(name, "/") {
+		return "", false
+	}
+	clean := path.Clean(name)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false
+	}
+	return clean, true
+}
+
+// gzipMembersHandler lists the tar members of a stored .tar.gz as JSON lines, or with
+// ?extract=<member> streams that member's bytes. Members with unsafe names are listed (flagged
+// "unsafe") but never extracted, and extraction is capped by Download.GzipMemberMaxBytes.
+func gzipMembersHandler(c *gin.Context) {
+	fsys, err := fs.New()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
+		return
+	}
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
+		return
+	}
+	var fr FileRecord
+	if err := db.First(&fr, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, codeFileNotFound, "file not found")
+		return
+	}
+	if !isGzipMIME(fr.MIME) {
+		apiErrorWith(c, http.StatusBadRequest, codeTypeMismatch, "not a gzip file", gin.H{"mime": fr.MIME})
+		return
+	}
+	want, extract := c.GetQuery("extract")
+	if extract {
+		var ok bool
+		if want, ok = safeMemberName(want); !ok {
+			apiError(c, http.StatusBadRequest, codeInvalidParam, "invalid member name")
+			return
+		}
+	}
+	// gzip input is stored as uploaded, so the on-disk bytes are the gzip stream itself
+	obj, err := fsys.OpenObjectHashedRaw(fr.objectKey())
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "read failed")
+		return
+	}
+	defer obj.Close()
+	gr, err := gzip.NewReader(obj)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, codeInvalidArchive, "invalid gzip stream: "+err.Error())
+		return
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	h, err := tr.Next()
+	if err != nil && err != io.EOF {
+		apiError(c, http.StatusBadRequest, codeInvalidArchive, "not a tar archive")
+		return
+	}
+	touchAccess(db, &fr)
+	if extract {
+		extractMember(c, fr.objectKey(), tr, h, want)
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	for ; err == nil; h, err = tr.Next() {
+		entry := tarEntryMeta(h)
+		if _, ok := safeMemberName(h.Name); !ok {
+			entry["unsafe"] = true
+		}
+		if enc.Encode(entry) != nil {
+			return
+		}
+	}
+}
+
+// extractMember advances tr from the current header h to the regular file named want (compared in
+// cleaned form) and streams it; objectKey is the archive's, for the download rate
+func extractMember(c *gin.Context, objectKey string, tr *tar.Reader, h *tar.Header, want string) {
+	var err error
+	for ; h != nil && err == nil; h, err = tr.Next() {
+		name, ok := safeMemberName(h.Name)
+		if !ok || name != want {
+			continue
+		}
+		if h.Typeflag != tar.TypeReg {
+			apiErrorWith(c, http.StatusBadRequest, codeTypeMismatch, "member is not a regular file", gin.H{"member": want})
+			return
+		}
+		// the header size is only a claim; the copy is capped as well
+		max := config.Get().Download.GzipMemberMaxBytes
+		if max > 0 && h.Size > max {
+			apiErrorWith(c, http.StatusRequestEntityTooLarge, codeMemberTooLarge, "member too large", gin.H{"size": h.Size, "max_bytes": max})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename="+path.Base(name))
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Length", strconv.FormatInt(h.Size, 10))
+		c.Status(http.StatusOK)
+		var r io.Reader = tr
+		if max > 0 {
+			r = io.LimitReader(tr, max)
+		}
+		if rate := downloadRate(c, objectKey); rate > 0 {
+			_, _ = io.Copy(newThrottledWriter(c.Writer, rate), r)
+			return
+		}
+		_, _ = io.Copy(c.Writer, r)
+		return
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		apiError(c, http.StatusBadRequest, codeInvalidArchive, "corrupt tar archive")
+		return
+	}
+	apiErrorWith(c, http.StatusNotFound, codeMemberNotFound, "member not found", gin.H{"member": want})
+}
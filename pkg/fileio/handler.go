@@ -6,14 +6,42 @@ import (
 
 // RegisterRoutes registers file upload/download routes under given router group
 func RegisterRoutes(rg *gin.RouterGroup) {
-	rg.POST("/upload", uploadHandler)
-	rg.POST("/upload/multi", uploadMultiHandler)
-	rg.POST("/upload/stream", streamUploadHandler)
+	rg.POST("/upload", uploadPrecheck, uploadHandler)
+	rg.POST("/upload/multi", uploadPrecheck, uploadMultiHandler)
+	rg.POST("/upload/stream", uploadPrecheck, streamUploadHandler)
+	rg.POST("/upload/archive", uploadPrecheck, uploadArchiveHandler)
+	rg.POST("/upload/chunked", chunkCreateHandler)
+	rg.GET("/upload/chunked/:id", chunkStatusHandler)
+	rg.HEAD("/upload/chunked/:id", chunkStatusHandler)
+	rg.PATCH("/upload/chunked/:id", chunkAppendHandler)
+	rg.POST("/upload/chunked/:id/commit", chunkCommitHandler)
 
 	rg.GET("/download/:filename", downloadHandler)
 	rg.GET("/download/by-md5/:md5", downloadByMD5Handler)
+	rg.GET("/download/raw/:id", downloadRawHandler)
+	rg.GET("/download/gzip-members/:id", gzipMembersHandler)
+	rg.GET("/object/:md5/exists", objectExistsHandler)
+	rg.GET("/object/:md5/info", objectInfoHandler)
+	rg.GET("/assets/*path", assetHandler)
+	rg.GET("/thumb/:id", thumbHandler)
 
 	rg.GET("/list", listHandler)
+	rg.GET("/duplicates", duplicatesHandler)
 	rg.GET("/stats", statsHandler)
 	rg.GET("/meta/:id", metaHandler)
+	rg.GET("/meta/by-md5/:md5", metaByMD5Handler)
+	rg.POST("/analysis/elf/:id/refresh", elfRefreshHandler)
+	rg.GET("/analysis/compress-bench/:id", compressBenchHandler)
+
+	rg.POST("/file/:id/pin", pinHandler(true))
+	rg.DELETE("/file/:id/pin", pinHandler(false))
+}
+
+// RegisterAdminRoutes registers the routes that delete data, rewrite bookkeeping or read the
+// whole store. The caller mounts them behind admin authentication.
+func RegisterAdminRoutes(rg *gin.RouterGroup) {
+	rg.DELETE("/file/:id", deleteHandler)
+	rg.POST("/gc", gcHandler)
+	rg.POST("/stats/recompute", statsRecomputeHandler)
+	rg.GET("/verify", verifyHandler)
 }
@@ -1,13 +1,31 @@
 package fileio
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
 	"io"
+	"math/rand"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,8 +33,18 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gorm.io/driver/sqlite"
 
+	"go4pack/pkg/common/compress"
+	"go4pack/pkg/common/config"
 	"go4pack/pkg/common/database"
+	"go4pack/pkg/common/file"
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/restful"
+	"go4pack/pkg/common/tracing"
+	"go4pack/pkg/common/worker"
 )
 
 // helper to setup router with routes
@@ -25,11 +53,12 @@ func setupRouter() *gin.Engine {
 	r := gin.New()
 	rg := r.Group("/files")
 	RegisterRoutes(rg)
+	RegisterAdminRoutes(rg)
 	return r
 }
 
 // reset database singleton and runtime dir for clean state
-func resetState(t *testing.T) string {
+func resetState(t testing.TB) string {
 	database.ResetForTest()
 	tempDir := t.TempDir()
 	cwd, _ := os.Getwd()
@@ -37,6 +66,14 @@ func resetState(t *testing.T) string {
 		t.Fatalf("chdir: %v", err)
 	}
 	t.Cleanup(func() { os.Chdir(cwd) })
+	// async analyses write into .runtime; let them finish before TempDir is removed
+	t.Cleanup(func() {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if st := worker.StatsSnapshot(); st["submitted"] == st["completed"] {
+				return
+			}
+		}
+	})
 	return tempDir
 }
 
@@ -54,6 +91,24 @@ func createMultipartFile(t *testing.T, fieldName, filename, content string) (*by
 	return &buf, w.FormDataContentType()
 }
 
+// uploadFile posts content via the buffered upload endpoint and decodes the JSON response
+func uploadFile(t *testing.T, r *gin.Engine, filename, content string) map[string]any {
+	t.Helper()
+	body, ct := createMultipartFile(t, "file", filename, content)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/files/upload", body)
+	req.Header.Set("Content-Type", ct)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload %s failed code=%d body=%s", filename, w.Code, w.Body.String())
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode upload response: %v", err)
+	}
+	return resp
+}
+
 func TestUploadAndList(t *testing.T) {
 	resetState(t)
 	r := setupRouter()
@@ -209,3 +264,3222 @@ func TestUploadTimestampMetadata(t *testing.T) {
 		t.Errorf("expected created_at in list")
 	}
 }
+
+func TestUploadQuota(t *testing.T) {
+	resetState(t)
+	cfg := config.Default()
+	cfg.Quota = config.QuotaConfig{Enabled: true, MaxBytes: 100, WindowSeconds: 3600}
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+
+	upload := func(name string) *httptest.ResponseRecorder {
+		body, ct := createMultipartFile(t, "file", name, strings.Repeat("q", 60))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/files/upload", body)
+		req.Header.Set("Content-Type", ct)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	w := upload("q1.txt")
+	if w.Code != http.StatusOK {
+		t.Fatalf("first upload failed: %d %s", w.Code, w.Body.String())
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"quota_remaining":40`)) {
+		t.Errorf("expected quota_remaining 40, got %s", w.Body.String())
+	}
+	w2 := upload("q2.txt")
+	if w2.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 past quota, got %d %s", w2.Code, w2.Body.String())
+	}
+	if !bytes.Contains(w2.Body.Bytes(), []byte(`"quota_remaining":40`)) {
+		t.Errorf("expected remaining 40 in rejection, got %s", w2.Body.String())
+	}
+
+	// an unauthenticated X-API-Key header does not open a fresh quota
+	body, ct := createMultipartFile(t, "file", "q3.txt", strings.Repeat("q", 60))
+	w3 := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/files/upload", body)
+	req.Header.Set("Content-Type", ct)
+	req.Header.Set("X-API-Key", "made-up")
+	r.ServeHTTP(w3, req)
+	if w3.Code != http.StatusTooManyRequests {
+		t.Fatalf("spoofed key: expected 429, got %d %s", w3.Code, w3.Body.String())
+	}
+}
+
+func TestUploadQuotaConcurrent(t *testing.T) {
+	resetState(t)
+	cfg := config.Default()
+	cfg.Quota = config.QuotaConfig{Enabled: true, MaxBytes: 100, WindowSeconds: 3600}
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+
+	// each upload fits on its own, but only one of them fits in the quota
+	const n = 8
+	codes := make([]int, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, ct := createMultipartFile(t, "file", fmt.Sprintf("c%d.txt", i), strings.Repeat(string(rune('a'+i)), 60))
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/files/upload", body)
+			req.Header.Set("Content-Type", ct)
+			r.ServeHTTP(w, req)
+			codes[i] = w.Code
+		}()
+	}
+	wg.Wait()
+	accepted := 0
+	for _, code := range codes {
+		if code == http.StatusOK {
+			accepted++
+		} else if code != http.StatusTooManyRequests {
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if accepted != 1 {
+		t.Fatalf("expected exactly one upload within quota, got %d (%v)", accepted, codes)
+	}
+}
+
+func TestUploadDryRun(t *testing.T) {
+	dir := resetState(t)
+	r := setupRouter()
+	bin := "/bin/uname"
+	content, err := os.ReadFile(bin)
+	if err != nil {
+		t.Skipf("sample ELF %s not available: %v", bin, err)
+	}
+	body, ct := createMultipartFile(t, "file", "uname", string(content))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/files/upload?dry_run=true", body)
+	req.Header.Set("Content-Type", ct)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("dry run failed: %d %s", w.Code, w.Body.String())
+	}
+	for _, want := range []string{`"stored":false`, `"md5":"`, `"mime":"`, `"elf":{`, `"machine"`} {
+		if !bytes.Contains(w.Body.Bytes(), []byte(want)) {
+			t.Errorf("dry run response missing %s: %s", want, w.Body.String())
+		}
+	}
+	// no DB row
+	w2 := httptest.NewRecorder()
+	r.ServeHTTP(w2, httptest.NewRequest(http.MethodGet, "/files/list", nil))
+	if !bytes.Contains(w2.Body.Bytes(), []byte(`"total":0`)) {
+		t.Errorf("expected no records after dry run, got %s", w2.Body.String())
+	}
+	// no stored object
+	var objects int
+	filepath.Walk(filepath.Join(dir, ".runtime", "objects"), func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			objects++
+		}
+		return nil
+	})
+	if objects != 0 {
+		t.Errorf("expected no stored objects after dry run, found %d", objects)
+	}
+}
+
+func TestUploadMultiStreamsParts(t *testing.T) {
+	resetState(t)
+	// the parts only carry the gzip magic; analyzing them would leave jobs running past the test
+	cfg := config.Default()
+	cfg.Analysis.Gzip = false
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+	const parts, partSize = 8, 4 << 20
+
+	// Generate the multipart body on the fly so the payload itself never sits in memory.
+	// Parts carry the gzip magic so they are stored raw: this keeps encoder buffers out of the
+	// measurement, leaving only what the handler itself holds on to.
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		chunk := make([]byte, 64<<10)
+		for i := 0; i < parts; i++ {
+			part, err := mw.CreateFormFile("files", "big"+strconv.Itoa(i)+".bin")
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			for written := 0; written < partSize; written += len(chunk) {
+				for j := range chunk {
+					chunk[j] = byte((i*31 + j + written/len(chunk)) % 251)
+				}
+				if written == 0 {
+					chunk[0], chunk[1] = 0x1f, 0x8b
+				}
+				if _, err := part.Write(chunk); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+			}
+		}
+		pw.CloseWithError(mw.Close())
+	}()
+
+	var base runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&base)
+	var peak uint64
+	stop := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		var ms runtime.MemStats
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+				runtime.ReadMemStats(&ms)
+				if ms.HeapInuse > peak {
+					peak = ms.HeapInuse
+				}
+			}
+		}
+	}()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/files/upload/multi", pr)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	r.ServeHTTP(w, req)
+	close(stop)
+	<-sampled
+	if w.Code != http.StatusOK {
+		t.Fatalf("multi upload failed: %d %s", w.Code, w.Body.String())
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"count":8`)) {
+		t.Fatalf("expected 8 results, got %s", w.Body.String())
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte(`"error"`)) {
+		t.Fatalf("unexpected per-file error: %s", w.Body.String())
+	}
+	if n := bytes.Count(w.Body.Bytes(), []byte(`"original_size":4194304`)); n != parts {
+		t.Errorf("expected %d parts of %d bytes, got %d", parts, partSize, n)
+	}
+	t.Logf("peak heap growth %d MiB", (int64(peak)-int64(base.HeapInuse))>>20)
+	// reading a part back whole would hold up to four of them at once; streaming stays well
+	// below the size of a single part
+	if growth := int64(peak) - int64(base.HeapInuse); growth >= 3<<20 {
+		t.Errorf("peak heap growth %d MiB not bounded below 3 MiB (one part is %d MiB)", growth>>20, partSize>>20)
+	}
+}
+
+func TestDeleteRetentionLocked(t *testing.T) {
+	resetState(t)
+	cfg := config.Default()
+	cfg.Retention = config.RetentionConfig{Enabled: true, PeriodSeconds: 3600}
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+
+	resp := uploadFile(t, r, "worm.txt", "write once read many")
+	if resp["retain_until"] == nil {
+		t.Errorf("expected retain_until in upload response: %v", resp)
+	}
+	id := strconv.Itoa(int(resp["id"].(float64)))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/files/file/"+id, nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 while locked, got %d %s", w.Code, w.Body.String())
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("RETENTION_LOCKED")) || !bytes.Contains(w.Body.Bytes(), []byte("retain_until")) {
+		t.Errorf("expected RETENTION_LOCKED with unlock time, got %s", w.Body.String())
+	}
+
+	// move the deadline into the past to simulate the window elapsing
+	past := time.Now().Add(-time.Minute)
+	if err := database.Get().Model(&FileRecord{}).Where("id = ?", id).Update("retain_until", past).Error; err != nil {
+		t.Fatalf("update retain_until: %v", err)
+	}
+	w2 := httptest.NewRecorder()
+	r.ServeHTTP(w2, httptest.NewRequest(http.MethodDelete, "/files/file/"+id, nil))
+	if w2.Code != http.StatusOK {
+		t.Fatalf("expected delete after retention, got %d %s", w2.Code, w2.Body.String())
+	}
+}
+
+func TestReuploadAfterDeleteFreesFilename(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	first := uploadFile(t, r, "same.txt", "first version")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/files/file/"+strconv.Itoa(int(first["id"].(float64))), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete failed: %d %s", w.Code, w.Body.String())
+	}
+	second := uploadFile(t, r, "same.txt", "second version")
+	if second["id"] == nil || second["id"].(float64) == 0 {
+		t.Fatalf("expected a new record id, got %v", second["id"])
+	}
+	var count int64
+	database.Get().Unscoped().Model(&FileRecord{}).Where("filename = ?", "same.txt").Count(&count)
+	if count != 1 {
+		t.Fatalf("expected exactly one row for same.txt, got %d", count)
+	}
+}
+
+func TestUploadFailsWhenRecordCannotBeCreated(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	uploadFile(t, r, "init.txt", "opens the database")
+	if err := database.Get().Exec("CREATE TRIGGER reject_records BEFORE INSERT ON file_records BEGIN SELECT RAISE(ABORT, 'rejected'); END").Error; err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	for _, path := range []string{"/files/upload", "/files/upload/stream"} {
+		body, ct := createMultipartFile(t, "file", "rejected.txt", "never recorded")
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.Header.Set("Content-Type", ct)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), codeStoreFailed) {
+			t.Errorf("%s: expected 500 %s, got %d %s", path, codeStoreFailed, w.Code, w.Body.String())
+		}
+	}
+	body, ct := createMultipartFile(t, "files", "rejected.txt", "never recorded")
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/files/upload/multi", body)
+	req.Header.Set("Content-Type", ct)
+	r.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "record create failed") {
+		t.Errorf("multi: expected a per-file error, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStatsCacheMatchesRecompute(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	getJSON := func(method, path string) map[string]any {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s failed: %d %s", method, path, w.Code, w.Body.String())
+		}
+		var m map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+			t.Fatalf("decode %s: %v", path, err)
+		}
+		return m
+	}
+	// build the cache while empty so subsequent changes are applied incrementally
+	getJSON(http.MethodGet, "/files/stats")
+
+	uploadFile(t, r, "a.txt", strings.Repeat("alpha", 100))
+	uploadFile(t, r, "b.txt", strings.Repeat("alpha", 100)) // duplicate content
+	del := uploadFile(t, r, "c.txt", strings.Repeat("gamma", 80))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/files/file/"+strconv.Itoa(int(del["id"].(float64))), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete failed: %d %s", w.Code, w.Body.String())
+	}
+
+	cached := getJSON(http.MethodGet, "/files/stats")
+	fresh := getJSON(http.MethodPost, "/files/stats/recompute")
+	for _, k := range []string{"file_count", "unique_hash_count", "total_original_size", "total_compressed_size", "unique_compressed_size", "compression_types", "mime_types"} {
+		if !reflect.DeepEqual(cached[k], fresh[k]) {
+			t.Errorf("%s: cached=%v recomputed=%v", k, cached[k], fresh[k])
+		}
+	}
+	if cached["file_count"] != float64(2) {
+		t.Errorf("expected 2 files after delete, got %v", cached["file_count"])
+	}
+}
+
+// untouchedBody fails the test if the handler reads any of the request body
+type untouchedBody struct{ t *testing.T }
+
+func (b untouchedBody) Read([]byte) (int, error) {
+	b.t.Error("request body was read despite early rejection")
+	return 0, io.EOF
+}
+
+func TestUploadExpectContinueEarlyReject(t *testing.T) {
+	resetState(t)
+	cfg := config.Default()
+	cfg.Upload.MaxBytes = 1024
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+
+	for _, path := range []string{"/files/upload", "/files/upload/multi", "/files/upload/stream"} {
+		req := httptest.NewRequest(http.MethodPost, path, untouchedBody{t})
+		req.ContentLength = 10 << 20
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+		req.Header.Set("Expect", "100-continue")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: expected 413, got %d %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	// a body without Content-Length is cut off once it passes the limit
+	for _, path := range []string{"/files/upload", "/files/upload/multi", "/files/upload/stream"} {
+		body, ct := createMultipartFile(t, "file", "big.bin", strings.Repeat("x", 4096))
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.ContentLength = -1
+		req.Header.Set("Content-Type", ct)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s chunked: expected 413, got %d %s", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestUploadAnalysisDisabled(t *testing.T) {
+	resetState(t)
+	cfg := config.Default()
+	cfg.Analysis.Enabled = false
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("compressed payload"))
+	zw.Close()
+	uploads := map[string]string{"payload.gz": gz.String()}
+	if elfBytes, err := os.ReadFile("/bin/uname"); err == nil {
+		uploads["uname"] = string(elfBytes)
+	}
+
+	before := worker.StatsSnapshot()["submitted"].(uint64)
+	for name, content := range uploads {
+		resp := uploadFile(t, r, name, content)
+		if resp["analysis_status"] != "none" {
+			t.Errorf("%s: expected analysis_status none, got %v", name, resp["analysis_status"])
+		}
+	}
+	if after := worker.StatsSnapshot()["submitted"].(uint64); after != before {
+		t.Errorf("expected no analysis jobs, submitted went %d -> %d", before, after)
+	}
+}
+
+func TestDownloadThrottled(t *testing.T) {
+	resetState(t)
+	cfg := config.Default()
+	cfg.Download.SigningKey = "test-key"
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+	md5v := uploadFile(t, r, "slow.bin", strings.Repeat("S", 1500))["md5"].(string)
+
+	// unsigned override is ignored: no throttling by default
+	start := time.Now()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/download/slow.bin?rate=1000&sig=bogus", nil))
+	if w.Code != http.StatusOK || w.Body.Len() != 1500 {
+		t.Fatalf("download failed: %d len=%d", w.Code, w.Body.Len())
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("unsigned rate override should not throttle")
+	}
+
+	// signed override: 1500 bytes at 1000 B/s takes at least ~1.5s
+	start = time.Now()
+	w2 := httptest.NewRecorder()
+	exp := time.Now().Add(time.Hour).Unix()
+	url := fmt.Sprintf("/files/download/slow.bin?rate=1000&exp=%d&sig=%s", exp, signRate("test-key", md5v, 1000, exp))
+	r.ServeHTTP(w2, httptest.NewRequest(http.MethodGet, url, nil))
+	if w2.Code != http.StatusOK || w2.Body.Len() != 1500 {
+		t.Fatalf("throttled download failed: %d len=%d", w2.Code, w2.Body.Len())
+	}
+	if elapsed := time.Since(start); elapsed < 1400*time.Millisecond {
+		t.Errorf("expected throttled transfer to take >=1.4s, took %v", elapsed)
+	}
+
+	// a signature only holds for its object, rate and expiry, and never lifts the limit
+	cfg.Download.RateLimitBytes = 5000
+	past := time.Now().Add(-time.Minute).Unix()
+	for name, q := range map[string]string{
+		"valid":         fmt.Sprintf("rate=1000&exp=%d&sig=%s", exp, signRate("test-key", md5v, 1000, exp)),
+		"other object":  fmt.Sprintf("rate=1000&exp=%d&sig=%s", exp, signRate("test-key", "other", 1000, exp)),
+		"expired":       fmt.Sprintf("rate=1000&exp=%d&sig=%s", past, signRate("test-key", md5v, 1000, past)),
+		"tampered rate": fmt.Sprintf("rate=2000&exp=%d&sig=%s", exp, signRate("test-key", md5v, 1000, exp)),
+		"unlimited":     fmt.Sprintf("rate=0&exp=%d&sig=%s", exp, signRate("test-key", md5v, 0, exp)),
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/files/download/slow.bin?"+q, nil)
+		want := int64(5000)
+		if name == "valid" {
+			want = 1000
+		}
+		if got := downloadRate(c, md5v); got != want {
+			t.Errorf("%s: rate = %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestObjectExists(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	resp := uploadFile(t, r, "exists.txt", "content addressed existence probe")
+	md5v := resp["md5"].(string)
+
+	check := func(hash string, wantCode int, wantExists bool) map[string]any {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/object/"+hash+"/exists", nil))
+		if w.Code != wantCode {
+			t.Fatalf("exists %s code=%d body=%s", hash, w.Code, w.Body.String())
+		}
+		var out map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &out)
+		if wantCode == http.StatusOK && out["exists"] != wantExists {
+			t.Fatalf("exists %s = %v want %v", hash, out["exists"], wantExists)
+		}
+		return out
+	}
+	out := check(md5v, http.StatusOK, true)
+	if out["size"].(float64) != float64(len("content addressed existence probe")) {
+		t.Errorf("unexpected size %v", out["size"])
+	}
+	check("00000000000000000000000000000000", http.StatusOK, false)
+	check("not-a-hash", http.StatusBadRequest, false)
+}
+
+func TestJanitorRemovesStaleTempAndResetsPending(t *testing.T) {
+	resetState(t)
+	objects := filepath.Join(".runtime", "objects")
+	scratch := filepath.Join(".runtime", "temp")
+	for _, d := range []string{objects, scratch} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	write := func(path string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte("partial"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+	staleUp := filepath.Join(objects, "up-123")
+	staleComp := filepath.Join(objects, "upc-456")
+	staleScratch := filepath.Join(scratch, "gzip-789.gz")
+	fresh := filepath.Join(objects, "up-fresh")
+	write(staleUp, old)
+	write(staleComp, old)
+	write(staleScratch, old)
+	write(fresh, time.Now())
+
+	db, err := ensureDB()
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	stuck := FileRecord{Filename: "stuck.bin", MD5: "stuck", AnalysisStatus: "pending"}
+	recent := FileRecord{Filename: "recent.bin", MD5: "recent", AnalysisStatus: "pending"}
+	db.Create(&stuck)
+	db.Create(&recent)
+	db.Model(&FileRecord{}).Where("id = ?", stuck.ID).UpdateColumn("updated_at", old)
+
+	removed, reset := runJanitor(time.Now())
+	if removed != 3 || reset != 1 {
+		t.Fatalf("runJanitor removed=%d reset=%d, want 3 and 1", removed, reset)
+	}
+	for _, p := range []string{staleUp, staleComp, staleScratch} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s should have been removed", p)
+		}
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("fresh temp file removed: %v", err)
+	}
+	var got FileRecord
+	db.First(&got, stuck.ID)
+	if got.AnalysisStatus != "none" {
+		t.Errorf("stuck record status=%s want none", got.AnalysisStatus)
+	}
+	var gotRecent FileRecord
+	db.First(&gotRecent, recent.ID)
+	if gotRecent.AnalysisStatus != "pending" {
+		t.Errorf("recent record status=%s want pending", gotRecent.AnalysisStatus)
+	}
+}
+
+// syncBuffer is a goroutine-safe log sink for asserting on async log output
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestAnalysisCompletedLogEvent(t *testing.T) {
+	resetState(t)
+	sink := &syncBuffer{}
+	prev := log.Logger
+	log.Logger = zerolog.New(sink)
+	t.Cleanup(func() { log.Logger = prev })
+	r := setupRouter()
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("payload for structured analysis logging"))
+	zw.Close()
+	uploadFile(t, r, "logged.gz", gz.String())
+
+	var event map[string]any
+	deadline := time.Now().Add(5 * time.Second)
+	for event == nil && time.Now().Before(deadline) {
+		for _, line := range strings.Split(sink.String(), "\n") {
+			var m map[string]any
+			if json.Unmarshal([]byte(line), &m) == nil && m["message"] == "analysis_completed" && m["kind"] == "gzip" {
+				event = m
+				break
+			}
+		}
+		if event == nil {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	if event == nil {
+		t.Fatalf("no analysis_completed event logged; got:\n%s", sink.String())
+	}
+	if event["kind"] != "gzip" || event["status"] != "done" {
+		t.Errorf("unexpected kind/status: %v", event)
+	}
+	if event["input_size"] != float64(gz.Len()) {
+		t.Errorf("input_size=%v want %d", event["input_size"], gz.Len())
+	}
+	for _, f := range []string{"record_id", "duration_ms", "result_size"} {
+		if _, ok := event[f]; !ok {
+			t.Errorf("missing field %s in %v", f, event)
+		}
+	}
+	if rs, _ := event["result_size"].(float64); rs <= 0 {
+		t.Errorf("result_size should be positive, got %v", event["result_size"])
+	}
+}
+
+func TestAssetServing(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	uploadFile(t, r, "page.html", "<html><script>alert(document.cookie)</script></html>")
+	off := httptest.NewRecorder()
+	r.ServeHTTP(off, httptest.NewRequest(http.MethodGet, "/files/assets/page.html", nil))
+	if off.Code != http.StatusNotFound {
+		t.Fatalf("assets must be off by default, got %d", off.Code)
+	}
+	cfg := config.Default()
+	cfg.Download.ServeAssets = true
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+
+	js := strings.Repeat("console.log('hello from the object store');\n", 20)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(js))
+	zw.Close()
+	uploadFile(t, r, "app.js.gz", gz.String())
+	uploadFile(t, r, "site.css", "body { color: red; }")
+
+	get := func(p, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/files/assets/"+p, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("app.js", "gzip, deflate")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("gzip asset code=%d encoding=%q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/javascript") {
+		t.Errorf("content-type=%q", w.Header().Get("Content-Type"))
+	}
+	if !bytes.Equal(w.Body.Bytes(), gz.Bytes()) {
+		t.Errorf("expected stored gzip bytes to be served untouched")
+	}
+
+	w = get("app.js", "gzip;q=0, identity")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("identity asset code=%d encoding=%q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+	if w.Body.String() != js {
+		t.Errorf("expected decompressed body")
+	}
+
+	w = get("site.css", "gzip")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "" || w.Body.String() != "body { color: red; }" {
+		t.Fatalf("css asset code=%d encoding=%q body=%q", w.Code, w.Header().Get("Content-Encoding"), w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/css") {
+		t.Errorf("css content-type=%q", w.Header().Get("Content-Type"))
+	}
+
+	w = get("page.html", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Security-Policy") != "sandbox" || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("html asset must be sandboxed: code=%d csp=%q", w.Code, w.Header().Get("Content-Security-Policy"))
+	}
+	if csp := get("site.css", "").Header().Get("Content-Security-Policy"); csp != "" {
+		t.Errorf("passive asset should not be sandboxed, got csp=%q", csp)
+	}
+
+	if w = get("app.js.gz", ""); w.Code != http.StatusNotFound {
+		t.Errorf("non web asset extension should 404, got %d", w.Code)
+	}
+	if w = get("missing.html", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing asset should 404, got %d", w.Code)
+	}
+}
+
+func TestAnalysisSkippedWhenTooLarge(t *testing.T) {
+	resetState(t)
+	cfg := config.Default()
+	cfg.Analysis.MaxBytes = 64
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(strings.Repeat("archive body larger than the analysis limit ", 10)))
+	zw.Close()
+	uploads := map[string]string{"big.gz": gz.String()}
+	if elfBytes, err := os.ReadFile("/bin/uname"); err == nil {
+		uploads["uname"] = string(elfBytes)
+	}
+
+	before := worker.StatsSnapshot()["submitted"].(uint64)
+	for name, content := range uploads {
+		resp := uploadFile(t, r, name, content)
+		if resp["analysis_status"] != analysisSkippedTooLarge {
+			t.Fatalf("%s: analysis_status=%v want %s", name, resp["analysis_status"], analysisSkippedTooLarge)
+		}
+		id := strconv.Itoa(int(resp["id"].(float64)))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/meta/"+id, nil))
+		var meta map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &meta)
+		if meta["analysis"] != nil {
+			t.Errorf("%s: expected no analysis, got %v", name, meta["analysis"])
+		}
+		if reason, _ := meta["analysis_skipped_reason"].(string); !strings.Contains(reason, "exceeds analysis limit") {
+			t.Errorf("%s: missing skip reason in meta: %v", name, meta)
+		}
+	}
+	if after := worker.StatsSnapshot()["submitted"].(uint64); after != before {
+		t.Errorf("expected no analysis jobs, submitted went %d -> %d", before, after)
+	}
+}
+
+func TestDownloadByMD5As(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	content := "shared content behind two names"
+	first := uploadFile(t, r, "first.txt", content)
+	uploadFile(t, r, "second.txt", content)
+	uploadFile(t, r, "other.txt", "different content")
+	md5v := first["md5"].(string)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/download/by-md5/"+md5v+query, nil))
+		return w
+	}
+	w := get("?as=second.txt")
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), "filename=second.txt") {
+		t.Fatalf("as=second.txt code=%d disposition=%q", w.Code, w.Header().Get("Content-Disposition"))
+	}
+	if w.Body.String() != content {
+		t.Errorf("unexpected body %q", w.Body.String())
+	}
+	if w = get(""); !strings.Contains(w.Header().Get("Content-Disposition"), "filename=first.txt") {
+		t.Errorf("default disposition=%q", w.Header().Get("Content-Disposition"))
+	}
+	for _, bad := range []string{"other.txt", "evil.exe"} {
+		if w = get("?as=" + bad); w.Code != http.StatusBadRequest {
+			t.Errorf("as=%s expected 400, got %d", bad, w.Code)
+		}
+	}
+}
+
+func TestUploadCustomFieldName(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	post := func(path, field, name string) *httptest.ResponseRecorder {
+		body, ct := createMultipartFile(t, field, name, "payload under a custom field "+name)
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.Header.Set("Content-Type", ct)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/files/upload", "attachment", "custom-default.txt")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("default config: expected 400, got %d", w.Code)
+	}
+	var errResp map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &errResp)
+	if avail, _ := errResp["available_fields"].([]any); len(avail) != 1 || avail[0] != "attachment" {
+		t.Errorf("expected available_fields [attachment], got %v", errResp)
+	}
+	if w = post("/files/upload/multi", "attachment", "custom-multi-default.txt"); w.Code != http.StatusBadRequest {
+		t.Errorf("multi with default config: expected 400, got %d", w.Code)
+	}
+
+	cfg := config.Default()
+	cfg.Upload.FieldNames = []string{"attachment"}
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	for _, path := range []string{"/files/upload", "/files/upload/stream", "/files/upload/multi"} {
+		if w = post(path, "attachment", "custom"+strings.ReplaceAll(path, "/", "-")+".txt"); w.Code != http.StatusOK {
+			t.Errorf("%s with configured field: code=%d body=%s", path, w.Code, w.Body.String())
+		}
+	}
+
+	cfg.Upload.FieldNames = []string{"file"}
+	cfg.Upload.FieldFallback = true
+	if w = post("/files/upload", "whatever", "fallback.txt"); w.Code != http.StatusOK {
+		t.Errorf("fallback: code=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestMetaByMD5(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	resp := uploadFile(t, r, "by-hash.txt", "meta lookup by content hash")
+	uploadFile(t, r, "by-hash-copy.txt", "meta lookup by content hash")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/meta/by-md5/"+resp["md5"].(string), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("meta by md5 code=%d body=%s", w.Code, w.Body.String())
+	}
+	var meta map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &meta)
+	fileObj, _ := meta["file"].(map[string]any)
+	if fileObj["id"] != resp["id"] || fileObj["filename"] != "by-hash.txt" {
+		t.Errorf("expected first referencing record, got %v", fileObj)
+	}
+	if _, ok := meta["available_analysis"]; !ok {
+		t.Errorf("expected shared meta fields, got %v", meta)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/meta/by-md5/ffffffffffffffffffffffffffffffff", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown md5: expected 404, got %d", w.Code)
+	}
+}
+
+func TestPinnedSurvivesCleanup(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	resp := uploadFile(t, r, "critical.txt", "pinned object must survive cleanup")
+	id := strconv.Itoa(int(resp["id"].(float64)))
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	if w := do(http.MethodPost, "/files/file/"+id+"/pin"); w.Code != http.StatusOK {
+		t.Fatalf("pin code=%d body=%s", w.Code, w.Body.String())
+	}
+
+	// a stuck analysis would normally be reset by the janitor
+	db, _ := ensureDB()
+	old := time.Now().Add(-2 * time.Hour)
+	db.Model(&FileRecord{}).Where("id = ?", id).UpdateColumns(map[string]any{"analysis_status": "pending", "updated_at": old})
+	if _, reset := runJanitor(time.Now()); reset != 0 {
+		t.Errorf("janitor reset %d records, pinned record should be skipped", reset)
+	}
+	var fr FileRecord
+	db.First(&fr, id)
+	if !fr.Pinned || fr.AnalysisStatus != "pending" {
+		t.Errorf("pinned record changed by janitor: pinned=%v status=%s", fr.Pinned, fr.AnalysisStatus)
+	}
+
+	if w := do(http.MethodDelete, "/files/file/"+id); w.Code != http.StatusConflict {
+		t.Fatalf("delete pinned: expected 409, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/files/file/"+id+"/pin"); w.Code != http.StatusOK {
+		t.Fatalf("unpin code=%d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/files/file/"+id); w.Code != http.StatusOK {
+		t.Fatalf("delete after unpin: code=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestDownloadDispositionPolicy(t *testing.T) {
+	resetState(t)
+	cases := []struct {
+		mime string
+		want string
+	}{
+		{"image/png", "inline"},
+		{"video/mp4", "inline"},
+		{"audio/mpeg", "inline"},
+		{"application/pdf", "inline"},
+		{"application/zip", "attachment"},
+		{"text/plain; charset=utf-8", "attachment"},
+		{"image/svg+xml", "attachment"},
+		{"text/html; charset=utf-8", "attachment"},
+	}
+	for _, tc := range cases {
+		if got := dispositionFor(tc.mime); got != tc.want {
+			t.Errorf("default policy %s: got %s want %s", tc.mime, got, tc.want)
+		}
+	}
+
+	cfg := config.Default()
+	cfg.Download.InlineTypes = []string{"text/", "image/"}
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	for mime, want := range map[string]string{
+		"text/plain":      "inline",
+		"image/png":       "inline",
+		"application/pdf": "attachment",
+		"text/html":       "attachment",
+		"image/svg+xml":   "attachment",
+	} {
+		if got := dispositionFor(mime); got != want {
+			t.Errorf("custom policy %s: got %s want %s", mime, got, want)
+		}
+	}
+
+	r := setupRouter()
+	uploadFile(t, r, "page.html", "<!DOCTYPE html><html><body><script>alert(1)</script></body></html>")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/download/page.html", nil))
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") {
+		t.Errorf("html download disposition=%q, want attachment", cd)
+	}
+}
+
+func TestUploadJSONSchemaValidation(t *testing.T) {
+	dir := resetState(t)
+	schemaPath := filepath.Join(dir, "schema.json")
+	schema := `{"type":"object","required":["name"],"properties":{"name":{"type":"string","minLength":1}}}`
+	if err := os.WriteFile(schemaPath, []byte(schema), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	cfg := config.Default()
+	cfg.Upload.JSONSchemaPath = schemaPath
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+
+	uploadFile(t, r, "good.json", `{"name":"widget","count":3}`)
+
+	for _, path := range []string{"/files/upload", "/files/upload/stream"} {
+		body, ct := createMultipartFile(t, "file", "bad.json", `{"count":3}`)
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.Header.Set("Content-Type", ct)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: expected 422, got %d body=%s", path, w.Code, w.Body.String())
+		}
+		var resp map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		details, _ := resp["details"].([]any)
+		if len(details) != 1 || !strings.Contains(details[0].(string), `"name"`) {
+			t.Errorf("%s: unexpected validation details %v", path, resp)
+		}
+	}
+
+	db, _ := ensureDB()
+	var count int64
+	db.Model(&FileRecord{}).Where("filename = ?", "bad.json").Count(&count)
+	if count != 0 {
+		t.Errorf("non-conforming upload was stored (%d records)", count)
+	}
+}
+
+func TestNormalizeCompressedDedup(t *testing.T) {
+	resetState(t)
+	cfg := config.Default()
+	cfg.Upload.NormalizeCompressed = true
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+
+	content := strings.Repeat("logically identical content, different wire encoding\n", 40)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(content))
+	zw.Close()
+
+	raw := uploadFile(t, r, "plain.txt", content)
+	packed := uploadFile(t, r, "packed.txt.gz", gz.String())
+	if raw["md5"] != packed["md5"] {
+		t.Fatalf("expected normalized uploads to share a hash: raw=%v gzipped=%v", raw["md5"], packed["md5"])
+	}
+	if packed["wire_encoding"] != "gzip" || packed["original_size"] != float64(len(content)) || packed["filename"] != "packed.txt" {
+		t.Errorf("unexpected normalized response %v", packed)
+	}
+
+	// the stream path decodes to a new spool file and renames the same way
+	body, ct := createMultipartFile(t, "file", "streamed.txt.gz", gz.String())
+	req := httptest.NewRequest(http.MethodPost, "/files/upload/stream", body)
+	req.Header.Set("Content-Type", ct)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var streamed map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &streamed)
+	if w.Code != http.StatusOK || streamed["md5"] != raw["md5"] || streamed["filename"] != "streamed.txt" || streamed["wire_encoding"] != "gzip" {
+		t.Fatalf("stream normalize: code=%d body=%s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/download/streamed.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != content {
+		t.Errorf("download of normalized upload: code=%d len=%d", w.Code, w.Body.Len())
+	}
+	fsys, _ := fs.New()
+	objects := 0
+	_ = fsys.WalkObjects(func(string, os.FileInfo) error { objects++; return nil })
+	if objects != 1 {
+		t.Errorf("expected 1 physical object, got %d", objects)
+	}
+	entries, _ := os.ReadDir(fsys.GetObjectsPath())
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), normalizeTempPrefix) || strings.HasPrefix(e.Name(), "up-") {
+			t.Errorf("spool file left behind: %s", e.Name())
+		}
+	}
+
+	// decoded size above the guard: stored as sent under the wire hash
+	cfg.Upload.NormalizeMaxBytes = 64
+	capped := uploadFile(t, r, "capped.txt.gz", gz.String())
+	if capped["md5"] == raw["md5"] || capped["wire_encoding"] != nil || capped["filename"] != "capped.txt.gz" {
+		t.Errorf("oversized decode should not be normalized: %v", capped)
+	}
+
+	for name, want := range map[string]string{
+		"a.txt.gz": "a.txt", "b.TGZ": "b.tar", "c.gzip": "c", "d.bin": "d.bin", ".gz": ".gz",
+	} {
+		if got := normalizedName(name, compress.Gzip); got != want {
+			t.Errorf("normalizedName(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if got := normalizedName("e.tar.zst", compress.Zstd); got != "e.tar" {
+		t.Errorf("normalizedName zstd = %q", got)
+	}
+}
+
+func TestTracingLinksAnalysisToUpload(t *testing.T) {
+	resetState(t)
+	exporter := &tracing.InMemoryExporter{}
+	tracing.SetExporter(exporter)
+	t.Cleanup(func() { tracing.SetExporter(nil) })
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(restful.TracingMiddleware())
+	RegisterRoutes(r.Group("/files"))
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("traced archive payload"))
+	zw.Close()
+	resp := uploadFile(t, r, "traced.gz", gz.String())
+	recID := uint(resp["id"].(float64))
+
+	var request, analysis *tracing.SpanData
+	deadline := time.Now().Add(3 * time.Second)
+	for analysis == nil && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		for _, s := range exporter.Spans() {
+			switch s.Name {
+			case "POST /files/upload":
+				request = &s
+			case "analysis.gzip":
+				// jobs left over from earlier tests may also finish here
+				if s.Attributes["record_id"] == recID {
+					analysis = &s
+				}
+			}
+		}
+	}
+	if request == nil || analysis == nil {
+		t.Fatalf("expected request and analysis spans, got %+v", exporter.Spans())
+	}
+	if request.Attributes["http.status_code"] != http.StatusOK {
+		t.Errorf("request span attributes %v", request.Attributes)
+	}
+	if len(analysis.Links) != 1 || analysis.Links[0] != request.SpanContext {
+		t.Errorf("analysis span links %v, want request span %v", analysis.Links, request.SpanContext)
+	}
+	if analysis.Attributes["analysis.status"] != "done" {
+		t.Errorf("analysis span attributes %v", analysis.Attributes)
+	}
+}
+
+func TestListPageSizeLimits(t *testing.T) {
+	resetState(t)
+	cfg := config.Default()
+	cfg.List.DefaultPageSize = 2
+	cfg.List.MaxPageSize = 3
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+	for i := 0; i < 5; i++ {
+		uploadFile(t, r, "page-"+strconv.Itoa(i)+".txt", "listing entry "+strconv.Itoa(i))
+	}
+
+	list := func(query string) map[string]any {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/list"+query, nil))
+		var resp map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+	resp := list("")
+	if resp["page_size"] != float64(2) || resp["count"] != float64(2) {
+		t.Errorf("default page: %v", resp)
+	}
+	resp = list("?page_size=100")
+	if resp["page_size"] != float64(3) || resp["count"] != float64(3) || resp["pages"] != float64(2) {
+		t.Errorf("over-max request not clamped: %v", resp)
+	}
+	if resp["max_page_size"] != float64(3) || resp["default_page_size"] != float64(2) {
+		t.Errorf("effective limits missing from response: %v", resp)
+	}
+}
+
+func TestObjectInfoReportsCodec(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("already gzipped before upload"))
+	zw.Close()
+	plain := uploadFile(t, r, "plain-info.txt", strings.Repeat("stored with the default codec ", 20))
+	packed := uploadFile(t, r, "packed-info.gz", gz.String())
+
+	info := func(md5v string) map[string]any {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/object/"+md5v+"/info", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("info %s: code=%d body=%s", md5v, w.Code, w.Body.String())
+		}
+		var resp map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+	for _, up := range []map[string]any{plain, packed} {
+		resp := info(up["md5"].(string))
+		if _, leaked := resp["path"]; leaked {
+			t.Errorf("%s: response exposes the on-disk path: %v", up["filename"], resp)
+		}
+		if resp["detected_codec"] != up["compression_type"] || resp["drift"] != false {
+			t.Errorf("%s: detected %v, recorded %v, drift %v", up["filename"], resp["detected_codec"], up["compression_type"], resp["drift"])
+		}
+		if resp["on_disk_size"] != up["compressed_size"] {
+			t.Errorf("%s: on_disk_size %v want %v", up["filename"], resp["on_disk_size"], up["compressed_size"])
+		}
+	}
+
+	// a salted copy is checked against its own object, not the shared one
+	body, ct := createMultipartFile(t, "file", "plain-copy.txt", strings.Repeat("stored with the default codec ", 20))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/files/upload", body)
+	req.Header.Set("Content-Type", ct)
+	req.Header.Set("X-No-Dedup", "true")
+	r.ServeHTTP(w, req)
+	var salted map[string]any
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &salted) != nil {
+		t.Fatalf("no-dedup upload: code=%d body=%s", w.Code, w.Body.String())
+	}
+	resp := info(plain["md5"].(string))
+	refs, _ := resp["records"].([]any)
+	if resp["drift"] != false || len(refs) != 2 || refs[1].(map[string]any)["object_key"] != salted["object_key"] || refs[1].(map[string]any)["on_disk"] != true {
+		t.Errorf("salted copy: %v", resp)
+	}
+	fsys, _ := fs.New()
+	if err := fsys.DeleteObjectHashed(salted["object_key"].(string)); err != nil {
+		t.Fatalf("delete salted copy: %v", err)
+	}
+	resp = info(plain["md5"].(string))
+	refs, _ = resp["records"].([]any)
+	if resp["drift"] != true || len(refs) != 2 || refs[1].(map[string]any)["on_disk"] != false || refs[0].(map[string]any)["on_disk"] != true {
+		t.Errorf("expected the missing salted copy to be drift: %v", resp)
+	}
+
+	// simulate a record that disagrees with the stored bytes
+	db, _ := ensureDB()
+	db.Model(&FileRecord{}).Where("md5 = ?", packed["md5"]).Update("compression_type", "zstd")
+	resp = info(packed["md5"].(string))
+	refs, _ = resp["records"].([]any)
+	if resp["drift"] != true || len(refs) != 1 || refs[0].(map[string]any)["codec_mismatch"] != true {
+		t.Errorf("expected drift to be reported: %v", resp)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/object/ffffffffffffffffffffffffffffffff/info", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown object: expected 404, got %d", w.Code)
+	}
+}
+
+func TestEvictionLeastRecentlyAccessed(t *testing.T) {
+	resetState(t)
+	cfg := config.Default()
+	cfg.Eviction.Enabled = true
+	cfg.Eviction.MaxBytes = 2500
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+
+	// random payloads barely compress, so each object takes roughly 1000 bytes on disk
+	rng := rand.New(rand.NewSource(7))
+	payload := func() string {
+		b := make([]byte, 1000)
+		rng.Read(b)
+		return string(b)
+	}
+	older := uploadFile(t, r, "older.bin", payload())
+	idle := uploadFile(t, r, "idle.bin", payload())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/download/older.bin", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("download code=%d", w.Code)
+	}
+	newest := uploadFile(t, r, "newest.bin", payload())
+
+	// eviction runs after the upload has been answered
+	fsys, _ := fs.New()
+	db, _ := ensureDB()
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if ok, _ := fsys.HashedObjectExists(idle["md5"].(string)); !ok {
+			break
+		}
+	}
+	for _, tc := range []struct {
+		resp map[string]any
+		kept bool
+	}{{older, true}, {idle, false}, {newest, true}} {
+		name := tc.resp["filename"].(string)
+		onDisk, _ := fsys.HashedObjectExists(tc.resp["md5"].(string))
+		var count int64
+		db.Model(&FileRecord{}).Where("filename = ?", name).Count(&count)
+		if onDisk != tc.kept || (count == 1) != tc.kept {
+			t.Errorf("%s: on disk=%v records=%d, want kept=%v", name, onDisk, count, tc.kept)
+		}
+	}
+}
+
+func TestEvictionSkipsPinned(t *testing.T) {
+	resetState(t)
+	cfg := config.Default()
+	// uploads do not trigger passes; the test runs one itself
+	cfg.Eviction.MaxBytes = 2500
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+
+	rng := rand.New(rand.NewSource(11))
+	payload := func() string {
+		b := make([]byte, 1000)
+		rng.Read(b)
+		return string(b)
+	}
+	pinned := uploadFile(t, r, "pinned.bin", payload())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/files/file/%d/pin", int(pinned["id"].(float64))), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("pin code=%d %s", w.Code, w.Body.String())
+	}
+	second := uploadFile(t, r, "second.bin", payload())
+	uploadFile(t, r, "third.bin", payload())
+
+	cfg.Eviction.Enabled = true
+	if n := evictObjects(); n != 1 {
+		t.Fatalf("evicted %d objects, want 1", n)
+	}
+	fsys, _ := fs.New()
+	if ok, _ := fsys.HashedObjectExists(pinned["md5"].(string)); !ok {
+		t.Error("pinned object was evicted")
+	}
+	if ok, _ := fsys.HashedObjectExists(second["md5"].(string)); ok {
+		t.Error("oldest unpinned object was kept")
+	}
+}
+
+func TestEvictionRemovesRecordData(t *testing.T) {
+	resetState(t)
+	cfg := config.Default()
+	cfg.Eviction.MaxBytes = 1500
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+
+	rng := rand.New(rand.NewSource(13))
+	payload := func() string {
+		b := make([]byte, 1000)
+		rng.Read(b)
+		return string(b)
+	}
+	old := uploadFile(t, r, "old.bin", payload())
+	oldID := uint(old["id"].(float64))
+	db, _ := ensureDB()
+	db.Create(&FileTag{FileID: oldID, Key: "team", Value: "infra"})
+	db.Create(&ElfAnalyzeCached{FileID: oldID, Data: "{}"})
+	db.Create(&ThumbnailCached{FileID: oldID})
+	uploadFile(t, r, "new.bin", payload())
+
+	cfg.Eviction.Enabled = true
+	if n := evictObjects(); n != 1 {
+		t.Fatalf("evicted %d objects, want 1", n)
+	}
+	for _, m := range []any{&FileTag{}, &ElfAnalyzeCached{}, &ThumbnailCached{}} {
+		var n int64
+		db.Model(m).Where("file_id = ?", oldID).Count(&n)
+		if n != 0 {
+			t.Errorf("%T: %d rows left for the evicted record", m, n)
+		}
+	}
+	var n int64
+	db.Unscoped().Model(&FileRecord{}).Where("id = ?", oldID).Count(&n)
+	if n != 0 {
+		t.Errorf("evicted record still in the table")
+	}
+	cfg.Eviction.Enabled = false
+	uploadFile(t, r, "old.bin", payload())
+}
+
+func TestSQLiteUploadAnalysis(t *testing.T) {
+	dir := resetState(t)
+	dbPath := filepath.Join(dir, "inventory.sqlite")
+	sdb, err := sql.Open(sqlite.DriverName, dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE owners (id INTEGER PRIMARY KEY)`,
+		`INSERT INTO items (name) VALUES ('bolt'), ('nut')`,
+	} {
+		if _, err := sdb.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	sdb.Close()
+	content, _ := os.ReadFile(dbPath)
+
+	r := setupRouter()
+	resp := uploadFile(t, r, "inventory.sqlite", string(content))
+	if resp["mime"] != sqliteMIME || resp["analysis_status"] != "pending" {
+		t.Fatalf("unexpected upload response %v", resp)
+	}
+	id := strconv.Itoa(int(resp["id"].(float64)))
+
+	var meta map[string]any
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/meta/"+id+"?type=sqlite", nil))
+		_ = json.Unmarshal(w.Body.Bytes(), &meta)
+		if meta["analysis"] != nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	analysis, _ := meta["analysis"].(map[string]any)
+	if analysis == nil {
+		t.Fatalf("sqlite analysis not available: %v", meta)
+	}
+	var names []string
+	rows := map[string]any{}
+	for _, tb := range analysis["tables"].([]any) {
+		entry := tb.(map[string]any)
+		names = append(names, entry["name"].(string))
+		rows[entry["name"].(string)] = entry["rows"]
+	}
+	if !reflect.DeepEqual(names, []string{"items", "owners"}) || rows["items"] != float64(2) {
+		t.Errorf("unexpected tables %v rows %v", names, rows)
+	}
+	if meta["analysis_type"] != "sqlite" || meta["analysis_status"] != "done" {
+		t.Errorf("unexpected meta %v", meta)
+	}
+	// the private copy the driver opened is gone once analysis finishes
+	if left, _ := filepath.Glob(filepath.Join(".runtime", "temp", "sqlite-*")); len(left) != 0 {
+		t.Errorf("analysis left temp files behind: %v", left)
+	}
+}
+
+func TestAnalysisAllowlist(t *testing.T) {
+	elfBytes, err := os.ReadFile("/bin/uname")
+	if err != nil {
+		t.Skipf("sample ELF not available: %v", err)
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("archive analysis stays enabled"))
+	zw.Close()
+
+	for name, tune := range map[string]func(*config.Config){
+		"elf toggle":     func(c *config.Config) { c.Analysis.ELF = false },
+		"mime allowlist": func(c *config.Config) { c.Analysis.MIMETypes = []string{"application/gzip"} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			resetState(t)
+			cfg := config.Default()
+			tune(cfg)
+			config.SetForTest(cfg)
+			t.Cleanup(func() { config.SetForTest(nil) })
+			r := setupRouter()
+
+			if resp := uploadFile(t, r, "uname", string(elfBytes)); resp["analysis_status"] != "none" {
+				t.Errorf("ELF: expected analysis_status none, got %v", resp["analysis_status"])
+			}
+			resp := uploadFile(t, r, "kept.gz", gz.String())
+			if resp["analysis_status"] != "pending" {
+				t.Fatalf("gzip: expected pending, got %v", resp["analysis_status"])
+			}
+			db, _ := ensureDB()
+			deadline := time.Now().Add(3 * time.Second)
+			var fr FileRecord
+			for time.Now().Before(deadline) {
+				db.First(&fr, uint(resp["id"].(float64)))
+				if fr.AnalysisStatus == "done" {
+					break
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			if fr.AnalysisStatus != "done" {
+				t.Errorf("gzip analysis status %q, want done", fr.AnalysisStatus)
+			}
+		})
+	}
+}
+
+func TestDownloadIfRange(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	content := "0123456789abcdefghij"
+	uploadFile(t, r, "ranged.txt", content)
+
+	get := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/files/download/ranged.txt", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	full := get(nil)
+	etag, lastMod := full.Header().Get("ETag"), full.Header().Get("Last-Modified")
+	if full.Code != http.StatusOK || etag == "" || lastMod == "" {
+		t.Fatalf("plain download code=%d etag=%q last-modified=%q", full.Code, etag, lastMod)
+	}
+
+	for _, ifRange := range []string{"", etag, lastMod} {
+		w := get(map[string]string{"Range": "bytes=2-5", "If-Range": ifRange})
+		if w.Code != http.StatusPartialContent || w.Body.String() != "2345" {
+			t.Errorf("If-Range %q: code=%d body=%q", ifRange, w.Code, w.Body.String())
+		}
+		if cr := w.Header().Get("Content-Range"); cr != "bytes 2-5/20" {
+			t.Errorf("If-Range %q: Content-Range %q", ifRange, cr)
+		}
+	}
+	stale := []string{`"0123456789abcdef0123456789abcdef"`, "W/" + etag, "Mon, 02 Jan 2006 15:04:05 GMT"}
+	for _, ifRange := range stale {
+		w := get(map[string]string{"Range": "bytes=2-5", "If-Range": ifRange})
+		if w.Code != http.StatusOK || w.Body.String() != content {
+			t.Errorf("stale If-Range %q: code=%d body=%q, want full body", ifRange, w.Code, w.Body.String())
+		}
+	}
+
+	if w := get(map[string]string{"Range": "bytes=-3"}); w.Code != http.StatusPartialContent || w.Body.String() != "hij" {
+		t.Errorf("suffix range: code=%d body=%q", w.Code, w.Body.String())
+	}
+	if w := get(map[string]string{"Range": "bytes=50-"}); w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("unsatisfiable range: code=%d", w.Code)
+	}
+}
+
+func TestDownloadRangeOverCompressedObject(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	// compressible, so the object is stored zstd and ranges apply to the decompressed bytes
+	content := strings.Repeat("0123456789", 1000)
+	uploadFile(t, r, "ranged-large.txt", content)
+
+	get := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/files/download/ranged-large.txt", nil)
+		req.Header.Set("Range", rangeHeader)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	cases := []struct {
+		rangeHeader  string
+		code         int
+		body         string
+		contentRange string
+	}{
+		{"bytes=0-", http.StatusPartialContent, content, "bytes 0-9999/10000"},
+		{"bytes=0-99999", http.StatusPartialContent, content, "bytes 0-9999/10000"},
+		{"bytes=-5", http.StatusPartialContent, "56789", "bytes 9995-9999/10000"},
+		{"bytes=9998-9999", http.StatusPartialContent, "89", "bytes 9998-9999/10000"},
+		{"bytes=10000-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10000"},
+		{"bytes=-0", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10000"},
+		// malformed ranges are ignored and the full body is sent
+		{"bytes=5-2", http.StatusOK, content, ""},
+		{"items=0-5", http.StatusOK, content, ""},
+	}
+	for _, tc := range cases {
+		w := get(tc.rangeHeader)
+		if w.Code != tc.code || w.Body.String() != tc.body {
+			t.Errorf("%s: code=%d len=%d, want %d len=%d", tc.rangeHeader, w.Code, w.Body.Len(), tc.code, len(tc.body))
+		}
+		if cr := w.Header().Get("Content-Range"); cr != tc.contentRange {
+			t.Errorf("%s: Content-Range %q, want %q", tc.rangeHeader, cr, tc.contentRange)
+		}
+		if tc.code == http.StatusPartialContent && w.Header().Get("Content-Length") != strconv.Itoa(len(tc.body)) {
+			t.Errorf("%s: Content-Length %q", tc.rangeHeader, w.Header().Get("Content-Length"))
+		}
+	}
+}
+
+func TestELFAnalysisRefresh(t *testing.T) {
+	resetState(t)
+	// no async analysis: the refresh alone must produce the cache
+	cfg := config.Default()
+	cfg.Analysis.ELF = false
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+	bin := "/bin/uname"
+	content, err := os.ReadFile(bin)
+	if err != nil {
+		t.Skipf("sample ELF %s not available: %v", bin, err)
+	}
+	elfRec := uploadFile(t, r, "uname", string(content))
+	textRec := uploadFile(t, r, "notes.txt", "plain text")
+	refresh := func(id any) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/files/analysis/elf/"+strconv.Itoa(int(id.(float64)))+"/refresh", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	db, _ := ensureDB()
+	id := uint(elfRec["id"].(float64))
+	// a stale cache entry is replaced, not duplicated
+	db.Create(&ElfAnalyzeCached{FileID: id, Data: `{"stale":true}`})
+	for i := 0; i < 2; i++ {
+		w := refresh(elfRec["id"])
+		if w.Code != http.StatusOK {
+			t.Fatalf("refresh: %d %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Status   string         `json:"analysis_status"`
+			Analysis map[string]any `json:"analysis"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if resp.Status != "done" || resp.Analysis["machine"] == nil || resp.Analysis["stale"] != nil {
+			t.Fatalf("unexpected refresh response %s", w.Body.String())
+		}
+	}
+	var caches []ElfAnalyzeCached
+	db.Where("file_id = ?", id).Find(&caches)
+	if len(caches) != 1 {
+		t.Fatalf("%d cache rows after refresh, want 1", len(caches))
+	}
+	var fr FileRecord
+	db.First(&fr, id)
+	if fr.AnalysisStatus != "done" {
+		t.Fatalf("analysis_status %q after refresh", fr.AnalysisStatus)
+	}
+
+	if w := refresh(textRec["id"]); w.Code != http.StatusBadRequest {
+		t.Fatalf("non-ELF refresh: code=%d, want 400", w.Code)
+	}
+	if w := refresh(float64(9999)); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown id: code=%d, want 404", w.Code)
+	}
+}
+
+func TestELFCachedSizesNormalizedOnRead(t *testing.T) {
+	elfBytes, err := os.ReadFile("/bin/uname")
+	if err != nil {
+		t.Skipf("sample ELF not available: %v", err)
+	}
+	resetState(t)
+	// no analysis runs, so the hand-written row below stands for one cached before sizes were strings
+	cfg := config.Default()
+	cfg.Analysis.ELF = false
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+	rec := uploadFile(t, r, "legacy-elf", string(elfBytes))
+	id := uint(rec["id"].(float64))
+	db, _ := ensureDB()
+	db.Create(&ElfAnalyzeCached{FileID: id, Data: `{"section_sizes":{"text":4096,"bss":"16"},"sections_detail":[{"name":".text","size":4096}]}`})
+
+	meta := func(query string) map[string]any {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/meta/"+strconv.Itoa(int(id))+"?type=elf"+query, nil))
+		var resp struct {
+			Analysis map[string]any `json:"analysis"`
+		}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil || resp.Analysis == nil {
+			t.Fatalf("meta%s: code=%d body=%s", query, w.Code, w.Body.String())
+		}
+		return resp.Analysis
+	}
+	for query, want := range map[string][2]any{"": {"4096", "16"}, "&numeric=true": {float64(4096), float64(16)}} {
+		a := meta(query)
+		sizes := a["section_sizes"].(map[string]any)
+		section := a["sections_detail"].([]any)[0].(map[string]any)
+		if sizes["text"] != want[0] || sizes["bss"] != want[1] || section["size"] != want[0] {
+			t.Errorf("meta%s: section_sizes=%v section=%v, want text/size %#v and bss %#v", query, sizes, section, want[0], want[1])
+		}
+	}
+}
+
+func TestAnalysisRegistryDispatchesRegisteredAnalyzer(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	type call struct {
+		recID uint
+		hash  string
+	}
+	calls := make(chan call, 4)
+	saved := analyzers
+	analyzers = append(append([]analyzer{}, saved...), analyzer{
+		kind:  "fake",
+		match: func(head []byte, _ string) bool { return bytes.HasPrefix(head, []byte("FAKE")) },
+		schedule: func(_ context.Context, recID uint, hash string) {
+			calls <- call{recID, hash}
+		},
+	})
+	t.Cleanup(func() { analyzers = saved })
+
+	resp := uploadFile(t, r, "sample.fake", "FAKE format payload")
+	if resp["analysis_status"] != "pending" {
+		t.Fatalf("analysis_status %v, want pending", resp["analysis_status"])
+	}
+	select {
+	case got := <-calls:
+		if got.recID != uint(resp["id"].(float64)) || got.hash != resp["md5"] {
+			t.Fatalf("fake analyzer called with %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("registered analyzer was not scheduled")
+	}
+
+	// uploads no analyzer matches are left alone
+	if resp := uploadFile(t, r, "other.txt", "plain text"); resp["analysis_status"] != "none" {
+		t.Fatalf("unmatched upload analysis_status %v, want none", resp["analysis_status"])
+	}
+	if len(calls) != 0 {
+		t.Fatal("fake analyzer scheduled for an unmatched upload")
+	}
+}
+
+// buildTestRPM assembles a package lead, an empty signature header and a main header holding
+// the given string tags; the payload is omitted
+func buildTestRPM(t *testing.T, tags map[uint32]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb, 3, 0})
+	buf.Write(lead)
+	writeHeader := func(tags []uint32, vals map[uint32]string) {
+		var store bytes.Buffer
+		var index bytes.Buffer
+		for _, tag := range tags {
+			_ = binary.Write(&index, binary.BigEndian, []uint32{tag, 6, uint32(store.Len()), 1})
+			store.WriteString(vals[tag] + "\x00")
+		}
+		buf.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+		_ = binary.Write(&buf, binary.BigEndian, []uint32{uint32(len(tags)), uint32(store.Len())})
+		buf.Write(index.Bytes())
+		buf.Write(store.Bytes())
+		buf.Write(make([]byte, (8-store.Len()%8)%8))
+	}
+	writeHeader(nil, nil)
+	order := make([]uint32, 0, len(tags))
+	for tag := range tags {
+		order = append(order, tag)
+	}
+	slices.Sort(order)
+	writeHeader(order, tags)
+	return buf.Bytes()
+}
+
+func TestRPMAnalysis(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	pkg := buildTestRPM(t, map[uint32]string{1000: "hello", 1001: "2.12", 1002: "3.fc40", 1022: "x86_64"})
+	resp := uploadFile(t, r, "hello-2.12-3.fc40.x86_64.rpm", string(pkg))
+	if resp["mime"] != rpmMIME || resp["analysis_status"] != "pending" {
+		t.Fatalf("upload mime=%v analysis_status=%v", resp["mime"], resp["analysis_status"])
+	}
+	id := strconv.Itoa(int(resp["id"].(float64)))
+
+	var meta struct {
+		Type      string         `json:"analysis_type"`
+		Status    string         `json:"analysis_status"`
+		Available []string       `json:"available_analysis"`
+		Analysis  map[string]any `json:"analysis"`
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/meta/"+id, nil))
+		meta.Analysis = nil
+		if err := json.Unmarshal(w.Body.Bytes(), &meta); err != nil {
+			t.Fatalf("decode meta: %v", err)
+		}
+		if meta.Status == "done" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if meta.Status != "done" || meta.Type != "rpm" || !slices.Equal(meta.Available, []string{"rpm"}) {
+		t.Fatalf("meta status=%q type=%q available=%v", meta.Status, meta.Type, meta.Available)
+	}
+	for k, v := range map[string]string{"name": "hello", "version": "2.12", "release": "3.fc40", "arch": "x86_64"} {
+		if meta.Analysis[k] != v {
+			t.Errorf("analysis %s=%v want %s", k, meta.Analysis[k], v)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/list", nil))
+	if !strings.Contains(w.Body.String(), `"available_analysis":["rpm"]`) {
+		t.Errorf("list does not advertise rpm analysis: %s", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/meta/"+id+"?type=sqlite", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("type=sqlite on an rpm: code=%d, want 400", w.Code)
+	}
+	text := uploadFile(t, r, "notes.txt", "plain")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/meta/"+strconv.Itoa(int(text["id"].(float64)))+"?type=rpm", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("type=rpm on a text file: code=%d, want 400", w.Code)
+	}
+}
+
+// buildTar returns an uncompressed tar holding the given members (name -> content) in order
+func buildTar(t *testing.T, members ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range members {
+		if err := tw.WriteHeader(&tar.Header{Name: m[0], Mode: 0o644, Size: int64(len(m[1])), Typeflag: tar.TypeReg, Format: tar.FormatUSTAR}); err != nil {
+			t.Fatalf("tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(m[1])); err != nil {
+			t.Fatalf("tar write: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestTarAnalysis(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	db, _ := ensureDB()
+	for i, path := range []string{"/files/upload", "/files/upload/stream"} {
+		archive := buildTar(t,
+			[2]string{"src/main.go", "package main\n"},
+			[2]string{"src/util.go", "package main\n\nfunc util() {}\n"},
+			[2]string{"README.md", "# tarball " + strconv.Itoa(i)},
+			[2]string{"LICENSE", "MIT"},
+		)
+		body, ct := createMultipartFile(t, "file", "bundle"+strconv.Itoa(i)+".tar", string(archive))
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.Header.Set("Content-Type", ct)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusOK || resp["mime"] != tarMIME || resp["analysis_status"] != "pending" {
+			t.Fatalf("%s: code=%d body=%s", path, w.Code, w.Body.String())
+		}
+		id := uint(resp["id"].(float64))
+		deadline := time.Now().Add(3 * time.Second)
+		var fr FileRecord
+		for db.First(&fr, id); fr.AnalysisStatus == "pending" && time.Now().Before(deadline); db.First(&fr, id) {
+			time.Sleep(20 * time.Millisecond)
+		}
+		if fr.AnalysisStatus != "done" {
+			t.Fatalf("%s: analysis_status %q", path, fr.AnalysisStatus)
+		}
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/meta/"+strconv.Itoa(int(id)), nil))
+		var meta struct {
+			Type      string   `json:"analysis_type"`
+			Available []string `json:"available_analysis"`
+			Analysis  struct {
+				Count      int            `json:"tar_count"`
+				Size       int64          `json:"uncompressed_size"`
+				Extensions map[string]int `json:"extensions"`
+				Entries    []struct {
+					Name string `json:"name"`
+				} `json:"tar_entries"`
+			} `json:"analysis"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &meta); err != nil {
+			t.Fatalf("decode meta: %v", err)
+		}
+		a := meta.Analysis
+		wantSize := int64(len("package main\n") + len("package main\n\nfunc util() {}\n") + len("# tarball 0") + len("MIT"))
+		if meta.Type != "tar" || !slices.Equal(meta.Available, []string{"tar"}) || a.Count != 4 || a.Size != wantSize {
+			t.Fatalf("%s: unexpected meta %s", path, w.Body.String())
+		}
+		if a.Extensions[".go"] != 2 || a.Extensions[".md"] != 1 || a.Extensions["(none)"] != 1 || a.Entries[0].Name != "src/main.go" {
+			t.Fatalf("%s: extensions %v entries %v", path, a.Extensions, a.Entries)
+		}
+	}
+}
+
+// buildTarGz returns a gzip-compressed tar holding the given members (name -> content) in order
+func buildTarGz(t *testing.T, members ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, m := range members {
+		if err := tw.WriteHeader(&tar.Header{Name: m[0], Mode: 0o644, Size: int64(len(m[1])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(m[1])); err != nil {
+			t.Fatalf("tar write: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar close: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGzipMembers(t *testing.T) {
+	resetState(t)
+	// members are read on demand here; the async analysis would only outlive the test
+	cfg := config.Default()
+	cfg.Analysis.Gzip = false
+	cfg.Download.GzipMemberMaxBytes = 64
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	r := setupRouter()
+
+	archive := buildTarGz(t,
+		[2]string{"docs/readme.txt", "hello from the archive"},
+		[2]string{"../escape.txt", "outside"},
+		[2]string{"big.bin", strings.Repeat("x", 100)},
+	)
+	gz := uploadFile(t, r, "bundle.tar.gz", string(archive))
+	plain := uploadFile(t, r, "plain.txt", "not an archive")
+	get := func(id any, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/files/download/gzip-members/"+strconv.Itoa(int(id.(float64)))+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(gz["id"], "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("listing code=%d content-type=%q body=%s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("listing has %d lines, want 3: %s", len(lines), w.Body.String())
+	}
+	var entries []map[string]any
+	for _, l := range lines {
+		var e map[string]any
+		if err := json.Unmarshal([]byte(l), &e); err != nil {
+			t.Fatalf("listing line %q: %v", l, err)
+		}
+		entries = append(entries, e)
+	}
+	if entries[0]["name"] != "docs/readme.txt" || entries[0]["size"].(float64) != 22 || entries[0]["unsafe"] != nil {
+		t.Fatalf("unexpected first entry %v", entries[0])
+	}
+	if entries[1]["unsafe"] != true {
+		t.Fatalf("traversal member should be flagged unsafe: %v", entries[1])
+	}
+
+	w = get(gz["id"], "?extract=docs/readme.txt")
+	if w.Code != http.StatusOK || w.Body.String() != "hello from the archive" {
+		t.Fatalf("extract code=%d body=%q", w.Code, w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != "attachment; filename=readme.txt" {
+		t.Fatalf("Content-Disposition %q", cd)
+	}
+	if w := get(gz["id"], "?extract=./docs//readme.txt"); w.Code != http.StatusOK {
+		t.Fatalf("uncleaned member name should resolve, got %d", w.Code)
+	}
+	for _, name := range []string{"../escape.txt", "/etc/passwd", "docs/../../escape.txt"} {
+		if w := get(gz["id"], "?extract="+name); w.Code != http.StatusBadRequest {
+			t.Fatalf("extract %q: code=%d, want 400", name, w.Code)
+		}
+	}
+	if w := get(gz["id"], "?extract=missing.txt"); w.Code != http.StatusNotFound {
+		t.Fatalf("missing member: code=%d, want 404", w.Code)
+	}
+	if w := get(gz["id"], "?extract=big.bin"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized member: code=%d, want 413", w.Code)
+	}
+	if w := get(plain["id"], ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("non-gzip record: code=%d, want 400", w.Code)
+	}
+	if w := get(float64(9999), ""); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown id: code=%d, want 404", w.Code)
+	}
+}
+
+// buildTraitELF assembles a minimal ELF64 image of the given type. A non-empty interp adds a
+// PT_INTERP segment (dynamically linked) and each name in sections becomes an empty section
+// (".symtab" is typed SHT_SYMTAB so the binary counts as unstripped).
+func buildTraitELF(t *testing.T, typ elf.Type, interp string, sections ...string) []byte {
+	t.Helper()
+	const ehsize, phentsize, shentsize = 64, 56, 64
+	shstrtab := []byte("\x00.shstrtab\x00")
+	nameOff := make([]uint32, len(sections))
+	for i, name := range sections {
+		nameOff[i] = uint32(len(shstrtab))
+		shstrtab = append(append(shstrtab, name...), 0)
+	}
+	var phnum uint16
+	if interp != "" {
+		phnum = 1
+	}
+	interpOff := uint64(ehsize + int(phnum)*phentsize)
+	interpData := []byte(interp)
+	if interp != "" {
+		interpData = append(interpData, 0)
+	}
+	strOff := interpOff + uint64(len(interpData))
+	hdr := elf.Header64{
+		Type:      uint16(typ),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     strOff + uint64(len(shstrtab)),
+		Ehsize:    ehsize,
+		Phentsize: phentsize,
+		Phnum:     phnum,
+		Shentsize: shentsize,
+		Shnum:     uint16(2 + len(sections)),
+		Shstrndx:  1,
+	}
+	if phnum > 0 {
+		hdr.Phoff = ehsize
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	shdrs := []elf.Section64{{}, {Name: 1, Type: uint32(elf.SHT_STRTAB), Off: strOff, Size: uint64(len(shstrtab)), Addralign: 1}}
+	for i, name := range sections {
+		typ := elf.SHT_PROGBITS
+		if name == ".symtab" {
+			typ = elf.SHT_SYMTAB
+		}
+		shdrs = append(shdrs, elf.Section64{Name: nameOff[i], Type: uint32(typ), Off: strOff, Addralign: 1})
+	}
+	var buf bytes.Buffer
+	write := func(v any) {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatalf("write elf: %v", err)
+		}
+	}
+	write(hdr)
+	if phnum > 0 {
+		write(elf.Prog64{Type: uint32(elf.PT_INTERP), Flags: uint32(elf.PF_R), Off: interpOff, Filesz: uint64(len(interpData)), Memsz: uint64(len(interpData)), Align: 1})
+	}
+	buf.Write(interpData)
+	buf.Write(shstrtab)
+	write(shdrs)
+	return buf.Bytes()
+}
+
+func TestListFiltersByELFTraits(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	goStatic := uploadFile(t, r, "gostatic", string(buildTraitELF(t, elf.ET_EXEC, "", ".gopclntab")))
+	cDynamic := uploadFile(t, r, "cdynamic", string(buildTraitELF(t, elf.ET_DYN, "/lib64/ld-linux-x86-64.so.2", ".symtab")))
+	uploadFile(t, r, "notes.txt", "plain text, never analyzed as ELF")
+
+	list := func(query string) (int, []string) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/list?"+query, nil))
+		var resp struct {
+			Files []FileRecord `json:"files"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		var names []string
+		for _, f := range resp.Files {
+			names = append(names, f.Filename)
+		}
+		return w.Code, names
+	}
+
+	// the traits are filled in once the async analysis has finished
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, names := list("pie=true"); len(names) == 1 {
+			if _, names := list("go_binary=true"); len(names) == 1 {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"go_binary=true&static=true", []string{"gostatic"}},
+		{"go_binary=true&static=false", nil},
+		{"static=false", []string{"cdynamic"}},
+		{"pie=true&go_binary=false", []string{"cdynamic"}},
+		{"stripped=true", []string{"gostatic"}},
+	}
+	for _, tc := range cases {
+		code, names := list(tc.query)
+		if code != http.StatusOK || !reflect.DeepEqual(names, tc.want) {
+			t.Fatalf("%s: code=%d names=%v want %v (uploads %v %v)", tc.query, code, names, tc.want, goStatic["id"], cDynamic["id"])
+		}
+	}
+	if code, names := list(""); code != http.StatusOK || len(names) != 3 {
+		t.Fatalf("unfiltered list: code=%d names=%v", code, names)
+	}
+	if code, _ := list("static=maybe"); code != http.StatusBadRequest {
+		t.Fatalf("invalid filter value: expected 400, got %d", code)
+	}
+}
+
+func TestUploadEmptyFilenameGetsHashName(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	const content = "part sent without a filename"
+	sum := file.MD5Sum([]byte(content))
+
+	// a blank (whitespace) filename on the buffered endpoint
+	resp := uploadFile(t, r, "   ", content)
+	if resp["filename"] != sum+".bin" {
+		t.Fatalf("expected generated name %s.bin, got %v", sum, resp["filename"])
+	}
+
+	// filename="" on the multi endpoint is still a file part; the generated name must not collide
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="files"; filename=""`)
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		t.Fatalf("create part: %v", err)
+	}
+	_, _ = part.Write([]byte(content))
+	mw.Close()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/files/upload/multi", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	r.ServeHTTP(w, req)
+	var multi struct {
+		Results []struct {
+			ID       uint   `json:"id"`
+			Filename string `json:"filename"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &multi); err != nil || w.Code != http.StatusOK || len(multi.Results) != 1 {
+		t.Fatalf("multi upload code=%d body=%s", w.Code, w.Body.String())
+	}
+	if got := multi.Results[0]; got.Filename != sum+"-1.bin" || got.ID == 0 {
+		t.Fatalf("expected stored record named %s-1.bin, got %+v", sum, got)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/download/"+sum+".bin", nil))
+	if w.Code != http.StatusOK || w.Body.String() != content {
+		t.Fatalf("download by generated name code=%d body=%q", w.Code, w.Body.String())
+	}
+}
+
+func TestCompressOffloadMatchesInline(t *testing.T) {
+	content := strings.Repeat("offloaded compression must store the same bytes\n", 4096)
+	sum := file.MD5Sum([]byte(content))
+	objectPath := filepath.Join(".runtime", "objects", sum[:2], sum)
+
+	upload := func(r *gin.Engine, offload string) map[string]any {
+		body, ct := createMultipartFile(t, "file", "payload.txt", content)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/files/upload", body)
+		req.Header.Set("Content-Type", ct)
+		req.Header.Set("X-Compress-Offload", offload)
+		r.ServeHTTP(w, req)
+		var resp map[string]any
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil {
+			t.Fatalf("upload (offload=%s) code=%d body=%s", offload, w.Code, w.Body.String())
+		}
+		return resp
+	}
+
+	resetState(t)
+	resp := upload(setupRouter(), "false")
+	if resp["compression_offloaded"] != nil || resp["compressed_size"].(float64) == 0 {
+		t.Fatalf("inline upload should report its compressed size: %v", resp)
+	}
+	inline, err := os.ReadFile(objectPath)
+	if err != nil {
+		t.Fatalf("read inline object: %v", err)
+	}
+
+	resetState(t)
+	r := setupRouter()
+	submitted := worker.StatsSnapshot()["submitted"].(uint64)
+	resp = upload(r, "true")
+	if resp["compression_offloaded"] != true {
+		t.Fatalf("expected the upload to be offloaded: %v", resp)
+	}
+	if worker.StatsSnapshot()["submitted"].(uint64) <= submitted {
+		t.Fatalf("offloaded upload did not go through the worker pool")
+	}
+	id := strconv.Itoa(int(resp["id"].(float64)))
+	var meta struct {
+		File FileRecord `json:"file"`
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/meta/"+id, nil))
+		_ = json.Unmarshal(w.Body.Bytes(), &meta)
+		if meta.File.CompressedSize > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	offloaded, err := os.ReadFile(objectPath)
+	if err != nil {
+		t.Fatalf("read offloaded object: %v", err)
+	}
+	if !bytes.Equal(inline, offloaded) {
+		t.Fatalf("offloaded object differs from inline one (%d vs %d bytes)", len(offloaded), len(inline))
+	}
+	if meta.File.CompressedSize != int64(len(inline)) {
+		t.Fatalf("record compressed_size=%d want %d", meta.File.CompressedSize, len(inline))
+	}
+}
+
+func TestUploadNoDedupStoresDistinctObjects(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	const content = "identical content kept as separate physical copies"
+	sum := file.MD5Sum([]byte(content))
+
+	upload := func(endpoint, filename string) map[string]any {
+		body, ct := createMultipartFile(t, "file", filename, content)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, endpoint, body)
+		req.Header.Set("Content-Type", ct)
+		req.Header.Set("X-No-Dedup", "true")
+		r.ServeHTTP(w, req)
+		var resp map[string]any
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil {
+			t.Fatalf("upload %s code=%d body=%s", filename, w.Code, w.Body.String())
+		}
+		return resp
+	}
+	first := upload("/files/upload", "tenant-a.txt")
+	second := upload("/files/upload/stream", "tenant-b.txt")
+	uploadFile(t, r, "shared.txt", content) // deduplicated as usual
+
+	keyA, _ := first["object_key"].(string)
+	keyB, _ := second["object_key"].(string)
+	if keyA == "" || keyB == "" || keyA == keyB {
+		t.Fatalf("expected two distinct object keys, got %q and %q", keyA, keyB)
+	}
+	for _, resp := range []map[string]any{first, second} {
+		if resp["md5"] != sum {
+			t.Fatalf("content hash must still be recorded, got %v", resp["md5"])
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(".runtime", "objects", sum[:2]))
+	if err != nil {
+		t.Fatalf("read shard: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{sum, keyA, keyB}
+	slices.Sort(want)
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("physical objects %v, want %v", names, want)
+	}
+
+	for _, name := range []string{"tenant-a.txt", "tenant-b.txt", "shared.txt"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/download/"+name, nil))
+		if w.Code != http.StatusOK || w.Body.String() != content {
+			t.Fatalf("download %s code=%d body=%q", name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestStreamUploadPipesThroughCompressor(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	payload := bytes.Repeat([]byte("streamed through the compressor in chunks\n"), 200_000) // ~8 MiB
+	body, ct := createMultipartFile(t, "file", "big.log", string(payload))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/files/upload/stream", body)
+	req.Header.Set("Content-Type", ct)
+	r.ServeHTTP(w, req)
+	var resp map[string]any
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil {
+		t.Fatalf("stream upload code=%d body=%s", w.Code, w.Body.String())
+	}
+	sum := file.MD5Sum(payload)
+	if resp["md5"] != sum || resp["original_size"] != float64(len(payload)) {
+		t.Fatalf("md5/size must describe the raw upload: %v", resp)
+	}
+	if cs := resp["compressed_size"].(float64); cs <= 0 || cs >= float64(len(payload)) {
+		t.Fatalf("expected a compressed object, got compressed_size=%v", cs)
+	}
+	fsys, _ := fs.New()
+	// the zstd frame records the content size, so the size lookup needs no decompression
+	if n, err := fsys.GetOriginalObjectSizeFast(sum); err != nil || n != int64(len(payload)) {
+		t.Fatalf("original size from frame header = %d, %v", n, err)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/download/big.log", nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), payload) {
+		t.Fatalf("download mismatch code=%d len=%d", w.Code, w.Body.Len())
+	}
+	matches, _ := filepath.Glob(filepath.Join(".runtime", "objects", "up*"))
+	if len(matches) != 0 {
+		t.Fatalf("temp files left behind: %v", matches)
+	}
+}
+
+func TestDeleteRemovesObjectWithLastReference(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	const content = "shared by two records through dedup"
+	sum := file.MD5Sum([]byte(content))
+	first := uploadFile(t, r, "first.txt", content)
+	second := uploadFile(t, r, "second.txt", content)
+	objectPath := filepath.Join(".runtime", "objects", sum[:2], sum)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("compressed payload with a cached analysis"))
+	zw.Close()
+	archive := uploadFile(t, r, "payload.gz", gz.String())
+	archiveID := uint(archive["id"].(float64))
+	deadline := time.Now().Add(3 * time.Second)
+	var cached int64
+	for time.Now().Before(deadline) && cached == 0 {
+		database.Get().Model(&GzipAnalyzeCached{}).Where("file_id = ?", archiveID).Count(&cached)
+		time.Sleep(20 * time.Millisecond)
+	}
+	if cached == 0 {
+		t.Fatalf("gzip analysis was not cached")
+	}
+
+	del := func(id any) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/files/file/"+strconv.Itoa(int(id.(float64))), nil))
+		var resp map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+	if code, resp := del(first["id"]); code != http.StatusOK || resp["object_removed"] != false {
+		t.Fatalf("first delete code=%d resp=%v", code, resp)
+	}
+	if _, err := os.Stat(objectPath); err != nil {
+		t.Fatalf("object still referenced by second.txt must stay: %v", err)
+	}
+	if code, resp := del(second["id"]); code != http.StatusOK || resp["object_removed"] != true {
+		t.Fatalf("second delete code=%d resp=%v", code, resp)
+	}
+	if _, err := os.Stat(objectPath); !os.IsNotExist(err) {
+		t.Fatalf("object should be gone after its last reference, stat err=%v", err)
+	}
+	if code, _ := del(second["id"]); code != http.StatusNotFound {
+		t.Fatalf("deleting twice should 404, got %d", code)
+	}
+
+	if code, resp := del(archive["id"]); code != http.StatusOK || resp["object_removed"] != true {
+		t.Fatalf("archive delete code=%d resp=%v", code, resp)
+	}
+	database.Get().Model(&GzipAnalyzeCached{}).Where("file_id = ?", archiveID).Count(&cached)
+	if cached != 0 {
+		t.Fatalf("cached analysis should be removed with the record")
+	}
+}
+
+func TestGCRemovesOrphanedObjects(t *testing.T) {
+	resetState(t)
+	prev := gcGracePeriod
+	gcGracePeriod = 0
+	t.Cleanup(func() { gcGracePeriod = prev })
+	r := setupRouter()
+	uploadFile(t, r, "kept.txt", "still referenced")
+	fsys, _ := fs.New()
+	orphan := file.MD5Sum([]byte("left behind"))
+	if err := fsys.WriteObjectHashed(orphan, []byte("left behind")); err != nil {
+		t.Fatalf("write orphan: %v", err)
+	}
+	size, _ := fsys.GetHashedObjectSize(orphan)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/files/gc", nil))
+	var resp map[string]any
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil {
+		t.Fatalf("gc code=%d body=%s", w.Code, w.Body.String())
+	}
+	if resp["removed"] != float64(1) || resp["freed_bytes"] != float64(size) {
+		t.Fatalf("unexpected gc result %v (orphan size %d)", resp, size)
+	}
+	if exists, _ := fsys.HashedObjectExists(orphan); exists {
+		t.Fatalf("orphan survived gc")
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/download/kept.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "still referenced" {
+		t.Fatalf("referenced object lost: code=%d body=%q", w.Code, w.Body.String())
+	}
+}
+
+func TestAdminRoutesNotPublic(t *testing.T) {
+	resetState(t)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutes(r.Group("/files"))
+	rec := uploadFile(t, r, "keep.txt", "not deletable from the public group")
+	id := strconv.Itoa(int(rec["id"].(float64)))
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodDelete, "/files/file/"+id, nil),
+		httptest.NewRequest(http.MethodPost, "/files/gc", nil),
+		httptest.NewRequest(http.MethodPost, "/files/stats/recompute", nil),
+		httptest.NewRequest(http.MethodGet, "/files/verify", nil),
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("%s %s: code=%d, want 404", req.Method, req.URL.Path, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/download/keep.txt", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("file gone: code=%d", w.Code)
+	}
+}
+
+func TestDownloadRawServesStoredBytes(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	content := strings.Repeat("served compressed, decoded by the client\n", 200)
+	get := func(id any, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/files/download/raw/"+strconv.Itoa(int(id.(float64))), nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	stored := func(hash string) []byte {
+		b, err := os.ReadFile(filepath.Join(".runtime", "objects", hash[:2], hash))
+		if err != nil {
+			t.Fatalf("read stored object: %v", err)
+		}
+		return b
+	}
+
+	zst := uploadFile(t, r, "notes.txt", content)
+	if w := get(zst["id"], "gzip, deflate"); w.Code != http.StatusNotAcceptable {
+		t.Fatalf("zstd object without Accept-Encoding: zstd should be 406, got %d", w.Code)
+	}
+	if w := get(zst["id"], "gzip, zstd;q=0"); w.Code != http.StatusNotAcceptable {
+		t.Fatalf("zstd refused with q=0 should be 406, got %d", w.Code)
+	}
+	w := get(zst["id"], "gzip, zstd")
+	raw := stored(zst["md5"].(string))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "zstd" || !bytes.Equal(w.Body.Bytes(), raw) {
+		t.Fatalf("zstd raw download code=%d encoding=%q len=%d want %d", w.Code, w.Header().Get("Content-Encoding"), w.Body.Len(), len(raw))
+	}
+	if w.Header().Get("Content-Length") != strconv.Itoa(len(raw)) || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("unexpected headers %v", w.Header())
+	}
+
+	fs.SetDefaultCompressor(compress.NewGzipCompressor(gzip.BestSpeed))
+	t.Cleanup(func() { fs.SetDefaultCompressor(nil) })
+	gz := uploadFile(t, r, "notes-gzip.txt", content+"gzip\n")
+	w = get(gz["id"], "")
+	raw = stored(gz["md5"].(string))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" || !bytes.Equal(w.Body.Bytes(), raw) {
+		t.Fatalf("gzip raw download code=%d encoding=%q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	if decoded, _ := io.ReadAll(zr); string(decoded) != content+"gzip\n" {
+		t.Fatalf("decoded body mismatch")
+	}
+
+	if w := get(float64(9999), "zstd"); w.Code != http.StatusNotFound {
+		t.Fatalf("missing id should 404, got %d", w.Code)
+	}
+}
+
+func TestListSearchFiltersAndOrder(t *testing.T) {
+	resetState(t)
+	cfg := config.Default()
+	cfg.Analysis.Gzip = false
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(config.Default()) })
+	r := setupRouter()
+	uploadFile(t, r, "report_2024.txt", "quarterly numbers")
+	uploadFile(t, r, "report-final.txt", strings.Repeat("x", 400))
+	uploadFile(t, r, "photo.txt", "tiny")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte("compressed payload"))
+	_ = zw.Close()
+	uploadFile(t, r, "bundle.gz", gz.String())
+
+	list := func(query string) (int, int64, []string) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/list?"+query, nil))
+		var resp struct {
+			Total int64        `json:"total"`
+			Files []FileRecord `json:"files"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		var names []string
+		for _, f := range resp.Files {
+			names = append(names, f.Filename)
+		}
+		return w.Code, resp.Total, names
+	}
+
+	cases := []struct {
+		query string
+		total int64
+		want  []string
+	}{
+		{"filename=report", 2, []string{"report-final.txt", "report_2024.txt"}},
+		// _ and % are matched literally, not as wildcards
+		{"filename=report_", 1, []string{"report_2024.txt"}},
+		{"filename=%25", 0, nil},
+		{"mime=application/gzip", 1, []string{"bundle.gz"}},
+		{"min_size=10&max_size=100&order=size", 2, []string{"report_2024.txt", "bundle.gz"}},
+		{"order=-size", 4, []string{"report-final.txt", "bundle.gz", "report_2024.txt", "photo.txt"}},
+		{"order=created_at&page_size=2", 4, []string{"report_2024.txt", "report-final.txt"}},
+		{"order=-size&page=2&page_size=3", 4, []string{"photo.txt"}},
+		{"analysis_status=pending", 0, nil},
+		{"filename=report&order=-created_at&page_size=1", 2, []string{"report-final.txt"}},
+	}
+	for _, tc := range cases {
+		code, total, names := list(tc.query)
+		if code != http.StatusOK || total != tc.total || !reflect.DeepEqual(names, tc.want) {
+			t.Fatalf("%s: code=%d total=%d names=%v want %d %v", tc.query, code, total, names, tc.total, tc.want)
+		}
+	}
+	for _, bad := range []string{"min_size=abc", "max_size=-1", "order=name", "order=size%3BDROP%20TABLE%20file_records"} {
+		if code, _, _ := list(bad); code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", bad, code)
+		}
+	}
+}
+
+func TestDuplicatesReport(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	first := uploadFile(t, r, "a.txt", "shared content for dedup report")
+	uploadFile(t, r, "b.txt", "shared content for dedup report")
+	uploadFile(t, r, "unique.txt", "only once")
+
+	report := func() (int, int64) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/duplicates", nil))
+		var resp struct {
+			Duplicates []struct {
+				Objects     int   `json:"objects"`
+				Reclaimable int64 `json:"reclaimable_bytes"`
+			} `json:"duplicates"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Duplicates) != 1 {
+			t.Fatalf("duplicates: code=%d body=%s", w.Code, w.Body.String())
+		}
+		return resp.Duplicates[0].Objects, resp.Duplicates[0].Reclaimable
+	}
+	// both uploads share one stored object, so nothing is reclaimable
+	if objects, reclaimable := report(); objects != 1 || reclaimable != 0 {
+		t.Fatalf("deduplicated group: objects=%d reclaimable=%d, want 1 and 0", objects, reclaimable)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/duplicates", nil))
+	var resp struct {
+		Total      int64 `json:"total"`
+		Duplicates []struct {
+			MD5   string `json:"md5"`
+			Count int64  `json:"count"`
+			Files []struct {
+				Filename       string `json:"filename"`
+				CompressedSize int64  `json:"compressed_size"`
+			} `json:"files"`
+		} `json:"duplicates"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("duplicates: code=%d body=%s", w.Code, w.Body.String())
+	}
+	if resp.Total != 1 || len(resp.Duplicates) != 1 {
+		t.Fatalf("expected one duplicate group, got %s", w.Body.String())
+	}
+	g := resp.Duplicates[0]
+	if g.MD5 != first["md5"] || g.Count != 2 || len(g.Files) != 2 || g.Files[0].Filename != "a.txt" || g.Files[1].Filename != "b.txt" {
+		t.Fatalf("unexpected group %+v", g)
+	}
+
+	// a physical copy stored with X-No-Dedup is what dropping duplicates would free
+	body, ct := createMultipartFile(t, "file", "c.txt", "shared content for dedup report")
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/files/upload", body)
+	req.Header.Set("Content-Type", ct)
+	req.Header.Set("X-No-Dedup", "true")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("no-dedup upload: code=%d body=%s", w.Code, w.Body.String())
+	}
+	if objects, reclaimable := report(); objects != 2 || reclaimable != g.Files[0].CompressedSize {
+		t.Fatalf("salted copy: objects=%d reclaimable=%d, want 2 and %d", objects, reclaimable, g.Files[0].CompressedSize)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/duplicates?page=2", nil))
+	resp.Duplicates = nil
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.Total != 1 || len(resp.Duplicates) != 0 {
+		t.Fatalf("page 2: code=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestUploadBodyLimit(t *testing.T) {
+	resetState(t)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(restful.MaxBodyBytes(4096))
+	RegisterRoutes(r.Group("/files"))
+
+	post := func(path, content string, chunked bool) *httptest.ResponseRecorder {
+		// one filename per endpoint: a name already taken fails the upload
+		body, ct := createMultipartFile(t, "file", path[len("/files/"):]+".bin", content)
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.Header.Set("Content-Type", ct)
+		if chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	for _, path := range []string{"/files/upload", "/files/upload/stream", "/files/upload/multi"} {
+		// multipart framing takes a few hundred bytes of the limit
+		if w := post(path, strings.Repeat("u", 3000)+path, true); w.Code != http.StatusOK {
+			t.Fatalf("%s under limit: code=%d body=%s", path, w.Code, w.Body.String())
+		}
+		for _, chunked := range []bool{false, true} {
+			if w := post(path, strings.Repeat("o", 5000), chunked); w.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("%s over limit (chunked=%v): code=%d body=%s", path, chunked, w.Code, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestStructuredErrorResponses(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	decode := func(w *httptest.ResponseRecorder) (code, msg string) {
+		var resp struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode error body %s: %v", w.Body.String(), err)
+		}
+		return resp.Error.Code, resp.Error.Message
+	}
+
+	// a multipart upload whose body is not a valid multipart stream
+	req := httptest.NewRequest(http.MethodPost, "/files/upload/multi", strings.NewReader("not multipart at all"))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if code, msg := decode(w); w.Code != http.StatusBadRequest || code != "INVALID_MULTIPART" || msg != "invalid multipart form" {
+		t.Fatalf("bad upload: status=%d code=%q msg=%q", w.Code, code, msg)
+	}
+
+	cases := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/files/meta/999", http.StatusNotFound, "FILE_NOT_FOUND"},
+		{"/files/object/nothex/exists", http.StatusBadRequest, "INVALID_MD5"},
+		{"/files/list?order=name", http.StatusBadRequest, "INVALID_PARAM"},
+		{"/files/download/raw/999", http.StatusNotFound, "FILE_NOT_FOUND"},
+		{"/files/download/gzip-members/999", http.StatusNotFound, "FILE_NOT_FOUND"},
+		{"/files/assets/site/index.html", http.StatusNotFound, "ASSETS_DISABLED"},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if code, _ := decode(w); w.Code != tc.status || code != tc.code {
+			t.Fatalf("%s: status=%d code=%q body=%s", tc.path, w.Code, code, w.Body.String())
+		}
+	}
+
+	// upload prechecks and per-request limits use the same shape
+	req = httptest.NewRequest(http.MethodPost, "/files/upload/stream", strings.NewReader("raw"))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if code, _ := decode(w); w.Code != http.StatusBadRequest || code != "INVALID_MULTIPART" {
+		t.Fatalf("non-multipart upload: status=%d body=%s", w.Code, w.Body.String())
+	}
+	body, ct := createMultipartFile(t, "attachment", "a.txt", "x")
+	req = httptest.NewRequest(http.MethodPost, "/files/upload/stream", body)
+	req.Header.Set("Content-Type", ct)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if code, _ := decode(w); w.Code != http.StatusBadRequest || code != "FILE_REQUIRED" || !strings.Contains(w.Body.String(), `"available_fields":["attachment"]`) {
+		t.Fatalf("missing file field: status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestEnsureDBMigratesAllModelsOnce(t *testing.T) {
+	resetState(t)
+	db, err := ensureDB()
+	if err != nil {
+		t.Fatalf("ensureDB: %v", err)
+	}
+	again, err := ensureDB()
+	if err != nil || again != db {
+		t.Fatalf("expected the same instance on later calls, err=%v", err)
+	}
+	tables, err := database.InspectSchema(db, append(models, &ThumbnailCached{}, &FileTag{})...)
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	for _, ts := range tables {
+		if !ts.Exists || len(ts.Pending) > 0 {
+			t.Errorf("table %s not fully migrated: exists=%v pending=%v", ts.Table, ts.Exists, ts.Pending)
+		}
+	}
+	applied, err := database.AppliedMigrations(db)
+	if err != nil || len(applied) != 4 || applied[0].ID != "0001_fileio_models" || applied[1].ID != "0002_thumbnails" || applied[2].ID != "0003_file_tags" || applied[3].ID != "0004_purge_deleted_records" {
+		t.Fatalf("expected the fileio migrations recorded once, got %+v (err=%v)", applied, err)
+	}
+}
+
+// BenchmarkEnsureDB measures the per-request cost of obtaining the database now that migrations
+// run once at init; BenchmarkEnsureDBAutoMigrate is the previous per-call AutoMigrate for comparison
+func BenchmarkEnsureDB(b *testing.B) {
+	resetState(b)
+	if _, err := ensureDB(); err != nil {
+		b.Fatalf("ensureDB: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ensureDB(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEnsureDBAutoMigrate(b *testing.B) {
+	resetState(b)
+	db, err := ensureDB()
+	if err != nil {
+		b.Fatalf("ensureDB: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := db.AutoMigrate(models...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestUploadArchive(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	db, _ := ensureDB()
+
+	post := func(name string, archive []byte) (int, map[string]any) {
+		body, ct := createMultipartFile(t, "file", name, string(archive))
+		req := httptest.NewRequest(http.MethodPost, "/files/upload/archive", body)
+		req.Header.Set("Content-Type", ct)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := post("bundle.tar.gz", buildTarGz(t,
+		[2]string{"docs/readme.txt", "read me first\n"},
+		[2]string{"docs/notes.txt", "some notes\n"},
+		[2]string{"config.json", `{"a":1}`},
+		[2]string{"../escape.txt", "nope"},
+	))
+	if code != http.StatusOK {
+		t.Fatalf("archive upload code=%d resp=%v", code, resp)
+	}
+	results, _ := resp["results"].([]any)
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %v", resp)
+	}
+	if last := results[3].(map[string]any); last["error"] != "invalid member path" {
+		t.Fatalf("expected traversal member rejected, got %v", last)
+	}
+	for _, name := range []string{"docs/readme.txt", "docs/notes.txt", "config.json"} {
+		var rec FileRecord
+		if err := db.Where("filename = ?", name).First(&rec).Error; err != nil {
+			t.Fatalf("record %s: %v", name, err)
+		}
+		if rec.MD5 == "" || rec.Size == 0 {
+			t.Fatalf("record %s incomplete: %+v", name, rec)
+		}
+	}
+	var n int64
+	db.Model(&FileRecord{}).Count(&n)
+	if n != 3 {
+		t.Fatalf("expected 3 records, got %d", n)
+	}
+
+	var zbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	fw, _ := zw.Create("zipped/one.txt")
+	fw.Write([]byte("from a zip\n"))
+	zw.Close()
+	if code, resp := post("bundle.zip", zbuf.Bytes()); code != http.StatusOK || resp["count"] != float64(1) {
+		t.Fatalf("zip upload code=%d resp=%v", code, resp)
+	}
+
+	if code, resp := post("plain.txt", []byte("not an archive")); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for non-archive, got %d %v", code, resp)
+	}
+}
+
+func TestVerifyObjects(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	uploadFile(t, r, "intact.txt", "this object stays intact")
+	uploadFile(t, r, "damaged.txt", "this object will be damaged")
+	uploadFile(t, r, "damaged-copy.txt", "this object will be damaged")
+	damaged := file.MD5Sum([]byte("this object will be damaged"))
+	fsys, _ := fs.New()
+	if err := os.WriteFile(fsys.HashedObjectPath(damaged), []byte("garbage"), 0644); err != nil {
+		t.Fatalf("corrupt object: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/verify", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify code=%d body=%s", w.Code, w.Body.String())
+	}
+	var report struct {
+		Corrupt []corruptObject `json:"corrupt"`
+		Count   int             `json:"count"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if report.Count != 1 || report.Corrupt[0].Key != damaged {
+		t.Fatalf("expected only %s corrupt, got %s", damaged, w.Body.String())
+	}
+	var names []string
+	for _, f := range report.Corrupt[0].Files {
+		names = append(names, f.Filename)
+	}
+	if !slices.Equal(names, []string{"damaged.txt", "damaged-copy.txt"}) {
+		t.Fatalf("expected both referencing files, got %v", names)
+	}
+}
+
+func TestIncompressibleUploadStoredRaw(t *testing.T) {
+	resetState(t)
+	fs.SetIncompressibleMIMETypes(config.Default().Compression.IncompressibleMIMETypes)
+	t.Cleanup(func() { fs.SetIncompressibleMIMETypes(nil) })
+	r := setupRouter()
+
+	// JPEG magic followed by highly compressible filler: compressing it would shrink it, but the
+	// type says not to bother
+	content := "\xFF\xD8\xFF\xE0" + strings.Repeat("A", 4096)
+	resp := uploadFile(t, r, "photo.jpg", content)
+	if resp["mime"] != "image/jpeg" || resp["compression_type"] != "none" {
+		t.Fatalf("expected raw jpeg, got %v", resp)
+	}
+	db, _ := ensureDB()
+	var rec FileRecord
+	if err := db.Where("filename = ?", "photo.jpg").First(&rec).Error; err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if rec.CompressionType != "none" || rec.CompressedSize != rec.Size {
+		t.Fatalf("expected record of an uncompressed object, got %+v", rec)
+	}
+	fsys, _ := fs.New()
+	if raw, _ := fsys.ReadObjectHashedRaw(rec.MD5); string(raw) != content {
+		t.Fatalf("expected object stored as uploaded, %d bytes on disk", len(raw))
+	}
+}
+
+func TestCompressBench(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	resp := uploadFile(t, r, "bench.txt", strings.Repeat("the quick brown fox jumps over the lazy dog\n", 200))
+	id := strconv.Itoa(int(resp["id"].(float64)))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/analysis/compress-bench/"+id, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("bench code=%d body=%s", w.Code, w.Body.String())
+	}
+	var report struct {
+		Sampled bool                  `json:"sampled"`
+		Results []compressBenchResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	ratios := map[string]float64{}
+	for i, res := range report.Results {
+		if res.Error != "" {
+			t.Fatalf("%s failed: %s", res.Algorithm, res.Error)
+		}
+		if i > 0 && res.Ratio < report.Results[i-1].Ratio {
+			t.Fatalf("results not sorted by ratio: %s", w.Body.String())
+		}
+		ratios[res.Algorithm] = res.Ratio
+	}
+	if report.Sampled || ratios["none"] != 1 || ratios["zstd"] >= ratios["none"] || ratios["gzip"] >= ratios["none"] {
+		t.Fatalf("expected zstd and gzip to beat none on text: %s", w.Body.String())
+	}
+
+	cfg := config.Default()
+	cfg.Analysis.CompressBenchMaxBytes = 1000
+	config.SetForTest(cfg)
+	t.Cleanup(func() { config.SetForTest(nil) })
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/analysis/compress-bench/"+id, nil))
+	var sampled struct {
+		OriginalSize int  `json:"original_size"`
+		Sampled      bool `json:"sampled"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &sampled); err != nil || !sampled.Sampled || sampled.OriginalSize != 1000 {
+		t.Fatalf("expected a 1000 byte sample, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/analysis/compress-bench/999", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown id, got %d", w.Code)
+	}
+}
+
+func TestConditionalDownload(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	content := "cache me if you can"
+	resp := uploadFile(t, r, "cached.txt", content)
+	md5v := resp["md5"].(string)
+
+	get := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	full := get("/files/download/cached.txt", nil)
+	etag, lastMod := full.Header().Get("ETag"), full.Header().Get("Last-Modified")
+	if full.Code != http.StatusOK || etag != `"`+md5v+`"` || lastMod == "" {
+		t.Fatalf("plain download code=%d etag=%q last-modified=%q", full.Code, etag, lastMod)
+	}
+
+	for _, path := range []string{"/files/download/cached.txt", "/files/download/by-md5/" + md5v} {
+		for _, h := range []map[string]string{
+			{"If-None-Match": etag},
+			{"If-None-Match": "W/" + etag},
+			{"If-None-Match": `"other", ` + etag},
+			{"If-None-Match": "*"},
+			{"If-Modified-Since": lastMod},
+		} {
+			w := get(path, h)
+			if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+				t.Errorf("%s %v: code=%d body=%q etag=%q", path, h, w.Code, w.Body.String(), w.Header().Get("ETag"))
+			}
+		}
+		for _, h := range []map[string]string{
+			{"If-None-Match": `"0123456789abcdef0123456789abcdef"`},
+			{"If-Modified-Since": "Mon, 02 Jan 2006 15:04:05 GMT"},
+			// If-None-Match wins over a matching If-Modified-Since
+			{"If-None-Match": `"stale"`, "If-Modified-Since": lastMod},
+		} {
+			if w := get(path, h); w.Code != http.StatusOK || w.Body.String() != content {
+				t.Errorf("%s %v: expected full body, got code=%d body=%q", path, h, w.Code, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 600, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 600; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, img); err != nil {
+		t.Fatal(err)
+	}
+	good := uploadFile(t, r, "wide.png", pngBuf.String())
+	// a PNG signature followed by garbage is detected as an image but cannot be decoded
+	bad := uploadFile(t, r, "broken.png", "\x89PNG\r\n\x1a\nnot really an image")
+	text := uploadFile(t, r, "notes.txt", "no preview for text")
+
+	get := func(id any) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/thumb/"+strconv.Itoa(int(id.(float64))), nil))
+		return w
+	}
+	var w *httptest.ResponseRecorder
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if w = get(good["id"]); w.Code != http.StatusNotFound && get(bad["id"]).Code != http.StatusNotFound {
+			break
+		}
+	}
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("thumb: code=%d type=%q body=%s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	thumb, err := jpeg.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("thumbnail is not a JPEG: %v", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 256 || b.Dy() != 128 {
+		t.Errorf("thumbnail size = %dx%d, want 256x128", b.Dx(), b.Dy())
+	}
+
+	db, _ := ensureDB()
+	var row ThumbnailCached
+	if err := db.Where("file_id = ?", uint(good["id"].(float64))).First(&row).Error; err != nil {
+		t.Fatalf("thumbnail row: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(".runtime", "objects", thumbDir, row.Hash)); err != nil {
+		t.Errorf("thumbnail object not stored: %v", err)
+	}
+
+	if w := get(bad["id"]); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), codeThumbnailFailed) {
+		t.Errorf("undecodable image: code=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := get(text["id"]); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), codeThumbnailNotFound) {
+		t.Errorf("text upload: code=%d body=%s", w.Code, w.Body.String())
+	}
+
+	if _, _, _, err := renderThumbnail(bytes.NewReader(pngBuf.Bytes()), 1000); err == nil || !strings.Contains(err.Error(), "exceeds thumbnail limit") {
+		t.Errorf("expected the pixel cap to reject the image before decoding, got %v", err)
+	}
+}
+
+func TestUploadTags(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+
+	upload := func(name, content string, fields [][2]string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, f := range fields {
+			mw.WriteField(f[0], f[1])
+		}
+		fw, _ := mw.CreateFormFile("file", name)
+		fw.Write([]byte(content))
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/files/upload", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	w := upload("a.txt", "alpha", [][2]string{{"tags", `{"project":"apollo","owner":"ops"}`}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"tags":{"owner":"ops","project":"apollo"}`) {
+		t.Fatalf("json tags: code=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := upload("b.txt", "beta", [][2]string{{"tag", "project:gemini"}, {"tag", "owner:ops"}}); w.Code != http.StatusOK {
+		t.Fatalf("repeated tags: code=%d body=%s", w.Code, w.Body.String())
+	}
+	uploadFile(t, r, "c.txt", "untagged")
+
+	list := func(q string) []string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/list?order=created_at&"+q, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("list %s: code=%d body=%s", q, w.Code, w.Body.String())
+		}
+		var body struct {
+			Files []struct {
+				Filename string `json:"filename"`
+			} `json:"files"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		var names []string
+		for _, f := range body.Files {
+			names = append(names, f.Filename)
+		}
+		return names
+	}
+	for q, want := range map[string][]string{
+		"tag_key=owner":                    {"a.txt", "b.txt"},
+		"tag_key=project&tag_value=gemini": {"b.txt"},
+		"tag_key=project&tag_value=none":   nil,
+		"tag_key=missing":                  nil,
+	} {
+		if got := list(q); !slices.Equal(got, want) {
+			t.Errorf("list %s = %v, want %v", q, got, want)
+		}
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/list?tag_value=ops", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("tag_value without tag_key: code=%d", w.Code)
+	}
+
+	tooMany := map[string]string{}
+	for i := 0; i <= maxTagsPerFile; i++ {
+		tooMany["k"+strconv.Itoa(i)] = "v"
+	}
+	many, _ := json.Marshal(tooMany)
+	for name, fields := range map[string][][2]string{
+		"bad json":   {{"tags", `["x"]`}},
+		"no colon":   {{"tag", "project"}},
+		"empty key":  {{"tag", ":v"}},
+		"long key":   {{"tag", strings.Repeat("k", maxTagKeyLen+1) + ":v"}},
+		"long value": {{"tag", "k:" + strings.Repeat("v", maxTagValueLen+1)}},
+		"too many":   {{"tags", string(many)}},
+	} {
+		if w := upload("rejected-"+name+".txt", name, fields); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), codeInvalidParam) {
+			t.Errorf("%s: code=%d body=%s", name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestGzipAnalysisInnerMIME(t *testing.T) {
+	resetState(t)
+	var inner bytes.Buffer
+	zw := gzip.NewWriter(&inner)
+	zw.Write([]byte("nested payload"))
+	zw.Close()
+	big := strings.Repeat("0123456789", 100) // longer than the sniffed head
+	meta := analyzeGzip(bytes.NewReader(buildTarGz(t, [2]string{"logs/app.log.gz", inner.String()}, [2]string{"README", "plain text notes"}, [2]string{"data.txt", big})))
+	if meta["error"] != nil {
+		t.Fatalf("analysis failed: %v", meta["error"])
+	}
+	entries := meta["tar_entries"].([]map[string]any)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %v", entries)
+	}
+	if entries[0]["mime"] != "application/gzip" || entries[0]["compression"] != "gzip" {
+		t.Errorf("gzip member: %v", entries[0])
+	}
+	for _, e := range entries[1:] {
+		if !strings.HasPrefix(e["mime"].(string), "text/plain") || e["compression"] != nil {
+			t.Errorf("text member: %v", e)
+		}
+	}
+	if got := meta["inner_compression"]; !reflect.DeepEqual(got, map[string]int{"gzip": 1}) {
+		t.Errorf("inner_compression = %v", got)
+	}
+	// sniffing the head must not change the size accounting
+	if want := int64(inner.Len() + len("plain text notes") + len(big)); meta["uncompressed_size"] != want {
+		t.Errorf("uncompressed_size = %v, want %d", meta["uncompressed_size"], want)
+	}
+}
+
+func TestAnalysisReadsStopAfterTimeout(t *testing.T) {
+	archive := buildTarGz(t, [2]string{"a.txt", "first"}, [2]string{"b.txt", "second"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	meta := analyzeGzip(ctxReadSeeker{ctx, bytes.NewReader(archive)})
+	if meta["error"] == nil || meta["tar_entries"] != nil {
+		t.Errorf("gzip analysis kept reading after its context ended: %v", meta)
+	}
+	tarball := buildTar(t, [2]string{"a.txt", "first"})
+	meta = analyzeTar(io.NewSectionReader(ctxReaderAt{ctx, bytes.NewReader(tarball)}, 0, int64(len(tarball))))
+	if meta["error"] == nil {
+		t.Errorf("tar analysis kept reading after its context ended: %v", meta)
+	}
+}
+
+func TestGzipAnalysisReadsStoredObject(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	db, _ := ensureDB()
+	for i, path := range []string{"/files/upload", "/files/upload/stream"} {
+		archive := buildTarGz(t, [2]string{"notes.txt", "stored " + strconv.Itoa(i)})
+		body, ct := createMultipartFile(t, "file", "bundle"+strconv.Itoa(i)+".tar.gz", string(archive))
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.Header.Set("Content-Type", ct)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusOK || resp["analysis_status"] != "pending" {
+			t.Fatalf("%s: code=%d body=%s", path, w.Code, w.Body.String())
+		}
+		id := uint(resp["id"].(float64))
+		deadline := time.Now().Add(3 * time.Second)
+		var fr FileRecord
+		for db.First(&fr, id); fr.AnalysisStatus == "pending" && time.Now().Before(deadline); db.First(&fr, id) {
+			time.Sleep(20 * time.Millisecond)
+		}
+		if fr.AnalysisStatus != "done" {
+			t.Fatalf("%s: analysis_status %q", path, fr.AnalysisStatus)
+		}
+		var cached GzipAnalyzeCached
+		if err := db.Where("file_id = ?", id).First(&cached).Error; err != nil {
+			t.Fatalf("%s: no cached analysis: %v", path, err)
+		}
+		if !strings.Contains(cached.Data, `"tar_count":1`) {
+			t.Errorf("%s: analysis %s", path, cached.Data)
+		}
+	}
+}
+
+func TestChunkedUpload(t *testing.T) {
+	resetState(t)
+	r := setupRouter()
+	t.Cleanup(func() {
+		chunkMu.Lock()
+		clear(chunkSessions)
+		chunkMu.Unlock()
+	})
+	do := func(method, path string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	create := func(headers map[string]string) string {
+		w := do(http.MethodPost, "/files/upload/chunked?filename=big.txt", "", headers)
+		var resp struct {
+			ID string `json:"id"`
+		}
+		if w.Code != http.StatusCreated || json.Unmarshal(w.Body.Bytes(), &resp) != nil || resp.ID == "" {
+			t.Fatalf("create: code=%d body=%s", w.Code, w.Body.String())
+		}
+		if w.Header().Get("Location") != "/files/upload/chunked/"+resp.ID {
+			t.Errorf("Location = %q", w.Header().Get("Location"))
+		}
+		return resp.ID
+	}
+
+	first, second := strings.Repeat("first chunk ", 4000), strings.Repeat("second chunk ", 3000)
+	id := create(map[string]string{"Upload-Length": strconv.Itoa(len(first) + len(second))})
+	url := "/files/upload/chunked/" + id
+	if w := do(http.MethodPatch, url, first, map[string]string{"Upload-Offset": "0"}); w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != strconv.Itoa(len(first)) {
+		t.Fatalf("first chunk: code=%d offset=%q body=%s", w.Code, w.Header().Get("Upload-Offset"), w.Body.String())
+	}
+	// a replayed chunk is rejected with the offset to resume from
+	if w := do(http.MethodPatch, url, first, map[string]string{"Upload-Offset": "0"}); w.Code != http.StatusConflict || w.Header().Get("Upload-Offset") != strconv.Itoa(len(first)) {
+		t.Errorf("out-of-order chunk: code=%d offset=%q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	if w := do(http.MethodPost, url+"/commit", "", nil); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), codeUploadIncomplete) {
+		t.Errorf("early commit: code=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPatch, url, second+"overrun", map[string]string{"Upload-Offset": strconv.Itoa(len(first))}); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunk past Upload-Length: code=%d", w.Code)
+	}
+	if w := do(http.MethodGet, url, "", nil); w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != strconv.Itoa(len(first)) {
+		t.Errorf("status after rollback: code=%d offset=%q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	if w := do(http.MethodPatch, url, second, map[string]string{"Upload-Offset": strconv.Itoa(len(first))}); w.Code != http.StatusOK {
+		t.Fatalf("second chunk: code=%d body=%s", w.Code, w.Body.String())
+	}
+	w := do(http.MethodPost, url+"/commit", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("commit: code=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp map[string]any
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	whole := first + second
+	if resp["md5"] != file.MD5Sum([]byte(whole)) || resp["original_size"] != float64(len(whole)) || resp["filename"] != "big.txt" {
+		t.Fatalf("commit response: %v", resp)
+	}
+	if w := do(http.MethodGet, "/files/download/big.txt", "", nil); w.Code != http.StatusOK || w.Body.String() != whole {
+		t.Errorf("committed object differs from the concatenated chunks (code=%d, %d bytes)", w.Code, w.Body.Len())
+	}
+	if w := do(http.MethodPatch, url, "late", map[string]string{"Upload-Offset": strconv.Itoa(len(whole))}); w.Code != http.StatusNotFound {
+		t.Errorf("session should end with the commit, got %d", w.Code)
+	}
+
+	// idle sessions expire together with their spool file
+	stale := create(nil)
+	chunkMu.Lock()
+	spool := chunkSessions[stale].path
+	chunkMu.Unlock()
+	if n := pruneChunkSessions(time.Now().Add(chunkSessionTTL() + time.Minute)); n != 1 {
+		t.Errorf("pruned %d sessions, want 1", n)
+	}
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Errorf("spool file of expired session kept: %v", err)
+	}
+	if w := do(http.MethodPatch, "/files/upload/chunked/"+stale, "x", map[string]string{"Upload-Offset": "0"}); w.Code != http.StatusNotFound {
+		t.Errorf("expired session: code=%d", w.Code)
+	}
+}
@@ -0,0 +1,123 @@
+package fileio
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/logger"
+)
+
+// applyRetention stamps a new record with its retention deadline when retention is enabled
+func applyRetention(rec *FileRecord) {
+	rc := config.Get().Retention
+	if !rc.Enabled || rc.PeriodSeconds <= 0 {
+		return
+	}
+	until := time.Now().Add(time.Duration(rc.PeriodSeconds) * time.Second).UTC()
+	rec.RetainUntil = &until
+}
+
+// retentionLocked reports whether the record is still inside its retention window
+func retentionLocked(rec *FileRecord) bool {
+	return rec.RetainUntil != nil && time.Now().Before(*rec.RetainUntil)
+}
+
+// pinHandler pins (pin=true) or unpins a record; pinned records are skipped by cleanup passes
+// and cannot be deleted
+func pinHandler(pin bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db, err := ensureDB()
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
+			return
+		}
+		var fr FileRecord
+		if err := db.First(&fr, c.Param("id")).Error; err != nil {
+			apiError(c, http.StatusNotFound, codeFileNotFound, "file not found")
+			return
+		}
+		if err := db.Model(&fr).Update("pinned", pin).Error; err != nil {
+			apiError(c, http.StatusInternalServerError, codeUpdateFailed, "update failed")
+			return
+		}
+		logger.GetLogger().Info().Uint("id", fr.ID).Bool("pinned", pin).Msg("file pin changed")
+		c.JSON(http.StatusOK, gin.H{"id": fr.ID, "pinned": pin})
+	}
+}
+
+// objectRefs counts live records whose object is stored under the same key as fr's
+func objectRefs(db *gorm.DB, fr *FileRecord) (int64, error) {
+	q := db.Model(&FileRecord{})
+	if fr.ObjectKey != "" {
+		q = q.Where("object_key = ?", fr.ObjectKey)
+	} else {
+		q = q.Where("md5 = ? AND (object_key = '' OR object_key IS NULL)", fr.MD5)
+	}
+	var n int64
+	err := q.Count(&n).Error
+	return n, err
+}
+
+// deleteRecord removes a record along with its cached analyses, tags and thumbnail. The stored
+// object is left to the caller, which knows whether other records still reference it.
+func deleteRecord(db *gorm.DB, fr *FileRecord) error {
+	// deleted for good: a soft-deleted row would keep holding its unique filename
+	if err := db.Unscoped().Delete(fr).Error; err != nil {
+		return err
+	}
+	db.Where("file_id = ?", fr.ID).Delete(&ElfAnalyzeCached{})
+	db.Where("file_id = ?", fr.ID).Delete(&GzipAnalyzeCached{})
+	db.Where("file_id = ?", fr.ID).Delete(&SqliteAnalyzeCached{})
+	db.Where("file_id = ?", fr.ID).Delete(&RpmAnalyzeCached{})
+	db.Where("file_id = ?", fr.ID).Delete(&TarAnalyzeCached{})
+	db.Where("file_id = ?", fr.ID).Delete(&FileTag{})
+	deleteThumbnail(db, fr.ID)
+	return nil
+}
+
+// deleteHandler removes a file record unless it is pinned or retention locked. The stored object
+// is removed with its last reference; objects shared through dedup stay for the other records.
+func deleteHandler(c *gin.Context) {
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
+		return
+	}
+	var fr FileRecord
+	if err := db.First(&fr, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, codeFileNotFound, "file not found")
+		return
+	}
+	if fr.Pinned {
+		apiError(c, http.StatusConflict, codePinned, "file is pinned; unpin it before deleting")
+		return
+	}
+	if retentionLocked(&fr) {
+		apiErrorWith(c, http.StatusForbidden, codeRetentionLocked, "file is under retention", gin.H{"retain_until": fr.RetainUntil})
+		return
+	}
+	if err := deleteRecord(db, &fr); err != nil {
+		apiError(c, http.StatusInternalServerError, codeDeleteFailed, "delete failed")
+		return
+	}
+
+	objectRemoved := false
+	if refs, err := objectRefs(db, &fr); err == nil && refs == 0 {
+		if fsys, err := fs.New(); err == nil {
+			if err := fsys.DeleteObjectHashed(fr.objectKey()); err == nil {
+				objectRemoved = true
+			} else if !os.IsNotExist(err) {
+				logger.GetLogger().Warn().Err(err).Str("hash", fr.objectKey()).Msg("delete object failed")
+			}
+		}
+	}
+	statsOnDelete(db, &fr, objectRemoved)
+	logger.GetLogger().Info().Uint("id", fr.ID).Str("filename", fr.Filename).Bool("object_removed", objectRemoved).Msg("file deleted")
+	c.JSON(http.StatusOK, gin.H{"deleted": true, "id": fr.ID, "object_removed": objectRemoved})
+}
@@ -3,6 +3,8 @@ package fileio
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -12,25 +14,25 @@ import (
 	"go4pack/pkg/common/compress"
 	"go4pack/pkg/common/file"
 	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/logger"
 )
 
 // streamUploadHandler handles large file uploads with streaming (reduces memory usage)
 func streamUploadHandler(c *gin.Context) {
-	fileHdr, header, err := c.Request.FormFile("file")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+	fileHdr, header, ok := uploadFormFile(c)
+	if !ok {
 		return
 	}
 	defer fileHdr.Close()
 
 	fsys, err := fs.New()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "filesystem init failed"})
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
 		return
 	}
 	temp, err := os.CreateTemp(fsys.GetObjectsPath(), "up-*")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "temp create failed"})
+		apiError(c, http.StatusInternalServerError, codeStoreFailed, "temp create failed")
 		return
 	}
 	defer temp.Close()
@@ -43,11 +45,11 @@ func streamUploadHandler(c *gin.Context) {
 		if n > 0 {
 			chunk := buf[:n]
 			if _, err := h.Write(chunk); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "hash failed"})
+				apiError(c, http.StatusInternalServerError, codeStoreFailed, "hash failed")
 				return
 			}
 			if _, err := temp.Write(chunk); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "write failed"})
+				apiError(c, http.StatusInternalServerError, codeStoreFailed, "write failed")
 				return
 			}
 			written += int64(n)
@@ -56,117 +58,194 @@ func streamUploadHandler(c *gin.Context) {
 			break
 		}
 		if rerr != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "read failed"})
+			apiError(c, http.StatusInternalServerError, codeReadFailed, "read failed")
 			return
 		}
 	}
-	md5sum := hex.EncodeToString(h.Sum(nil))
+	finishSpooledUpload(c, fsys, temp, header.Filename, hex.EncodeToString(h.Sum(nil)), written, "stream")
+}
 
+// finishSpooledUpload stores an upload spooled to temp (a file in the objects directory) whose
+// md5sum and size were computed while it was received: it normalizes, checks quota and pre-store
+// hooks, compresses into the hashed store, creates the record and writes the response. temp is
+// consumed (renamed into the store or removed) except on some internal errors, which the janitor
+// cleans up. mode labels the upload metrics.
+func finishSpooledUpload(c *gin.Context, fsys *fs.FileSystem, temp *os.File, uploadName, md5sum string, written int64, mode string) {
 	if _, err := temp.Seek(0, 0); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "seek failed"})
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "seek failed")
 		return
 	}
 	head := make([]byte, 512)
 	nHead, _ := io.ReadFull(temp, head)
-	mimeType := file.DetectMIME(head[:nHead], header.Filename)
-	if _, err := temp.Seek(0, 0); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "seek failed"})
-		return
-	}
-	firstBytes := head[:nHead]
-	preCT := compress.IsCompressedOrMIME(firstBytes, mimeType)
-	finalTempPath := temp.Name()
-
-	if preCT == compress.None {
+	mimeType := file.DetectMIME(head[:nHead], uploadName)
+	preCT := compress.IsCompressedOrMIME(head[:nHead], mimeType)
+	var wireEncoding string
+	if decoded, sum, size, ok := normalizeSpooled(fsys.GetObjectsPath(), uploadName, temp, preCT); ok {
+		// the decoded copy replaces the spool; the caller still closes the original
+		_ = os.Remove(temp.Name())
+		temp = decoded
+		defer temp.Close()
+		wireEncoding = preCT.String()
+		uploadName = normalizedName(uploadName, preCT)
+		md5sum, written = sum, size
 		if _, err := temp.Seek(0, 0); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "seek failed"})
-			return
-		}
-		compTemp, err := os.CreateTemp(fsys.GetObjectsPath(), "upc-*")
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "temp comp failed"})
-			return
-		}
-		cWriter := fsys.GetCompressor()
-		data, err := io.ReadAll(temp)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "read temp failed"})
+			_ = os.Remove(temp.Name())
+			apiError(c, http.StatusInternalServerError, codeReadFailed, "seek failed")
 			return
 		}
-		compressedData, err := cWriter.Compress(data)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "compress failed"})
-			return
-		}
-		if _, err := compTemp.Write(compressedData); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "write comp failed"})
-			return
+		nHead, _ = io.ReadFull(temp, head)
+		mimeType = file.DetectMIME(head[:nHead], uploadName)
+		preCT = compress.IsCompressedOrMIME(head[:nHead], mimeType)
+	}
+	hold, remaining, ok := reserveQuota(c, written)
+	if !ok {
+		_ = os.Remove(temp.Name())
+		rejectQuota(c, remaining)
+		return
+	}
+	charged := false
+	defer func() {
+		if !charged {
+			hold.release()
 		}
-		compTemp.Close()
-		_ = os.Remove(finalTempPath)
-		finalTempPath = compTemp.Name()
-		written = int64(len(data))
+	}()
+	filename := storedFilename(uploadName, md5sum)
+	charset := textCharset(mimeType, head[:nHead])
+	if perr := runPreStoreHooks(&preStoreInput{Filename: filename, MIME: mimeType, Size: written, Open: fileOpener(temp.Name())}); perr != nil {
+		_ = os.Remove(temp.Name())
+		rejectPreStore(c, perr)
+		return
 	}
-
-	if _, _, err = fsys.CommitTempAsHashed(finalTempPath, md5sum); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "commit failed"})
+	if _, err := temp.Seek(0, 0); err != nil {
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "seek failed")
 		return
 	}
-	if vErr := fsys.VerifyHashedRegular(md5sum); vErr != nil {
-		_ = fsys.DeleteObject(md5sum)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stored object"})
+	key, err := uploadObjectKey(c, md5sum)
+	if err != nil {
+		_ = os.Remove(temp.Name())
+		apiError(c, http.StatusInternalServerError, codeStoreFailed, "commit failed")
 		return
 	}
-
-	compressedSize, _ := fsys.GetHashedObjectSize(md5sum)
-	compressionType := preCT.String()
-	if preCT == compress.None {
-		compressionType = fsys.GetCompressor().Type().String()
+	if err := commitSpooled(fsys, temp, key, preCT, mimeType); err != nil {
+		if errors.Is(err, errSpoolCompress) {
+			apiError(c, http.StatusInternalServerError, codeCompressFailed, "compress failed")
+		} else {
+			apiError(c, http.StatusInternalServerError, codeStoreFailed, "commit failed")
+		}
+		return
+	}
+	if vErr := fsys.VerifyHashedRegular(key); vErr != nil {
+		_ = fsys.DeleteObjectHashed(key)
+		apiError(c, http.StatusBadRequest, codeInvalidObject, "invalid stored object")
+		return
 	}
 
+	compressedSize, _ := fsys.GetHashedObjectSize(key)
+	compressionType := storedCompressionType(fsys, preCT, mimeType)
+
 	if _, err := temp.Seek(0, 0); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "seek failed"})
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "seek failed")
 		return
 	}
-	magic := make([]byte, 4)
-	n, _ := temp.Read(magic)
-	isELF := n == 4 && magic[0] == 0x7f && magic[1] == 'E' && magic[2] == 'L' && magic[3] == 'F'
+	// one tar block: enough for every detector, including the ustar magic at offset 257
+	magic := make([]byte, 512)
+	n, _ := io.ReadFull(temp, magic)
+	kind := analysisKind(magic[:n], mimeType)
 	if _, err := temp.Seek(0, 0); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "seek failed"})
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "seek failed")
 		return
 	}
 
 	var rec FileRecord
 	if db, err := ensureDB(); err == nil {
 		rec = FileRecord{
-			Filename:        header.Filename,
+			Filename:        filename,
 			Size:            written,
 			CompressedSize:  compressedSize,
 			CompressionType: compressionType,
 			MD5:             md5sum,
 			MIME:            mimeType,
+			Charset:         charset,
+			WireEncoding:    wireEncoding,
+			ObjectKey:       recordObjectKey(key, md5sum),
 			AnalysisStatus:  "none",
 		}
-		if isELF {
+		if kind != "" && analysisTooLarge(written) {
+			markAnalysisTooLarge(&rec)
+		} else if kind != "" {
 			rec.AnalysisStatus = "pending"
 		}
-		_ = db.Create(&rec).Error
-		if isELF {
-			if dataAll, rErr := io.ReadAll(temp); rErr == nil {
-				scheduleELFAnalysis(rec.ID, dataAll)
-			}
+		applyRetention(&rec)
+		if err := db.Create(&rec).Error; err != nil {
+			// an object stored without a record is left for GC to collect
+			logger.GetLogger().Error().Err(err).Str("filename", filename).Msg("create file record failed")
+			apiError(c, http.StatusInternalServerError, codeStoreFailed, "record create failed")
+			return
+		}
+		statsOnCreate(db, &rec)
+		enforceObjectsCap()
+		if rec.AnalysisStatus == "pending" {
+			scheduleAnalysis(c.Request.Context(), kind, rec.ID, key)
 		}
 	}
 
+	charged = true
+	countUpload(mode, written)
+
 	resp := gin.H{
-		"filename":         header.Filename,
+		"filename":         filename,
 		"original_size":    written,
 		"compressed_size":  compressedSize,
 		"compression_type": compressionType,
 		"md5":              md5sum,
 		"mime":             mimeType,
+		"charset":          charset,
 		"analysis_status":  rec.AnalysisStatus,
 		"id":               rec.ID,
 	}
+	if key != md5sum {
+		resp["object_key"] = key
+	}
+	if wireEncoding != "" {
+		resp["wire_encoding"] = wireEncoding
+	}
+	if rec.RetainUntil != nil {
+		resp["retain_until"] = rec.RetainUntil
+	}
+	if remaining, enabled := quotaRemaining(c); enabled {
+		resp["quota_remaining"] = remaining
+	}
 	c.JSON(http.StatusOK, resp)
 }
+
+// errSpoolCompress marks commitSpooled failures that happened while compressing
+var errSpoolCompress = errors.New("compress spooled upload")
+
+// commitSpooled moves the spooled upload temp into the hashed store under key, piping it through
+// the compressor first unless it is already compressed or of an incompressible type. The spool
+// file is consumed (moved or removed) on success; on failure the caller still removes it.
+func commitSpooled(fsys *fs.FileSystem, temp *os.File, key string, preCT compress.CompressionType, mimeType string) error {
+	path := temp.Name()
+	if preCT == compress.None && !fs.IsIncompressibleMIME(mimeType) {
+		if _, err := temp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		compTemp, err := os.CreateTemp(fsys.GetObjectsPath(), "upc-*")
+		if err != nil {
+			return fmt.Errorf("%w: %v", errSpoolCompress, err)
+		}
+		// pipe the spooled upload through the compressor; the md5 was taken from the raw bytes
+		err = compress.CompressStream(fsys.GetCompressor(), compTemp, temp)
+		if cerr := compTemp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(compTemp.Name())
+			return fmt.Errorf("%w: %v", errSpoolCompress, err)
+		}
+		_ = os.Remove(path)
+		path = compTemp.Name()
+	}
+	_, _, err := fsys.CommitTempAsHashed(path, key)
+	return err
+}
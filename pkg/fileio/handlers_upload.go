@@ -1,92 +1,184 @@
 package fileio
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"io"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
 	"go4pack/pkg/common/compress"
+	elfutil "go4pack/pkg/common/elf"
 	"go4pack/pkg/common/file"
 	"go4pack/pkg/common/fs"
 	"go4pack/pkg/common/logger"
+	rpmutil "go4pack/pkg/common/rpm"
 )
 
 // uploadHandler handles single file upload (buffered)
 func uploadHandler(c *gin.Context) {
-	fileHdr, header, err := c.Request.FormFile("file")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+	fileHdr, header, ok := uploadFormFile(c)
+	if !ok {
 		return
 	}
 	defer fileHdr.Close()
+	tags, err := parseUploadTags(c)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, codeInvalidParam, err.Error())
+		return
+	}
 
 	fsys, err := fs.New()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "filesystem init failed"})
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
 		return
 	}
 	data, err := io.ReadAll(fileHdr)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "read file failed"})
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "read file failed")
 		return
 	}
 
-	originalSize := int64(len(data))
-	md5sum := file.MD5Sum(data)
-	mimeType := file.DetectMIME(data, header.Filename)
+	uploadName := header.Filename
+	mimeType := file.DetectMIME(data, uploadName)
 	preCT := compress.IsCompressedOrMIME(data, mimeType)
+	var wireEncoding string
+	if content, ok := normalizeUpload(uploadName, data, preCT); ok {
+		wireEncoding = preCT.String()
+		uploadName = normalizedName(uploadName, preCT)
+		data = content
+		mimeType = file.DetectMIME(data, uploadName)
+		preCT = compress.IsCompressedOrMIME(data, mimeType)
+	}
 
-	if err := fsys.WriteObjectHashedWithMIME(md5sum, data, mimeType); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "store file failed"})
+	originalSize := int64(len(data))
+	hold, remaining, ok := reserveQuota(c, originalSize)
+	if !ok {
+		rejectQuota(c, remaining)
 		return
 	}
-	if vErr := fsys.VerifyHashedRegular(md5sum); vErr != nil {
-		_ = fsys.DeleteObject(md5sum)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stored object"})
+	// the bytes stay charged only once the object is stored; dry runs and failures give them back
+	charged := false
+	defer func() {
+		if !charged {
+			hold.release()
+		}
+	}()
+	md5sum := file.MD5Sum(data)
+	filename := storedFilename(uploadName, md5sum)
+	charset := textCharset(mimeType, data)
+	if perr := runPreStoreHooks(&preStoreInput{Filename: filename, MIME: mimeType, Size: originalSize, Open: bytesOpener(data)}); perr != nil {
+		rejectPreStore(c, perr)
 		return
 	}
-	compressedSize, err := fsys.GetHashedObjectSize(md5sum)
-	if err != nil {
-		logger.GetLogger().Warn().Err(err).Str("hash", md5sum).Msg("failed to get compressed size")
-		compressedSize = originalSize
+
+	if dryRun, _ := strconv.ParseBool(c.Query("dry_run")); dryRun {
+		dryRunUpload(c, fsys, filename, data, md5sum, mimeType, charset, preCT)
+		return
 	}
-	compressionType := fsys.GetCompressor().Type().String()
-	if preCT != compress.None {
-		compressionType = preCT.String()
+	key, err := uploadObjectKey(c, md5sum)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeStoreFailed, "store file failed")
+		return
 	}
 
 	db, dbErr := ensureDB()
+	// offloading needs the record to report back into, so it is only possible with a database
+	offload := dbErr == nil && compressOffload(c)
+	analysisDeferred := offload
+	var compressedSize int64
+	if !offload {
+		size, invalid, err := storeObject(fsys, key, data, mimeType)
+		if invalid {
+			apiError(c, http.StatusBadRequest, codeInvalidObject, "invalid stored object")
+			return
+		}
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, codeStoreFailed, "store file failed")
+			return
+		}
+		compressedSize = size
+	}
+	compressionType := storedCompressionType(fsys, preCT, mimeType)
+
+	kind := analysisKind(data, mimeType)
 	var rec FileRecord
 	if dbErr == nil {
 		rec = FileRecord{
-			Filename:        header.Filename,
+			Filename:        filename,
 			Size:            originalSize,
 			CompressedSize:  compressedSize,
 			CompressionType: compressionType,
 			MD5:             md5sum,
 			MIME:            mimeType,
+			Charset:         charset,
+			WireEncoding:    wireEncoding,
+			ObjectKey:       recordObjectKey(key, md5sum),
 			AnalysisStatus:  "none",
 		}
-		if len(data) >= 4 && data[0] == 0x7f && data[1] == 'E' && data[2] == 'L' && data[3] == 'F' {
+		if kind != "" && analysisTooLarge(originalSize) {
+			markAnalysisTooLarge(&rec)
+		} else if kind != "" {
 			rec.AnalysisStatus = "pending"
 		}
-		_ = db.Create(&rec).Error
+		applyRetention(&rec)
+		if err := db.Create(&rec).Error; err != nil {
+			// an object stored without a record is left for GC to collect
+			logger.GetLogger().Error().Err(err).Str("filename", filename).Msg("create file record failed")
+			apiError(c, http.StatusInternalServerError, codeStoreFailed, "record create failed")
+			return
+		}
+		if offload {
+			// the job owns its own copy of the record; rec is still read below for the response.
+			// Analyses and the thumbnail read the stored object, so they are scheduled once it
+			// has been written.
+			job := rec
+			ctx := c.Request.Context()
+			pooled, err := offloadStore(db, fsys, &job, data, func() {
+				if job.AnalysisStatus == "pending" {
+					scheduleAnalysis(ctx, kind, job.ID, key)
+				}
+				scheduleThumbnail(job.ID, key, mimeType)
+			})
+			if err != nil {
+				apiError(c, http.StatusInternalServerError, codeStoreFailed, "store file failed")
+				return
+			}
+			if offload = pooled; !pooled {
+				compressedSize = job.CompressedSize
+			}
+		} else {
+			statsOnCreate(db, &rec)
+			enforceObjectsCap()
+		}
 	}
-	if rec.AnalysisStatus == "pending" {
-		scheduleELFAnalysis(rec.ID, data)
+	if !analysisDeferred {
+		if rec.AnalysisStatus == "pending" {
+			scheduleAnalysis(c.Request.Context(), kind, rec.ID, key)
+		}
+		scheduleThumbnail(rec.ID, key, mimeType)
 	}
-	if mimeType == "application/gzip" || mimeType == "application/x-gzip" {
-		if rec.AnalysisStatus == "none" && dbErr == nil {
-			db.Model(&FileRecord{}).Where("id = ?", rec.ID).Update("analysis_status", "pending")
-			rec.AnalysisStatus = "pending"
+	if rec.ID != 0 {
+		if err := saveTags(db, rec.ID, tags); err != nil {
+			logger.GetLogger().Warn().Err(err).Uint("id", rec.ID).Msg("save tags failed")
 		}
-		scheduleGzipAnalysis(rec.ID, data)
 	}
 
+	charged = true
+	countUpload("single", originalSize)
+
 	logger.GetLogger().Info().
-		Str("filename", header.Filename).
+		Str("filename", filename).
 		Str("hash", md5sum).
 		Int64("original_size", originalSize).
 		Int64("compressed_size", compressedSize).
@@ -95,144 +187,447 @@ func uploadHandler(c *gin.Context) {
 		Msg("file uploaded")
 
 	resp := gin.H{
-		"filename":          header.Filename,
+		"filename":          filename,
 		"original_size":     originalSize,
 		"compressed_size":   compressedSize,
 		"compression_type":  compressionType,
 		"compression_ratio": float64(compressedSize) / float64(originalSize),
 		"md5":               md5sum,
 		"mime":              mimeType,
+		"charset":           charset,
 		"analysis_status":   rec.AnalysisStatus,
 		"id":                rec.ID,
 	}
+	if offload {
+		// compressed_size is filled in on the record once the worker has written the object
+		resp["compression_offloaded"] = true
+	}
+	if key != md5sum {
+		resp["object_key"] = key
+	}
+	if wireEncoding != "" {
+		resp["wire_encoding"] = wireEncoding
+	}
+	if rec.RetainUntil != nil {
+		resp["retain_until"] = rec.RetainUntil
+	}
+	if len(tags) > 0 {
+		resp["tags"] = tags
+	}
+	if remaining, enabled := quotaRemaining(c); enabled {
+		resp["quota_remaining"] = remaining
+	}
 	c.JSON(http.StatusOK, resp)
 }
 
-// uploadMultiHandler handles multiple files in one request
-func uploadMultiHandler(c *gin.Context) {
-	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid multipart form"})
-		return
+// dryRunUpload mirrors the buffered upload response without writing the object or a DB row.
+// Analyses that normally run asynchronously are computed inline and returned under "analysis".
+func dryRunUpload(c *gin.Context, fsys *fs.FileSystem, filename string, data []byte, md5sum, mimeType, charset string, preCT compress.CompressionType) {
+	originalSize := int64(len(data))
+	compressedSize := originalSize
+	compressionType := storedCompressionType(fsys, preCT, mimeType)
+	if preCT == compress.None && !fs.IsIncompressibleMIME(mimeType) {
+		compressed, err := fsys.GetCompressor().Compress(data)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, codeCompressFailed, "compress failed")
+			return
+		}
+		compressedSize = int64(len(compressed))
+	}
+	exists, _ := fsys.HashedObjectExists(md5sum)
+
+	analysisStatus := "none"
+	analysis := gin.H{}
+	switch kind := analysisKind(data, mimeType); {
+	case kind == "":
+	case analysisTooLarge(originalSize):
+		analysisStatus = analysisSkippedTooLarge
+	case kind == "elf":
+		if m, err := elfutil.AnalyzeBytes(data); err == nil {
+			analysis["elf"] = m
+			analysisStatus = "done"
+		} else {
+			analysis["elf"] = gin.H{"error": err.Error()}
+			analysisStatus = "error"
+		}
+	case kind == "sqlite":
+		if m, err := analyzeSQLiteBytes(data); err == nil {
+			analysis["sqlite"] = m
+			analysisStatus = "done"
+		} else {
+			analysis["sqlite"] = gin.H{"error": err.Error()}
+			analysisStatus = "error"
+		}
+	case kind == "rpm":
+		if m, err := rpmutil.Analyze(data); err == nil {
+			analysis["rpm"] = m
+			analysisStatus = "done"
+		} else {
+			analysis["rpm"] = gin.H{"error": err.Error()}
+			analysisStatus = "error"
+		}
+	case kind == "tar":
+		m := analyzeTar(bytes.NewReader(data))
+		analysis["tar"] = m
+		analysisStatus = "done"
+		if _, hasErr := m["error"]; hasErr {
+			analysisStatus = "error"
+		}
+	case kind == "gzip":
+		m := analyzeGzip(bytes.NewReader(data))
+		analysis["gzip"] = m
+		analysisStatus = "done"
+		if _, hasErr := m["error"]; hasErr {
+			analysisStatus = "error"
+		}
 	}
-	form := c.Request.MultipartForm
-	files := form.File["files"]
-	if len(files) == 0 {
-		files = form.File["file"]
+
+	var ratio float64
+	if originalSize > 0 {
+		ratio = float64(compressedSize) / float64(originalSize)
 	}
-	if len(files) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no files provided"})
+	resp := gin.H{
+		"filename":          filename,
+		"original_size":     originalSize,
+		"compressed_size":   compressedSize,
+		"compression_type":  compressionType,
+		"compression_ratio": ratio,
+		"md5":               md5sum,
+		"mime":              mimeType,
+		"charset":           charset,
+		"analysis_status":   analysisStatus,
+		"analysis":          analysis,
+		"deduplicated":      exists,
+		"stored":            false,
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// storedCompressionType is the FileRecord.CompressionType of an object written by
+// WriteObjectHashedWithMIME: the upload's own compression, none for incompressible MIME types,
+// otherwise the filesystem's compressor
+func storedCompressionType(fsys *fs.FileSystem, preCT compress.CompressionType, mimeType string) string {
+	if preCT != compress.None {
+		return preCT.String()
+	}
+	if fs.IsIncompressibleMIME(mimeType) {
+		return compress.None.String()
+	}
+	return fsys.GetCompressor().Type().String()
+}
+
+// textCharset returns the detected encoding for text MIME types (empty for binary content).
+func textCharset(mimeType string, data []byte) string {
+	if !strings.HasPrefix(mimeType, "text/") {
+		return ""
+	}
+	charset, _ := file.DetectEncoding(data)
+	return charset
+}
+
+// spoolToTemp copies r into a new temp file under dir while hashing it, so a part never sits fully in memory.
+func spoolToTemp(dir string, r io.Reader) (path, md5sum string, size int64, err error) {
+	temp, err := os.CreateTemp(dir, "up-*")
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer temp.Close()
+	h := md5.New()
+	size, err = io.Copy(io.MultiWriter(temp, h), r)
+	if err != nil {
+		_ = os.Remove(temp.Name())
+		return "", "", 0, err
+	}
+	return temp.Name(), hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// uploadMultiHandler handles multiple files in one request.
+// Parts are read one at a time from the multipart stream and spooled to temp files, which are
+// then streamed into the store, so memory use is bounded regardless of the number or size of parts.
+func uploadMultiHandler(c *gin.Context) {
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		apiError(c, http.StatusBadRequest, codeInvalidMultipart, "invalid multipart form")
 		return
 	}
 	fsys, err := fs.New()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "filesystem init failed"})
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
 		return
 	}
-	db, dbErr := ensureDB()
+	db, _ := ensureDB()
+	opts := newStoreOptions(c, "multi")
 
-	type result struct {
-		ID               uint    `json:"id"`
-		Filename         string  `json:"filename"`
-		OriginalSize     int64   `json:"original_size"`
-		CompressedSize   int64   `json:"compressed_size"`
-		CompressionType  string  `json:"compression_type"`
-		CompressionRatio float64 `json:"compression_ratio"`
-		MD5              string  `json:"md5"`
-		MIME             string  `json:"mime"`
-		AnalysisStatus   string  `json:"analysis_status"`
-		Error            string  `json:"error,omitempty"`
-	}
-	results := make([]result, len(files))
+	var results []*uploadResult
+	var skippedFields []string
 	var wg sync.WaitGroup
 	sem := make(chan struct{}, 4)
 
-	for i, fh := range files {
+	for {
+		part, perr := mr.NextPart()
+		if perr == io.EOF {
+			break
+		}
+		if perr != nil {
+			wg.Wait()
+			if !rejectBodyTooLarge(c, perr) {
+				apiError(c, http.StatusBadRequest, codeInvalidMultipart, "invalid multipart form")
+			}
+			return
+		}
+		if part.FileName() == "" && !partHasFilename(part) {
+			part.Close()
+			continue
+		}
+		if !acceptsUploadField(part.FormName()) {
+			if !slices.Contains(skippedFields, part.FormName()) {
+				skippedFields = append(skippedFields, part.FormName())
+			}
+			part.Close()
+			continue
+		}
+		res := &uploadResult{Filename: part.FileName()}
+		results = append(results, res)
+		// spool sequentially (the multipart stream can only be read in order), store concurrently
+		tempPath, md5sum, size, serr := spoolToTemp(fsys.GetObjectsPath(), part)
+		part.Close()
+		if serr != nil {
+			res.Error = "read failed"
+			if rejectBodyTooLarge(c, serr) {
+				wg.Wait()
+				return
+			}
+			continue
+		}
+		res.MD5 = md5sum
+		res.OriginalSize = size
+		hold, _, ok := reserveQuota(c, size)
+		if !ok {
+			_ = os.Remove(tempPath)
+			res.Error = "upload quota exceeded"
+			continue
+		}
+
 		wg.Add(1)
-		idx := i
-		fheader := fh
+		sem <- struct{}{}
 		go func() {
 			defer wg.Done()
-			sem <- struct{}{}
 			defer func() { <-sem }()
-			res := &results[idx]
-			res.Filename = fheader.Filename
+			defer os.Remove(tempPath)
 
-			f, err := fheader.Open()
-			if err != nil {
-				res.Error = "open failed"
-				return
+			storeSpooledResult(opts, fsys, db, res, tempPath)
+			if res.Error != "" {
+				hold.release()
 			}
-			data, err := io.ReadAll(f)
-			f.Close()
-			if err != nil {
-				res.Error = "read failed"
-				return
-			}
-			res.OriginalSize = int64(len(data))
-			res.MD5 = file.MD5Sum(data)
-			res.MIME = file.DetectMIME(data, fheader.Filename)
-			preCT := compress.IsCompressedOrMIME(data, res.MIME)
+		}()
+	}
+	wg.Wait()
+	if len(results) == 0 {
+		rejectUploadFields(c, "no files provided", skippedFields)
+		return
+	}
+	resp := gin.H{"results": results, "count": len(results)}
+	if remaining, enabled := quotaRemaining(c); enabled {
+		resp["quota_remaining"] = remaining
+	}
+	c.JSON(http.StatusOK, resp)
+}
 
-			if err := fsys.WriteObjectHashedWithMIME(res.MD5, data, res.MIME); err != nil {
-				res.Error = "store failed"
-				return
-			}
-			if vErr := fsys.VerifyHashedRegular(res.MD5); vErr != nil {
-				res.Error = "invalid stored object"
-				return
-			}
-			cs, err := fsys.GetHashedObjectSize(res.MD5)
-			if err != nil {
-				cs = res.OriginalSize
-			}
-			res.CompressedSize = cs
-			if preCT != compress.None {
-				res.CompressionType = preCT.String()
-			} else {
-				res.CompressionType = fsys.GetCompressor().Type().String()
-			}
-			if res.OriginalSize > 0 {
-				res.CompressionRatio = float64(res.CompressedSize) / float64(res.OriginalSize)
-			}
+// uploadResult is the per-file outcome reported by the multi and archive upload handlers
+type uploadResult struct {
+	ID               uint       `json:"id"`
+	Filename         string     `json:"filename"`
+	OriginalSize     int64      `json:"original_size"`
+	CompressedSize   int64      `json:"compressed_size"`
+	CompressionType  string     `json:"compression_type"`
+	CompressionRatio float64    `json:"compression_ratio"`
+	MD5              string     `json:"md5"`
+	MIME             string     `json:"mime"`
+	Charset          string     `json:"charset,omitempty"`
+	WireEncoding     string     `json:"wire_encoding,omitempty"`
+	ObjectKey        string     `json:"object_key,omitempty"`
+	AnalysisStatus   string     `json:"analysis_status"`
+	RetainUntil      *time.Time `json:"retain_until,omitempty"`
+	Error            string     `json:"error,omitempty"`
+	Details          []string   `json:"details,omitempty"`
+}
 
-			if dbErr == nil && db != nil {
-				rec := &FileRecord{
-					Filename:        res.Filename,
-					Size:            res.OriginalSize,
-					CompressedSize:  res.CompressedSize,
-					CompressionType: res.CompressionType,
-					MD5:             res.MD5,
-					MIME:            res.MIME,
-					AnalysisStatus:  "none",
-				}
-				if len(data) >= 4 && data[0] == 0x7f && data[1] == 'E' && data[2] == 'L' && data[3] == 'F' {
-					rec.AnalysisStatus = "pending"
-				}
-				_ = db.Create(rec).Error
-				res.ID = rec.ID
-				res.AnalysisStatus = rec.AnalysisStatus
-				if rec.AnalysisStatus == "pending" {
-					scheduleELFAnalysis(rec.ID, data)
-				}
-				if res.MIME == "application/gzip" || res.MIME == "application/x-gzip" {
-					if res.AnalysisStatus == "none" {
-						db.Model(&FileRecord{}).Where("id = ?", rec.ID).Update("analysis_status", "pending")
-						res.AnalysisStatus = "pending"
-					}
-					scheduleGzipAnalysis(rec.ID, data)
-				}
-			}
+// storeOptions are the request settings a store job needs, read from the request before fanning
+// out: the *gin.Context is not safe for concurrent use and must never reach a job
+type storeOptions struct {
+	ctx     context.Context // request context, only used to link the analyses it schedules
+	noDedup bool
+	mode    string // upload metrics label
+}
 
-			logger.GetLogger().Info().
-				Str("filename", res.Filename).
-				Str("hash", res.MD5).
-				Int64("original_size", res.OriginalSize).
-				Int64("compressed_size", res.CompressedSize).
-				Str("compression", res.CompressionType).
-				Str("mime", res.MIME).
-				Msg("file uploaded (multi)")
-		}()
+// newStoreOptions reads the store settings of the request c
+func newStoreOptions(c *gin.Context, mode string) storeOptions {
+	return storeOptions{ctx: c.Request.Context(), noDedup: noDedup(c), mode: mode}
+}
+
+// storeUploadResult normalizes, stores and records one file of a multi-file upload, filling in
+// res; failures are reported through res.Error rather than aborting the request. db may be nil
+// when the database is unavailable, in which case only the object is stored. It runs on several
+// goroutines at once, so it only sees the request through opts.
+func storeUploadResult(opts storeOptions, fsys *fs.FileSystem, db *gorm.DB, res *uploadResult, data []byte) {
+	res.MIME = file.DetectMIME(data, res.Filename)
+	preCT := compress.IsCompressedOrMIME(data, res.MIME)
+	if content, ok := normalizeUpload(res.Filename, data, preCT); ok {
+		res.WireEncoding = preCT.String()
+		res.Filename = normalizedName(res.Filename, preCT)
+		data = content
+		res.MD5 = file.MD5Sum(data)
+		res.OriginalSize = int64(len(data))
+		res.MIME = file.DetectMIME(data, res.Filename)
+		preCT = compress.IsCompressedOrMIME(data, res.MIME)
 	}
-	wg.Wait()
-	c.JSON(http.StatusOK, gin.H{"results": results, "count": len(results)})
+	res.Filename = storedFilename(res.Filename, res.MD5)
+	key, err := objectKeyFor(res.MD5, opts.noDedup)
+	if err != nil {
+		res.Error = "store failed"
+		return
+	}
+	res.ObjectKey = recordObjectKey(key, res.MD5)
+	res.Charset = textCharset(res.MIME, data)
+	if perr := runPreStoreHooks(&preStoreInput{Filename: res.Filename, MIME: res.MIME, Size: res.OriginalSize, Open: bytesOpener(data)}); perr != nil {
+		res.Error = perr.Message
+		res.Details = perr.Details
+		return
+	}
+
+	if err := fsys.WriteObjectHashedWithMIME(key, data, res.MIME); err != nil {
+		res.Error = "store failed"
+		return
+	}
+	if vErr := fsys.VerifyHashedRegular(key); vErr != nil {
+		res.Error = "invalid stored object"
+		return
+	}
+	cs, err := fsys.GetHashedObjectSize(key)
+	if err != nil {
+		cs = res.OriginalSize
+	}
+	res.CompressedSize = cs
+	res.CompressionType = storedCompressionType(fsys, preCT, res.MIME)
+	if res.OriginalSize > 0 {
+		res.CompressionRatio = float64(res.CompressedSize) / float64(res.OriginalSize)
+	}
+
+	recordUploadResult(opts, db, res, key, data)
+}
+
+// recordUploadResult records a stored file of a multi-file upload and schedules its analyses and
+// thumbnail. head is the start of the content, enough for analysisKind.
+func recordUploadResult(opts storeOptions, db *gorm.DB, res *uploadResult, key string, head []byte) {
+	if db != nil {
+		rec := &FileRecord{
+			Filename:        res.Filename,
+			Size:            res.OriginalSize,
+			CompressedSize:  res.CompressedSize,
+			CompressionType: res.CompressionType,
+			MD5:             res.MD5,
+			MIME:            res.MIME,
+			Charset:         res.Charset,
+			WireEncoding:    res.WireEncoding,
+			ObjectKey:       res.ObjectKey,
+			AnalysisStatus:  "none",
+		}
+		kind := analysisKind(head, res.MIME)
+		if kind != "" && analysisTooLarge(res.OriginalSize) {
+			markAnalysisTooLarge(rec)
+		} else if kind != "" {
+			rec.AnalysisStatus = "pending"
+		}
+		applyRetention(rec)
+		if err := db.Create(rec).Error; err != nil {
+			logger.GetLogger().Error().Err(err).Str("filename", res.Filename).Msg("create file record failed")
+			res.Error = "record create failed"
+			return
+		}
+		statsOnCreate(db, rec)
+		enforceObjectsCap()
+		res.ID = rec.ID
+		res.RetainUntil = rec.RetainUntil
+		res.AnalysisStatus = rec.AnalysisStatus
+		if rec.AnalysisStatus == "pending" {
+			scheduleAnalysis(opts.ctx, kind, rec.ID, key)
+		}
+		scheduleThumbnail(rec.ID, key, res.MIME)
+	}
+
+	logger.GetLogger().Info().
+		Str("filename", res.Filename).
+		Str("hash", res.MD5).
+		Int64("original_size", res.OriginalSize).
+		Int64("compressed_size", res.CompressedSize).
+		Str("compression", res.CompressionType).
+		Str("mime", res.MIME).
+		Msg("file uploaded (" + opts.mode + ")")
+	countUpload(opts.mode, res.OriginalSize)
+}
+
+// storeSpooledResult is storeUploadResult for a file spooled to path, with res.MD5 and
+// res.OriginalSize already taken while spooling. The content is streamed into the store like
+// finishSpooledUpload does; only its first block is read, for MIME and analysis detection.
+func storeSpooledResult(opts storeOptions, fsys *fs.FileSystem, db *gorm.DB, res *uploadResult, path string) {
+	temp, err := os.Open(path)
+	if err != nil {
+		res.Error = "read failed"
+		return
+	}
+	defer func() { temp.Close() }()
+	// one tar block: enough for every detector, including the ustar magic at offset 257
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(temp, head)
+	res.MIME = file.DetectMIME(head[:n], res.Filename)
+	preCT := compress.IsCompressedOrMIME(head[:n], res.MIME)
+	if decoded, sum, size, ok := normalizeSpooled(fsys.GetObjectsPath(), res.Filename, temp, preCT); ok {
+		// the decoded copy replaces the spool, which the caller removes
+		temp.Close()
+		temp = decoded
+		defer os.Remove(decoded.Name())
+		res.WireEncoding = preCT.String()
+		res.Filename = normalizedName(res.Filename, preCT)
+		res.MD5, res.OriginalSize = sum, size
+		if _, err := temp.Seek(0, io.SeekStart); err != nil {
+			res.Error = "read failed"
+			return
+		}
+		n, _ = io.ReadFull(temp, head)
+		res.MIME = file.DetectMIME(head[:n], res.Filename)
+		preCT = compress.IsCompressedOrMIME(head[:n], res.MIME)
+	}
+	head = head[:n]
+	res.Filename = storedFilename(res.Filename, res.MD5)
+	key, err := objectKeyFor(res.MD5, opts.noDedup)
+	if err != nil {
+		res.Error = "store failed"
+		return
+	}
+	res.ObjectKey = recordObjectKey(key, res.MD5)
+	res.Charset = textCharset(res.MIME, head)
+	if perr := runPreStoreHooks(&preStoreInput{Filename: res.Filename, MIME: res.MIME, Size: res.OriginalSize, Open: fileOpener(temp.Name())}); perr != nil {
+		res.Error = perr.Message
+		res.Details = perr.Details
+		return
+	}
+
+	if err := commitSpooled(fsys, temp, key, preCT, res.MIME); err != nil {
+		res.Error = "store failed"
+		return
+	}
+	if vErr := fsys.VerifyHashedRegular(key); vErr != nil {
+		res.Error = "invalid stored object"
+		return
+	}
+	cs, err := fsys.GetHashedObjectSize(key)
+	if err != nil {
+		cs = res.OriginalSize
+	}
+	res.CompressedSize = cs
+	res.CompressionType = storedCompressionType(fsys, preCT, res.MIME)
+	if res.OriginalSize > 0 {
+		res.CompressionRatio = float64(res.CompressedSize) / float64(res.OriginalSize)
+	}
+	recordUploadResult(opts, db, res, key, head)
 }
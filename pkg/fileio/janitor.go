@@ -0,0 +1,95 @@
+package fileio
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/logger"
+)
+
+// tempPrefixes are the name prefixes of upload spool files created directly under the objects root
+var tempPrefixes = []string{"up-", "upc-", normalizeTempPrefix, chunkTempPrefix}
+
+// StartJanitor runs cleanup passes at the configured interval until ctx is cancelled
+func StartJanitor(ctx context.Context) {
+	jc := config.Get().Janitor
+	if !jc.Enabled || jc.IntervalSeconds <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(jc.IntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runJanitor(time.Now())
+			}
+		}
+	}()
+}
+
+// runJanitor removes stale temp files and resets analyses stuck in "pending", returning both counts
+func runJanitor(now time.Time) (tempRemoved int, pendingReset int64) {
+	jc := config.Get().Janitor
+	log := logger.GetLogger()
+	if fsys, err := fs.New(); err == nil {
+		cutoff := now.Add(-time.Duration(jc.TempMaxAgeSeconds) * time.Second)
+		// resumable uploads expire on their own TTL; only orphaned spool files are stale here
+		tempRemoved += pruneChunkSessions(now)
+		tempRemoved += removeStale(fsys.GetObjectsPath(), cutoff, func(name string) bool {
+			if strings.HasPrefix(name, chunkTempPrefix) && chunkTempLive(name) {
+				return false
+			}
+			for _, p := range tempPrefixes {
+				if strings.HasPrefix(name, p) {
+					return true
+				}
+			}
+			return false
+		})
+		// scratch space used by analyzers (see fs.OpenObjectHashed)
+		tempRemoved += removeStale(filepath.Join(fsys.GetRuntimePath(), "temp"), cutoff, func(string) bool { return true })
+	}
+	if db, err := ensureDB(); err == nil {
+		cutoff := now.Add(-time.Duration(jc.PendingTimeoutSeconds) * time.Second)
+		// "none" lets the next upload of the same content or a meta request schedule analysis again
+		res := db.Model(&FileRecord{}).Where("analysis_status = ? AND updated_at < ? AND pinned = ?", "pending", cutoff, false).
+			Update("analysis_status", "none")
+		if res.Error == nil {
+			pendingReset = res.RowsAffected
+		}
+	}
+	if tempRemoved > 0 || pendingReset > 0 {
+		log.Info().Int("temp_removed", tempRemoved).Int64("pending_reset", pendingReset).Msg("janitor pass")
+	}
+	return tempRemoved, pendingReset
+}
+
+// removeStale deletes regular files directly inside dir that match and were last modified before cutoff
+func removeStale(dir string, cutoff time.Time, match func(name string) bool) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	for _, e := range entries {
+		if e.IsDir() || !match(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if os.Remove(filepath.Join(dir, e.Name())) == nil {
+			removed++
+		}
+	}
+	return removed
+}
@@ -2,47 +2,109 @@ package fileio
 
 import (
 	"encoding/json"
-	iofs "io/fs"
 	"net/http"
-	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
+	"go4pack/pkg/common/config"
 	elfutil "go4pack/pkg/common/elf"
 	"go4pack/pkg/common/fs"
 	"go4pack/pkg/common/logger"
 )
 
+// listOrders maps the accepted ?order= values to ORDER BY clauses; id breaks ties so pages are stable
+var listOrders = map[string]string{
+	"size":        "size ASC, id ASC",
+	"-size":       "size DESC, id DESC",
+	"created_at":  "created_at ASC, id ASC",
+	"-created_at": "created_at DESC, id DESC",
+}
+
+// likeEscaper escapes LIKE wildcards so ?filename= matches its value literally
+var likeEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
+// listHandler pages through file records, newest first by default. Optional filters: filename
+// (substring), mime (exact), min_size/max_size (bytes, inclusive), analysis_status and the ELF
+// traits; total counts the filtered set.
 func listHandler(c *gin.Context) {
-	pageStr := c.DefaultQuery("page", "1")
-	pageSizeStr := c.DefaultQuery("page_size", "50")
-	page, _ := strconv.Atoi(pageStr)
-	pageSize, _ := strconv.Atoi(pageSizeStr)
+	lc := config.Get().List
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
 	if page <= 0 {
 		page = 1
 	}
 	if pageSize <= 0 {
-		pageSize = 50
+		pageSize = lc.DefaultPageSize
 	}
-	if pageSize > 500 {
-		pageSize = 500
+	if pageSize > lc.MaxPageSize {
+		pageSize = lc.MaxPageSize
 	}
 
 	db, err := ensureDB()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database init failed"})
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "database init failed")
+		return
+	}
+	query := db.Model(&FileRecord{})
+	// ELF characteristic filters, e.g. ?go_binary=true&static=false
+	for name, col := range elfTraitColumns {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, codeInvalidParam, "invalid "+name+" (expected true or false)")
+			return
+		}
+		query = query.Where(col+" = ?", b)
+	}
+	if name := c.Query("filename"); name != "" {
+		query = query.Where("filename LIKE ? ESCAPE '\\'", "%"+likeEscaper.Replace(name)+"%")
+	}
+	if mime := c.Query("mime"); mime != "" {
+		query = query.Where("mime = ?", mime)
+	}
+	if status := c.Query("analysis_status"); status != "" {
+		query = query.Where("analysis_status = ?", status)
+	}
+	// tag filters: ?tag_key=project matches any value, adding &tag_value=x narrows to one
+	if key, value := c.Query("tag_key"), c.Query("tag_value"); key != "" {
+		query = tagFilter(db, query, key, value)
+	} else if value != "" {
+		apiError(c, http.StatusBadRequest, codeInvalidParam, "tag_value requires tag_key")
+		return
+	}
+	for name, op := range map[string]string{"min_size": ">=", "max_size": "<="} {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			apiError(c, http.StatusBadRequest, codeInvalidParam, "invalid "+name+" (expected a non-negative integer)")
+			return
+		}
+		query = query.Where("size "+op+" ?", n)
+	}
+	order, ok := listOrders[c.DefaultQuery("order", "-created_at")]
+	if !ok {
+		apiError(c, http.StatusBadRequest, codeInvalidParam, "invalid order (expected size|-size|created_at|-created_at)")
 		return
 	}
 	var total int64
-	if err := db.Model(&FileRecord{}).Count(&total).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "count failed"})
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		apiError(c, http.StatusInternalServerError, codeQueryFailed, "count failed")
 		return
 	}
 	var files []FileRecord
 	offset := (page - 1) * pageSize
-	if err := db.Order("created_at DESC").Limit(pageSize).Offset(offset).Find(&files).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "query files failed"})
+	if err := query.Order(order).Limit(pageSize).Offset(offset).Find(&files).Error; err != nil {
+		apiError(c, http.StatusInternalServerError, codeQueryFailed, "query files failed")
 		return
 	}
 	resp := make([]gin.H, 0, len(files))
@@ -57,6 +119,12 @@ func listHandler(c *gin.Context) {
 		if isGzip {
 			avail = append(avail, "gzip")
 		}
+		if f.MIME == rpmMIME {
+			avail = append(avail, "rpm")
+		}
+		if f.MIME == tarMIME {
+			avail = append(avail, "tar")
+		}
 		resp = append(resp, gin.H{
 			"id":                 f.ID,
 			"filename":           f.Filename,
@@ -75,107 +143,93 @@ func listHandler(c *gin.Context) {
 	}
 	pages := (total + int64(pageSize) - 1) / int64(pageSize)
 	logger.GetLogger().Info().Int("count", len(files)).Int64("total", total).Int("page", page).Int("page_size", pageSize).Msg("files listed paginated")
-	c.JSON(http.StatusOK, gin.H{"files": resp, "count": len(files), "total": total, "page": page, "page_size": pageSize, "pages": pages})
+	c.JSON(http.StatusOK, gin.H{"files": resp, "count": len(files), "total": total, "page": page, "page_size": pageSize, "pages": pages, "default_page_size": lc.DefaultPageSize, "max_page_size": lc.MaxPageSize})
 }
 
 func statsHandler(c *gin.Context) {
 	db, err := ensureDB()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database init failed"})
-		return
-	}
-	var files []FileRecord
-	if err := db.Find(&files).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "query files failed"})
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "database init failed")
 		return
 	}
-	var totalOriginalSize, totalCompressedSize int64
-	compressionStats := make(map[string]int)
-	mimeStats := make(map[string]int)
-	uniqueHashSeen := make(map[string]struct{})
-	var uniqueCompressedSize int64
-	for _, file := range files {
-		totalOriginalSize += file.Size
-		totalCompressedSize += file.CompressedSize
-		compressionStats[file.CompressionType]++
-		mimeStats[file.MIME]++
-		if _, ok := uniqueHashSeen[file.MD5]; !ok {
-			uniqueHashSeen[file.MD5] = struct{}{}
-			uniqueCompressedSize += file.CompressedSize
+	sc, err := loadStatsCache(db)
+	if err != nil {
+		// first request (or cache lost): build it with a full scan
+		if sc, err = recomputeStats(db); err != nil {
+			apiError(c, http.StatusInternalServerError, codeQueryFailed, "query files failed")
+			return
 		}
 	}
-	var compressionRatio float64
-	if totalOriginalSize > 0 {
-		compressionRatio = float64(totalCompressedSize) / float64(totalOriginalSize)
-	}
-	spaceSaved := totalOriginalSize - totalCompressedSize
-	var spaceSavedPct float64
-	if totalOriginalSize > 0 {
-		spaceSavedPct = float64(spaceSaved) / float64(totalOriginalSize) * 100
-	}
-	physicalObjectsCount := 0
-	var physicalObjectsSize int64
-	if fsys, err := fs.New(); err == nil {
-		root := fsys.GetObjectsPath()
-		_ = filepath.WalkDir(root, func(path string, d iofs.DirEntry, err error) error {
-			if err != nil || d.IsDir() {
-				return nil
-			}
-			info, e := d.Info()
-			if e != nil {
-				return nil
-			}
-			physicalObjectsCount++
-			physicalObjectsSize += info.Size()
-			return nil
-		})
-	}
-	var dedupSavedCompressed int64 = totalCompressedSize - physicalObjectsSize
-	if dedupSavedCompressed < 0 {
-		dedupSavedCompressed = 0
-	}
-	var dedupSavedCompressedPct float64
-	if totalCompressedSize > 0 {
-		dedupSavedCompressedPct = float64(dedupSavedCompressed) / float64(totalCompressedSize) * 100
-	}
-	var dedupSavedOriginal int64 = totalOriginalSize - physicalObjectsSize
-	if dedupSavedOriginal < 0 {
-		dedupSavedOriginal = 0
+	resp := statsResponse(sc)
+	logger.GetLogger().Info().Int64("file_count", sc.FileCount).Int64("unique_hash_count", sc.UniqueHashCount).Int64("logical_original", sc.TotalOriginalSize).Int64("logical_compressed", sc.TotalCompressedSize).Int64("physical_compressed", sc.PhysicalObjectsSize).Interface("compression_ratio", resp["compression_ratio"]).Msg("compression & dedup stats requested")
+	c.JSON(http.StatusOK, resp)
+}
+
+// statsRecomputeHandler rebuilds the stats cache from a full table scan and objects walk to heal drift
+func statsRecomputeHandler(c *gin.Context) {
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "database init failed")
+		return
 	}
-	var dedupSavedOriginalPct float64
-	if totalOriginalSize > 0 {
-		dedupSavedOriginalPct = float64(dedupSavedOriginal) / float64(totalOriginalSize) * 100
+	sc, err := recomputeStats(db)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeQueryFailed, "query files failed")
+		return
 	}
-	logger.GetLogger().Info().Int("file_count", len(files)).Int("unique_hash_count", len(uniqueHashSeen)).Int64("logical_original", totalOriginalSize).Int64("logical_compressed", totalCompressedSize).Int64("physical_compressed", physicalObjectsSize).Float64("compression_ratio", compressionRatio).Msg("compression & dedup stats requested")
-	c.JSON(http.StatusOK, gin.H{"file_count": len(files), "unique_hash_count": len(uniqueHashSeen), "total_original_size": totalOriginalSize, "total_compressed_size": totalCompressedSize, "compression_ratio": compressionRatio, "space_saved": spaceSaved, "space_saved_percentage": spaceSavedPct, "compression_types": compressionStats, "mime_types": mimeStats, "unique_compressed_size": uniqueCompressedSize, "physical_objects_count": physicalObjectsCount, "physical_objects_size": physicalObjectsSize, "dedup_saved_compressed": dedupSavedCompressed, "dedup_saved_compr_pct": dedupSavedCompressedPct, "dedup_saved_original": dedupSavedOriginal, "dedup_saved_original_pct": dedupSavedOriginalPct})
+	logger.GetLogger().Info().Int64("file_count", sc.FileCount).Int64("physical_compressed", sc.PhysicalObjectsSize).Msg("stats cache recomputed")
+	c.JSON(http.StatusOK, statsResponse(sc))
 }
 
 func metaHandler(c *gin.Context) {
 	idParam := c.Param("id")
 	if idParam == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "id required"})
+		apiError(c, http.StatusBadRequest, codeInvalidParam, "id required")
 		return
 	}
 	db, err := ensureDB()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db init failed"})
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
 		return
 	}
 	var fr FileRecord
 	if err := db.First(&fr, idParam).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		apiError(c, http.StatusNotFound, codeFileNotFound, "file not found")
 		return
 	}
+	respondMeta(c, db, fr)
+}
 
-	reqType := c.Query("type") // "", "elf", "gzip"
-	if reqType != "" && reqType != "elf" && reqType != "gzip" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid type (expected elf|gzip)"})
+// metaByMD5Handler serves meta for the first (oldest) record referencing a content hash
+func metaByMD5Handler(c *gin.Context) {
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
+		return
+	}
+	var fr FileRecord
+	if err := db.Where("md5 = ?", strings.ToLower(c.Param("md5"))).Order("id").First(&fr).Error; err != nil {
+		apiError(c, http.StatusNotFound, codeFileNotFound, "file not found")
+		return
+	}
+	respondMeta(c, db, fr)
+}
+
+// respondMeta writes the meta response for fr, including ?type= analysis selection and
+// on-demand ELF analysis; shared by the id and md5 lookups.
+func respondMeta(c *gin.Context, db *gorm.DB, fr FileRecord) {
+	reqType := c.Query("type") // "", "elf", "gzip", "sqlite", "rpm", "tar"
+	if reqType != "" && reqType != "elf" && reqType != "gzip" && reqType != "sqlite" && reqType != "rpm" && reqType != "tar" {
+		apiError(c, http.StatusBadRequest, codeInvalidParam, "invalid type (expected elf|gzip|sqlite|rpm|tar)")
 		return
 	}
 
 	isGzip := fr.MIME == "application/gzip" || fr.MIME == "application/x-gzip"
+	isSQLite := fr.MIME == sqliteMIME
+	isRPM := fr.MIME == rpmMIME
+	isTarFile := fr.MIME == tarMIME
 	// We consider ELF if status not none (pending/done/error) or magic can be confirmed on demand
-	isELFStatus := fr.AnalysisStatus == "pending" || fr.AnalysisStatus == "done" || fr.AnalysisStatus == "error"
+	isELFStatus := !isSQLite && !isRPM && !isTarFile && (fr.AnalysisStatus == "pending" || fr.AnalysisStatus == "done" || fr.AnalysisStatus == "error")
 
 	// Decide target analysis type
 	var target string
@@ -184,6 +238,12 @@ func metaHandler(c *gin.Context) {
 	} else {
 		if isGzip {
 			target = "gzip"
+		} else if isSQLite {
+			target = "sqlite"
+		} else if isRPM {
+			target = "rpm"
+		} else if isTarFile {
+			target = "tar"
 		} else if isELFStatus {
 			target = "elf"
 		}
@@ -191,19 +251,31 @@ func metaHandler(c *gin.Context) {
 
 	// Validate compatibility if user requested a type mismatching file characteristics
 	if reqType == "gzip" && !isGzip {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file is not gzip"})
+		apiError(c, http.StatusBadRequest, codeTypeMismatch, "file is not gzip")
+		return
+	}
+	if reqType == "sqlite" && !isSQLite {
+		apiError(c, http.StatusBadRequest, codeTypeMismatch, "file is not a sqlite database")
+		return
+	}
+	if reqType == "rpm" && !isRPM {
+		apiError(c, http.StatusBadRequest, codeTypeMismatch, "file is not an rpm package")
+		return
+	}
+	if reqType == "tar" && !isTarFile {
+		apiError(c, http.StatusBadRequest, codeTypeMismatch, "file is not a tar archive")
 		return
 	}
 	if reqType == "elf" && !isELFStatus {
 		// we can still probe magic to upgrade
 		if fsys, ferr := fs.New(); ferr == nil {
-			if data, rerr := fsys.ReadObjectHashed(fr.MD5); rerr == nil && len(data) >= 4 &&
+			if data, rerr := fsys.ReadObjectHashed(fr.objectKey()); rerr == nil && len(data) >= 4 &&
 				data[0] == 0x7f && data[1] == 'E' && data[2] == 'L' && data[3] == 'F' {
 				isELFStatus = true
 			}
 		}
 		if !isELFStatus {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "file is not ELF"})
+			apiError(c, http.StatusBadRequest, codeTypeMismatch, "file is not ELF")
 			return
 		}
 	}
@@ -212,12 +284,21 @@ func metaHandler(c *gin.Context) {
 
 	// NEW: advertise available analyses
 	avail := []string{}
-	if fr.AnalysisStatus == "pending" || fr.AnalysisStatus == "done" || fr.AnalysisStatus == "error" {
+	if isELFStatus {
 		avail = append(avail, "elf")
 	}
 	if fr.MIME == "application/gzip" || fr.MIME == "application/x-gzip" {
 		avail = append(avail, "gzip")
 	}
+	if isSQLite {
+		avail = append(avail, "sqlite")
+	}
+	if isRPM {
+		avail = append(avail, "rpm")
+	}
+	if isTarFile {
+		avail = append(avail, "tar")
+	}
 	resp["available_analysis"] = avail
 
 	switch target {
@@ -227,22 +308,27 @@ func metaHandler(c *gin.Context) {
 		if err := db.Where("file_id = ?", fr.ID).First(&cache).Error; err == nil {
 			cacheFound = true
 		} else {
-			// On-demand compute if not error status
-			if fr.AnalysisStatus != "error" {
+			// On-demand compute if not error status (and analysis is enabled)
+			if fr.AnalysisStatus != "error" && analysisEnabled("elf") && !analysisTooLarge(fr.Size) {
 				if fsys, ferr := fs.New(); ferr == nil {
-					if data, rerr := fsys.ReadObjectHashed(fr.MD5); rerr == nil && len(data) >= 4 &&
+					if data, rerr := fsys.ReadObjectHashed(fr.objectKey()); rerr == nil && len(data) >= 4 &&
 						data[0] == 0x7f && data[1] == 'E' && data[2] == 'L' && data[3] == 'F' {
+						start := time.Now()
+						reqID := logger.RequestID(c.Request.Context())
 						if analysisMap, aerr := elfutil.AnalyzeBytes(data); aerr == nil {
 							if b, mErr := json.Marshal(analysisMap); mErr == nil {
+								logAnalysisCompleted("elf", fr.ID, reqID, start, len(data), len(b), "done", nil)
 								cache = ElfAnalyzeCached{FileID: fr.ID, Data: string(b)}
 								_ = db.Create(&cache).Error
 								if fr.AnalysisStatus != "done" {
 									_ = db.Model(&FileRecord{}).Where("id = ?", fr.ID).Update("analysis_status", "done").Error
 									fr.AnalysisStatus = "done"
 								}
+								recordELFTraits(db, fr.ID, analysisMap)
 								cacheFound = true
 							}
 						} else {
+							logAnalysisCompleted("elf", fr.ID, reqID, start, len(data), 0, "error", aerr)
 							msg := aerr.Error()
 							_ = db.Model(&FileRecord{}).Where("id = ?", fr.ID).
 								Updates(map[string]any{"analysis_status": "error", "analysis_error": msg})
@@ -254,7 +340,7 @@ func metaHandler(c *gin.Context) {
 		}
 		resp["analysis_type"] = "elf"
 		if cacheFound {
-			resp["analysis"] = json.RawMessage(cache.Data)
+			resp["analysis"] = elfAnalysisJSON(c, cache.Data)
 		} else {
 			resp["analysis"] = nil
 		}
@@ -267,6 +353,30 @@ func metaHandler(c *gin.Context) {
 			resp["analysis_type"] = "gzip"
 			resp["analysis"] = nil
 		}
+	case "sqlite":
+		var scache SqliteAnalyzeCached
+		resp["analysis_type"] = "sqlite"
+		if res := db.Where("file_id = ?", fr.ID).Limit(1).Find(&scache); res.Error == nil && res.RowsAffected > 0 {
+			resp["analysis"] = json.RawMessage(scache.Data)
+		} else {
+			resp["analysis"] = nil
+		}
+	case "rpm":
+		var rcache RpmAnalyzeCached
+		resp["analysis_type"] = "rpm"
+		if res := db.Where("file_id = ?", fr.ID).Limit(1).Find(&rcache); res.Error == nil && res.RowsAffected > 0 {
+			resp["analysis"] = json.RawMessage(rcache.Data)
+		} else {
+			resp["analysis"] = nil
+		}
+	case "tar":
+		var tcache TarAnalyzeCached
+		resp["analysis_type"] = "tar"
+		if res := db.Where("file_id = ?", fr.ID).Limit(1).Find(&tcache); res.Error == nil && res.RowsAffected > 0 {
+			resp["analysis"] = json.RawMessage(tcache.Data)
+		} else {
+			resp["analysis"] = nil
+		}
 	default:
 		// No analysis requested/detected
 		resp["analysis_type"] = nil
@@ -274,6 +384,12 @@ func metaHandler(c *gin.Context) {
 	}
 
 	resp["analysis_status"] = fr.AnalysisStatus
+	if tags := loadTags(db, fr.ID); len(tags) > 0 {
+		resp["tags"] = tags
+	}
+	if fr.AnalysisStatus == analysisSkippedTooLarge || (target != "" && resp["analysis"] == nil && analysisTooLarge(fr.Size)) {
+		resp["analysis_skipped_reason"] = analysisTooLargeReason(fr.Size)
+	}
 	c.JSON(http.StatusOK, resp)
 }
 
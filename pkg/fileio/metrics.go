@@ -0,0 +1,16 @@
+package fileio
+
+import "go4pack/pkg/common/metrics"
+
+var (
+	uploadsTotal      = metrics.NewCounterVec("go4pack_uploads_total", "Files stored, by upload endpoint.", "mode")
+	uploadBytesTotal  = metrics.NewCounterVec("go4pack_upload_bytes_total", "Original bytes of stored uploads, by upload endpoint.", "mode")
+	analysesTotal     = metrics.NewCounterVec("go4pack_analysis_total", "Completed content analyses by kind and outcome.", "kind", "status")
+	analysisDurations = metrics.NewHistogramVec("go4pack_analysis_duration_seconds", "Content analysis duration by kind.", nil, "kind")
+)
+
+// countUpload records one stored upload of size original bytes
+func countUpload(mode string, size int64) {
+	uploadsTotal.Inc(mode)
+	uploadBytesTotal.Add(float64(size), mode)
+}
@@ -5,6 +5,7 @@ import (
 
 	"gorm.io/gorm"
 
+	"go4pack/pkg/common/config"
 	"go4pack/pkg/common/database"
 )
 
@@ -17,11 +18,22 @@ type FileRecord struct {
 	CompressionType string         `json:"compression_type"` // Type of compression used
 	MD5             string         `json:"md5"`
 	MIME            string         `json:"mime"`
+	Charset         string         `json:"charset,omitempty"`       // Detected text encoding (text/* only)
+	WireEncoding    string         `json:"wire_encoding,omitempty"` // Upload encoding removed by normalization (e.g. gzip)
+	ObjectKey       string         `json:"object_key,omitempty"`    // Storage key of a non-deduplicated copy; empty means MD5
 	CreatedAt       time.Time      `json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
 	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
 	AnalysisStatus  string         `json:"analysis_status" gorm:"default:pending"`
 	AnalysisError   *string        `json:"analysis_error,omitempty"`
+	RetainUntil     *time.Time     `json:"retain_until,omitempty"`                  // Deletion refused before this time
+	Pinned          bool           `gorm:"not null;default:false" json:"pinned"`    // Exempt from deletion and cleanup passes
+	LastAccessedAt  *time.Time     `gorm:"index" json:"last_accessed_at,omitempty"` // Last download; nil until first access
+	// ELF characteristics copied from the analysis so listings can filter on them; nil until analyzed
+	ElfGoBinary *bool `gorm:"index" json:"elf_go_binary,omitempty"`
+	ElfStatic   *bool `gorm:"index" json:"elf_static,omitempty"`
+	ElfPIE      *bool `gorm:"index" json:"elf_pie,omitempty"`
+	ElfStripped *bool `gorm:"index" json:"elf_stripped,omitempty"`
 }
 
 // ElfAnalyzeCached stores cached ELF analysis JSON for a file
@@ -42,16 +54,88 @@ type GzipAnalyzeCached struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// ensureDB migrates and returns db (always AutoMigrate to add new columns)
+// SqliteAnalyzeCached stores cached SQLite database analysis JSON
+type SqliteAnalyzeCached struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	FileID    uint      `gorm:"uniqueIndex" json:"file_id"`
+	Data      string    `gorm:"type:text" json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RpmAnalyzeCached stores cached RPM package header analysis JSON
+type RpmAnalyzeCached struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	FileID    uint      `gorm:"uniqueIndex" json:"file_id"`
+	Data      string    `gorm:"type:text" json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TarAnalyzeCached stores cached analysis JSON of uncompressed tar archives
+type TarAnalyzeCached struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	FileID    uint      `gorm:"uniqueIndex" json:"file_id"`
+	Data      string    `gorm:"type:text" json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ThumbnailCached records the JPEG preview of an image upload. Hash keys the thumbnail object in
+// the thumb/ directory of the object store; Error is set instead when no preview could be made.
+type ThumbnailCached struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	FileID    uint      `gorm:"uniqueIndex" json:"file_id"`
+	Hash      string    `gorm:"index;size:32" json:"hash,omitempty"`
+	Width     int       `json:"width,omitempty"`
+	Height    int       `json:"height,omitempty"`
+	Error     *string   `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FileTag is a client-supplied key/value label of an upload, indexed for listing by tag
+type FileTag struct {
+	ID     uint   `gorm:"primaryKey" json:"-"`
+	FileID uint   `gorm:"index" json:"-"`
+	Key    string `gorm:"size:64;index:idx_file_tags_key_value" json:"key"`
+	Value  string `gorm:"size:256;index:idx_file_tags_key_value" json:"value"`
+}
+
+// TableName avoids gorm's default "sqlite_analyze_cacheds": SQLite reserves the "sqlite_" prefix
+func (SqliteAnalyzeCached) TableName() string { return "sqlitedb_analyze_cacheds" }
+
+// objectKey returns the key the record's object is stored under
+func (fr *FileRecord) objectKey() string {
+	if fr.ObjectKey != "" {
+		return fr.ObjectKey
+	}
+	return fr.MD5
+}
+
+// models are the tables owned by fileio, in migration order
+var models = []any{&FileRecord{}, &ElfAnalyzeCached{}, &GzipAnalyzeCached{}, &SqliteAnalyzeCached{}, &RpmAnalyzeCached{}, &TarAnalyzeCached{}, &UploadQuotaUsage{}, &StatsCache{}}
+
+func init() {
+	database.RegisterModels(models...)
+	database.RegisterModels(&ThumbnailCached{}, &FileTag{})
+	database.RegisterMigrations(
+		database.Migration{ID: "0001_fileio_models", Models: models},
+		database.Migration{ID: "0002_thumbnails", Models: []any{&ThumbnailCached{}}},
+		database.Migration{ID: "0003_file_tags", Models: []any{&FileTag{}}},
+		// records used to be soft-deleted, leaving their filenames taken for good
+		database.Migration{ID: "0004_purge_deleted_records", Run: func(tx *gorm.DB) error {
+			return tx.Unscoped().Where("deleted_at IS NOT NULL").Delete(&FileRecord{}).Error
+		}},
+	)
+}
+
+// ensureDB returns the database, opening it on first use; Init applies the registered migrations
+// so handlers no longer AutoMigrate per request
 func ensureDB() (*gorm.DB, error) {
 	if db := database.Get(); db != nil {
-		_ = db.AutoMigrate(&FileRecord{}, &ElfAnalyzeCached{}, &GzipAnalyzeCached{})
 		return db, nil
 	}
-	db, err := database.Init("filemeta.db", &FileRecord{}, &ElfAnalyzeCached{}, &GzipAnalyzeCached{})
-	if err != nil {
-		return nil, err
-	}
-	_ = db.AutoMigrate(&FileRecord{}, &ElfAnalyzeCached{}, &GzipAnalyzeCached{})
-	return db, nil
+	c := config.Get().Database
+	return database.InitWithConfig(database.Config{Driver: c.Driver, DSN: c.DSN, Name: c.Name})
 }
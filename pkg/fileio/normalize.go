@@ -0,0 +1,103 @@
+package fileio
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+
+	"go4pack/pkg/common/compress"
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/logger"
+)
+
+// normalizeUpload decodes a gzip/zstd upload so it is hashed and stored by its logical content.
+// ok is false when normalization is disabled, the data is not compressed, decoding fails, or the
+// decoded size exceeds Upload.NormalizeMaxBytes (decompression bomb guard); callers then store
+// the upload as sent.
+func normalizeUpload(filename string, data []byte, preCT compress.CompressionType) (content []byte, ok bool) {
+	uc := config.Get().Upload
+	if !uc.NormalizeCompressed || preCT == compress.None {
+		return nil, false
+	}
+	r, err := compress.NewReader(preCT, bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	defer r.Close()
+	limit := uc.NormalizeMaxBytes
+	if limit <= 0 {
+		return nil, false
+	}
+	content, err = io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		logger.GetLogger().Debug().Err(err).Str("filename", filename).Msg("normalize: decode failed, storing as sent")
+		return nil, false
+	}
+	if int64(len(content)) > limit {
+		logger.GetLogger().Warn().Str("filename", filename).Int64("limit", limit).Msg("normalize: decoded size exceeds limit, storing as sent")
+		return nil, false
+	}
+	return content, true
+}
+
+// normalizeTempPrefix names the decoded copies of spooled uploads in the objects directory
+const normalizeTempPrefix = "upn-"
+
+// normalizeSpooled is normalizeUpload for an upload spooled to temp: it stream-decodes temp into a
+// new file in dir while hashing it, so the decoded content never has to fit in memory. On success
+// the caller owns out and temp is left untouched; otherwise out is nil.
+func normalizeSpooled(dir, filename string, temp *os.File, preCT compress.CompressionType) (out *os.File, md5sum string, size int64, ok bool) {
+	uc := config.Get().Upload
+	limit := uc.NormalizeMaxBytes
+	if !uc.NormalizeCompressed || preCT == compress.None || limit <= 0 {
+		return nil, "", 0, false
+	}
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return nil, "", 0, false
+	}
+	r, err := compress.NewReader(preCT, temp)
+	if err != nil {
+		return nil, "", 0, false
+	}
+	defer r.Close()
+	out, err = os.CreateTemp(dir, normalizeTempPrefix+"*")
+	if err != nil {
+		return nil, "", 0, false
+	}
+	h := md5.New()
+	size, err = io.Copy(io.MultiWriter(out, h), io.LimitReader(r, limit+1))
+	if err == nil && size > limit {
+		logger.GetLogger().Warn().Str("filename", filename).Int64("limit", limit).Msg("normalize: decoded size exceeds limit, storing as sent")
+	} else if err != nil {
+		logger.GetLogger().Debug().Err(err).Str("filename", filename).Msg("normalize: decode failed, storing as sent")
+	}
+	if err != nil || size > limit {
+		out.Close()
+		_ = os.Remove(out.Name())
+		return nil, "", 0, false
+	}
+	return out, hex.EncodeToString(h.Sum(nil)), size, true
+}
+
+// wireSuffixes maps the file extensions of each upload encoding to what they stand for once
+// decoded ("" drops the extension)
+var wireSuffixes = map[compress.CompressionType][][2]string{
+	compress.Gzip: {{".tgz", ".tar"}, {".gz", ""}, {".gzip", ""}},
+	compress.Zstd: {{".tzst", ".tar"}, {".zst", ""}, {".zstd", ""}},
+}
+
+// normalizedName renames a normalized upload after its decoded content, so foo.txt.gz is stored
+// and served as foo.txt rather than plain text under a .gz name. Names without a matching
+// extension are kept.
+func normalizedName(name string, preCT compress.CompressionType) string {
+	lower := strings.ToLower(name)
+	for _, s := range wireSuffixes[preCT] {
+		if strings.HasSuffix(lower, s[0]) && len(name) > len(s[0]) {
+			return name[:len(name)-len(s[0])] + s[1]
+		}
+	}
+	return name
+}
@@ -0,0 +1,123 @@
+package fileio
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/compress"
+	"go4pack/pkg/common/fs"
+)
+
+// objectHeadLen is enough leading bytes for every registered codec's magic
+const objectHeadLen = 16
+
+// objectState is what the storage layer sees for one object key
+type objectState struct {
+	onDisk   bool
+	size     int64
+	detected string
+}
+
+// statObject reads the size and leading bytes of the object stored under key
+func statObject(fsys *fs.FileSystem, key string) (objectState, error) {
+	onDisk, err := fsys.HashedObjectExists(key)
+	if err != nil || !onDisk {
+		return objectState{}, err
+	}
+	size, err := fsys.GetHashedObjectSize(key)
+	if err != nil {
+		return objectState{}, err
+	}
+	head, err := fsys.ReadHashedObjectHead(key, objectHeadLen)
+	if err != nil {
+		return objectState{}, err
+	}
+	return objectState{onDisk: true, size: size, detected: compress.IsCompressed(head).String()}, nil
+}
+
+// objectInfoHandler reports what the storage layer sees for a hashed object next to what the
+// records referencing it claim, so DB/disk drift (e.g. a record saying zstd over gzip bytes) is
+// visible. Records stored with X-No-Dedup are checked against their own salted copy. header is
+// reserved for self-describing object headers and is null until they exist.
+func objectInfoHandler(c *gin.Context) {
+	md5v, ok := md5Param(c)
+	if !ok {
+		return
+	}
+	fsys, err := fs.New()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
+		return
+	}
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
+		return
+	}
+	var records []FileRecord
+	if err := db.Where("md5 = ?", md5v).Order("id").Find(&records).Error; err != nil {
+		apiError(c, http.StatusInternalServerError, codeLookupFailed, "lookup failed")
+		return
+	}
+	states := map[string]objectState{}
+	for _, key := range append([]string{md5v}, recordKeys(records)...) {
+		if _, seen := states[key]; seen {
+			continue
+		}
+		st, err := statObject(fsys, key)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, codeReadFailed, "stat failed")
+			return
+		}
+		states[key] = st
+	}
+	shared := states[md5v]
+	if !shared.onDisk && len(records) == 0 {
+		apiError(c, http.StatusNotFound, codeObjectNotFound, "object not found")
+		return
+	}
+
+	resp := gin.H{"md5": md5v, "on_disk": shared.onDisk, "header": nil}
+	if shared.onDisk {
+		resp["on_disk_size"] = shared.size
+		resp["detected_codec"] = shared.detected
+	}
+	refs := make([]gin.H, 0, len(records))
+	drift := false
+	// a stored object nobody references, or a record whose object is gone, is drift too
+	unreferenced := shared.onDisk
+	for _, fr := range records {
+		st := states[fr.objectKey()]
+		mismatch := st.onDisk && fr.CompressionType != st.detected
+		drift = drift || mismatch || !st.onDisk
+		if fr.ObjectKey == "" {
+			unreferenced = false
+		}
+		ref := gin.H{
+			"id":               fr.ID,
+			"filename":         fr.Filename,
+			"compression_type": fr.CompressionType,
+			"compressed_size":  fr.CompressedSize,
+			"on_disk":          st.onDisk,
+			"codec_mismatch":   mismatch,
+		}
+		if fr.ObjectKey != "" {
+			ref["object_key"] = fr.ObjectKey
+			ref["detected_codec"] = st.detected
+		}
+		refs = append(refs, ref)
+	}
+	resp["records"] = refs
+	resp["drift"] = drift || unreferenced
+	c.JSON(http.StatusOK, resp)
+}
+
+// recordKeys returns the object key of every record
+func recordKeys(records []FileRecord) []string {
+	keys := make([]string, len(records))
+	for i, fr := range records {
+		keys[i] = fr.objectKey()
+	}
+	return keys
+}
@@ -0,0 +1,68 @@
+package fileio
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/logger"
+	"go4pack/pkg/common/worker"
+)
+
+// compressOffload reports whether this upload's compression runs on the worker pool: the
+// X-Compress-Offload header ("true"/"false") wins over the global upload.compress_offload.
+func compressOffload(c *gin.Context) bool {
+	if v, err := strconv.ParseBool(c.GetHeader("X-Compress-Offload")); err == nil {
+		return v
+	}
+	return config.Get().Upload.CompressOffload
+}
+
+// storeObject compresses and writes data under md5sum, verifies it and returns the stored size.
+// invalid reports a failed verification, after which the object has already been removed.
+func storeObject(fsys *fs.FileSystem, md5sum string, data []byte, mimeType string) (size int64, invalid bool, err error) {
+	if err := fsys.WriteObjectHashedWithMIME(md5sum, data, mimeType); err != nil {
+		return 0, false, err
+	}
+	if err := fsys.VerifyHashedRegular(md5sum); err != nil {
+		_ = fsys.DeleteObjectHashed(md5sum)
+		return 0, true, err
+	}
+	size, err = fsys.GetHashedObjectSize(md5sum)
+	if err != nil {
+		logger.GetLogger().Warn().Err(err).Str("hash", md5sum).Msg("failed to get compressed size")
+		size = int64(len(data))
+	}
+	return size, false, nil
+}
+
+// offloadStore writes an already recorded upload on the worker pool and then runs then (e.g. to
+// schedule analyses that read the stored object). When the pool is saturated the write runs
+// inline instead, so a burst of uploads is slowed down rather than queued without bound; err is
+// only reported for such an inline write.
+func offloadStore(db *gorm.DB, fsys *fs.FileSystem, rec *FileRecord, data []byte, then func()) (pooled bool, err error) {
+	if err := worker.Submit(func() { _ = finishOffloadedStore(db, fsys, rec, data, then) }); err == nil {
+		return true, nil
+	}
+	return false, finishOffloadedStore(db, fsys, rec, data, then)
+}
+
+// finishOffloadedStore stores the object for rec, then fills in its compressed size and folds it
+// into the stats. A failed write removes the record so it never points at a missing object.
+func finishOffloadedStore(db *gorm.DB, fsys *fs.FileSystem, rec *FileRecord, data []byte, then func()) error {
+	size, _, err := storeObject(fsys, rec.objectKey(), data, rec.MIME)
+	if err != nil {
+		logger.GetLogger().Error().Err(err).Uint("record_id", rec.ID).Str("hash", rec.MD5).Msg("offloaded store failed")
+		db.Unscoped().Delete(&FileRecord{}, rec.ID)
+		return err
+	}
+	rec.CompressedSize = size
+	db.Model(&FileRecord{}).Where("id = ?", rec.ID).Update("compressed_size", size)
+	statsOnCreate(db, rec)
+	enforceObjectsCap()
+	then()
+	return nil
+}
@@ -0,0 +1,57 @@
+package fileio
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/config"
+)
+
+// multipartSlack is subtracted from Content-Length before the early quota check to allow for
+// multipart boundaries and part headers, so uploads that fit exactly are not rejected up front.
+const multipartSlack = 1024
+
+// uploadPrecheck validates an upload from its headers alone, before any body byte is read.
+// net/http only answers "Expect: 100-continue" with 100 Continue once the handler first reads the
+// body, so aborting here sends the 4xx instead and the client never streams the payload. The body
+// is then capped at Upload.MaxBytes as well, so a chunked request or one understating its
+// Content-Length is cut off there and answered with 413 by the handler.
+func uploadPrecheck(c *gin.Context) {
+	if ct := c.GetHeader("Content-Type"); !strings.HasPrefix(ct, "multipart/form-data") {
+		apiError(c, http.StatusBadRequest, codeInvalidMultipart, "multipart/form-data required")
+		c.Abort()
+		return
+	}
+	declared := c.Request.ContentLength
+	if max := config.Get().Upload.MaxBytes; max > 0 {
+		if declared > max {
+			apiErrorWith(c, http.StatusRequestEntityTooLarge, codeUploadTooLarge, "upload too large", gin.H{"max_bytes": max})
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+	}
+	if declared > 0 {
+		// the declared length includes multipart framing; the handler re-checks with exact sizes
+		if remaining, ok := checkQuota(c, declared-multipartSlack); !ok {
+			rejectQuota(c, remaining)
+			c.Abort()
+			return
+		}
+	}
+	c.Next()
+}
+
+// rejectBodyTooLarge writes a 413 and returns true when err comes from a request body cut off by
+// the server's body size limit (restful.MaxBodyBytes), which a chunked upload only hits mid-read
+func rejectBodyTooLarge(c *gin.Context, err error) bool {
+	var mbe *http.MaxBytesError
+	if !errors.As(err, &mbe) {
+		return false
+	}
+	apiErrorWith(c, http.StatusRequestEntityTooLarge, codeUploadTooLarge, "request body too large", gin.H{"max_bytes": mbe.Limit})
+	return true
+}
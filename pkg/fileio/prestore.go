@@ -0,0 +1,131 @@
+package fileio
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/jsonschema"
+	"go4pack/pkg/common/logger"
+)
+
+// preStoreInput describes an upload that has been received and sniffed but not yet stored
+type preStoreInput struct {
+	Filename string
+	MIME     string
+	Size     int64
+	// Open returns a fresh reader over the full upload content
+	Open func() (io.ReadCloser, error)
+}
+
+// preStoreError rejects an upload before it is stored
+type preStoreError struct {
+	Status  int
+	Code    string // error code of the response, codeUploadRejected when empty
+	Message string
+	Details []string
+}
+
+func (e *preStoreError) Error() string { return e.Message }
+
+// preStoreHook inspects an upload before it is stored; a non-nil error rejects it
+type preStoreHook func(in *preStoreInput) *preStoreError
+
+// preStoreHooks run in order for every upload path (buffered, multi and stream)
+var preStoreHooks = []preStoreHook{jsonSchemaHook}
+
+// runPreStoreHooks returns the first rejection, or nil when every hook accepts the upload
+func runPreStoreHooks(in *preStoreInput) *preStoreError {
+	for _, hook := range preStoreHooks {
+		if err := hook(in); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rejectPreStore writes the response for an upload refused by a pre-store hook
+func rejectPreStore(c *gin.Context, e *preStoreError) {
+	code := e.Code
+	if code == "" {
+		code = codeUploadRejected
+	}
+	var extra gin.H
+	if len(e.Details) > 0 {
+		extra = gin.H{"details": e.Details}
+	}
+	apiErrorWith(c, e.Status, code, e.Message, extra)
+}
+
+// bytesOpener adapts an in-memory upload to preStoreInput.Open
+func bytesOpener(data []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+}
+
+// fileOpener adapts a spooled upload to preStoreInput.Open
+func fileOpener(path string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+}
+
+var (
+	schemaMu     sync.Mutex
+	schemaPath   string
+	schemaCached *jsonschema.Schema
+)
+
+// uploadSchema returns the compiled deployment schema, or nil when none is configured.
+// The compiled schema is cached until the configured path changes.
+func uploadSchema() (*jsonschema.Schema, error) {
+	path := config.Get().Upload.JSONSchemaPath
+	if path == "" {
+		return nil, nil
+	}
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+	if schemaCached != nil && schemaPath == path {
+		return schemaCached, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := jsonschema.Compile(data)
+	if err != nil {
+		return nil, err
+	}
+	schemaPath, schemaCached = path, s
+	return s, nil
+}
+
+// jsonSchemaHook validates application/json uploads against the configured schema
+func jsonSchemaHook(in *preStoreInput) *preStoreError {
+	if in.MIME != "application/json" {
+		return nil
+	}
+	schema, err := uploadSchema()
+	if err != nil {
+		logger.GetLogger().Error().Err(err).Str("path", config.Get().Upload.JSONSchemaPath).Msg("load upload schema failed")
+		return &preStoreError{Status: http.StatusInternalServerError, Code: codeSchemaUnavailable, Message: "schema unavailable"}
+	}
+	if schema == nil {
+		return nil
+	}
+	r, err := in.Open()
+	if err != nil {
+		return &preStoreError{Status: http.StatusInternalServerError, Code: codeReadFailed, Message: "read failed"}
+	}
+	defer r.Close()
+	if errs := schema.ValidateReader(r); len(errs) > 0 {
+		return &preStoreError{Status: http.StatusUnprocessableEntity, Code: codeSchemaInvalid, Message: "schema validation failed", Details: errs}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package fileio
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/logger"
+	"go4pack/pkg/common/restful"
+)
+
+// UploadQuotaUsage records bytes accepted from a client; rows inside the quota window are summed
+type UploadQuotaUsage struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ClientKey string    `gorm:"index;size:255" json:"client_key"`
+	Bytes     int64     `json:"bytes"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// quotaClientKey identifies the uploader: the API key it authenticated with when auth is on,
+// otherwise its IP. The X-API-Key header alone is never trusted, as any client could rotate it to
+// get a fresh quota.
+func quotaClientKey(c *gin.Context) string {
+	if id := restful.AuthIdentity(c); id != "" {
+		return id
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// quotaRemaining returns the bytes the client may still upload in the current window.
+// enabled is false when quotas are switched off (remaining is then meaningless).
+func quotaRemaining(c *gin.Context) (remaining int64, enabled bool) {
+	qc := config.Get().Quota
+	if !qc.Enabled {
+		return 0, false
+	}
+	db, err := ensureDB()
+	if err != nil {
+		// fail open: storage should not become unavailable because accounting is
+		return qc.MaxBytes, true
+	}
+	used, err := quotaUsed(db, quotaClientKey(c), qc.WindowSeconds)
+	if err != nil {
+		logger.GetLogger().Warn().Err(err).Msg("quota usage lookup failed")
+		return qc.MaxBytes, true
+	}
+	return max(qc.MaxBytes-used, 0), true
+}
+
+// quotaUsed sums the bytes charged to clientKey inside the window
+func quotaUsed(db *gorm.DB, clientKey string, windowSeconds int) (int64, error) {
+	since := time.Now().Add(-time.Duration(windowSeconds) * time.Second)
+	var used int64
+	err := db.Model(&UploadQuotaUsage{}).
+		Where("client_key = ? AND created_at > ?", clientKey, since).
+		Select("COALESCE(SUM(bytes), 0)").Scan(&used).Error
+	return used, err
+}
+
+// checkQuota reports whether size more bytes fit in the client's quota, with the remaining figure.
+// It only screens requests early from declared sizes; bytes are charged by reserveQuota.
+func checkQuota(c *gin.Context, size int64) (remaining int64, ok bool) {
+	remaining, enabled := quotaRemaining(c)
+	if !enabled {
+		return 0, true
+	}
+	return remaining, size <= remaining
+}
+
+// errQuotaExceeded rolls back a reservation that does not fit
+var errQuotaExceeded = errors.New("upload quota exceeded")
+
+// quotaMu serializes reservations, so two uploads cannot both claim the same remaining bytes
+var quotaMu sync.Mutex
+
+// quotaReservation holds bytes charged to a client's quota ahead of storing an upload. The zero
+// value (quotas off, or nothing charged) holds nothing.
+type quotaReservation struct {
+	id uint
+}
+
+// reserveQuota charges size bytes to the client's quota if they fit. The usage row is inserted and
+// the window re-summed in one transaction, rolled back when the total overruns the quota, so
+// concurrent uploads cannot each pass a check and then together exceed it. remaining is what is
+// left after the reservation, or before it when ok is false. Callers release the reservation when
+// the upload then fails.
+func reserveQuota(c *gin.Context, size int64) (res quotaReservation, remaining int64, ok bool) {
+	qc := config.Get().Quota
+	if !qc.Enabled {
+		return res, 0, true
+	}
+	if size <= 0 {
+		remaining, _ = quotaRemaining(c)
+		return res, remaining, true
+	}
+	db, err := ensureDB()
+	if err != nil {
+		return res, qc.MaxBytes, true
+	}
+	clientKey := quotaClientKey(c)
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		row := UploadQuotaUsage{ClientKey: clientKey, Bytes: size}
+		if err := tx.Create(&row).Error; err != nil {
+			return err
+		}
+		used, err := quotaUsed(tx, clientKey, qc.WindowSeconds)
+		if err != nil {
+			return err
+		}
+		if used > qc.MaxBytes {
+			remaining = max(qc.MaxBytes-(used-size), 0)
+			return errQuotaExceeded
+		}
+		res.id, remaining = row.ID, qc.MaxBytes-used
+		return nil
+	})
+	if errors.Is(err, errQuotaExceeded) {
+		return quotaReservation{}, remaining, false
+	}
+	if err != nil {
+		logger.GetLogger().Warn().Err(err).Msg("quota reservation failed")
+		return quotaReservation{}, qc.MaxBytes, true
+	}
+	return res, remaining, true
+}
+
+// release returns the reserved bytes to the quota
+func (r quotaReservation) release() {
+	if r.id == 0 {
+		return
+	}
+	if db, err := ensureDB(); err == nil {
+		_ = db.Delete(&UploadQuotaUsage{}, r.id).Error
+	}
+}
+
+// rejectQuota writes the standard 429 response for an upload exceeding the client's quota
+func rejectQuota(c *gin.Context, remaining int64) {
+	apiErrorWith(c, http.StatusTooManyRequests, codeQuotaExceeded, "upload quota exceeded", gin.H{"quota_remaining": remaining})
+}
@@ -0,0 +1,133 @@
+package fileio
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// objectETag is the strong validator for a record's content: objects are content addressed
+func objectETag(fr *FileRecord) string {
+	return `"` + fr.MD5 + `"`
+}
+
+// serveObject writes a downloaded object with validators, answering 304 to a matching
+// If-None-Match or If-Modified-Since, and honouring a single-range Range header (206) and
+// If-Range: a range is only served when If-Range, if present, matches the current ETag or
+// Last-Modified, otherwise the full body is sent so a stale partial download restarts.
+// Last-Modified is the upload time rather than UpdatedAt: the content never changes, while
+// UpdatedAt moves with analysis status and pinning.
+// Multi-range requests are answered with the full body.
+// Objects are stored compressed, so data is the whole decompressed payload and a range is a slice
+// of it: serving the last byte of a large file costs its full size in memory. Seekable (framed)
+// decompression would let ranges read only the frames they cover; that is left as a follow-up.
+func serveObject(c *gin.Context, fr *FileRecord, data []byte) {
+	size := int64(len(data))
+	modified := fr.CreatedAt.UTC().Truncate(time.Second)
+	c.Header("ETag", objectETag(fr))
+	c.Header("Last-Modified", modified.Format(http.TimeFormat))
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("Content-Type", fr.MIME)
+
+	if notModified(c, fr, modified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if rh := c.GetHeader("Range"); rh != "" && ifRangeMatches(c.GetHeader("If-Range"), fr, modified) {
+		start, end, ok := parseByteRange(rh, size)
+		if !ok {
+			c.Header("Content-Range", fmt.Sprintf("bytes */%d", size))
+			c.Status(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if start >= 0 {
+			c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+			c.Header("Content-Length", strconv.FormatInt(end-start+1, 10))
+			c.Status(http.StatusPartialContent)
+			writeBody(c, fr.objectKey(), data[start:end+1])
+			return
+		}
+	}
+	c.Header("Content-Length", strconv.FormatInt(size, 10))
+	c.Status(http.StatusOK)
+	writeBody(c, fr.objectKey(), data)
+}
+
+// notModified evaluates the cache validators of a GET/HEAD: If-None-Match (weak comparison, any
+// listed tag or "*") takes precedence, and If-Modified-Since is only consulted without it
+func notModified(c *gin.Context, fr *FileRecord, modified time.Time) bool {
+	if m := c.Request.Method; m != http.MethodGet && m != http.MethodHead {
+		return false
+	}
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		etag := objectETag(fr)
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	t, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	return err == nil && !modified.After(t)
+}
+
+// ifRangeMatches reports whether a Range may be honoured: no If-Range, a strong ETag equal to the
+// current one, or an HTTP date equal to Last-Modified
+func ifRangeMatches(ifRange string, fr *FileRecord, modified time.Time) bool {
+	ifRange = strings.TrimSpace(ifRange)
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		// weak validators never match for If-Range
+		return ifRange == objectETag(fr)
+	}
+	t, err := http.ParseTime(ifRange)
+	return err == nil && t.Equal(modified)
+}
+
+// parseByteRange parses a single "bytes=" range against size. ok is false when the range is
+// unsatisfiable; start is -1 when the header should be ignored (malformed or multiple ranges).
+func parseByteRange(h string, size int64) (start, end int64, ok bool) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(h), "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return -1, -1, true
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return -1, -1, true
+	}
+	if first == "" {
+		// suffix range: the last N bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return -1, -1, true
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false
+		}
+		return max(size-n, 0), size - 1, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return -1, -1, true
+	}
+	if start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if last != "" {
+		e, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || e < start {
+			return -1, -1, true
+		}
+		end = min(e, size-1)
+	}
+	return start, end, true
+}
@@ -0,0 +1,185 @@
+package fileio
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"go4pack/pkg/common/fs"
+)
+
+// StatsCache holds incrementally maintained storage statistics (single row, ID 1).
+// Counters are adjusted on upload/delete; POST /stats/recompute rebuilds them from scratch.
+type StatsCache struct {
+	ID                   uint      `gorm:"primaryKey" json:"-"`
+	FileCount            int64     `json:"file_count"`
+	UniqueHashCount      int64     `json:"unique_hash_count"`
+	TotalOriginalSize    int64     `json:"total_original_size"`
+	TotalCompressedSize  int64     `json:"total_compressed_size"`
+	UniqueCompressedSize int64     `json:"unique_compressed_size"`
+	PhysicalObjectsCount int64     `json:"physical_objects_count"`
+	PhysicalObjectsSize  int64     `json:"physical_objects_size"`
+	CompressionTypes     string    `gorm:"type:text" json:"-"` // JSON map[string]int
+	MIMETypes            string    `gorm:"type:text" json:"-"` // JSON map[string]int
+	RecomputedAt         time.Time `json:"recomputed_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+const statsCacheID = 1
+
+// statsMu serializes read-modify-write cycles on the cache row
+var statsMu sync.Mutex
+
+// loadStatsCache returns the cached stats row (gorm.ErrRecordNotFound until first recompute)
+func loadStatsCache(db *gorm.DB) (*StatsCache, error) {
+	var sc StatsCache
+	if err := db.First(&sc, statsCacheID).Error; err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// recomputeStats rebuilds the cache from a full table scan plus a walk of the stored objects
+func recomputeStats(db *gorm.DB) (*StatsCache, error) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	var files []FileRecord
+	if err := db.Find(&files).Error; err != nil {
+		return nil, err
+	}
+	sc := &StatsCache{ID: statsCacheID, RecomputedAt: time.Now().UTC()}
+	compressionStats := make(map[string]int)
+	mimeStats := make(map[string]int)
+	uniqueHashSeen := make(map[string]struct{})
+	for _, file := range files {
+		sc.FileCount++
+		sc.TotalOriginalSize += file.Size
+		sc.TotalCompressedSize += file.CompressedSize
+		compressionStats[file.CompressionType]++
+		mimeStats[file.MIME]++
+		if _, ok := uniqueHashSeen[file.MD5]; !ok {
+			uniqueHashSeen[file.MD5] = struct{}{}
+			sc.UniqueCompressedSize += file.CompressedSize
+		}
+	}
+	sc.UniqueHashCount = int64(len(uniqueHashSeen))
+	if fsys, err := fs.New(); err == nil {
+		_ = fsys.WalkObjects(func(_ string, info os.FileInfo) error {
+			sc.PhysicalObjectsCount++
+			sc.PhysicalObjectsSize += info.Size()
+			return nil
+		})
+	}
+	setStatsMaps(sc, compressionStats, mimeStats)
+	if err := db.Save(sc).Error; err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// statsOnCreate folds a newly created record into the cache; no-op until the cache has been built
+func statsOnCreate(db *gorm.DB, rec *FileRecord) {
+	adjustStats(db, rec, 1)
+}
+
+// statsOnDelete removes a deleted record from the cache; objectRemoved reports a physical delete
+func statsOnDelete(db *gorm.DB, rec *FileRecord, objectRemoved bool) {
+	adjustStats(db, rec, -1)
+	if !objectRemoved {
+		return
+	}
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	db.Model(&StatsCache{}).Where("id = ?", statsCacheID).Updates(map[string]any{
+		"physical_objects_count": gorm.Expr("physical_objects_count - 1"),
+		"physical_objects_size":  gorm.Expr("physical_objects_size - ?", rec.CompressedSize),
+	})
+}
+
+// adjustStats applies a +1/-1 delta for rec. Uniqueness is judged by the number of live records
+// sharing the hash after the change, so it must run after the record was created/deleted.
+func adjustStats(db *gorm.DB, rec *FileRecord, delta int64) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	sc, err := loadStatsCache(db)
+	if err != nil {
+		return
+	}
+	sc.FileCount += delta
+	sc.TotalOriginalSize += delta * rec.Size
+	sc.TotalCompressedSize += delta * rec.CompressedSize
+	var sameHash int64
+	db.Model(&FileRecord{}).Where("md5 = ?", rec.MD5).Count(&sameHash)
+	if (delta > 0 && sameHash == 1) || (delta < 0 && sameHash == 0) {
+		sc.UniqueHashCount += delta
+		sc.UniqueCompressedSize += delta * rec.CompressedSize
+	}
+	// a first reference, or a copy stored without dedup, means a newly written physical object
+	if delta > 0 && (sameHash == 1 || rec.ObjectKey != "") {
+		sc.PhysicalObjectsCount++
+		sc.PhysicalObjectsSize += rec.CompressedSize
+	}
+	compressionStats, mimeStats := getStatsMaps(sc)
+	compressionStats[rec.CompressionType] += int(delta)
+	if compressionStats[rec.CompressionType] <= 0 {
+		delete(compressionStats, rec.CompressionType)
+	}
+	mimeStats[rec.MIME] += int(delta)
+	if mimeStats[rec.MIME] <= 0 {
+		delete(mimeStats, rec.MIME)
+	}
+	setStatsMaps(sc, compressionStats, mimeStats)
+	_ = db.Save(sc).Error
+}
+
+func getStatsMaps(sc *StatsCache) (compressionStats, mimeStats map[string]int) {
+	compressionStats = make(map[string]int)
+	mimeStats = make(map[string]int)
+	_ = json.Unmarshal([]byte(sc.CompressionTypes), &compressionStats)
+	_ = json.Unmarshal([]byte(sc.MIMETypes), &mimeStats)
+	return compressionStats, mimeStats
+}
+
+func setStatsMaps(sc *StatsCache, compressionStats, mimeStats map[string]int) {
+	b, _ := json.Marshal(compressionStats)
+	sc.CompressionTypes = string(b)
+	b, _ = json.Marshal(mimeStats)
+	sc.MIMETypes = string(b)
+}
+
+// statsResponse derives ratios and dedup savings from the cached counters
+func statsResponse(sc *StatsCache) gin.H {
+	totalOriginalSize, totalCompressedSize := sc.TotalOriginalSize, sc.TotalCompressedSize
+	physicalObjectsSize := sc.PhysicalObjectsSize
+	var compressionRatio float64
+	if totalOriginalSize > 0 {
+		compressionRatio = float64(totalCompressedSize) / float64(totalOriginalSize)
+	}
+	spaceSaved := totalOriginalSize - totalCompressedSize
+	var spaceSavedPct float64
+	if totalOriginalSize > 0 {
+		spaceSavedPct = float64(spaceSaved) / float64(totalOriginalSize) * 100
+	}
+	var dedupSavedCompressed int64 = totalCompressedSize - physicalObjectsSize
+	if dedupSavedCompressed < 0 {
+		dedupSavedCompressed = 0
+	}
+	var dedupSavedCompressedPct float64
+	if totalCompressedSize > 0 {
+		dedupSavedCompressedPct = float64(dedupSavedCompressed) / float64(totalCompressedSize) * 100
+	}
+	var dedupSavedOriginal int64 = totalOriginalSize - physicalObjectsSize
+	if dedupSavedOriginal < 0 {
+		dedupSavedOriginal = 0
+	}
+	var dedupSavedOriginalPct float64
+	if totalOriginalSize > 0 {
+		dedupSavedOriginalPct = float64(dedupSavedOriginal) / float64(totalOriginalSize) * 100
+	}
+	compressionStats, mimeStats := getStatsMaps(sc)
+	return gin.H{"file_count": sc.FileCount, "unique_hash_count": sc.UniqueHashCount, "total_original_size": totalOriginalSize, "total_compressed_size": totalCompressedSize, "compression_ratio": compressionRatio, "space_saved": spaceSaved, "space_saved_percentage": spaceSavedPct, "compression_types": compressionStats, "mime_types": mimeStats, "unique_compressed_size": sc.UniqueCompressedSize, "physical_objects_count": sc.PhysicalObjectsCount, "physical_objects_size": physicalObjectsSize, "dedup_saved_compressed": dedupSavedCompressed, "dedup_saved_compr_pct": dedupSavedCompressedPct, "dedup_saved_original": dedupSavedOriginal, "dedup_saved_original_pct": dedupSavedOriginalPct, "recomputed_at": sc.RecomputedAt}
+}
@@ -0,0 +1,80 @@
+package fileio
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Limits on client-supplied upload tags
+const (
+	maxTagsPerFile = 32
+	maxTagKeyLen   = 64
+	maxTagValueLen = 256
+)
+
+// parseUploadTags reads the optional tags of an upload: a "tags" form field holding a JSON object
+// of strings and/or repeated "tag" fields of the form key:value. A key given twice keeps its last
+// value. The multipart form must already be parsed.
+func parseUploadTags(c *gin.Context) (map[string]string, error) {
+	tags := map[string]string{}
+	if raw := strings.TrimSpace(c.PostForm("tags")); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &tags); err != nil {
+			return nil, fmt.Errorf("invalid tags (expected a JSON object of strings): %v", err)
+		}
+	}
+	for _, kv := range c.PostFormArray("tag") {
+		k, v, ok := strings.Cut(kv, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid tag %q (expected key:value)", kv)
+		}
+		tags[k] = v
+	}
+	if len(tags) > maxTagsPerFile {
+		return nil, fmt.Errorf("too many tags: %d (max %d)", len(tags), maxTagsPerFile)
+	}
+	for k, v := range tags {
+		if k == "" || len(k) > maxTagKeyLen {
+			return nil, fmt.Errorf("invalid tag key %q (1-%d bytes)", k, maxTagKeyLen)
+		}
+		if len(v) > maxTagValueLen {
+			return nil, fmt.Errorf("tag %q value too long (max %d bytes)", k, maxTagValueLen)
+		}
+	}
+	return tags, nil
+}
+
+// saveTags stores the tags of a new record
+func saveTags(db *gorm.DB, fileID uint, tags map[string]string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	rows := make([]FileTag, 0, len(tags))
+	for k, v := range tags {
+		rows = append(rows, FileTag{FileID: fileID, Key: k, Value: v})
+	}
+	return db.Create(&rows).Error
+}
+
+// loadTags returns a record's tags as a map (empty when it has none)
+func loadTags(db *gorm.DB, fileID uint) map[string]string {
+	var rows []FileTag
+	db.Where("file_id = ?", fileID).Find(&rows)
+	tags := make(map[string]string, len(rows))
+	for _, t := range rows {
+		tags[t.Key] = t.Value
+	}
+	return tags
+}
+
+// tagFilter narrows a FileRecord query to records carrying tag key (with value, when non-empty)
+func tagFilter(db, query *gorm.DB, key, value string) *gorm.DB {
+	sub := db.Model(&FileTag{}).Select("file_id").Where("key = ?", key)
+	if value != "" {
+		sub = sub.Where("value = ?", value)
+	}
+	return query.Where("id IN (?)", sub)
+}
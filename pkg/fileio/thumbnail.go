@@ -0,0 +1,215 @@
+package fileio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	_ "image/png" // registers the PNG decoder
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"go4pack/pkg/common/config"
+	"go4pack/pkg/common/file"
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/logger"
+	"go4pack/pkg/common/worker"
+)
+
+const (
+	// thumbDir is the objects subdirectory holding thumbnails, outside the hashed shards so GC,
+	// eviction and stats never see them
+	thumbDir = "thumb"
+	// thumbMaxSide bounds the longer side of a thumbnail; smaller images keep their size
+	thumbMaxSide = 256
+	thumbQuality = 80
+)
+
+// scheduleThumbnail submits a job rendering a JPEG preview of an image upload, read back from the
+// object stored under key, and recording it in ThumbnailCached. Formats without a registered
+// decoder, and images over Analysis.ThumbnailMaxPixels, are recorded with an error so
+// GET /thumb/:id can explain the missing preview. Non-image uploads are ignored.
+func scheduleThumbnail(recID uint, key, mime string) {
+	if recID == 0 || !config.Get().Analysis.Thumbnails || !strings.HasPrefix(strings.ToLower(mime), "image/") {
+		return
+	}
+	_ = worker.Submit(func() {
+		db, err := ensureDB()
+		if err != nil {
+			return
+		}
+		start := time.Now()
+		row := ThumbnailCached{FileID: recID}
+		thumb, w, h, terr := renderStoredThumbnail(key, config.Get().Analysis.ThumbnailMaxPixels)
+		if terr == nil {
+			row.Hash, row.Width, row.Height = file.MD5Sum(thumb), w, h
+			fsys, err := fs.New()
+			if err == nil {
+				err = fsys.WriteObjectToDir(thumbDir, row.Hash, thumb)
+			}
+			if err != nil {
+				terr = fmt.Errorf("store thumbnail: %w", err)
+			}
+		}
+		if terr != nil {
+			msg := terr.Error()
+			row = ThumbnailCached{FileID: recID, Error: &msg}
+		}
+		_ = db.Where("file_id = ?", recID).
+			Assign(map[string]any{"hash": row.Hash, "width": row.Width, "height": row.Height, "error": row.Error}).
+			FirstOrCreate(&row).Error
+		if terr != nil {
+			logger.GetLogger().Warn().Err(terr).Uint("id", recID).Msg("thumbnail failed")
+			return
+		}
+		logger.GetLogger().Info().Uint("id", recID).Str("hash", row.Hash).Dur("duration", time.Since(start)).Msg("thumbnail generated")
+	})
+}
+
+// renderStoredThumbnail renders the thumbnail of the object stored under key
+func renderStoredThumbnail(key string, maxPixels int64) ([]byte, int, int, error) {
+	fsys, err := fs.New()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	obj, err := fsys.OpenObjectHashed(key)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("open image: %w", err)
+	}
+	defer obj.Close()
+	return renderThumbnail(io.NewSectionReader(obj, 0, obj.Size()), maxPixels)
+}
+
+// renderThumbnail decodes an image and encodes it as a JPEG whose longer side is at most
+// thumbMaxSide. The header is checked against maxPixels (0 = unlimited) before the pixels are
+// decoded, so a small file declaring huge dimensions is rejected cheaply.
+func renderThumbnail(r io.ReadSeeker, maxPixels int64) ([]byte, int, int, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if errors.Is(err, image.ErrFormat) {
+		return nil, 0, 0, errors.New("unsupported image format")
+	}
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid image: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, 0, 0, errors.New("invalid image dimensions")
+	}
+	if maxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, 0, 0, fmt.Errorf("image of %dx%d exceeds thumbnail limit of %d pixels", cfg.Width, cfg.Height, maxPixels)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, 0, err
+	}
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid image: %w", err)
+	}
+	dst := scaleDown(src, thumbMaxSide)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbQuality}); err != nil {
+		return nil, 0, 0, fmt.Errorf("encode thumbnail: %w", err)
+	}
+	b := dst.Bounds()
+	return buf.Bytes(), b.Dx(), b.Dy(), nil
+}
+
+// scaleDown box-filters src so its longer side is at most maxSide, averaging every source pixel
+// that falls into a destination pixel. Transparent areas are composited onto white, as JPEG has
+// no alpha.
+func scaleDown(src image.Image, maxSide int) *image.RGBA {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	dw, dh := sw, sh
+	if sw > maxSide || sh > maxSide {
+		if sw >= sh {
+			dw, dh = maxSide, max(1, sh*maxSide/sw)
+		} else {
+			dw, dh = max(1, sw*maxSide/sh), maxSide
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := sb.Min.Y+dy*sh/dh, sb.Min.Y+(dy+1)*sh/dh
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := sb.Min.X+dx*sw/dw, sb.Min.X+(dx+1)*sw/dw
+			var r, g, b, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					cr, cg, cb, ca := src.At(x, y).RGBA()
+					// premultiplied: add the white background under the uncovered share
+					bg := uint64(0xffff - ca)
+					r, g, b = r+uint64(cr)+bg, g+uint64(cg)+bg, b+uint64(cb)+bg
+					n++
+				}
+			}
+			dst.SetRGBA(dx, dy, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: 0xff})
+		}
+	}
+	return dst
+}
+
+// deleteThumbnail drops a record's thumbnail row, removing the thumbnail object once no other
+// record shares it
+func deleteThumbnail(db *gorm.DB, fileID uint) {
+	var row ThumbnailCached
+	if db.Where("file_id = ?", fileID).First(&row).Error != nil {
+		return
+	}
+	db.Delete(&row)
+	if row.Hash == "" {
+		return
+	}
+	var n int64
+	if db.Model(&ThumbnailCached{}).Where("hash = ?", row.Hash).Count(&n).Error != nil || n > 0 {
+		return
+	}
+	if fsys, err := fs.New(); err == nil {
+		_ = fsys.DeleteObject(path.Join(thumbDir, row.Hash))
+	}
+}
+
+// thumbHandler serves the JPEG preview of an image upload. 404 means no thumbnail was made (not
+// an image, thumbnails disabled, or still being rendered); 422 carries the recorded failure.
+func thumbHandler(c *gin.Context) {
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "db init failed")
+		return
+	}
+	var fr FileRecord
+	if err := db.First(&fr, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, codeFileNotFound, "file not found")
+		return
+	}
+	var row ThumbnailCached
+	if err := db.Where("file_id = ?", fr.ID).First(&row).Error; err != nil {
+		apiError(c, http.StatusNotFound, codeThumbnailNotFound, "no thumbnail for this file")
+		return
+	}
+	if row.Error != nil {
+		apiError(c, http.StatusUnprocessableEntity, codeThumbnailFailed, *row.Error)
+		return
+	}
+	fsys, err := fs.New()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
+		return
+	}
+	data, err := fsys.ReadObjectFromDir(thumbDir, row.Hash)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "read failed")
+		return
+	}
+	c.Header("ETag", `"`+row.Hash+`"`)
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "image/jpeg", data)
+}
@@ -0,0 +1,60 @@
+package fileio
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/fs"
+	"go4pack/pkg/common/logger"
+)
+
+// corruptObject is one stored object failing verification and the uploads that reference it
+type corruptObject struct {
+	Key   string        `json:"key"`
+	Files []corruptFile `json:"files"`
+}
+
+type corruptFile struct {
+	ID       uint   `json:"id"`
+	Filename string `json:"filename"`
+}
+
+// verifyHandler re-hashes every stored object (see fs.VerifyAllHashed) and reports those whose
+// content no longer matches their key, with the records pointing at each. It reads the whole
+// store, so it is meant for operators rather than routine polling.
+func verifyHandler(c *gin.Context) {
+	fsys, err := fs.New()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeFSInitFailed, "filesystem init failed")
+		return
+	}
+	db, err := ensureDB()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeDBInitFailed, "database init failed")
+		return
+	}
+	keys, err := fsys.VerifyAllHashed()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, codeReadFailed, "verify objects failed")
+		return
+	}
+	corrupt := make([]corruptObject, 0, len(keys))
+	for _, key := range keys {
+		var recs []FileRecord
+		// unsalted objects are referenced by md5 with an empty object_key
+		if err := db.Where("object_key = ? OR (object_key = '' AND md5 = ?)", key, key).Order("id").Find(&recs).Error; err != nil {
+			apiError(c, http.StatusInternalServerError, codeQueryFailed, "query files failed")
+			return
+		}
+		obj := corruptObject{Key: key, Files: make([]corruptFile, 0, len(recs))}
+		for _, r := range recs {
+			obj.Files = append(obj.Files, corruptFile{ID: r.ID, Filename: r.Filename})
+		}
+		corrupt = append(corrupt, obj)
+	}
+	if len(corrupt) > 0 {
+		logger.GetLogger().Error().Strs("keys", keys).Msg("object verification found corrupt objects")
+	}
+	c.JSON(http.StatusOK, gin.H{"corrupt": corrupt, "count": len(corrupt)})
+}
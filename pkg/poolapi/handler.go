@@ -13,4 +13,26 @@ func RegisterRoutes(rg *gin.RouterGroup) {
 	rg.GET("/stats", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"pool": worker.StatsSnapshot()})
 	})
+	rg.GET("/history", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"history": worker.History()})
+	})
+	rg.POST("/resize", resizeHandler)
+	rg.POST("/ping-job", pingJobHandler)
+	rg.GET("/ping-job/:token", pingStatusHandler)
+}
+
+// resizeHandler tunes the worker pool capacity: {"size": N} with N > 0
+func resizeHandler(c *gin.Context) {
+	var req struct {
+		Size int `json:"size"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if err := worker.Resize(req.Size); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"capacity": worker.Cap()})
 }
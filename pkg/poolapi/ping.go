@@ -0,0 +1,109 @@
+package poolapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/metrics"
+	"go4pack/pkg/common/worker"
+)
+
+const (
+	// defaultPingSleep and maxPingSleep bound the ?sleep_ms= of a ping job
+	defaultPingSleep = 5 * time.Millisecond
+	maxPingSleep     = time.Second
+	// pingTTL is how long a ping token can be looked up after it was submitted
+	pingTTL = 10 * time.Minute
+)
+
+// pingJob tracks one diagnostic job; finishedAt is zero until it has run
+type pingJob struct {
+	submittedAt time.Time
+	finishedAt  time.Time
+}
+
+var (
+	pingMu        sync.Mutex
+	pingJobs      = map[string]*pingJob{}
+	pingCompleted atomic.Uint64
+)
+
+func init() {
+	metrics.NewCounterFunc("go4pack_pool_ping_jobs_completed_total", "Diagnostic ping jobs finished by the worker pool.", func() float64 { return float64(pingCompleted.Load()) })
+}
+
+// pingJobHandler submits a no-op job that sleeps ?sleep_ms= (default 5, at most 1000) and returns
+// a token to poll, so operators can see the pool actually draining work end to end. A saturated
+// or shutting down pool is reported as 503 instead of running the job inline.
+func pingJobHandler(c *gin.Context) {
+	sleep := defaultPingSleep
+	if v := c.Query("sleep_ms"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 || time.Duration(ms)*time.Millisecond > maxPingSleep {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sleep_ms must be between 0 and 1000"})
+			return
+		}
+		sleep = time.Duration(ms) * time.Millisecond
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token generation failed"})
+		return
+	}
+	token := hex.EncodeToString(b)
+	job := &pingJob{submittedAt: time.Now()}
+
+	pingMu.Lock()
+	for t, j := range pingJobs {
+		if time.Since(j.submittedAt) > pingTTL {
+			delete(pingJobs, t)
+		}
+	}
+	pingJobs[token] = job
+	pingMu.Unlock()
+
+	err := worker.Submit(func() {
+		time.Sleep(sleep)
+		pingCompleted.Add(1)
+		pingMu.Lock()
+		job.finishedAt = time.Now()
+		pingMu.Unlock()
+	})
+	if err != nil {
+		pingMu.Lock()
+		delete(pingJobs, token)
+		pingMu.Unlock()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "submit failed", "detail": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"token": token, "sleep_ms": sleep.Milliseconds()})
+}
+
+// pingStatusHandler reports whether the ping job behind :token has run
+func pingStatusHandler(c *gin.Context) {
+	pingMu.Lock()
+	job, ok := pingJobs[c.Param("token")]
+	var j pingJob
+	if ok {
+		j = *job
+	}
+	pingMu.Unlock()
+	if !ok || time.Since(j.submittedAt) > pingTTL {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown or expired token"})
+		return
+	}
+	resp := gin.H{"token": c.Param("token"), "status": "pending", "submitted_at": j.submittedAt, "completed_total": pingCompleted.Load()}
+	if !j.finishedAt.IsZero() {
+		resp["status"] = "done"
+		resp["finished_at"] = j.finishedAt
+		resp["latency_ms"] = j.finishedAt.Sub(j.submittedAt).Milliseconds()
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,75 @@
+package poolapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go4pack/pkg/common/worker"
+)
+
+func TestPingJob(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutes(r.Group("/pool"))
+	before := worker.StatsSnapshot()["completed"].(uint64)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/pool/ping-job?sleep_ms=2", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("submit code=%d body=%s", w.Code, w.Body.String())
+	}
+	var submitted struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &submitted); err != nil || submitted.Token == "" {
+		t.Fatalf("decode submit: %v body=%s", err, w.Body.String())
+	}
+
+	var status struct {
+		Status         string `json:"status"`
+		CompletedTotal uint64 `json:"completed_total"`
+	}
+	for deadline := time.Now().Add(5 * time.Second); status.Status != "done"; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("ping job never completed, last status %q", status.Status)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pool/ping-job/"+submitted.Token, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status code=%d body=%s", w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatalf("decode status: %v", err)
+		}
+	}
+	if status.CompletedTotal == 0 {
+		t.Error("expected the ping counter to count the job")
+	}
+	// the pool records completion after the job body returns
+	for deadline := time.Now().Add(time.Second); worker.StatsSnapshot()["completed"].(uint64) <= before; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("pool stats never counted the ping job as completed")
+		}
+	}
+
+	for path, want := range map[string]int{
+		"/pool/ping-job/unknown":          http.StatusNotFound,
+		"/pool/ping-job?sleep_ms=5000":    http.StatusBadRequest,
+		"/pool/ping-job?sleep_ms=notanum": http.StatusBadRequest,
+	} {
+		method := http.MethodPost
+		if path == "/pool/ping-job/unknown" {
+			method = http.MethodGet
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		if w.Code != want {
+			t.Errorf("%s %s: code=%d, want %d", method, path, w.Code, want)
+		}
+	}
+}